@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+// Reverse indexes from the hashes behind position and limit order IDs to their locations.
+// Limit order entries are removed when the order is fully claimed or its first mint is
+// rolled back. Burned orders keep their entries, so lookups check the order still exists.
+type entityIdIndex struct {
+	positions RWLockMap[[32]byte, types.PositionLocation]
+	limits    RWLockMap[[32]byte, types.KOClaimLocation]
+}
+
+func newEntityIdIndex() *entityIdIndex {
+	return &entityIdIndex{
+		positions: newRwLockMap[[32]byte, types.PositionLocation](),
+		limits:    newRwLockMap[[32]byte, types.KOClaimLocation](),
+	}
+}
+
+func (m *MemoryCache) indexPosition(loc types.PositionLocation) {
+	m.entityIds.positions.insert(loc.Hash(nil), loc)
+}
+
+// Limit order IDs include the pivot time, so each mint's claim is indexed as it's added.
+// Returns false if the claim was already indexed by an earlier mint.
+func (m *MemoryCache) IndexLimitClaim(loc types.PositionLocation, pivotTime int) bool {
+	claim := loc.ToClaimLoc(pivotTime)
+	hash := claim.Hash(nil)
+	if _, ok := m.entityIds.limits.lookup(hash); ok {
+		return false
+	}
+	m.entityIds.limits.insert(hash, claim)
+	return true
+}
+
+// Returns false if the claim wasn't indexed
+func (m *MemoryCache) UnindexLimitClaim(loc types.PositionLocation, pivotTime int) bool {
+	hash := loc.ToClaimLoc(pivotTime).Hash(nil)
+	if _, ok := m.entityIds.limits.lookup(hash); !ok {
+		return false
+	}
+	m.entityIds.limits.remove(hash)
+	return true
+}
+
+func (m *MemoryCache) RetrievePositionById(hash [32]byte) (types.PositionLocation, *model.PositionTracker, bool) {
+	loc, ok := m.entityIds.positions.lookup(hash)
+	if !ok {
+		return loc, nil, false
+	}
+	pos, ok := m.liqPosition.lookup(loc)
+	return loc, pos, ok
+}
+
+func (m *MemoryCache) RetrieveLimitById(hash [32]byte) (types.KOClaimLocation, *model.KnockoutSubplot, bool) {
+	claim, ok := m.entityIds.limits.lookup(hash)
+	if !ok {
+		return claim, nil, false
+	}
+	subplot, ok := m.liqKnockouts.lookup(claim.PositionLocation)
+	return claim, subplot, ok
+}
@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/tables"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+// Pool events between the checkpoints kept for rebuilding historical curves
+const LIQ_CURVE_CHECKPOINT_EVENTS = 1000
+
+// Curve with every liquidity change and cross up to and including the block
+type liqCurveCheckpoint struct {
+	block int
+	time  int // Latest time of the changes in the checkpoint
+	curve *model.LiquidityCurve
+}
+
+// Historical curve rebuild in progress. Changes to the pool while it runs lower dirtyBlock,
+// and only the checkpoints before it are kept.
+type liqCurveRebuild struct {
+	dirtyBlock int
+}
+
+// Knockout sagas indexed by pool, so their crosses can be replayed, and the checkpoints
+// taken while rebuilding historical curves. Checkpoints are dropped from the block of any
+// change that arrives late or is rolled back.
+type liqCurveHistSet struct {
+	sagas       map[types.PoolLocation]map[types.BookLocation]*model.KnockoutSaga
+	checkpoints map[types.PoolLocation][]liqCurveCheckpoint
+	rebuilds    map[types.PoolLocation]map[*liqCurveRebuild]struct{}
+	lock        sync.Mutex
+}
+
+func newLiqCurveHistSet() *liqCurveHistSet {
+	return &liqCurveHistSet{
+		sagas:       make(map[types.PoolLocation]map[types.BookLocation]*model.KnockoutSaga),
+		checkpoints: make(map[types.PoolLocation][]liqCurveCheckpoint),
+		rebuilds:    make(map[types.PoolLocation]map[*liqCurveRebuild]struct{}),
+	}
+}
+
+func (m *MemoryCache) indexKnockoutSaga(loc types.BookLocation, saga *model.KnockoutSaga) {
+	h := m.liqCurveHist
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	sagas, ok := h.sagas[loc.PoolLocation]
+	if !ok {
+		sagas = make(map[types.BookLocation]*model.KnockoutSaga)
+		h.sagas[loc.PoolLocation] = sagas
+	}
+	sagas[loc] = saga
+}
+
+// Drops the pool's curve checkpoints at or after a block whose liquidity changes or crosses
+// were modified.
+func (m *MemoryCache) TouchPoolLiqCurve(pool types.PoolLocation, block int) {
+	h := m.liqCurveHist
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	cps := h.checkpoints[pool]
+	i := slices.IndexFunc(cps, func(cp liqCurveCheckpoint) bool { return cp.block >= block })
+	if i >= 0 {
+		h.checkpoints[pool] = cps[:i]
+	}
+	for rebuild := range h.rebuilds[pool] {
+		rebuild.dirtyBlock = min(rebuild.dirtyBlock, block)
+	}
+}
+
+func touchesLiqCurve(tx types.PoolTxEvent) bool {
+	return tx.EntityType == tables.EntityTypeLiqChange || tx.EntityType == tables.EntityTypeLimit
+}
+
+// Curve as of histTime, or histBlock if non-zero. Replays the pool's liquidity changes and
+// the crosses from its knockout sagas from the latest checkpoint before then. Crosses are
+// applied after the other changes in their block, the same as pending crosses are ingested.
+func (m *MemoryCache) RetrievePoolLiqCurveAt(pool types.PoolLocation, histTime int, histBlock int) *model.LiquidityCurve {
+	inRange := func(block int, time int) bool {
+		if histBlock > 0 {
+			return block <= histBlock
+		}
+		return time <= histTime
+	}
+
+	h := m.liqCurveHist
+	rebuild := &liqCurveRebuild{dirtyBlock: math.MaxInt}
+	start := liqCurveCheckpoint{block: -1}
+	h.lock.Lock()
+	for _, cp := range h.checkpoints[pool] {
+		if !inRange(cp.block, cp.time) {
+			break
+		}
+		start = cp
+	}
+	sagas := make(map[types.BookLocation]*model.KnockoutSaga, len(h.sagas[pool]))
+	for loc, saga := range h.sagas[pool] {
+		sagas[loc] = saga
+	}
+	if _, ok := h.rebuilds[pool]; !ok {
+		h.rebuilds[pool] = make(map[*liqCurveRebuild]struct{})
+	}
+	h.rebuilds[pool][rebuild] = struct{}{}
+	h.lock.Unlock()
+
+	curve := model.NewLiquidityCurve()
+	if start.curve != nil {
+		curve = start.curve.Copy()
+	}
+	crosses := poolCrossesAfter(sagas, start.block)
+	txs, _ := m.poolTxs.lookupFromTime(pool, start.time, math.MaxInt)
+
+	newCps := make([]liqCurveCheckpoint, 0)
+	block, time, nEvents, nextCross := start.block, start.time, 0, 0
+	applyCrossesBefore := func(endBlock int) {
+		for nextCross < len(crosses) && crosses[nextCross].Block < endBlock &&
+			inRange(crosses[nextCross].Block, crosses[nextCross].Time) {
+			curve.ApplyCross(crosses[nextCross])
+			time = max(time, crosses[nextCross].Time)
+			nEvents++
+			nextCross++
+		}
+	}
+
+	for _, tx := range txs {
+		if tx.BlockNum <= start.block {
+			continue
+		}
+		if !inRange(tx.BlockNum, tx.TxTime) {
+			break
+		}
+		if tx.BlockNum > block {
+			applyCrossesBefore(tx.BlockNum)
+			if nEvents >= LIQ_CURVE_CHECKPOINT_EVENTS {
+				newCps = append(newCps, liqCurveCheckpoint{tx.BlockNum - 1, time, curve.Copy()})
+				nEvents = 0
+			}
+			block = tx.BlockNum
+		}
+		curve.ApplyPoolTx(tx)
+		time = max(time, tx.TxTime)
+		nEvents++
+	}
+	applyCrossesBefore(math.MaxInt)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.rebuilds[pool], rebuild)
+	if len(h.rebuilds[pool]) == 0 {
+		delete(h.rebuilds, pool)
+	}
+	for _, cp := range newCps {
+		if cp.block >= rebuild.dirtyBlock {
+			break
+		}
+		cps := h.checkpoints[pool]
+		i, found := slices.BinarySearchFunc(cps, cp.block, func(c liqCurveCheckpoint, block int) int {
+			return cmp.Compare(c.block, block)
+		})
+		if !found {
+			h.checkpoints[pool] = slices.Insert(cps, i, cp)
+		}
+	}
+	return curve
+}
+
+func poolCrossesAfter(sagas map[types.BookLocation]*model.KnockoutSaga, block int) []model.CurveCross {
+	crosses := make([]model.CurveCross, 0)
+	for loc, saga := range sagas {
+		tick := loc.AskTick
+		if loc.IsBid {
+			tick = loc.BidTick
+		}
+		for _, cross := range saga.Crosses() {
+			if cross.CrossBlock > block {
+				crosses = append(crosses, model.CurveCross{
+					Tick: tick, IsBid: loc.IsBid, Block: cross.CrossBlock, Time: cross.CrossTime})
+			}
+		}
+	}
+	slices.SortFunc(crosses, func(a, b model.CurveCross) int {
+		return cmp.Or(cmp.Compare(a.Block, b.Block), cmp.Compare(a.Time, b.Time), cmp.Compare(a.Tick, b.Tick))
+	})
+	return crosses
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/tables"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestPoolLiqCurveAtReplaysSagaCrosses(t *testing.T) {
+	pool := types.PoolLocation{ChainId: "0x1", Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420}
+	liqChange := func(block int, posType tables.PosType, bidTick int, askTick int, isBid bool) types.PoolTxEvent {
+		return types.PoolTxEvent{
+			EthTxHeader:         types.EthTxHeader{BlockNum: block, TxTime: block * 10, TxHash: "0x01", User: "0xcccc"},
+			PoolLocation:        pool,
+			PoolEventFlow:       types.PoolEventFlow{BaseFlow: 1000, QuoteFlow: 1000},
+			PoolEventDescriptor: types.PoolEventDescriptor{EntityType: tables.EntityTypeLiqChange, ChangeType: tables.ChangeTypeMint, PositionType: posType},
+			PoolRangeFields:     types.PoolRangeFields{BidTick: bidTick, AskTick: askTick, IsBuy: isBid},
+		}
+	}
+
+	m := New()
+	ref := model.NewLiquidityCurve()
+	refAt := make(map[int]*model.LiquidityCurve)
+	addEvent := func(tx types.PoolTxEvent) {
+		m.AddPoolEvent(tx)
+		ref.ApplyPoolTx(tx)
+		refAt[tx.BlockNum] = ref.Copy()
+	}
+
+	// The history has no cross row for the knockout, like on chains synced from the subgraph
+	addEvent(liqChange(10, tables.PosTypeKnockout, 100, 116, true))
+	sagaLoc := types.BookLocation{PoolLocation: pool, LiquidityLocation: types.KnockoutTickLocation(100, true, 16)}
+	m.MaterializeKnockoutSaga(sagaLoc).UpdateCross(tables.KnockoutCross{Block: 20, Time: 200, Tick: 100, IsBid: 1, PivotTime: 100})
+	ref.ApplyCross(model.CurveCross{Tick: 100, IsBid: true, Block: 20, Time: 200})
+	refAt[20] = ref.Copy()
+
+	lastBlock := 30 + 2*LIQ_CURVE_CHECKPOINT_EVENTS
+	for block := 30; block <= lastBlock; block++ {
+		addEvent(liqChange(block, tables.PosTypeConcentrated, -200+block%50, 200, false))
+	}
+
+	if curve := m.RetrievePoolLiqCurveAt(pool, 0, 15); curve.Bumps[100].KnockoutBidLiq == 0 {
+		t.Fatalf("Knockout liquidity missing before the cross %+v", curve.Bumps[100])
+	}
+	if curve := m.RetrievePoolLiqCurveAt(pool, 0, 25); !reflect.DeepEqual(curve, refAt[20]) {
+		t.Fatalf("Knocked out liquidity not removed by the cross %+v", curve.Bumps[100])
+	}
+
+	if curve := m.RetrievePoolLiqCurveAt(pool, lastBlock*10, 0); !reflect.DeepEqual(curve, ref) {
+		t.Fatal("Latest historical curve doesn't match the replayed curve")
+	}
+	if n := len(m.liqCurveHist.checkpoints[pool]); n != 2 {
+		t.Fatalf("Expected 2 checkpoints, got %d", n)
+	}
+
+	// Rebuilds from a checkpoint match a full replay
+	midBlock := lastBlock - 10
+	if curve := m.RetrievePoolLiqCurveAt(pool, 0, midBlock); !reflect.DeepEqual(curve, refAt[midBlock]) {
+		t.Fatal("Curve rebuilt from a checkpoint doesn't match the replayed curve")
+	}
+
+	// A late change drops the checkpoints after it
+	m.AddPoolEvent(liqChange(25, tables.PosTypeAmbient, 0, 0, false))
+	if n := len(m.liqCurveHist.checkpoints[pool]); n != 0 {
+		t.Fatalf("Checkpoints after a late change not dropped, %d left", n)
+	}
+}
@@ -11,6 +11,7 @@ type MemoryCache struct {
 	latestBlocks RWLockMap[types.ChainId, int64]
 
 	userBalTokens RWLockMapArray[chainAndAddr, types.EthAddress]
+	userSurplus   RWLockMap[SurplusKey, *model.SurplusBalance]
 
 	liqPosition   RWLockMap[types.PositionLocation, *model.PositionTracker]
 	userPositions RWLockMapMap[chainAndAddr, types.PositionLocation, *model.PositionTracker]
@@ -25,12 +26,21 @@ type MemoryCache struct {
 
 	userTxs        RWLockMapArray[chainAndAddr, types.PoolTxEvent]
 	poolTxs        RWLockMapArray[types.PoolLocation, types.PoolTxEvent]
+	txEvents       RWLockMapArray[chainAndTx, types.PoolTxEvent]
 	poolPosUpdates RWLockMapArray[types.PoolLocation, PosAndLocPair]
 	poolKoUpdates  RWLockMapArray[types.PoolLocation, KoAndLocPair]
 
 	poolLiqCurve       RWLockMap[types.PoolLocation, *model.LiquidityCurve]
 	poolTradingHistory RWLockMap[types.PoolLocation, *model.PoolTradingHistory]
 	poolHourlyCandles  RWLockMap[types.PoolLocation, *[]model.Candle]
+	poolFeeHistory     RWLockMap[types.PoolLocation, *model.FeeHistory]
+
+	positionAprs RWLockMap[types.PositionLocation, *model.AprHistory]
+
+	entityIds    *entityIdIndex
+	liqCurveHist *liqCurveHistSet
+	syncStatus   *syncStatusSet
+	txSubs       *txSubscribers
 }
 
 func New() *MemoryCache {
@@ -38,6 +48,7 @@ func New() *MemoryCache {
 		latestBlocks: newRwLockMap[types.ChainId, int64](),
 
 		userBalTokens: newRwLockMapArray[chainAndAddr, types.EthAddress](),
+		userSurplus:   newRwLockMap[SurplusKey, *model.SurplusBalance](),
 
 		liqPosition:   newRwLockMap[types.PositionLocation, *model.PositionTracker](),
 		userPositions: newRwLockMapMap[chainAndAddr, types.PositionLocation, *model.PositionTracker](),
@@ -52,12 +63,21 @@ func New() *MemoryCache {
 
 		userTxs:        newRwLockMapArray[chainAndAddr, types.PoolTxEvent](),
 		poolTxs:        newRwLockMapArray[types.PoolLocation, types.PoolTxEvent](),
+		txEvents:       newRwLockMapArray[chainAndTx, types.PoolTxEvent](),
 		poolPosUpdates: newRwLockMapArray[types.PoolLocation, PosAndLocPair](),
 		poolKoUpdates:  newRwLockMapArray[types.PoolLocation, KoAndLocPair](),
 
 		poolLiqCurve:       newRwLockMap[types.PoolLocation, *model.LiquidityCurve](),
 		poolTradingHistory: newRwLockMap[types.PoolLocation, *model.PoolTradingHistory](),
 		poolHourlyCandles:  newRwLockMap[types.PoolLocation, *[]model.Candle](),
+		poolFeeHistory:     newRwLockMap[types.PoolLocation, *model.FeeHistory](),
+
+		positionAprs: newRwLockMap[types.PositionLocation, *model.AprHistory](),
+
+		entityIds:    newEntityIdIndex(),
+		liqCurveHist: newLiqCurveHistSet(),
+		syncStatus:   newSyncStatusSet(),
+		txSubs:       newTxSubscribers(),
 	}
 }
 
@@ -66,6 +86,17 @@ type chainAndAddr struct {
 	types.EthAddress
 }
 
+type chainAndTx struct {
+	types.ChainId
+	types.EthTxHash
+}
+
+type SurplusKey struct {
+	ChainId types.ChainId
+	User    types.EthAddress
+	Token   types.EthAddress
+}
+
 type chainUserAndPool struct {
 	user types.EthAddress
 	types.PoolLocation
@@ -84,6 +115,10 @@ func (p PosAndLocPair) Hash(buf *bytes.Buffer) [32]byte {
 	return p.Loc.Hash(buf)
 }
 
+func (p PosAndLocPair) Cursor(buf *bytes.Buffer) ArrayCursor {
+	return ArrayCursor{Time: p.Time(), Hash: p.Hash(buf)}
+}
+
 type KoAndLocPair struct {
 	Loc types.PositionLocation
 	Ko  *model.KnockoutSubplot
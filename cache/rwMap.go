@@ -2,6 +2,7 @@ package cache
 
 import (
 	"bytes"
+	"cmp"
 	"slices"
 	"sync"
 )
@@ -130,6 +131,131 @@ func (m *RWLockMapArray[Key, Val]) lookupLastNAtTime(key Key, afterTime int, bef
 	return
 }
 
+// Returns all elements at or after startTime in ascending time order, up to n. It
+// assumes the array is sorted by time. Used to replay events for resumed streams.
+func (m *RWLockMapArray[Key, Val]) lookupFromTime(key Key, startTime int, n int) (result []Val, ok bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	rows, ok := m.entries[key]
+	if ok {
+		i := len(rows)
+		for i > 0 && rows[i-1].Time() >= startTime {
+			i--
+		}
+		end := len(rows)
+		if end-i > n {
+			end = i + n
+		}
+		result = append(result, rows[i:end]...)
+	}
+	return
+}
+
+// Like lookupFromTime, but skips elements that fail the filter before taking up to n. Also
+// returns whether later elements that pass the filter were left out.
+func (m *RWLockMapArray[Key, Val]) lookupFromTimeFiltered(key Key, startTime int, n int, keep func(Val) bool) (result []Val, truncated bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	rows := m.entries[key]
+	i := len(rows)
+	for i > 0 && rows[i-1].Time() >= startTime {
+		i--
+	}
+	for _, row := range rows[i:] {
+		if !keep(row) {
+			continue
+		}
+		if len(result) == n {
+			return result, true
+		}
+		result = append(result, row)
+	}
+	return result, false
+}
+
+// Position of an element in a time ordered array. Elements are ordered by time, then
+// call index, then hash, so a cursor identifies exactly one element even when many
+// share the same timestamp.
+type ArrayCursor struct {
+	Time      int
+	CallIndex int
+	Hash      [32]byte
+}
+
+func (c ArrayCursor) compare(o ArrayCursor) int {
+	if c.Time != o.Time {
+		return cmp.Compare(c.Time, o.Time)
+	}
+	if c.CallIndex != o.CallIndex {
+		return cmp.Compare(c.CallIndex, o.CallIndex)
+	}
+	return bytes.Compare(c.Hash[:], o.Hash[:])
+}
+
+// Returns up to n elements strictly before the cursor, newest first. A nil cursor starts
+// from the newest element. The returned cursor points at the last element and is nil if
+// there's nothing left, which is checked by looking one element past the page. Because the array is only sorted by time, all elements sharing a
+// timestamp with the page boundary are collected and ordered before truncating.
+// `nonUnique` should be set for poolPosUpdates/poolKoUpdates, where only the most recent
+// entry for each hash is considered.
+func (m *RWLockMapArray[Key, Val]) lookupLastNBeforeCursor(key Key, cursor *ArrayCursor, n int,
+	cursorOf func(Val, *bytes.Buffer) ArrayCursor, nonUnique bool) (result []Val, next *ArrayCursor) {
+	type cursorAndVal struct {
+		pos ArrayCursor
+		val Val
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	rows := m.entries[key]
+
+	cands := make([]cursorAndVal, 0, n)
+	var seen map[[32]byte]struct{}
+	if nonUnique {
+		seen = make(map[[32]byte]struct{}, n*2)
+	}
+	buf := new(bytes.Buffer)
+	buf.Grow(300)
+
+	for i := len(rows) - 1; i >= 0; i-- {
+		t := rows[i].Time()
+		if len(cands) > n && t < cands[len(cands)-1].pos.Time {
+			break
+		}
+		if !nonUnique && cursor != nil && t > cursor.Time {
+			continue
+		}
+
+		pos := cursorOf(rows[i], buf)
+		if nonUnique {
+			if _, ok := seen[pos.Hash]; ok {
+				continue
+			}
+			seen[pos.Hash] = struct{}{}
+		}
+		if cursor != nil && pos.compare(*cursor) >= 0 {
+			continue
+		}
+		cands = append(cands, cursorAndVal{pos, rows[i]})
+	}
+
+	slices.SortFunc(cands, func(a, b cursorAndVal) int {
+		return b.pos.compare(a.pos)
+	})
+	if len(cands) > n {
+		cands = cands[:n]
+		if n > 0 {
+			next = &cands[n-1].pos
+		}
+	}
+
+	result = make([]Val, 0, len(cands))
+	for _, c := range cands {
+		result = append(result, c.val)
+	}
+	return
+}
+
 // Version of lookupLastNAtTime that's used for poolPosUpdates and poolKoUpdates because
 // they have entries for updates so the same position/order will be stored multiple times.
 // `seen` is passed in to not reallocate it every time for subsequent calls.
@@ -210,6 +336,12 @@ func (m *RWLockMapArray[Key, Val]) insert(key Key, val Val) {
 	m.entries[key] = append(m.entries[key], val)
 }
 
+func (m *RWLockMapArray[Key, Val]) insertAll(key Key, vals []Val) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.entries[key] = append(m.entries[key], vals...)
+}
+
 func (m *RWLockMapArray[Key, Val]) insertSorted(key Key, val Val, less func(i, j Val) bool) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -239,6 +371,34 @@ func (m *RWLockMapMap[Key, KeyInner, Val]) insert(key Key, keyIn KeyInner, val V
 	m.entries[key][keyIn] = val
 }
 
+func (m *RWLockMap[Key, Val]) remove(key Key) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.entries, key)
+	delete(m.entryLocks, key)
+}
+
+// Removes the most recent element that matches. Used to undo an insert when rows are
+// rolled back, so it searches from the end of the array.
+func (m *RWLockMapArray[Key, Val]) removeLast(key Key, matches func(Val) bool) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	rows := m.entries[key]
+	for i := len(rows) - 1; i >= 0; i-- {
+		if matches(rows[i]) {
+			m.entries[key] = slices.Delete(rows, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+func (m *RWLockMapMap[Key, KeyInner, Val]) remove(key Key, keyIn KeyInner) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.entries[key], keyIn)
+}
+
 func newRwLockMap[Key comparable, Val any]() RWLockMap[Key, Val] {
 	return RWLockMap[Key, Val]{
 		entries:    make(map[Key]Val),
@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"slices"
+
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+// Derived cache state for a single chain. Only the primary data is stored. The user and
+// pool indices, position update arrays and user txs are rebuilt from it on restore. Candles
+// are rebuilt lazily from the trading history like after any other restart.
+type ChainSnapshot struct {
+	ChainId      types.ChainId
+	UserBalances map[types.EthAddress][]types.EthAddress
+	Positions    map[types.PositionLocation]*model.PositionTracker
+	KnockoutLocs []types.PositionLocation
+	Sagas        map[types.BookLocation]model.KnockoutSagaSnapshot
+	PivotTimes   map[types.BookLocation]int
+	Curves       map[types.PoolLocation]*model.LiquidityCurve
+	TradingHists map[types.PoolLocation]*model.PoolTradingHistory
+	PoolTxs      map[types.PoolLocation][]types.PoolTxEvent
+	PositionAprs map[types.PositionLocation][]model.AprSnap
+	FeeHists     map[types.PoolLocation][]model.FeeRateChange
+}
+
+// Captures a deep copy of the chain's state, taking each object's lock while it's copied.
+// Should only be called while ingestion on the chain is idle, otherwise the snapshot may
+// hold a partially applied row. Position trackers have no lock of their own, so the caller
+// must also make sure no position updates are being applied.
+func (m *MemoryCache) SnapshotChain(chainId types.ChainId) *ChainSnapshot {
+	snap := &ChainSnapshot{
+		ChainId:      chainId,
+		UserBalances: make(map[types.EthAddress][]types.EthAddress),
+		Positions:    make(map[types.PositionLocation]*model.PositionTracker),
+		KnockoutLocs: make([]types.PositionLocation, 0),
+		Sagas:        make(map[types.BookLocation]model.KnockoutSagaSnapshot),
+		PivotTimes:   make(map[types.BookLocation]int),
+		Curves:       make(map[types.PoolLocation]*model.LiquidityCurve),
+		TradingHists: make(map[types.PoolLocation]*model.PoolTradingHistory),
+		PoolTxs:      make(map[types.PoolLocation][]types.PoolTxEvent),
+		PositionAprs: make(map[types.PositionLocation][]model.AprSnap),
+		FeeHists:     make(map[types.PoolLocation][]model.FeeRateChange),
+	}
+
+	m.userBalTokens.lock.RLock()
+	for key, tokens := range m.userBalTokens.entries {
+		if key.ChainId == chainId {
+			snap.UserBalances[key.EthAddress] = slices.Clone(tokens)
+		}
+	}
+	m.userBalTokens.lock.RUnlock()
+
+	for loc, pos := range m.liqPosition.clone() {
+		if loc.ChainId == chainId {
+			snap.Positions[loc] = pos.CopyHistory()
+		}
+	}
+	for loc := range m.liqKnockouts.clone() {
+		if loc.ChainId == chainId {
+			snap.KnockoutLocs = append(snap.KnockoutLocs, loc)
+		}
+	}
+	for loc, saga := range m.knockoutSagas.clone() {
+		if loc.ChainId == chainId {
+			snap.Sagas[loc] = saga.Snapshot()
+		}
+	}
+	for loc, pivotTime := range m.knockoutPivotTimes.clone() {
+		if loc.ChainId == chainId {
+			snap.PivotTimes[loc] = pivotTime
+		}
+	}
+	for _, loc := range m.poolLiqCurve.keySet() {
+		if loc.ChainId != chainId {
+			continue
+		}
+		if curve, ok, lock := m.poolLiqCurve.lockLookup(loc, false); ok {
+			snap.Curves[loc] = curve.Copy()
+			lock.RUnlock()
+		}
+	}
+	for _, loc := range m.poolTradingHistory.keySet() {
+		if loc.ChainId != chainId {
+			continue
+		}
+		if hist, ok, lock := m.poolTradingHistory.lockLookup(loc, false); ok {
+			snap.TradingHists[loc] = hist.Copy()
+			lock.RUnlock()
+		}
+	}
+
+	m.poolTxs.lock.RLock()
+	for loc, txs := range m.poolTxs.entries {
+		if loc.ChainId == chainId {
+			snap.PoolTxs[loc] = slices.Clone(txs)
+		}
+	}
+	m.poolTxs.lock.RUnlock()
+
+	for loc, hist := range m.positionAprs.clone() {
+		if loc.ChainId == chainId {
+			snap.PositionAprs[loc] = hist.Series()
+		}
+	}
+	for loc, hist := range m.poolFeeHistory.clone() {
+		if loc.ChainId == chainId {
+			snap.FeeHists[loc] = hist.Series()
+		}
+	}
+	return snap
+}
+
+// Loads a chain's snapshot into an empty cache, before any rows are ingested on the chain
+func (m *MemoryCache) RestoreChain(snap *ChainSnapshot) {
+	chainId := snap.ChainId
+	for user, tokens := range snap.UserBalances {
+		m.userBalTokens.insertAll(chainAndAddr{chainId, user}, tokens)
+		// Surplus amounts aren't stored, they're refreshed after the startup sync
+		for _, token := range tokens {
+			m.MaterializeUserSurplus(chainId, user, token)
+		}
+	}
+
+	posUpdates := make(map[types.PoolLocation][]PosAndLocPair)
+	for loc, pos := range snap.Positions {
+		m.liqPosition.insert(loc, pos)
+		m.userPositions.insert(chainAndAddr{loc.ChainId, loc.User}, loc, pos)
+		m.poolPositions.insert(loc.PoolLocation, loc, pos)
+		m.indexPosition(loc)
+		posUpdates[loc.PoolLocation] = append(posUpdates[loc.PoolLocation], PosAndLocPair{loc, pos})
+	}
+	for pool, updates := range posUpdates {
+		slices.SortStableFunc(updates, func(a, b PosAndLocPair) int { return a.Time() - b.Time() })
+		m.poolPosUpdates.insertAll(pool, updates)
+	}
+
+	for loc, saga := range snap.Sagas {
+		restored := model.RestoreKnockoutSaga(saga)
+		m.knockoutSagas.insert(loc, restored)
+		m.indexKnockoutSaga(loc, restored)
+	}
+	koUpdates := make(map[types.PoolLocation][]KoAndLocPair)
+	for _, loc := range snap.KnockoutLocs {
+		saga := m.MaterializeKnockoutSaga(loc.ToBookLoc())
+		subplot := saga.ForUser(loc.User)
+		m.liqKnockouts.insert(loc, subplot)
+		m.userKnockouts.insert(chainAndAddr{loc.ChainId, loc.User}, loc, subplot)
+		m.poolKnockouts.insert(loc.PoolLocation, loc, subplot)
+		for _, mint := range subplot.Mints {
+			if !subplot.Liq.IsClaimed(mint.PivotTime) {
+				m.IndexLimitClaim(loc, mint.PivotTime)
+			}
+		}
+		koUpdates[loc.PoolLocation] = append(koUpdates[loc.PoolLocation], KoAndLocPair{loc, subplot})
+	}
+	for pool, updates := range koUpdates {
+		slices.SortStableFunc(updates, func(a, b KoAndLocPair) int { return a.Time() - b.Time() })
+		m.poolKoUpdates.insertAll(pool, updates)
+	}
+
+	for loc, pivotTime := range snap.PivotTimes {
+		m.knockoutPivotTimes.insert(loc, pivotTime)
+	}
+	for loc, curve := range snap.Curves {
+		m.poolLiqCurve.insert(loc, curve)
+	}
+	for loc, hist := range snap.TradingHists {
+		m.poolTradingHistory.insert(loc, hist)
+	}
+
+	allTxs := make([]types.PoolTxEvent, 0)
+	for loc, txs := range snap.PoolTxs {
+		m.poolTxs.insertAll(loc, txs)
+		allTxs = append(allTxs, txs...)
+	}
+	slices.SortStableFunc(allTxs, func(a, b types.PoolTxEvent) int {
+		if userTxLess(b, a) {
+			return -1
+		} else if userTxLess(a, b) {
+			return 1
+		}
+		return 0
+	})
+	userTxs := make(map[chainAndAddr][]types.PoolTxEvent)
+	for _, tx := range allTxs {
+		key := chainAndAddr{tx.ChainId, tx.User}
+		userTxs[key] = append(userTxs[key], tx)
+	}
+	for key, txs := range userTxs {
+		m.userTxs.insertAll(key, txs)
+	}
+	for _, tx := range allTxs {
+		m.txEvents.insertSorted(chainAndTx{tx.ChainId, tx.TxHash}, tx, txCallLess)
+	}
+
+	for loc, snaps := range snap.PositionAprs {
+		m.positionAprs.insert(loc, &model.AprHistory{Snaps: snaps})
+	}
+	for loc, changes := range snap.FeeHists {
+		m.poolFeeHistory.insert(loc, &model.FeeHistory{Changes: changes})
+	}
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math/big"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/tables"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	pool := types.PoolLocation{ChainId: "0x1", Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420}
+	user := types.EthAddress("0xcccc")
+	liqFlow := 1000.0
+
+	src := New()
+	src.AddUserBalance(pool.ChainId, user, pool.Quote)
+
+	posLoc := types.PositionLocation{PoolLocation: pool, LiquidityLocation: types.RangeLiquidityLocation(-100, 100), User: user}
+	pos := src.MaterializePosition(posLoc)
+	pos.UpdatePosition(tables.LiqChange{Time: 500, ChangeType: tables.ChangeTypeMint, PositionType: tables.PosTypeConcentrated,
+		BaseFlow: &liqFlow, QuoteFlow: &liqFlow, TX: "0x01"})
+	pos.UpdatePosition(tables.LiqChange{Time: 600, ChangeType: tables.ChangeTypeHarvest, PositionType: tables.PosTypeConcentrated})
+	pos.ConcLiq.SetInt64(12345)
+
+	koLoc := types.PositionLocation{PoolLocation: pool, LiquidityLocation: types.KnockoutTickLocation(-64, true, 16), User: user}
+	ko := src.MaterializeKnockoutPos(koLoc)
+	ko.AppendMint(model.KnockoutSagaTx{TxTime: 700, TxHash: "0x02", PivotTime: 700})
+	ko.Liq.UpdatePostKOLiq(700, *big.NewInt(999), 800)
+	src.MaterializeKnockoutSaga(koLoc.ToBookLoc()).UpdateCross(tables.KnockoutCross{Time: 750, PivotTime: 700, FeeMileage: 5})
+	// Another user's order at the same pivot that's been claimed
+	claimedLoc := koLoc
+	claimedLoc.User = "0x000000000000000000000000000000000000000d"
+	claimed := src.MaterializeKnockoutPos(claimedLoc)
+	claimed.AppendMint(model.KnockoutSagaTx{TxTime: 710, TxHash: "0x05", PivotTime: 700})
+	claimed.Liq.UpdatePostKOLiq(700, *big.NewInt(0), 800)
+
+	curve, lock := src.MaterializePoolLiqCurve(pool, true)
+	curve.UpdateLiqChange(tables.LiqChange{Time: 500, BidTick: -100, AskTick: 100, ChangeType: tables.ChangeTypeMint,
+		PositionType: tables.PosTypeConcentrated, BaseFlow: &liqFlow, QuoteFlow: &liqFlow})
+	lock.Unlock()
+
+	for i := 0; i < 3; i++ {
+		src.AddPoolEvent(types.PoolTxEvent{
+			EthTxHeader:  types.EthTxHeader{TxTime: 500 + i, TxHash: "0x03", User: user, CallIndex: i},
+			PoolLocation: pool,
+		})
+	}
+
+	chainSnap := src.SnapshotChain(pool.ChainId)
+	// The snapshot is a copy, so later updates to the source don't leak into it
+	curve, lock = src.MaterializePoolLiqCurve(pool, true)
+	curve.UpdateLiqChange(tables.LiqChange{Time: 900, BidTick: -200, AskTick: 200, ChangeType: tables.ChangeTypeMint,
+		PositionType: tables.PosTypeConcentrated, BaseFlow: &liqFlow, QuoteFlow: &liqFlow})
+	lock.Unlock()
+	ko.AppendMint(model.KnockoutSagaTx{TxTime: 900, TxHash: "0x04", PivotTime: 900})
+	pos.UpdatePosition(tables.LiqChange{Time: 900, ChangeType: tables.ChangeTypeHarvest, PositionType: tables.PosTypeConcentrated})
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(chainSnap); err != nil {
+		t.Fatal(err)
+	}
+	var snap ChainSnapshot
+	if err := gob.NewDecoder(&buf).Decode(&snap); err != nil {
+		t.Fatal(err)
+	}
+	dst := New()
+	dst.RestoreChain(&snap)
+
+	if tokens := dst.RetrieveUserBalances(pool.ChainId, user); len(tokens) != 1 || tokens[0] != pool.Quote {
+		t.Fatalf("Bad restored balances %v", tokens)
+	}
+
+	// Position liquidity isn't stored, it's refreshed after the restore
+	restored := dst.RetrieveUserPositions(pool.ChainId, user)[posLoc]
+	if restored == nil || restored.ConcLiq.Sign() != 0 || restored.RefreshTime != 0 || restored.LatestUpdateTime != 600 ||
+		len(restored.LiqHist.Hist) != 2 || !restored.LiqHist.Hist[1].ResetRewards {
+		t.Fatalf("Bad restored position %+v", restored)
+	}
+	if len(dst.RetrieveLastNPoolPos(pool, 10)) != 1 {
+		t.Fatal("Position update index not rebuilt")
+	}
+
+	limit := dst.RetrieveUserLimits(pool.ChainId, user)[koLoc]
+	if limit == nil || len(limit.Mints) != 1 || limit.Liq.KnockedOut[700].ConcLiq.Int64() != 999 {
+		t.Fatalf("Bad restored knockout %+v", limit)
+	}
+	if _, byId, ok := dst.RetrievePositionById(posLoc.Hash(nil)); !ok || byId != restored {
+		t.Fatal("Position ID index not rebuilt")
+	}
+	if claim, byId, ok := dst.RetrieveLimitById(koLoc.ToClaimLoc(700).Hash(nil)); !ok || byId != limit || claim.PivotTime != 700 {
+		t.Fatal("Limit order ID index not rebuilt")
+	}
+	if _, _, ok := dst.RetrieveLimitById(claimedLoc.ToClaimLoc(700).Hash(nil)); ok {
+		t.Fatal("Claimed limit order indexed on restore")
+	}
+	cross, ok := limit.GetCrossForPivotTime(700)
+	if !ok || cross.CrossTime != 750 || cross.FeeMileage != 5 {
+		t.Fatalf("Knockout not linked to restored saga %+v", cross)
+	}
+	if dst.MaterializeKnockoutSaga(koLoc.ToBookLoc()).ForUser(user) != limit {
+		t.Fatal("Restored saga doesn't share the user's subplot")
+	}
+
+	_, bumps := dst.RetrievePoolLiqCurve(pool)
+	if len(bumps) != 2 {
+		t.Fatalf("Bad restored curve %+v", bumps)
+	}
+
+	poolTxs := dst.RetrievePoolTxs(pool)
+	userTxs := dst.RetrieveLastNUserTxs(pool.ChainId, user, 10)
+	if len(poolTxs) != 3 || len(userTxs) != 3 || userTxs[0].TxTime != 502 {
+		t.Fatalf("Bad restored txs %+v %+v", poolTxs, userTxs)
+	}
+	txEvents := dst.RetrieveTxEvents(pool.ChainId, "0x03")
+	if len(txEvents) != 3 || txEvents[0].CallIndex != 0 || txEvents[2].CallIndex != 2 {
+		t.Fatalf("Bad restored tx index %+v", txEvents)
+	}
+}
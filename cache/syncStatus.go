@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+type TableSyncStatus struct {
+	Block     int   `json:"block"`
+	Time      int   `json:"time"`      // Time of the latest row ingested
+	UpdatedAt int64 `json:"updatedAt"` // When the table last advanced
+}
+
+type ChainSyncStatus struct {
+	ChainId     types.ChainId              `json:"chainId"`
+	StartupDone bool                       `json:"startupDone"`
+	HeadBlock   int                        `json:"headBlock"`
+	HeadAt      int64                      `json:"headAt"` // When the head block last advanced
+	SyncedBlock int                        `json:"syncedBlock"`
+	SyncedAt    int64                      `json:"syncedAt"`
+	SyncError   string                     `json:"syncError,omitempty"`   // Latest failure if the sync is stalled
+	SyncErrorAt int64                      `json:"syncErrorAt,omitempty"` // When the sync started failing
+	Tables      map[string]TableSyncStatus `json:"tables"`
+}
+
+type RefreshBacklog struct {
+	Urgent  int `json:"urgent"`
+	Slow    int `json:"slow"`
+	Pending int `json:"pending"`
+}
+
+type syncStatusSet struct {
+	chains  map[types.ChainId]*ChainSyncStatus
+	backlog RefreshBacklog
+	lock    sync.RWMutex
+}
+
+func newSyncStatusSet() *syncStatusSet {
+	return &syncStatusSet{chains: make(map[types.ChainId]*ChainSyncStatus)}
+}
+
+// Must be called with the write lock held
+func (s *syncStatusSet) materialize(chainId types.ChainId) *ChainSyncStatus {
+	status, ok := s.chains[chainId]
+	if !ok {
+		status = &ChainSyncStatus{ChainId: chainId, Tables: make(map[string]TableSyncStatus)}
+		s.chains[chainId] = status
+	}
+	return status
+}
+
+func (m *MemoryCache) SetStartupSynced(chainId types.ChainId) {
+	m.syncStatus.lock.Lock()
+	defer m.syncStatus.lock.Unlock()
+	m.syncStatus.materialize(chainId).StartupDone = true
+}
+
+// Lists the chain before its startup sync begins, so it's reported as syncing while the
+// chains ahead of it sync
+func (m *MemoryCache) AddSyncingChain(chainId types.ChainId) {
+	m.syncStatus.lock.Lock()
+	defer m.syncStatus.lock.Unlock()
+	m.syncStatus.materialize(chainId)
+}
+
+// True for chains that are listed but haven't finished their startup sync
+func (m *MemoryCache) IsChainSyncing(chainId types.ChainId) bool {
+	m.syncStatus.lock.RLock()
+	defer m.syncStatus.lock.RUnlock()
+	status, ok := m.syncStatus.chains[chainId]
+	return ok && !status.StartupDone
+}
+
+// Latest block reported by the chain's data source, i.e. the subgraph or the RPC node
+func (m *MemoryCache) SetHeadBlock(chainId types.ChainId, block int) {
+	m.syncStatus.lock.Lock()
+	defer m.syncStatus.lock.Unlock()
+	status := m.syncStatus.materialize(chainId)
+	if block != status.HeadBlock {
+		status.HeadBlock = block
+		status.HeadAt = time.Now().Unix()
+	}
+}
+
+// Block that every table on the chain has been ingested through
+func (m *MemoryCache) SetSyncedBlock(chainId types.ChainId, block int) {
+	m.latestBlocks.insert(chainId, int64(block))
+	m.syncStatus.lock.Lock()
+	defer m.syncStatus.lock.Unlock()
+	status := m.syncStatus.materialize(chainId)
+	if block != status.SyncedBlock {
+		status.SyncedBlock = block
+		status.SyncedAt = time.Now().Unix()
+	}
+}
+
+// Set while the chain's sync is failing to fetch new rows, and cleared with "" once it recovers
+func (m *MemoryCache) SetSyncError(chainId types.ChainId, err string) {
+	m.syncStatus.lock.Lock()
+	defer m.syncStatus.lock.Unlock()
+	status := m.syncStatus.materialize(chainId)
+	if err == "" {
+		status.SyncErrorAt = 0
+	} else if status.SyncError == "" {
+		status.SyncErrorAt = time.Now().Unix()
+	}
+	status.SyncError = err
+}
+
+func (m *MemoryCache) SetTableSynced(chainId types.ChainId, table string, block int, rowTime int) {
+	m.syncStatus.lock.Lock()
+	defer m.syncStatus.lock.Unlock()
+	status := m.syncStatus.materialize(chainId)
+	prev := status.Tables[table]
+	if block != prev.Block {
+		status.Tables[table] = TableSyncStatus{Block: block, Time: rowTime, UpdatedAt: time.Now().Unix()}
+	}
+}
+
+func (m *MemoryCache) SetRefreshBacklog(backlog RefreshBacklog) {
+	m.syncStatus.lock.Lock()
+	defer m.syncStatus.lock.Unlock()
+	m.syncStatus.backlog = backlog
+}
+
+func (m *MemoryCache) RetrieveRefreshBacklog() RefreshBacklog {
+	m.syncStatus.lock.RLock()
+	defer m.syncStatus.lock.RUnlock()
+	return m.syncStatus.backlog
+}
+
+// Sync status of every chain, in chain ID order
+func (m *MemoryCache) RetrieveSyncStatus() []ChainSyncStatus {
+	m.syncStatus.lock.RLock()
+	defer m.syncStatus.lock.RUnlock()
+	result := make([]ChainSyncStatus, 0, len(m.syncStatus.chains))
+	for _, status := range m.syncStatus.chains {
+		copied := *status
+		copied.Tables = maps.Clone(status.Tables)
+		result = append(result, copied)
+	}
+	slices.SortFunc(result, func(a, b ChainSyncStatus) int {
+		return types.CompareChainIds(a.ChainId, b.ChainId)
+	})
+	return result
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"bytes"
 	"log"
 	"slices"
 	"sync"
@@ -25,6 +26,12 @@ func (m *MemoryCache) RetrieveUserBalances(chainId types.ChainId, user types.Eth
 	return tokens
 }
 
+// Every event in the transaction, in call order
+func (m *MemoryCache) RetrieveTxEvents(chainId types.ChainId, txHash types.EthTxHash) []types.PoolTxEvent {
+	txs, _ := m.txEvents.lookupCopy(chainAndTx{chainId, txHash})
+	return txs
+}
+
 func (m *MemoryCache) RetrieveLastNUserTxs(chainId types.ChainId, user types.EthAddress, nResults int) []types.PoolTxEvent {
 	key := chainAndAddr{chainId, user}
 	txs, _ := m.userTxs.lookupLastN(key, nResults)
@@ -37,6 +44,18 @@ func (m *MemoryCache) RetrieveUserTxsAtTime(chainId types.ChainId, user types.Et
 	return txs
 }
 
+// Returns user events at or after (startTime, startCallIndex) in ascending order, up to n.
+// Also returns whether the limit was hit, in which case later events were left out.
+func (m *MemoryCache) RetrieveUserTxsFrom(chainId types.ChainId, user types.EthAddress, startTime int, startCallIndex int, n int) ([]types.PoolTxEvent, bool) {
+	key := chainAndAddr{chainId, user}
+	return m.userTxs.lookupFromTimeFiltered(key, startTime, n, txFromCallIndex(startTime, startCallIndex))
+}
+
+func (m *MemoryCache) RetrieveUserTxsBeforeCursor(chainId types.ChainId, user types.EthAddress, cursor *ArrayCursor, n int) ([]types.PoolTxEvent, *ArrayCursor) {
+	key := chainAndAddr{chainId, user}
+	return m.userTxs.lookupLastNBeforeCursor(key, cursor, n, txCursor, false)
+}
+
 func (m *MemoryCache) RetrievePoolSet() []types.PoolLocation {
 	return m.poolTradingHistory.keySet()
 }
@@ -56,6 +75,27 @@ func (m *MemoryCache) RetrievePoolTxsAtTime(pool types.PoolLocation, afterTime i
 	return txs
 }
 
+// Returns pool events at or after (startTime, startCallIndex) in ascending order, up to n.
+// Also returns whether the limit was hit, in which case later events were left out.
+func (m *MemoryCache) RetrievePoolTxsFrom(pool types.PoolLocation, startTime int, startCallIndex int, n int) ([]types.PoolTxEvent, bool) {
+	return m.poolTxs.lookupFromTimeFiltered(pool, startTime, n, txFromCallIndex(startTime, startCallIndex))
+}
+
+func (m *MemoryCache) RetrievePoolTxsBeforeCursor(pool types.PoolLocation, cursor *ArrayCursor, n int) ([]types.PoolTxEvent, *ArrayCursor) {
+	return m.poolTxs.lookupLastNBeforeCursor(pool, cursor, n, txCursor, false)
+}
+
+func txCursor(tx types.PoolTxEvent, buf *bytes.Buffer) ArrayCursor {
+	return ArrayCursor{Time: tx.TxTime, CallIndex: tx.CallIndex, Hash: tx.Hash(buf)}
+}
+
+// Skips the events in the start block before the start call
+func txFromCallIndex(startTime int, startCallIndex int) func(types.PoolTxEvent) bool {
+	return func(tx types.PoolTxEvent) bool {
+		return tx.TxTime > startTime || tx.CallIndex >= startCallIndex
+	}
+}
+
 func (m *MemoryCache) RetrieveLastNPoolPos(pool types.PoolLocation, lastN int) []PosAndLocPair {
 	txs, _ := m.poolPosUpdates.lookupLastN(pool, lastN)
 	return txs
@@ -66,6 +106,10 @@ func (m *MemoryCache) RetrievePoolPosAtTime(pool types.PoolLocation, afterTime i
 	return txs
 }
 
+func (m *MemoryCache) RetrievePoolPosBeforeCursor(pool types.PoolLocation, cursor *ArrayCursor, n int) ([]PosAndLocPair, *ArrayCursor) {
+	return m.poolPosUpdates.lookupLastNBeforeCursor(pool, cursor, n, PosAndLocPair.Cursor, true)
+}
+
 func (m *MemoryCache) RetrieveLastNPoolKo(pool types.PoolLocation, lastN int) []KoAndLocPair {
 	txs, _ := m.poolKoUpdates.lookupLastN(pool, lastN)
 	return txs
@@ -128,6 +172,62 @@ func (m *MemoryCache) RetrievePoolLimits(loc types.PoolLocation) map[types.Posit
 	}
 }
 
+// Appends the current APR estimate of every non-empty position to its history. Snapshots
+// before minTime are dropped, along with the histories of positions that were emptied or
+// rolled back once they have none left.
+func (m *MemoryCache) RecordPositionAprs(time int, minTime int) int {
+	nRecorded := 0
+	positions := m.liqPosition.clone()
+	for loc, pos := range positions {
+		if pos.IsEmpty() {
+			continue
+		}
+		hist, ok := m.positionAprs.lookup(loc)
+		if !ok {
+			hist = &model.AprHistory{}
+			m.positionAprs.insert(loc, hist)
+		}
+		hist.Record(time, pos.CalcAPR(loc).Apr, minTime)
+		nRecorded += 1
+	}
+
+	for loc, hist := range m.positionAprs.clone() {
+		if pos, ok := positions[loc]; ok && !pos.IsEmpty() {
+			continue
+		}
+		if hist.Prune(minTime) {
+			m.positionAprs.remove(loc)
+		}
+	}
+	return nRecorded
+}
+
+func (m *MemoryCache) RetrievePositionAprs(loc types.PositionLocation) []model.AprSnap {
+	hist, ok := m.positionAprs.lookup(loc)
+	if !ok {
+		return []model.AprSnap{}
+	}
+	return hist.Series()
+}
+
+func (m *MemoryCache) MaterializePoolFeeHist(loc types.PoolLocation) *model.FeeHistory {
+	hist, ok := m.poolFeeHistory.lookup(loc)
+	if !ok {
+		hist = &model.FeeHistory{}
+		m.poolFeeHistory.insert(loc, hist)
+	}
+	return hist
+}
+
+// Returns nil if no fee changes have been recorded for the pool
+func (m *MemoryCache) RetrievePoolFeeHist(loc types.PoolLocation) *model.FeeHistory {
+	hist, ok := m.poolFeeHistory.lookup(loc)
+	if !ok {
+		return nil
+	}
+	return hist
+}
+
 func (m *MemoryCache) RetrievePoolPositions(loc types.PoolLocation) map[types.PositionLocation]*model.PositionTracker {
 	pos, okay := m.poolPositions.lookupSet(loc)
 	if okay {
@@ -162,6 +262,26 @@ func (m *MemoryCache) RetrievePoolLiqCurve(loc types.PoolLocation) (float64, []*
 	return ambientLiq, returnVal
 }
 
+func (m *MemoryCache) SimulatePoolSwap(loc types.PoolLocation, price float64, feeRate float64,
+	isBuy bool, qty float64) model.SwapQuote {
+	curve, okay, lock := m.poolLiqCurve.lockLookup(loc, false)
+	if !okay {
+		return model.NewLiquidityCurve().SimulateSwap(price, feeRate, isBuy, qty)
+	}
+	defer lock.RUnlock()
+	return curve.SimulateSwap(price, feeRate, isBuy, qty)
+}
+
+func (m *MemoryCache) RetrievePoolDepth(loc types.PoolLocation, price float64,
+	bucketTicks int, nBuckets int) model.CurveDepth {
+	curve, okay, lock := m.poolLiqCurve.lockLookup(loc, false)
+	if !okay {
+		return model.NewLiquidityCurve().Depth(price, bucketTicks, nBuckets)
+	}
+	defer lock.RUnlock()
+	return curve.Depth(price, bucketTicks, nBuckets)
+}
+
 func (m *MemoryCache) RetrievePoolAccum(loc types.PoolLocation) (stats model.AccumPoolStats, eventCount int) {
 	pos, okay := m.poolTradingHistory.lookup(loc)
 	if !okay {
@@ -198,6 +318,39 @@ func (m *MemoryCache) RetrieveChainAccums(chainId types.ChainId) []AccumTagged {
 	return retVal
 }
 
+// Stats of every pool on the chain as of each of the times, which must be ascending. Pools
+// created after a time are skipped. Each pool's snapshots are read in a single pass.
+func (m *MemoryCache) RetrieveChainAccumsSeries(chainId types.ChainId, times []int) [][]AccumTagged {
+	retVal := make([][]AccumTagged, len(times))
+	for i := range retVal {
+		retVal[i] = make([]AccumTagged, 0)
+	}
+	for _, loc := range m.poolTradingHistory.keySet() {
+		if loc.ChainId != chainId {
+			continue
+		}
+		pos, okay, lock := m.poolTradingHistory.lockLookup(loc, false)
+		if !okay {
+			continue
+		}
+		nextSnap := 0
+		for i, histTime := range times {
+			if histTime >= pos.StatsCounter.LatestTime {
+				retVal[i] = append(retVal[i], AccumTagged{pos.StatsCounter, loc})
+				continue
+			}
+			for nextSnap < len(pos.TimeSnaps) && pos.TimeSnaps[nextSnap].LatestTime <= histTime {
+				nextSnap++
+			}
+			if nextSnap > 0 {
+				retVal[i] = append(retVal[i], AccumTagged{pos.TimeSnaps[nextSnap-1], loc})
+			}
+		}
+		lock.RUnlock()
+	}
+	return retVal
+}
+
 func (m *MemoryCache) RetrievePoolAccumBefore(loc types.PoolLocation, histTime int) (stats model.AccumPoolStats, eventCount int) {
 	pos, okay, lock := m.poolTradingHistory.lockLookup(loc, false)
 	if !okay {
@@ -306,6 +459,13 @@ func (m *MemoryCache) BorrowPoolHourlyCandles(loc types.PoolLocation, writeLock
 	return candles, lock
 }
 
+// Drops the cached candles so they're rebuilt from the trading history on the next query
+func (m *MemoryCache) ClearPoolHourlyCandles(loc types.PoolLocation) {
+	candles, lock := m.BorrowPoolHourlyCandles(loc, true)
+	defer lock.Unlock()
+	*candles = (*candles)[:0]
+}
+
 func (m *MemoryCache) RetrieveUserPoolPositions(user types.EthAddress, pool types.PoolLocation) map[types.PositionLocation]*model.PositionTracker {
 	userPositions := m.RetrieveUserPositions(pool.ChainId, user)
 	filtered := make(map[types.PositionLocation]*model.PositionTracker)
@@ -333,11 +493,56 @@ func (m *MemoryCache) AddUserBalance(chainId types.ChainId, user types.EthAddres
 	m.userBalTokens.insert(key, token)
 }
 
+func (m *MemoryCache) MaterializeUserSurplus(chainId types.ChainId, user types.EthAddress, token types.EthAddress) *model.SurplusBalance {
+	key := SurplusKey{chainId, user, token}
+	val, ok := m.userSurplus.lookup(key)
+	if !ok {
+		val = &model.SurplusBalance{}
+		m.userSurplus.insert(key, val)
+	}
+	return val
+}
+
+func (m *MemoryCache) RetrieveUserSurplus(chainId types.ChainId, user types.EthAddress, token types.EthAddress) (*model.SurplusBalance, bool) {
+	return m.userSurplus.lookup(SurplusKey{chainId, user, token})
+}
+
+// Undoes MaterializeUserSurplus for a balance row that was rolled back
+func (m *MemoryCache) RemoveUserSurplus(chainId types.ChainId, user types.EthAddress, token types.EthAddress) {
+	m.userSurplus.remove(SurplusKey{chainId, user, token})
+}
+
+// Returns every (user, token) surplus balance tracked on all chains
+func (m *MemoryCache) RetrieveAllSurplus() map[SurplusKey]*model.SurplusBalance {
+	return m.userSurplus.clone()
+}
+
+func (m *MemoryCache) RemoveUserBalance(chainId types.ChainId, user types.EthAddress, token types.EthAddress) {
+	key := chainAndAddr{chainId, user}
+	m.userBalTokens.removeLast(key, func(t types.EthAddress) bool { return t == token })
+}
+
+func (m *MemoryCache) RemovePoolEvent(tx types.PoolTxEvent) {
+	userKey := chainAndAddr{tx.ChainId, tx.User}
+	// Identified by the call that emitted the event rather than comparing every field,
+	// because NaN flows never compare equal
+	matches := func(t types.PoolTxEvent) bool {
+		return t.TxHash == tx.TxHash && t.CallIndex == tx.CallIndex && t.PoolLocation == tx.PoolLocation
+	}
+	m.userTxs.removeLast(userKey, matches)
+	m.poolTxs.removeLast(tx.PoolLocation, matches)
+	m.txEvents.removeLast(chainAndTx{tx.ChainId, tx.TxHash}, matches)
+	if touchesLiqCurve(tx) {
+		m.TouchPoolLiqCurve(tx.PoolLocation, tx.BlockNum)
+	}
+}
+
 func (m *MemoryCache) AddPoolEvent(tx types.PoolTxEvent) {
 	userKey := chainAndAddr{tx.ChainId, tx.User}
 	// m.userTxs.insert(userKey, tx)
 	// m.poolTxs.insert(tx.PoolLocation, tx)
-	m.userTxs.insertSorted(userKey, tx, func(i, j types.PoolTxEvent) bool {
+	m.userTxs.insertSorted(userKey, tx, userTxLess)
+	m.poolTxs.insertSorted(tx.PoolLocation, tx, func(i, j types.PoolTxEvent) bool {
 		if i.TxTime != j.TxTime {
 			return i.TxTime > j.TxTime
 		}
@@ -355,14 +560,6 @@ func (m *MemoryCache) AddPoolEvent(tx types.PoolTxEvent) {
 			return i.PositionType > j.PositionType
 		}
 
-		if i.Base != j.Base {
-			return i.Base > j.Base
-		}
-
-		if i.Quote != j.Quote {
-			return i.Quote > j.Quote
-		}
-
 		if i.BidTick != j.BidTick {
 			return i.BidTick > j.BidTick
 		}
@@ -372,33 +569,52 @@ func (m *MemoryCache) AddPoolEvent(tx types.PoolTxEvent) {
 		}
 		return false
 	})
-	m.poolTxs.insertSorted(tx.PoolLocation, tx, func(i, j types.PoolTxEvent) bool {
-		if i.TxTime != j.TxTime {
-			return i.TxTime > j.TxTime
-		}
+	m.txEvents.insertSorted(chainAndTx{tx.ChainId, tx.TxHash}, tx, txCallLess)
+	if touchesLiqCurve(tx) {
+		m.TouchPoolLiqCurve(tx.PoolLocation, tx.BlockNum)
+	}
+	m.txSubs.publish(tx)
+}
 
-		if i.CallIndex != j.CallIndex {
-			return i.CallIndex > j.CallIndex
-		}
+// Events within a transaction are kept in call order
+func txCallLess(i, j types.PoolTxEvent) bool {
+	return i.CallIndex > j.CallIndex
+}
 
-		// Tie breakers if occurs at same time
-		if i.ChangeType != j.ChangeType {
-			return i.ChangeType > j.ChangeType
-		}
+func userTxLess(i, j types.PoolTxEvent) bool {
+	if i.TxTime != j.TxTime {
+		return i.TxTime > j.TxTime
+	}
 
-		if i.PositionType != j.PositionType {
-			return i.PositionType > j.PositionType
-		}
+	if i.CallIndex != j.CallIndex {
+		return i.CallIndex > j.CallIndex
+	}
 
-		if i.BidTick != j.BidTick {
-			return i.BidTick > j.BidTick
-		}
+	// Tie breakers if occurs at same time
+	if i.ChangeType != j.ChangeType {
+		return i.ChangeType > j.ChangeType
+	}
 
-		if i.AskTick != j.AskTick {
-			return i.BidTick > j.BidTick
-		}
-		return false
-	})
+	if i.PositionType != j.PositionType {
+		return i.PositionType > j.PositionType
+	}
+
+	if i.Base != j.Base {
+		return i.Base > j.Base
+	}
+
+	if i.Quote != j.Quote {
+		return i.Quote > j.Quote
+	}
+
+	if i.BidTick != j.BidTick {
+		return i.BidTick > j.BidTick
+	}
+
+	if i.AskTick != j.AskTick {
+		return i.BidTick > j.BidTick
+	}
+	return false
 }
 
 func (m *MemoryCache) MaterializePoolLiqCurve(loc types.PoolLocation, writeLock bool) (*model.LiquidityCurve, *sync.RWMutex) {
@@ -441,6 +657,7 @@ func (m *MemoryCache) MaterializePosition(loc types.PositionLocation) *model.Pos
 		m.liqPosition.insert(loc, val)
 		m.userPositions.insert(chainAndAddr{loc.ChainId, loc.User}, loc, val)
 		m.poolPositions.insert(loc.PoolLocation, loc, val)
+		m.indexPosition(loc)
 		// m.userAndPoolPositions.insert(
 		// 	chainUserAndPool{loc.User, loc.PoolLocation}, loc, val)
 	}
@@ -449,11 +666,29 @@ func (m *MemoryCache) MaterializePosition(loc types.PositionLocation) *model.Pos
 	return val
 }
 
+func (m *MemoryCache) HasPosition(loc types.PositionLocation) bool {
+	_, ok := m.liqPosition.lookup(loc)
+	return ok
+}
+
+// Undoes MaterializePosition for a liquidity change that was rolled back. If the position
+// was created by the change it's removed entirely.
+func (m *MemoryCache) RevertPositionUpdate(loc types.PositionLocation, isNew bool) {
+	m.poolPosUpdates.removeLast(loc.PoolLocation, func(p PosAndLocPair) bool { return p.Loc == loc })
+	if isNew {
+		m.liqPosition.remove(loc)
+		m.userPositions.remove(chainAndAddr{loc.ChainId, loc.User}, loc)
+		m.poolPositions.remove(loc.PoolLocation, loc)
+		m.entityIds.positions.remove(loc.Hash(nil))
+	}
+}
+
 func (m *MemoryCache) MaterializeKnockoutSaga(loc types.BookLocation) *model.KnockoutSaga {
 	val, ok := m.knockoutSagas.lookup(loc)
 	if !ok {
 		val = model.NewKnockoutSaga()
 		m.knockoutSagas.insert(loc, val)
+		m.indexKnockoutSaga(loc, val)
 	}
 	return val
 }
@@ -472,6 +707,21 @@ func (m *MemoryCache) MaterializeKnockoutPos(loc types.PositionLocation) *model.
 	return val
 }
 
+func (m *MemoryCache) HasKnockoutPos(loc types.PositionLocation) bool {
+	_, ok := m.liqKnockouts.lookup(loc)
+	return ok
+}
+
+// Undoes MaterializeKnockoutPos for a liquidity change that was rolled back
+func (m *MemoryCache) RevertKnockoutUpdate(loc types.PositionLocation, isNew bool) {
+	m.poolKoUpdates.removeLast(loc.PoolLocation, func(k KoAndLocPair) bool { return k.Loc == loc })
+	if isNew {
+		m.liqKnockouts.remove(loc)
+		m.userKnockouts.remove(chainAndAddr{loc.ChainId, loc.User}, loc)
+		m.poolKnockouts.remove(loc.PoolLocation, loc)
+	}
+}
+
 func (m *MemoryCache) RetrievePivotTime(loc types.BookLocation) int {
 	pos, okay := m.knockoutPivotTimes.lookup(loc)
 	if okay {
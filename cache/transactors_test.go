@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestRemovePoolEvent(t *testing.T) {
+	pool := types.PoolLocation{ChainId: "0x1", Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420}
+	user := types.EthAddress("0xcccc")
+	m := New()
+
+	events := make([]types.PoolTxEvent, 3)
+	for i := range events {
+		events[i] = types.PoolTxEvent{
+			EthTxHeader:   types.EthTxHeader{TxTime: 500, TxHash: "0x03", User: user, CallIndex: i},
+			PoolLocation:  pool,
+			PoolEventFlow: types.PoolEventFlow{BaseFlow: math.NaN(), QuoteFlow: float64(i)},
+		}
+		m.AddPoolEvent(events[i])
+	}
+
+	// NaN flows never compare equal, so the event has to be found by its call
+	m.RemovePoolEvent(events[1])
+
+	for _, txs := range [][]types.PoolTxEvent{
+		m.RetrievePoolTxs(pool),
+		m.RetrieveLastNUserTxs(pool.ChainId, user, 10),
+		m.RetrieveTxEvents(pool.ChainId, "0x03"),
+	} {
+		if len(txs) != 2 {
+			t.Fatalf("Expected one event removed: %+v", txs)
+		}
+		for _, tx := range txs {
+			if tx.CallIndex == 1 {
+				t.Fatalf("Wrong event removed: %+v", txs)
+			}
+		}
+	}
+}
+
+func TestRecordPositionAprsPrunes(t *testing.T) {
+	pool := types.PoolLocation{ChainId: "0x1", Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420}
+	posLoc := func(tick int) types.PositionLocation {
+		return types.PositionLocation{PoolLocation: pool, LiquidityLocation: types.RangeLiquidityLocation(-tick, tick), User: "0xcccc"}
+	}
+	live, emptied, stale := posLoc(100), posLoc(200), posLoc(300)
+	m := New()
+	m.MaterializePosition(live).ConcLiq.SetInt64(1000)
+	m.MaterializePosition(emptied)
+	m.MaterializePosition(stale)
+	m.positionAprs.insert(live, &model.AprHistory{Snaps: []model.AprSnap{{Time: 100, Apr: 1}, {Time: 900, Apr: 1}}})
+	m.positionAprs.insert(emptied, &model.AprHistory{Snaps: []model.AprSnap{{Time: 800, Apr: 1}}})
+	m.positionAprs.insert(stale, &model.AprHistory{Snaps: []model.AprSnap{{Time: 100, Apr: 1}}})
+
+	if n := m.RecordPositionAprs(1000, 500); n != 1 {
+		t.Fatalf("Expected one position recorded, got %d", n)
+	}
+	if snaps := m.RetrievePositionAprs(live); len(snaps) != 2 || snaps[0].Time != 900 || snaps[1].Time != 1000 {
+		t.Fatalf("Bad live position history %+v", snaps)
+	}
+	if snaps := m.RetrievePositionAprs(emptied); len(snaps) != 1 {
+		t.Fatalf("History within the window dropped %+v", snaps)
+	}
+	if _, ok := m.positionAprs.lookup(stale); ok {
+		t.Fatal("History past the window not removed")
+	}
+}
+
+func TestRetrieveChainAccumsSeries(t *testing.T) {
+	m := New()
+	pools := []types.PoolLocation{
+		{ChainId: "0x1", Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420},
+		{ChainId: "0x1", Base: "0xaaaa", Quote: "0xcccc", PoolIdx: 420},
+		{ChainId: "0x2", Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420},
+	}
+	for i, pool := range pools {
+		hist, lock := m.MaterializePoolTradingHist(pool, true)
+		for snapTime := 100 * (i + 1); snapTime < 1000; snapTime += 150 {
+			hist.TimeSnaps = append(hist.TimeSnaps, model.AccumPoolStats{LatestTime: snapTime, BaseVolume: float64(snapTime)})
+		}
+		hist.StatsCounter = model.AccumPoolStats{LatestTime: 1000, BaseVolume: 1000}
+		lock.Unlock()
+	}
+
+	times := []int{50, 100, 199, 200, 640, 999, 1000, 5000}
+	series := m.RetrieveChainAccumsSeries("0x1", times)
+	for i, histTime := range times {
+		expected := make(map[types.PoolLocation]model.AccumPoolStats)
+		for _, pool := range pools[:2] {
+			if accum, eventCount := m.RetrievePoolAccumBefore(pool, histTime); eventCount > 0 {
+				expected[pool] = accum
+			}
+		}
+		got := make(map[types.PoolLocation]model.AccumPoolStats)
+		for _, accum := range series[i] {
+			got[accum.PoolLocation] = accum.AccumPoolStats
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("At %d expected %+v, got %+v", histTime, expected, got)
+		}
+	}
+}
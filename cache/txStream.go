@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+// Live feed of pool events for a single pool or a single user. Events are delivered
+// on the channel in the order they're committed. If the subscriber falls behind and
+// the buffer fills, the channel is closed and the subscriber should resume from the
+// last event it processed.
+type TxSubscription struct {
+	Events chan types.PoolTxEvent
+	pool   *types.PoolLocation
+	user   *chainAndAddr
+}
+
+type txSubscribers struct {
+	subs map[*TxSubscription]struct{}
+	lock sync.RWMutex
+}
+
+const TX_SUBSCRIPTION_BUFFER = 1000
+
+func newTxSubscribers() *txSubscribers {
+	return &txSubscribers{
+		subs: make(map[*TxSubscription]struct{}),
+	}
+}
+
+func (m *MemoryCache) SubscribePoolTxs(pool types.PoolLocation) *TxSubscription {
+	sub := &TxSubscription{
+		Events: make(chan types.PoolTxEvent, TX_SUBSCRIPTION_BUFFER),
+		pool:   &pool,
+	}
+	m.txSubs.add(sub)
+	return sub
+}
+
+func (m *MemoryCache) SubscribeUserTxs(chainId types.ChainId, user types.EthAddress) *TxSubscription {
+	sub := &TxSubscription{
+		Events: make(chan types.PoolTxEvent, TX_SUBSCRIPTION_BUFFER),
+		user:   &chainAndAddr{chainId, user},
+	}
+	m.txSubs.add(sub)
+	return sub
+}
+
+func (m *MemoryCache) Unsubscribe(sub *TxSubscription) {
+	m.txSubs.remove(sub)
+}
+
+// Closes all subscriptions on the chain, e.g. after a reorg removed events that were
+// already delivered. Subscribers should treat this like an overflow and resync.
+func (m *MemoryCache) ResyncTxSubscriptions(chainId types.ChainId) {
+	m.txSubs.lock.RLock()
+	var onChain []*TxSubscription
+	for sub := range m.txSubs.subs {
+		if (sub.pool != nil && sub.pool.ChainId == chainId) || (sub.user != nil && sub.user.ChainId == chainId) {
+			onChain = append(onChain, sub)
+		}
+	}
+	m.txSubs.lock.RUnlock()
+
+	for _, sub := range onChain {
+		m.txSubs.remove(sub)
+	}
+}
+
+func (s *TxSubscription) matches(tx types.PoolTxEvent) bool {
+	if s.pool != nil {
+		return *s.pool == tx.PoolLocation
+	}
+	return s.user.ChainId == tx.ChainId && s.user.EthAddress == tx.User
+}
+
+func (t *txSubscribers) add(sub *TxSubscription) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.subs[sub] = struct{}{}
+}
+
+func (t *txSubscribers) remove(sub *TxSubscription) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.subs[sub]; ok {
+		delete(t.subs, sub)
+		close(sub.Events)
+	}
+}
+
+func (t *txSubscribers) publish(tx types.PoolTxEvent) {
+	t.lock.RLock()
+	if len(t.subs) == 0 {
+		t.lock.RUnlock()
+		return
+	}
+
+	var overflowed []*TxSubscription
+	for sub := range t.subs {
+		if !sub.matches(tx) {
+			continue
+		}
+		select {
+		case sub.Events <- tx:
+		default:
+			overflowed = append(overflowed, sub)
+		}
+	}
+	t.lock.RUnlock()
+
+	// Slow consumers are dropped rather than blocking ingestion
+	for _, sub := range overflowed {
+		t.remove(sub)
+	}
+}
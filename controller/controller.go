@@ -4,10 +4,13 @@ import (
 	"log"
 	"math"
 	"math/big"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/CrocSwap/graphcache-go/cache"
 	"github.com/CrocSwap/graphcache-go/loader"
+	"github.com/CrocSwap/graphcache-go/metrics"
 	"github.com/CrocSwap/graphcache-go/model"
 	"github.com/CrocSwap/graphcache-go/tables"
 	"github.com/CrocSwap/graphcache-go/types"
@@ -19,6 +22,11 @@ type Controller struct {
 	history   *model.HistoryWriter
 	workers   *workers
 	refresher *LiquidityRefresher
+	journals  map[types.ChainId]*reorgJournal
+	jrnlLock  sync.Mutex
+
+	snapshotDir      string
+	snapshotInterval time.Duration
 }
 
 func New(netCfg loader.NetworkConfig, cache *cache.MemoryCache, chain *loader.OnChainLoader) *Controller {
@@ -38,8 +46,11 @@ func NewOnQuery(netCfg loader.NetworkConfig, cache *cache.MemoryCache, query loa
 		workers:   workers,
 		refresher: refresher,
 		history:   history,
+		journals:  make(map[types.ChainId]*reorgJournal),
 	}
 	go ctrl.runPeriodicRefresh()
+	go ctrl.runAprRecorder()
+	go ctrl.runBacklogTracker()
 
 	return ctrl
 }
@@ -62,6 +73,24 @@ type ControllerOverNetwork struct {
 	chainId  types.ChainId
 	chainCfg loader.ChainConfig
 	ctrl     *Controller
+	journal  *reorgJournal
+	crosses  *pendingCrosses
+
+	lastSnapshot time.Time
+	// Latest head reported by the syncer's source, and the head when the pending snapshot
+	// was written
+	headBlock    int
+	pendingBlock int
+	hasPending   bool
+}
+
+// Knockout crosses are synced from their own table ahead of the liquidity changes, but
+// have to be applied in order with the liquidity changes at the same ticks. They're held
+// here until the cross row for the same event comes through the liquidity changes, or
+// until the liquidity changes have been ingested past the cross block.
+type pendingCrosses struct {
+	rows []tables.KnockoutCross
+	lock sync.Mutex
 }
 
 func (c *Controller) OnNetwork(network types.NetworkName) *ControllerOverNetwork {
@@ -75,22 +104,66 @@ func (c *Controller) OnNetwork(network types.NetworkName) *ControllerOverNetwork
 		ctrl:     c,
 		chainId:  chainId,
 		chainCfg: chainCfg,
+		journal:  c.journalForChain(chainId),
+		crosses:  &pendingCrosses{},
 	}
 }
 
+func (c *Controller) journalForChain(chainId types.ChainId) *reorgJournal {
+	c.jrnlLock.Lock()
+	defer c.jrnlLock.Unlock()
+	journal, ok := c.journals[chainId]
+	if !ok {
+		journal = newReorgJournal()
+		c.journals[chainId] = journal
+	}
+	return journal
+}
+
 func (c *ControllerOverNetwork) IngestBalance(b tables.Balance) {
 	token := types.RequireEthAddr(b.Token)
 	user := types.RequireEthAddr(b.User)
+	_, hadSurplus := c.ctrl.cache.RetrieveUserSurplus(c.chainId, user, token)
 	c.ctrl.cache.AddUserBalance(c.chainId, user, token)
+	surplus := c.ctrl.cache.MaterializeUserSurplus(c.chainId, user, token)
+	priorBalance, priorTime := surplus.Read()
+	c.pushSurplusRefresh(user, token, surplus, b.Time)
+	c.journal.record(b.Block, func() {
+		c.ctrl.cache.RemoveUserBalance(c.chainId, user, token)
+		if !hadSurplus {
+			c.ctrl.cache.RemoveUserSurplus(c.chainId, user, token)
+			return
+		}
+		// The refresh for the row may have read the orphaned block, so the balance goes back
+		// to its prior value and is queried again
+		surplus.Update(*priorBalance, priorTime)
+		c.pushSurplusRefresh(user, token, surplus, b.Time)
+	})
+}
+
+// Every surplus is refreshed once the startup sync is done (see resyncSurplus), so the rows
+// replayed by the sync don't each queue their own refresh
+func (c *ControllerOverNetwork) pushSurplusRefresh(user types.EthAddress, token types.EthAddress,
+	surplus *model.SurplusBalance, eventTime int) {
+	if c.ctrl.cache.IsChainSyncing(c.chainId) {
+		return
+	}
+	c.ctrl.workers.omniUpdates <- &surplusRefreshMsg{
+		chainId: c.chainId, user: user, token: token, surplus: surplus, eventTime: eventTime}
 }
 
 func (c *ControllerOverNetwork) IngestLiqChange(l tables.LiqChange) {
+	c.applyCrossesBefore(l.Block)
 	if l.ChangeType == tables.ChangeTypeCross {
-		c.IngestKnockout(l)
+		c.applyCrossAt(l)
+	} else {
+		c.applyToPosition(l)
+		c.applyToLiqCurve(l)
 	}
-	c.applyToPosition(l)
-	c.applyToLiqCurve(l)
-	c.ctrl.history.CommitLiqChange(l)
+	tx := c.ctrl.history.CommitLiqChange(l)
+	c.journal.record(l.Block, func() {
+		c.ctrl.cache.RemovePoolEvent(tx)
+	})
 }
 
 func (c *ControllerOverNetwork) applyToPosition(l tables.LiqChange) {
@@ -126,7 +199,14 @@ func (c *ControllerOverNetwork) applyToLiqCurve(l tables.LiqChange) {
 	}
 	curve, lock := c.ctrl.cache.MaterializePoolLiqCurve(pool, true)
 	defer lock.Unlock()
+	checkpoint := curve.Checkpoint(l)
 	curve.UpdateLiqChange(l)
+
+	c.journal.record(l.Block, func() {
+		curve, lock := c.ctrl.cache.MaterializePoolLiqCurve(pool, true)
+		defer lock.Unlock()
+		curve.Restore(checkpoint)
+	})
 }
 
 func (c *ControllerOverNetwork) applyToKnockout(l tables.LiqChange, loc types.PositionLocation) {
@@ -136,13 +216,12 @@ func (c *ControllerOverNetwork) applyToKnockout(l tables.LiqChange, loc types.Po
 	} else {
 		pivotLoc.LiquidityLocation.BidTick = l.AskTick
 	}
-	if l.ChangeType == tables.ChangeTypeCross {
-		c.ctrl.cache.SetPivotTime(pivotLoc, 0)
-		return
-	}
 	pivotTime := c.ctrl.cache.RetrievePivotTime(pivotLoc)
 	if l.ChangeType == tables.ChangeTypeMint && pivotTime == 0 {
 		c.ctrl.cache.SetPivotTime(pivotLoc, l.Time)
+		c.journal.record(l.Block, func() {
+			c.ctrl.cache.SetPivotTime(pivotLoc, 0)
+		})
 		pivotTime = l.Time
 	}
 
@@ -151,14 +230,33 @@ func (c *ControllerOverNetwork) applyToKnockout(l tables.LiqChange, loc types.Po
 		TxHash:    l.TX,
 		PivotTime: pivotTime,
 	}
+	isNew := !c.ctrl.cache.HasKnockoutPos(loc)
 	pos := c.ctrl.cache.MaterializeKnockoutPos(loc)
+	checkpoint := pos.Checkpoint()
+	newClaim, claimed := false, false
 	if l.ChangeType == tables.ChangeTypeMint {
 		pos.AppendMint(event)
+		newClaim = c.ctrl.cache.IndexLimitClaim(loc, pivotTime)
 	} else if l.ChangeType == tables.ChangeTypeBurn {
 		pos.AppendBurn(event)
+	} else if (l.ChangeType == tables.ChangeTypeClaim || l.ChangeType == tables.ChangeTypeRecover) && l.PivotTime != nil {
+		// Claims and recovers take all the liquidity knocked out at the pivot
+		claimed = c.ctrl.cache.UnindexLimitClaim(loc, *l.PivotTime)
 	}
 
-	c.ctrl.workers.omniUpdates <- &koPosUpdateMsg{liq: l, pos: pos, loc: loc}
+	update := &koPosUpdateMsg{liq: l, pos: pos, loc: loc}
+	c.ctrl.workers.omniUpdates <- update
+	c.journal.record(l.Block, func() {
+		if newClaim {
+			c.ctrl.cache.UnindexLimitClaim(loc, pivotTime)
+		}
+		if claimed {
+			c.ctrl.cache.IndexLimitClaim(loc, *l.PivotTime)
+		}
+		c.ctrl.cache.RevertKnockoutUpdate(loc, isNew)
+		pos.Restore(checkpoint)
+		c.ctrl.workers.omniUpdates <- &koPosRevertMsg{update}
+	})
 
 	// Estimate position liquidity from the flows
 	if (l.ChangeType == tables.ChangeTypeMint || l.ChangeType == tables.ChangeTypeBurn || l.ChangeType == tables.ChangeTypeRecover) && l.BaseFlow != nil && l.QuoteFlow != nil {
@@ -190,12 +288,21 @@ func (c *ControllerOverNetwork) applyToKnockout(l tables.LiqChange, loc types.Po
 }
 
 func (c *ControllerOverNetwork) applyToPassiveLiq(l tables.LiqChange, loc types.PositionLocation) {
+	isNew := !c.ctrl.cache.HasPosition(loc)
 	pos := c.ctrl.cache.MaterializePosition(loc)
-	c.ctrl.workers.omniUpdates <- &posUpdateMsg{liq: l, pos: pos, loc: loc}
+	update := &posUpdateMsg{liq: l, pos: pos, loc: loc}
+	c.ctrl.workers.omniUpdates <- update
+	c.journal.record(l.Block, func() {
+		c.ctrl.cache.RevertPositionUpdate(loc, isNew)
+		c.ctrl.workers.omniUpdates <- &posRevertMsg{update}
+	})
 }
 
 func (c *ControllerOverNetwork) IngestSwap(l tables.Swap) {
-	c.ctrl.history.CommitSwap(l)
+	tx := c.ctrl.history.CommitSwap(l)
+	c.journal.record(l.Block, func() {
+		c.ctrl.cache.RemovePoolEvent(tx)
+	})
 
 	updates := c.resyncPoolOnSwap(l)
 	// Use array entry, instead of element loop, because otherwise same pointer
@@ -206,6 +313,19 @@ func (c *ControllerOverNetwork) IngestSwap(l tables.Swap) {
 }
 
 func (c *ControllerOverNetwork) IngestFee(l tables.FeeChange) {
+	pool := types.PoolLocation{
+		ChainId: c.chainId,
+		PoolIdx: l.PoolIdx,
+		Base:    types.RequireEthAddr(l.Base),
+		Quote:   types.RequireEthAddr(l.Quote),
+	}
+	hist := c.ctrl.cache.MaterializePoolFeeHist(pool)
+	if !hist.Record(l) {
+		return
+	}
+	c.journal.record(l.Block, func() {
+		hist.Remove(l.ID)
+	})
 }
 
 func (c *ControllerOverNetwork) IngestAggEvent(r tables.AggEvent) {
@@ -217,31 +337,122 @@ func (c *ControllerOverNetwork) IngestAggEvent(r tables.AggEvent) {
 	}
 	hist, lock := c.ctrl.cache.MaterializePoolTradingHist(pool, true)
 	defer lock.Unlock()
+	checkpoint := hist.Checkpoint()
+	// Fee changes aren't always flagged on the agg events, so the recorded fee history
+	// takes precedence for the rate that swap fees accrue at
+	if feeHist := c.ctrl.cache.RetrievePoolFeeHist(pool); feeHist != nil && !r.IsFeeChange {
+		if rate, ok := feeHist.RateAt(r.Time); ok {
+			hist.StatsCounter.FeeRate = rate
+		}
+	}
 	hist.NextEvent(r)
+
+	c.journal.record(r.Block, func() {
+		hist, lock := c.ctrl.cache.MaterializePoolTradingHist(pool, true)
+		hist.Restore(checkpoint)
+		lock.Unlock()
+		c.ctrl.cache.ClearPoolHourlyCandles(pool)
+	})
 	// c.ctrl.workers.omniUpdates <- &poolInitPriceMsg{pool: pool, block: r.Block, hist: hist}
 }
 
-func (c *ControllerOverNetwork) IngestKnockout(l tables.LiqChange) {
-	liq := types.KnockoutTickLocation(l.BidTick, l.IsBid > 0, c.knockoutTickWidth())
+func (c *ControllerOverNetwork) IngestKnockoutCross(k tables.KnockoutCross) {
+	c.crosses.lock.Lock()
+	defer c.crosses.lock.Unlock()
+	i := len(c.crosses.rows)
+	for i > 0 && c.crosses.rows[i-1].Block > k.Block {
+		i--
+	}
+	c.crosses.rows = slices.Insert(c.crosses.rows, i, k)
+}
+
+func (c *ControllerOverNetwork) applyCrossesBefore(block int) {
+	c.crosses.lock.Lock()
+	defer c.crosses.lock.Unlock()
+	n := 0
+	for n < len(c.crosses.rows) && c.crosses.rows[n].Block < block {
+		c.applyKnockoutCross(c.crosses.rows[n])
+		n++
+	}
+	c.crosses.rows = slices.Delete(c.crosses.rows, 0, n)
+}
+
+// Applies the pending cross for a cross row in the liquidity changes, so that it's in the
+// same order with the liquidity changes in its block as the events on chain.
+func (c *ControllerOverNetwork) applyCrossAt(l tables.LiqChange) {
+	tick := l.AskTick
+	if l.IsBid > 0 {
+		tick = l.BidTick
+	}
+	c.crosses.lock.Lock()
+	defer c.crosses.lock.Unlock()
+	i := slices.IndexFunc(c.crosses.rows, func(k tables.KnockoutCross) bool {
+		return k.Block == l.Block && k.Tx == l.TX && k.Tick == tick && k.IsBid == l.IsBid &&
+			k.PoolIdx == l.PoolIdx && k.Base == l.Base && k.Quote == l.Quote
+	})
+	if i < 0 {
+		return
+	}
+	c.applyKnockoutCross(c.crosses.rows[i])
+	c.crosses.rows = slices.Delete(c.crosses.rows, i, i+1)
+}
+
+// Pending crosses after the fork are dropped, since the sync channel re-ingests them
+func (c *ControllerOverNetwork) dropCrossesAfter(block int) {
+	c.crosses.lock.Lock()
+	defer c.crosses.lock.Unlock()
+	c.crosses.rows = slices.DeleteFunc(c.crosses.rows, func(k tables.KnockoutCross) bool {
+		return k.Block > block
+	})
+}
+
+func (c *ControllerOverNetwork) applyKnockoutCross(k tables.KnockoutCross) {
 	pool := types.PoolLocation{
 		ChainId: c.chainId,
-		PoolIdx: l.PoolIdx,
-		Base:    types.RequireEthAddr(l.Base),
-		Quote:   types.RequireEthAddr(l.Quote),
+		PoolIdx: k.PoolIdx,
+		Base:    types.RequireEthAddr(k.Base),
+		Quote:   types.RequireEthAddr(k.Quote),
+	}
+
+	// Subsequent mints at the tick start a new pivot
+	pivotLoc := types.BookLocation{
+		PoolLocation:      pool,
+		LiquidityLocation: types.KnockoutRangeLocation(k.Tick, k.Tick, k.IsBid > 0),
 	}
+	prevPivotTime := c.ctrl.cache.RetrievePivotTime(pivotLoc)
+	c.ctrl.cache.SetPivotTime(pivotLoc, 0)
+
 	loc := types.BookLocation{
 		PoolLocation:      pool,
-		LiquidityLocation: liq,
+		LiquidityLocation: types.KnockoutTickLocation(k.Tick, k.IsBid > 0, c.knockoutTickWidth()),
 	}
-	pos := c.ctrl.cache.MaterializeKnockoutSaga(loc)
-	pos.UpdateCross(l)
-	c.ctrl.workers.omniUpdates <- &koCrossUpdateMsg{loc: loc, pos: pos, cross: l}
+	saga := c.ctrl.cache.MaterializeKnockoutSaga(loc)
+	// Historical curves replay crosses from the saga, so their checkpoints are dropped after
+	// it's updated
+	touchCurve := func() { c.ctrl.cache.TouchPoolLiqCurve(pool, k.Block) }
+	c.ctrl.workers.omniUpdates <- &koCrossUpdateMsg{loc: loc, pos: saga, cross: k, onApplied: touchCurve}
+
+	curve, lock := c.ctrl.cache.MaterializePoolLiqCurve(pool, true)
+	checkpoint := curve.CheckpointCross(k)
+	curve.UpdateKnockoutCross(k)
+	lock.Unlock()
+
+	c.journal.record(k.Block, func() {
+		curve, lock := c.ctrl.cache.MaterializePoolLiqCurve(pool, true)
+		curve.Restore(checkpoint)
+		lock.Unlock()
+		c.ctrl.cache.SetPivotTime(pivotLoc, prevPivotTime)
+		c.ctrl.workers.omniUpdates <- &koCrossRevertMsg{loc: loc, pos: saga, cross: k, onApplied: touchCurve}
+	})
 }
 
 /* Called to indicate that all tables have completed the most recent sync cycle up
- * to the checkpointed time. */
-func (c *ControllerOverNetwork) FlushSyncCycle(time int) {
-
+ * to the checkpointed block. */
+func (c *ControllerOverNetwork) FlushSyncCycle(block int, channels *syncChannels) {
+	c.applyCrossesBefore(block + 1)
+	metrics.SetSyncedBlock(string(c.chainId), block)
+	c.ctrl.cache.SetSyncedBlock(c.chainId, block)
+	channels.recordStatus(c.ctrl.cache, c.chainId)
 }
 
 /* Currently this uses a preset value from the network config. Long-term we should be querying
@@ -276,6 +487,7 @@ func (c *Controller) StartupSubgraphSyncDone() {
 		c.workers.omniUpdates <- &posRefreshMsg{posLocPair.Loc, posLocPair.Pos, posLocPair.Pos.LatestUpdateTime}
 	}
 	c.resyncBumps()
+	c.resyncSurplus()
 	log.Println("Waiting for a few liquidity refreshes to go through...")
 	time.Sleep(2 * time.Second * time.Duration(len(allPos)/100000))
 }
@@ -291,13 +503,26 @@ func (c *Controller) resyncLiquidity() {
 
 func (c *Controller) resyncBumps() {
 	poolCurves := c.cache.RetrieveAllCurves()
-	for pool, curve := range poolCurves {
+	for pool := range poolCurves {
+		curve, lock := c.cache.MaterializePoolLiqCurve(pool, false)
+		msgs := make([]*bumpRefreshMsg, 0, len(curve.Bumps))
 		for tick, bump := range curve.Bumps {
-			c.workers.omniUpdates <- &bumpRefreshMsg{pool, tick, curve, bump}
+			msgs = append(msgs, &bumpRefreshMsg{pool, tick, curve, bump, lock})
+		}
+		lock.RUnlock()
+		for _, msg := range msgs {
+			c.workers.omniUpdates <- msg
 		}
 	}
 }
 
+func (c *Controller) resyncSurplus() {
+	for key, surplus := range c.cache.RetrieveAllSurplus() {
+		c.workers.omniUpdates <- &surplusRefreshMsg{
+			chainId: key.ChainId, user: key.User, token: key.Token, surplus: surplus, isPoll: true}
+	}
+}
+
 const REFRESH_CYCLE_TIME = 30 * 60
 
 func (c *Controller) runPeriodicRefresh() {
@@ -309,5 +534,31 @@ func (c *Controller) runPeriodicRefresh() {
 		log.Println("Running full refresh at", refreshTime)
 		c.resyncLiquidity()
 		c.resyncBumps()
+		c.resyncSurplus()
+	}
+}
+
+// Positions' APR estimates are recorded hourly and kept for two weeks
+const APR_SNAP_INTERVAL = 60 * 60
+const APR_RETENTION_SECS = 3600 * 24 * 14
+
+const BACKLOG_TRACK_INTERVAL = 5 * time.Second
+
+// Publishes the refresher's queue lengths to the cache for the sync status
+func (c *Controller) runBacklogTracker() {
+	for {
+		c.cache.SetRefreshBacklog(c.refresher.backlog())
+		time.Sleep(BACKLOG_TRACK_INTERVAL)
+	}
+}
+
+func (c *Controller) runAprRecorder() {
+	c.SpinUntilLiqSync()
+	for {
+		now := time.Now().Unix()
+		nextSnap := now - now%APR_SNAP_INTERVAL + APR_SNAP_INTERVAL
+		time.Sleep(time.Duration(nextSnap-now) * time.Second)
+		nRecorded := c.cache.RecordPositionAprs(int(nextSnap), int(nextSnap)-APR_RETENTION_SECS)
+		log.Printf("Recorded APR of %d positions", nRecorded)
 	}
 }
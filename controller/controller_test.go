@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/loader"
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/tables"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+const (
+	testBase  = "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	testQuote = "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	testUser  = "0xcccccccccccccccccccccccccccccccccccccccc"
+	zeroUser  = "0x0000000000000000000000000000000000000000"
+)
+
+func testTxHash(n int) string {
+	return fmt.Sprintf("0x%064x", n)
+}
+
+func testNetworkController() *ControllerOverNetwork {
+	netCfg := loader.NetworkConfig{"test": loader.ChainConfig{ChainID: 1}}
+	return &ControllerOverNetwork{
+		chainId: "0x1",
+		ctrl:    NewOnQuery(netCfg, cache.New(), &loader.NonCrocQuery{}),
+		journal: newReorgJournal(),
+		crosses: &pendingCrosses{},
+	}
+}
+
+func TestCrossOrderedWithinBlock(t *testing.T) {
+	c := testNetworkController()
+	pool := types.PoolLocation{ChainId: c.chainId, Base: testBase, Quote: testQuote, PoolIdx: 420}
+	knockoutMint := func(block int, tx int, flow float64) tables.LiqChange {
+		return tables.LiqChange{Network: "test", TX: testTxHash(tx), Block: block, Time: block * 10, Base: testBase,
+			Quote: testQuote, PoolIdx: 420, User: testUser, PositionType: tables.PosTypeKnockout, ChangeType: tables.ChangeTypeMint,
+			BidTick: -64, AskTick: 0, IsBid: 1, BaseFlow: &flow, QuoteFlow: &flow}
+	}
+
+	c.IngestLiqChange(knockoutMint(5, 1, 1000))
+
+	// The cross comes first from its own table, then its row in the liq changes is followed
+	// by a mint at the same tick in the same block, which isn't knocked out
+	pivotTime := 50
+	c.IngestKnockoutCross(tables.KnockoutCross{Network: "test", Tx: testTxHash(2), Block: 10, Time: 100,
+		Base: testBase, Quote: testQuote, PoolIdx: 420, Tick: -64, IsBid: 1, PivotTime: pivotTime})
+	c.IngestLiqChange(tables.LiqChange{Network: "test", TX: testTxHash(2), Block: 10, Time: 100, Base: testBase,
+		Quote: testQuote, PoolIdx: 420, User: zeroUser, PositionType: tables.PosTypeKnockout,
+		ChangeType: tables.ChangeTypeCross, BidTick: -64, AskTick: -64, IsBid: 1, PivotTime: &pivotTime})
+	lateMint := knockoutMint(10, 3, 3000)
+	c.IngestLiqChange(lateMint)
+	c.FlushSyncCycle(10, &syncChannels{})
+
+	expected := model.NewLiquidityCurve()
+	expected.UpdateLiqChange(lateMint)
+
+	curve, lock := c.ctrl.cache.MaterializePoolLiqCurve(pool, true)
+	defer lock.Unlock()
+	bump := curve.Bumps[-64]
+	if bump.KnockoutBidLiq != expected.Bumps[-64].KnockoutBidLiq || bump.KnockoutBidLiq == 0 {
+		t.Fatalf("Expected only the later mint's knockout liq at the tick, got %+v", bump)
+	}
+	if bump.LatestUpdateTime != 100 {
+		t.Fatalf("Cross time changed: %+v", bump)
+	}
+
+	hasCross := false
+	for _, tx := range c.ctrl.cache.RetrievePoolTxs(pool) {
+		hasCross = hasCross || tx.ChangeType == tables.ChangeTypeCross
+	}
+	if !hasCross {
+		t.Fatal("Cross row missing from the tx history")
+	}
+}
+
+func TestBalanceRollbackRevertsSurplus(t *testing.T) {
+	c := testNetworkController()
+	c.journal.setFloor(0)
+	tokenA, tokenB := types.EthAddress(testBase), types.EthAddress(testQuote)
+	balance := func(block int, token types.EthAddress) tables.Balance {
+		return tables.Balance{Network: "test", Tx: testTxHash(block), Block: block, Time: block * 10,
+			User: testUser, Token: string(token)}
+	}
+
+	c.IngestBalance(balance(3, tokenB))
+	surplusB, _ := c.ctrl.cache.RetrieveUserSurplus(c.chainId, testUser, tokenB)
+	surplusB.Update(*big.NewInt(77), 30)
+
+	// The refresh for the orphaned row reads the balance from the orphaned block
+	c.IngestBalance(balance(10, tokenB))
+	surplusB.Update(*big.NewInt(99), 100)
+	c.IngestBalance(balance(10, tokenA))
+
+	c.RollbackToBlock(5)
+	c.ctrl.workers.flush()
+
+	if _, ok := c.ctrl.cache.RetrieveUserSurplus(c.chainId, testUser, tokenA); ok {
+		t.Fatal("Surplus added by the rolled back row wasn't removed")
+	}
+	restored, ok := c.ctrl.cache.RetrieveUserSurplus(c.chainId, testUser, tokenB)
+	if balance, refreshTime := restored.Read(); !ok || restored != surplusB || balance.Int64() != 77 || refreshTime != 30 {
+		t.Fatalf("Surplus not reverted to before the rolled back row: %v %d", balance, refreshTime)
+	}
+	if tokens := c.ctrl.cache.RetrieveUserBalances(c.chainId, testUser); len(tokens) != 1 || tokens[0] != tokenB {
+		t.Fatalf("Bad balance tokens after rollback %v", tokens)
+	}
+}
+
+func TestBalanceRefreshAfterStartupSync(t *testing.T) {
+	updates := make(chan IMsgType, 10)
+	c := &ControllerOverNetwork{
+		chainId: "0x1",
+		ctrl:    &Controller{cache: cache.New(), workers: &workers{omniUpdates: updates}},
+		journal: newReorgJournal(),
+	}
+	balance := tables.Balance{Network: "test", Tx: testTxHash(1), Block: 1, Time: 10, User: testUser, Token: testBase}
+
+	// Left to the refresh of every surplus once the sync is done
+	c.ctrl.cache.AddSyncingChain(c.chainId)
+	c.IngestBalance(balance)
+	if len(updates) != 0 {
+		t.Fatalf("Expected no refresh during the startup sync, got %d", len(updates))
+	}
+
+	c.ctrl.cache.SetStartupSynced(c.chainId)
+	c.IngestBalance(balance)
+	if len(updates) != 1 {
+		t.Fatalf("Expected a refresh after the startup sync, got %d", len(updates))
+	}
+	if msg, ok := (<-updates).(*surplusRefreshMsg); !ok || msg.user != testUser || msg.eventTime != 10 {
+		t.Fatalf("Expected a surplus refresh, got %+v", msg)
+	}
+}
+
+func TestLimitClaimIdsRemoved(t *testing.T) {
+	c := testNetworkController()
+	c.journal.setFloor(0)
+	pool := types.PoolLocation{ChainId: c.chainId, Base: testBase, Quote: testQuote, PoolIdx: 420}
+	loc := types.PositionLocation{PoolLocation: pool, LiquidityLocation: types.KnockoutRangeLocation(-64, 0, true),
+		User: testUser}
+	flow := 1000.0
+	knockoutChange := func(block int, changeType tables.ChangeType, pivotTime *int) tables.LiqChange {
+		return tables.LiqChange{Network: "test", TX: testTxHash(block), Block: block, Time: block * 10, Base: testBase,
+			Quote: testQuote, PoolIdx: 420, User: testUser, PositionType: tables.PosTypeKnockout, ChangeType: changeType,
+			BidTick: -64, AskTick: 0, IsBid: 1, BaseFlow: &flow, QuoteFlow: &flow, PivotTime: pivotTime}
+	}
+	isIndexed := func(pivotTime int) bool {
+		_, _, ok := c.ctrl.cache.RetrieveLimitById(loc.ToClaimLoc(pivotTime).Hash(nil))
+		return ok
+	}
+
+	// Both mints share the pivot of the first
+	pivotTime := 50
+	c.IngestLiqChange(knockoutChange(5, tables.ChangeTypeMint, nil))
+	c.IngestLiqChange(knockoutChange(8, tables.ChangeTypeMint, nil))
+	c.IngestKnockoutCross(tables.KnockoutCross{Network: "test", Tx: testTxHash(10), Block: 10, Time: 100,
+		Base: testBase, Quote: testQuote, PoolIdx: 420, Tick: -64, IsBid: 1, PivotTime: pivotTime})
+	c.IngestLiqChange(knockoutChange(12, tables.ChangeTypeClaim, &pivotTime))
+	// Mint at a new pivot after the cross
+	c.IngestLiqChange(knockoutChange(15, tables.ChangeTypeMint, nil))
+	c.FlushSyncCycle(15, &syncChannels{})
+	if isIndexed(pivotTime) || !isIndexed(150) {
+		t.Fatal("Expected only the new pivot's limit order indexed after the claim")
+	}
+
+	// The position still exists, so the lookup only fails if the ID was removed
+	c.RollbackToBlock(14)
+	if isIndexed(150) {
+		t.Fatal("Limit order ID outlived its rolled back mint")
+	}
+	c.RollbackToBlock(11)
+	if !isIndexed(pivotTime) {
+		t.Fatal("Rolled back claim didn't restore the limit order's ID")
+	}
+	c.RollbackToBlock(6)
+	if !isIndexed(pivotTime) {
+		t.Fatal("Limit order ID removed by rolling back a later mint")
+	}
+	c.ctrl.workers.flush()
+}
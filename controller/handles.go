@@ -4,8 +4,8 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
-	"log"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/CrocSwap/graphcache-go/loader"
@@ -17,7 +17,8 @@ type IRefreshHandle interface {
 	Hash(buf *bytes.Buffer) [32]byte
 	RefreshTime() int64
 	Skippable() bool
-	RefreshQuery(query *loader.ICrocQuery)
+	// Errors are returned as is, the RPC pool has already failed over between endpoints
+	RefreshQuery(query *loader.ICrocQuery) error
 	LabelTag() string
 }
 
@@ -46,93 +47,118 @@ type PoolInitPriceHandle struct {
 	Hist  *model.PoolTradingHistory
 }
 
+type SurplusRefreshHandle struct {
+	chainId types.ChainId
+	user    types.EthAddress
+	token   types.EthAddress
+	surplus *model.SurplusBalance
+}
+
 type BumpRefreshHandle struct {
 	pool  types.PoolLocation
 	tick  int
 	curve *model.LiquidityCurve
 	bump  *model.LiquidityBump
+	lock  *sync.RWMutex
 }
 
-func (p *PositionRefreshHandle) RefreshQuery(query *loader.ICrocQuery) {
+func (p *PositionRefreshHandle) RefreshQuery(query *loader.ICrocQuery) error {
 	posType := types.PositionTypeForLiq(p.location.LiquidityLocation)
 
 	if posType == "ambient" {
-		liqFn := func() (*big.Int, error) { return (*query).QueryAmbientLiq(p.location) }
-		ambientLiq, _ := tryQueryAttempt(liqFn, "ambientLiq", N_MAX_RETRIES, true)
+		ambientLiq, err := (*query).QueryAmbientLiq(p.location)
+		if err != nil {
+			return err
+		}
 		p.pos.UpdateAmbient(*ambientLiq)
 	}
 
 	if posType == "range" {
-		liqFn := func() (*big.Int, error) { return (*query).QueryRangeLiquidity(p.location) }
-		rewardFn := func() (*big.Int, error) { return (*query).QueryRangeRewardsLiq(p.location) }
-		concLiq, _ := tryQueryAttempt(liqFn, "rangeLiq", N_MAX_RETRIES, true)
-		rewardLiq, _ := tryQueryAttempt(rewardFn, "rangeRewards", N_MAX_RETRIES, true)
+		concLiq, err := (*query).QueryRangeLiquidity(p.location)
+		if err != nil {
+			return err
+		}
+		rewardLiq, err := (*query).QueryRangeRewardsLiq(p.location)
+		if err != nil {
+			return err
+		}
 		p.pos.UpdateRange(*concLiq, *rewardLiq)
 	}
+	return nil
 }
 
-func (p *RewardsRefreshHandle) RefreshQuery(query *loader.ICrocQuery) {
+func (p *RewardsRefreshHandle) RefreshQuery(query *loader.ICrocQuery) error {
 	posType := types.PositionTypeForLiq(p.location.LiquidityLocation)
 
 	if posType == "range" {
-		rewardFn := func() (*big.Int, error) { return (*query).QueryRangeRewardsLiq(p.location) }
-		rewardLiq, _ := tryQueryAttempt(rewardFn, "rangeRewards", N_MAX_RETRIES, true)
+		rewardLiq, err := (*query).QueryRangeRewardsLiq(p.location)
+		if err != nil {
+			return err
+		}
 		p.pos.UpdateRangeRewards(*rewardLiq)
 	}
+	return nil
 }
 
-func (p *KnockoutAliveHandle) RefreshQuery(query *loader.ICrocQuery) {
-	pivotTimeFn := func() (uint32, error) { return (*query).QueryKnockoutPivot(p.location) }
-	pivotTime, _ := tryQueryAttempt(pivotTimeFn, "pivotTimeLatest", N_MAX_RETRIES, true)
+func (p *KnockoutAliveHandle) RefreshQuery(query *loader.ICrocQuery) error {
+	pivotTime, err := (*query).QueryKnockoutPivot(p.location)
+	if err != nil {
+		return err
+	}
 
 	if pivotTime == 0 {
 		p.pos.Liq.UpdateActiveLiq(*big.NewInt(0), time.Now().Unix())
 
 	} else {
 		claimLoc := types.KOClaimLocation{PositionLocation: p.location, PivotTime: int(pivotTime)}
-		liqFn := func() (loader.KnockoutLiqResp, error) { return (*query).QueryKnockoutLiq(claimLoc) }
-		koLiqResp, _ := tryQueryAttempt(liqFn, "knockoutLiq", N_MAX_RETRIES, true)
+		koLiqResp, err := (*query).QueryKnockoutLiq(claimLoc)
+		if err != nil {
+			return err
+		}
 		p.pos.Liq.UpdateActiveLiq(*koLiqResp.Liq, time.Now().Unix())
 	}
+	return nil
 }
 
-func (p *KnockoutPostHandle) RefreshQuery(query *loader.ICrocQuery) {
-	liqFn := func() (loader.KnockoutLiqResp, error) { return (*query).QueryKnockoutLiq(p.location) }
-	koLiqResp, _ := tryQueryAttempt(liqFn, "knockoutLiq", N_MAX_RETRIES, true)
+func (p *KnockoutPostHandle) RefreshQuery(query *loader.ICrocQuery) error {
+	koLiqResp, err := (*query).QueryKnockoutLiq(p.location)
+	if err != nil {
+		return err
+	}
 	if koLiqResp.KnockedOut {
 		p.pos.Liq.UpdatePostKOLiq(p.location.PivotTime, *koLiqResp.Liq, time.Now().Unix())
 	}
+	return nil
 }
 
-func (p *PoolInitPriceHandle) RefreshQuery(query *loader.ICrocQuery) {
+func (p *PoolInitPriceHandle) RefreshQuery(query *loader.ICrocQuery) error {
 	// priceFn := func() (*big.Int, error) { return (*query).QueryPoolPrice(p.Pool) }
+	return nil
 }
 
-func (p *BumpRefreshHandle) RefreshQuery(query *loader.ICrocQuery) {
-	refreshFn := func() (loader.LevelResp, error) { return (*query).QueryLevel(p.pool, p.tick) }
-	levelResp, _ := tryQueryAttempt(refreshFn, "bumpRefresh", N_MAX_RETRIES, false)
+func (p *BumpRefreshHandle) RefreshQuery(query *loader.ICrocQuery) error {
+	levelResp, err := (*query).QueryLevel(p.pool, p.tick)
+	if err != nil {
+		return err
+	}
 	askLiq := big.NewInt(0).Mul(levelResp.AskLots, big.NewInt(1024))
 	bidLiq := big.NewInt(0).Mul(levelResp.BidLots, big.NewInt(1024))
 	delta := big.NewInt(0).Sub(bidLiq, askLiq)
 	deltaF64, _ := delta.Float64()
+	// Bumps are guarded by their curve's lock in the cache
+	p.lock.Lock()
 	p.bump.LiquidityDelta = deltaF64
+	p.lock.Unlock()
+	return nil
 }
 
-func tryQueryAttempt[T any](queryFn func() (T, error), label string, nAttempts int, fatal bool) (result T, err error) {
-	result, err = queryFn()
-	for retryCount := 0; err != nil && retryCount < nAttempts; retryCount += 1 {
-		log.Printf("Query attempt %d/%d failed for \"%s\" with err: \"%s\"", retryCount, nAttempts, label, err)
-		retryWaitRandom()
-		result, err = queryFn()
-	}
+func (p *SurplusRefreshHandle) RefreshQuery(query *loader.ICrocQuery) error {
+	surplus, err := (*query).QuerySurplus(p.chainId, p.user, p.token)
 	if err != nil {
-		if fatal {
-			log.Fatalf("Unable to query \"%s\", err: %s", label, err)
-		} else {
-			log.Printf("Unable to query \"%s\", err: %s, giving up", label, err)
-		}
+		return err
 	}
-	return
+	p.surplus.Update(*surplus, time.Now().Unix())
+	return nil
 }
 
 func (p *PositionRefreshHandle) LabelTag() string {
@@ -155,6 +181,10 @@ func (p *PoolInitPriceHandle) LabelTag() string {
 	return "poolInitPrice"
 }
 
+func (p *SurplusRefreshHandle) LabelTag() string {
+	return "surplus"
+}
+
 func (p *BumpRefreshHandle) LabelTag() string {
 	return "bumpRefresh"
 }
@@ -179,6 +209,10 @@ func (p *PoolInitPriceHandle) RefreshTime() int64 {
 	return 0
 }
 
+func (p *SurplusRefreshHandle) RefreshTime() int64 {
+	return p.surplus.LastRefreshTime()
+}
+
 func (p *BumpRefreshHandle) RefreshTime() int64 {
 	return 0
 }
@@ -209,6 +243,21 @@ func (p *PoolInitPriceHandle) Hash(buf *bytes.Buffer) [32]byte {
 	return p.Pool.Hash(buf)
 }
 
+func (p *SurplusRefreshHandle) Hash(buf *bytes.Buffer) [32]byte {
+	if buf == nil {
+		buf = new(bytes.Buffer)
+		buf.Grow(100)
+	} else {
+		buf.Reset()
+	}
+	// Prefixed so the hash can't collide with any other handle type
+	buf.WriteString("surplus")
+	buf.WriteString(string(p.chainId))
+	buf.WriteString(string(p.user))
+	buf.WriteString(string(p.token))
+	return sha256.Sum256(buf.Bytes())
+}
+
 func (p *BumpRefreshHandle) Hash(buf *bytes.Buffer) [32]byte {
 	if buf == nil {
 		buf = new(bytes.Buffer)
@@ -244,6 +293,10 @@ func (p *PoolInitPriceHandle) Skippable() bool {
 	return false
 }
 
+func (p *SurplusRefreshHandle) Skippable() bool {
+	return false
+}
+
 func (p *BumpRefreshHandle) Skippable() bool {
 	return false
 }
@@ -7,7 +7,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/CrocSwap/graphcache-go/cache"
 	"github.com/CrocSwap/graphcache-go/loader"
+	"github.com/CrocSwap/graphcache-go/metrics"
 )
 
 type LiquidityRefresher struct {
@@ -20,11 +22,15 @@ type LiquidityRefresher struct {
 	// if it is read from the workSlow queue). If urgent wasn't stored then there could have been a
 	// situation where an urgent refresh would be ignored because there was a slow refresh pending.
 	pending        map[[32]byte]bool
+	retries        map[[32]byte]int
 	pendingLock    sync.Mutex
 	postProcess    chan string
 	query          *loader.ICrocQuery
 	lastRefreshSec int64
 	paused         bool
+	// Wait before a failed refresh is requeued, and the requeues still waiting
+	retryDelay func() time.Duration
+	retrying   sync.WaitGroup
 }
 
 const NUM_PARALLEL_WORKERS = 200 // Should be higher than multicall_max_batch for the given chain
@@ -37,12 +43,23 @@ func NewLiquidityRefresher(query *loader.ICrocQuery) *LiquidityRefresher {
 		workUrgent:  make(chan IRefreshHandle, URGENT_QUEUE_SIZE),
 		workSlow:    make(chan IRefreshHandle, SLOW_QUEUE_SIZE),
 		pending:     make(map[[32]byte]bool),
+		retries:     make(map[[32]byte]int),
 		pendingLock: sync.Mutex{},
 		query:       query,
 		postProcess: make(chan string),
 		paused:      false,
+		retryDelay:  retryDelayRandom,
 	}
 
+	metrics.RegisterRefreshQueues(
+		func() int { return len(liqRefresher.workUrgent) },
+		func() int { return len(liqRefresher.workSlow) },
+		func() int {
+			liqRefresher.pendingLock.Lock()
+			defer liqRefresher.pendingLock.Unlock()
+			return len(liqRefresher.pending)
+		})
+
 	go liqRefresher.watchPostProcess()
 	for idx := 0; idx < NUM_PARALLEL_WORKERS; idx += 1 {
 		go liqRefresher.watchWork()
@@ -111,15 +128,45 @@ func (lr *LiquidityRefresher) pushFollowup(hndl IRefreshHandle) {
 const RETRY_QUERY_MIN_WAIT = 10
 const RETRY_QUERY_MAX_WAIT = 60
 
-// Should be high because temporary RPC issues should not cause a crash,
-// especially since running without RPC data isn't that bad these days.
+// Should be high because temporary RPC issues should not lose a refresh, especially since
+// the retries wait in the background without holding a worker.
 const N_MAX_RETRIES = 500
 
 // Do this so that in case the problem is overloading the RPC, calls don't all spam again
 // at same deterministic time
-func retryWaitRandom() {
+func retryDelayRandom() time.Duration {
 	waitTime := rand.Intn(RETRY_QUERY_MAX_WAIT-RETRY_QUERY_MIN_WAIT) + RETRY_QUERY_MIN_WAIT
-	time.Sleep(time.Duration(waitTime) * time.Second)
+	return time.Duration(waitTime) * time.Second
+}
+
+// Requeues a failed refresh on the slow queue after a random wait. The RPC pool has already
+// tried the other endpoints, so this is for outages on every endpoint.
+func (lr *LiquidityRefresher) retryFailed(hndl IRefreshHandle, hash [32]byte, err error) {
+	lr.pendingLock.Lock()
+	lr.retries[hash] += 1
+	retryCount := lr.retries[hash]
+	if retryCount > N_MAX_RETRIES {
+		delete(lr.retries, hash)
+	}
+	lr.pendingLock.Unlock()
+
+	if retryCount > N_MAX_RETRIES {
+		log.Printf("Unable to refresh \"%s\", err: %s, giving up", hndl.LabelTag(), err)
+		return
+	}
+	log.Printf("Refresh attempt %d/%d failed for \"%s\" with err: \"%s\"", retryCount, N_MAX_RETRIES, hndl.LabelTag(), err)
+	lr.retrying.Add(1)
+	go func() {
+		defer lr.retrying.Done()
+		time.Sleep(lr.retryDelay())
+		lr.requestRefresh(hndl, false)
+	}()
+}
+
+func (lr *LiquidityRefresher) clearRetries(hash [32]byte) {
+	lr.pendingLock.Lock()
+	defer lr.pendingLock.Unlock()
+	delete(lr.retries, hash)
 }
 
 func (lr *LiquidityRefresher) watchWork() {
@@ -162,11 +209,16 @@ func (lr *LiquidityRefresher) watchWork() {
 		lr.pendingLock.Unlock()
 
 		hndlPending = true
-		hndl.RefreshQuery(lr.query)
+		err := hndl.RefreshQuery(lr.query)
 		lr.pendingLock.Lock()
 		delete(lr.pending, hash)
 		hndlPending = false
 		lr.pendingLock.Unlock()
+		if err != nil {
+			lr.retryFailed(hndl, hash, err)
+		} else {
+			lr.clearRetries(hash)
+		}
 		lr.postProcess <- hndl.LabelTag()
 
 		nowSec := time.Now().Unix()
@@ -198,6 +250,16 @@ func (lr *LiquidityRefresher) watchPostProcess() {
 	}
 }
 
+func (lr *LiquidityRefresher) backlog() cache.RefreshBacklog {
+	lr.pendingLock.Lock()
+	defer lr.pendingLock.Unlock()
+	return cache.RefreshBacklog{
+		Urgent:  len(lr.workUrgent),
+		Slow:    len(lr.workSlow),
+		Pending: len(lr.pending),
+	}
+}
+
 func (lr *LiquidityRefresher) SetPause(pause bool) {
 	log.Printf("Liquidity refresher pause=%v", pause)
 	lr.paused = pause
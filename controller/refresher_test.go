@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/loader"
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+// Stands in for an RPC pool with every endpoint down
+type failingQuery struct {
+	loader.NonCrocQuery
+}
+
+var errRpcDown = errors.New("all endpoints down")
+
+func (q *failingQuery) QueryRangeLiquidity(pos types.PositionLocation) (*big.Int, error) {
+	return nil, errRpcDown
+}
+
+func (q *failingQuery) QueryLevel(pool types.PoolLocation, tick int) (loader.LevelResp, error) {
+	return loader.LevelResp{}, errRpcDown
+}
+
+func TestRefreshQueryReturnsError(t *testing.T) {
+	var query loader.ICrocQuery = &failingQuery{}
+	pos := &model.PositionTracker{}
+	pos.ConcLiq.SetInt64(500)
+	loc := types.PositionLocation{LiquidityLocation: types.RangeLiquidityLocation(-100, 100)}
+
+	posHandle := &PositionRefreshHandle{location: loc, pos: pos}
+	if err := posHandle.RefreshQuery(&query); !errors.Is(err, errRpcDown) {
+		t.Fatalf("Expected the query error, got %v", err)
+	}
+	if pos.ConcLiq.Int64() != 500 || pos.RefreshTime != 0 {
+		t.Fatalf("Failed refresh updated the position %+v", pos)
+	}
+
+	bump := &model.LiquidityBump{LiquidityDelta: 7}
+	bumpHandle := &BumpRefreshHandle{bump: bump}
+	if err := bumpHandle.RefreshQuery(&query); !errors.Is(err, errRpcDown) {
+		t.Fatalf("Expected the query error, got %v", err)
+	}
+	if bump.LiquidityDelta != 7 {
+		t.Fatalf("Failed refresh updated the bump %+v", bump)
+	}
+}
+
+func TestRefreshRetriesBounded(t *testing.T) {
+	// Paused so the requeues are dropped
+	lr := &LiquidityRefresher{
+		pending:    make(map[[32]byte]bool),
+		retries:    make(map[[32]byte]int),
+		paused:     true,
+		retryDelay: func() time.Duration { return 0 },
+	}
+	defer lr.retrying.Wait()
+	// Every attempt is logged
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	hndl := &PositionRefreshHandle{pos: &model.PositionTracker{}}
+	hash := hndl.Hash(nil)
+
+	for i := 0; i < N_MAX_RETRIES; i++ {
+		lr.retryFailed(hndl, hash, errRpcDown)
+	}
+	if lr.retries[hash] != N_MAX_RETRIES {
+		t.Fatalf("Bad retry count %d", lr.retries[hash])
+	}
+	lr.retryFailed(hndl, hash, errRpcDown)
+	if _, ok := lr.retries[hash]; ok {
+		t.Fatal("Refresh not given up after max retries")
+	}
+
+	lr.retryFailed(hndl, hash, errRpcDown)
+	lr.clearRetries(hash)
+	if _, ok := lr.retries[hash]; ok {
+		t.Fatal("Retries not cleared after a successful refresh")
+	}
+}
@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"log"
+	"math"
+	"sync"
+
+	"github.com/CrocSwap/graphcache-go/metrics"
+)
+
+// Rows within this many blocks of the head are journaled so they can be undone if the
+// chain reorgs. Reorgs deeper than this can't be fully rolled back.
+const REORG_WINDOW_BLOCKS = 256
+
+// Undo log of the effects of recently ingested rows on a single chain. Each ingested row
+// records a closure that reverses its effect on the cache. Safe for concurrent use,
+// because the normal subgraph syncer ingests tables in parallel.
+type reorgJournal struct {
+	floor   int
+	entries []reorgUndo
+	lock    sync.Mutex
+}
+
+type reorgUndo struct {
+	block int
+	undo  func()
+}
+
+// Nothing is journaled until the syncer sets a floor, so rows loaded from the startup
+// cache aren't kept around.
+func newReorgJournal() *reorgJournal {
+	return &reorgJournal{floor: math.MaxInt}
+}
+
+func (j *reorgJournal) record(block int, undo func()) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if block > j.floor {
+		j.entries = append(j.entries, reorgUndo{block, undo})
+	}
+}
+
+// Rows at or below the floor are considered final and their undo entries are dropped
+func (j *reorgJournal) setFloor(block int) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.floor = block
+	kept := j.entries[:0]
+	for _, entry := range j.entries {
+		if entry.block > block {
+			kept = append(kept, entry)
+		}
+	}
+	clear(j.entries[len(kept):])
+	j.entries = kept
+}
+
+// Undoes every row after the fork block, in reverse order of ingestion. Rows at or
+// before the fork that were ingested later (tables sync independently) are kept. The undos
+// are run after releasing the lock, because some block on the worker channels.
+func (j *reorgJournal) rollback(forkBlock int) int {
+	j.lock.Lock()
+	undone := make([]reorgUndo, 0)
+	kept := make([]reorgUndo, 0, len(j.entries))
+	for _, entry := range j.entries {
+		if entry.block > forkBlock {
+			undone = append(undone, entry)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	j.entries = kept
+	j.lock.Unlock()
+
+	for i := len(undone) - 1; i >= 0; i-- {
+		undone[i].undo()
+	}
+	return len(undone)
+}
+
+// Tracks the block hashes seen at the head of a sync source on recent polls. If the source
+// later reports a different hash for one of those blocks, the chain reorged underneath us.
+type reorgTracker struct {
+	heads  []blockHead
+	hashAt func(block int) (string, error)
+}
+
+type blockHead struct {
+	block int
+	hash  string
+}
+
+func newReorgTracker(hashAt func(block int) (string, error)) *reorgTracker {
+	return &reorgTracker{hashAt: hashAt}
+}
+
+func (t *reorgTracker) observe(block int, hash string) {
+	if hash == "" {
+		return
+	}
+	if len(t.heads) > 0 && t.heads[len(t.heads)-1].block >= block {
+		return
+	}
+	t.heads = append(t.heads, blockHead{block, hash})
+
+	i := 0
+	for i < len(t.heads) && t.heads[i].block <= block-REORG_WINDOW_BLOCKS {
+		i++
+	}
+	t.heads = t.heads[i:]
+}
+
+// Compares the recorded heads against the source's current head. Returns the last block
+// that's still canonical if the chain forked. If the source is behind the latest recorded
+// head, the check waits until it catches back up.
+func (t *reorgTracker) checkFork(headBlock int, headHash string) (forkBlock int, isFork bool, err error) {
+	if len(t.heads) == 0 || t.heads[len(t.heads)-1].block > headBlock {
+		return 0, false, nil
+	}
+
+	for i := len(t.heads) - 1; i >= 0; i-- {
+		recorded := t.heads[i]
+		hash := headHash
+		if recorded.block != headBlock {
+			hash, err = t.hashAt(recorded.block)
+			if err != nil {
+				return 0, false, err
+			}
+		}
+
+		if hash == recorded.hash {
+			isFork = i < len(t.heads)-1
+			t.heads = t.heads[:i+1]
+			return recorded.block, isFork, nil
+		}
+	}
+
+	forkBlock = t.heads[0].block - 1
+	log.Printf("Warning reorg deeper than all tracked heads. Rolling back to block %d", forkBlock)
+	t.heads = t.heads[:0]
+	return forkBlock, true, nil
+}
+
+// Called by the syncers on every poll with the current head of their source
+func (c *ControllerOverNetwork) SetReorgFloor(headBlock int) {
+	c.journal.setFloor(headBlock - REORG_WINDOW_BLOCKS)
+}
+
+// Undoes all rows ingested after the fork block. The syncer is responsible for rewinding
+// its channels so that the canonical rows are re-ingested.
+func (c *ControllerOverNetwork) RollbackToBlock(forkBlock int) {
+	c.dropCrossesAfter(forkBlock)
+	nUndone := c.journal.rollback(forkBlock)
+	c.ctrl.cache.ResyncTxSubscriptions(c.chainId)
+	log.Printf("Rolled back %d rows after block %d on chainId=%s", nUndone, forkBlock, c.chainId)
+}
+
+func (s *syncChannels) setReorgFloor(headBlock int) {
+	floor := headBlock - REORG_WINDOW_BLOCKS
+	s.bal.SetReorgFloor(floor)
+	s.liq.SetReorgFloor(floor)
+	s.swaps.SetReorgFloor(floor)
+	s.fees.SetReorgFloor(floor)
+	s.aggs.SetReorgFloor(floor)
+	s.ko.SetReorgFloor(floor)
+}
+
+func (s *syncChannels) rollback(forkBlock int) {
+	s.bal.Rollback(forkBlock)
+	s.liq.Rollback(forkBlock)
+	s.swaps.Rollback(forkBlock)
+	s.fees.Rollback(forkBlock)
+	s.aggs.Rollback(forkBlock)
+	s.ko.Rollback(forkBlock)
+}
+
+// Checks the head reported by a syncer's source for a reorg, and rolls back the rows and
+// channel IDs after the fork. Returns the fork block when the syncer needs to rewind.
+// Otherwise the head is recorded and rows from the next sync are journaled.
+func (c *ControllerOverNetwork) checkReorg(tracker *reorgTracker, channels *syncChannels, headBlock int, headHash string) (forkBlock int, isFork bool) {
+	metrics.SetHeadBlock(string(c.chainId), headBlock)
+	c.ctrl.cache.SetHeadBlock(c.chainId, headBlock)
+	c.headBlock = headBlock
+	forkBlock, isFork, err := tracker.checkFork(headBlock, headHash)
+	if err != nil {
+		log.Println("Warning unable to check for reorg:", err.Error())
+		return 0, false
+	}
+
+	if isFork {
+		log.Printf("Reorg detected on chainId=%s at block %d. Head is now %d", c.chainId, forkBlock, headBlock)
+		c.RollbackToBlock(forkBlock)
+		c.discardPendingSnapshot(forkBlock)
+		channels.rollback(forkBlock)
+		return forkBlock, true
+	}
+
+	tracker.observe(headBlock, headHash)
+	c.SetReorgFloor(headBlock)
+	channels.setReorgFloor(headBlock)
+	return 0, false
+}
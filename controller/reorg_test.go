@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestJournalRollback(t *testing.T) {
+	j := newReorgJournal()
+	j.setFloor(0)
+	undone := make([]int, 0)
+	for _, block := range []int{5, 2, 8, 3} {
+		j.record(block, func() { undone = append(undone, block) })
+	}
+
+	// Stands in for an undo blocked on a worker channel, while the worker ingests more rows
+	j.record(6, func() {
+		recorded := make(chan struct{})
+		go func() {
+			j.record(1, func() {})
+			close(recorded)
+		}()
+		select {
+		case <-recorded:
+		case <-time.After(time.Second):
+			t.Error("Ingest blocked behind the rollback")
+		}
+	})
+
+	if n := j.rollback(3); n != 3 || !slices.Equal(undone, []int{8, 5}) {
+		t.Fatalf("Expected the rows after the fork undone newest first, got %d %v", n, undone)
+	}
+	blocks := make([]int, 0)
+	for _, entry := range j.entries {
+		blocks = append(blocks, entry.block)
+	}
+	if !slices.Equal(blocks, []int{2, 3, 1}) {
+		t.Fatalf("Expected the rows up to the fork kept, got %v", blocks)
+	}
+}
@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/loader"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+// Bumped whenever the snapshot layout changes, so that stale snapshots are ignored
+const SNAPSHOT_VERSION = 5
+
+// Position of a syncer's tables when the snapshot was taken. Ids are the rows that the
+// resumed sync may return again, by table name. Decoder is the log decoder's pool state,
+// only set by the log syncer.
+type syncSnapshot struct {
+	Blocks  loader.SubgraphStartBlocks
+	Ids     map[string][]string
+	Decoder *loader.DexLogState
+}
+
+type snapshotFile struct {
+	Version int
+	Sync    syncSnapshot
+	Cache   *cache.ChainSnapshot
+}
+
+// Implemented by the syncers so the controller can save and restore their position
+type snapshotSyncer interface {
+	SubgraphSyncer
+	syncState() syncSnapshot
+	restoreSyncState(state syncSnapshot)
+}
+
+// Periodically writes each chain's cache state to the directory, and restores it on
+// startup instead of replaying the full event history. Must be called before the syncers
+// are created.
+func (c *Controller) EnableSnapshots(dir string, interval time.Duration) {
+	c.snapshotDir = dir
+	c.snapshotInterval = interval
+}
+
+func snapshotPath(dir string, chainId types.ChainId) string {
+	return filepath.Join(dir, fmt.Sprintf("snapshot_%s.gob.gz", chainId))
+}
+
+// Called by the syncers while they're idle between polls
+func (c *ControllerOverNetwork) maybeSnapshot(syncer snapshotSyncer) {
+	if c.ctrl.snapshotDir == "" {
+		return
+	}
+	c.publishSnapshot()
+	if c.hasPending || time.Since(c.lastSnapshot) < c.ctrl.snapshotInterval {
+		return
+	}
+	c.lastSnapshot = time.Now()
+	if c.writeSnapshot(syncer.syncState()) {
+		c.hasPending = true
+		c.pendingBlock = c.headBlock
+	}
+}
+
+// Snapshots are written to a pending file, and only replace the one restored on startup
+// once the head has moved past the reorg window. Rows restored from a snapshot have no
+// undo entries in the reorg journal, so it must only contain blocks that are final.
+func (c *ControllerOverNetwork) publishSnapshot() {
+	if !c.hasPending || c.headBlock-REORG_WINDOW_BLOCKS < c.pendingBlock {
+		return
+	}
+	c.hasPending = false
+	path := snapshotPath(c.ctrl.snapshotDir, c.chainId)
+	if err := os.Rename(pendingSnapshotPath(path), path); err != nil {
+		log.Println("Warning unable to publish state snapshot:", err.Error())
+		return
+	}
+	log.Printf("Published state snapshot on chainId=%s taken at block %d", c.chainId, c.pendingBlock)
+}
+
+// A reorg below the head when the pending snapshot was taken means it has orphaned rows
+func (c *ControllerOverNetwork) discardPendingSnapshot(forkBlock int) {
+	if !c.hasPending || forkBlock >= c.pendingBlock {
+		return
+	}
+	c.hasPending = false
+	os.Remove(pendingSnapshotPath(snapshotPath(c.ctrl.snapshotDir, c.chainId)))
+	log.Printf("Discarded pending state snapshot on chainId=%s after reorg at block %d", c.chainId, forkBlock)
+}
+
+func pendingSnapshotPath(path string) string {
+	return path + ".pending"
+}
+
+func (c *ControllerOverNetwork) writeSnapshot(state syncSnapshot) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("Warning: panic during state snapshot:", r)
+			log.Println(string(debug.Stack()))
+			ok = false
+		}
+	}()
+
+	snap := snapshotFile{
+		Version: SNAPSHOT_VERSION,
+		Sync:    state,
+	}
+	// Position updates are applied by the worker, so the state is copied there once the
+	// ingested rows have gone through
+	c.ctrl.workers.runInSeq(func() {
+		snap.Cache = c.ctrl.cache.SnapshotChain(c.chainId)
+	})
+
+	path := pendingSnapshotPath(snapshotPath(c.ctrl.snapshotDir, c.chainId))
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		log.Println("Warning unable to create state snapshot:", err.Error())
+		return false
+	}
+	zipper := gzip.NewWriter(file)
+	err = gob.NewEncoder(zipper).Encode(&snap)
+	if err == nil {
+		err = zipper.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		log.Println("Warning unable to write state snapshot:", err.Error())
+		os.Remove(tmpPath)
+		return false
+	}
+	log.Printf("Wrote state snapshot on chainId=%s to %s", c.chainId, path)
+	return true
+}
+
+// Restores the chain's cache and the syncer's position from the latest snapshot. Returns
+// false if there's no usable snapshot, in which case the syncer starts from scratch.
+func (c *ControllerOverNetwork) loadSnapshot(syncer snapshotSyncer) bool {
+	if c.ctrl.snapshotDir == "" {
+		return false
+	}
+	path := snapshotPath(c.ctrl.snapshotDir, c.chainId)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		log.Printf("No state snapshot for chainId=%s at %s", c.chainId, path)
+		return false
+	} else if err != nil {
+		log.Println("Warning unable to open state snapshot:", err.Error())
+		return false
+	}
+	defer file.Close()
+
+	unzipper, err := gzip.NewReader(file)
+	if err != nil {
+		log.Println("Warning unable to read state snapshot:", err.Error())
+		return false
+	}
+	var snap snapshotFile
+	if err := gob.NewDecoder(unzipper).Decode(&snap); err != nil {
+		log.Println("Warning unable to decode state snapshot:", err.Error())
+		return false
+	}
+	if snap.Version != SNAPSHOT_VERSION || snap.Cache == nil || snap.Cache.ChainId != c.chainId {
+		log.Printf("Warning ignoring incompatible state snapshot at %s", path)
+		return false
+	}
+
+	c.ctrl.cache.RestoreChain(snap.Cache)
+	syncer.restoreSyncState(snap.Sync)
+	c.lastSnapshot = time.Now()
+	log.Printf("Restored state snapshot on chainId=%s. Resuming at blocks %+v", c.chainId, snap.Sync.Blocks)
+	return true
+}
+
+func (s *syncChannels) resumeIds() map[string][]string {
+	return map[string][]string{
+		"swaps":            s.swaps.ResumeIds(),
+		"aggEvents":        s.aggs.ResumeIds(),
+		"liquidityChanges": s.liq.ResumeIds(),
+		"feeChanges":       s.fees.ResumeIds(),
+		"userBalances":     s.bal.ResumeIds(),
+		"knockoutCrosses":  s.ko.ResumeIds(),
+	}
+}
+
+func (s *syncChannels) markObserved(ids map[string][]string) {
+	s.swaps.MarkObserved(ids["swaps"])
+	s.aggs.MarkObserved(ids["aggEvents"])
+	s.liq.MarkObserved(ids["liquidityChanges"])
+	s.fees.MarkObserved(ids["feeChanges"])
+	s.bal.MarkObserved(ids["userBalances"])
+	s.ko.MarkObserved(ids["knockoutCrosses"])
+}
+
+func (s *NormalSubgraphSyncer) syncState() syncSnapshot {
+	// Resume from the lookback block, so the last window is still synced a second time
+	block := s.lookbackBlocks
+	return syncSnapshot{
+		Blocks: loader.SubgraphStartBlocks{Swaps: block, Aggs: block, Bal: block, Fee: block, Ko: block, Liq: block},
+		Ids:    s.channels.resumeIds(),
+	}
+}
+
+func (s *NormalSubgraphSyncer) restoreSyncState(state syncSnapshot) {
+	s.lookbackBlocks = state.Blocks.Liq
+	s.lastSyncBlock = state.Blocks.Liq
+	s.channels.markObserved(state.Ids)
+}
+
+func (s *CombinedSubgraphSyncer) syncState() syncSnapshot {
+	return syncSnapshot{
+		Blocks: s.lastBlocks,
+		Ids:    s.channels.resumeIds(),
+	}
+}
+
+func (s *CombinedSubgraphSyncer) restoreSyncState(state syncSnapshot) {
+	s.lastBlocks = state.Blocks
+	s.channels.markObserved(state.Ids)
+}
+
+func (s *LogSyncer) syncState() syncSnapshot {
+	block := s.nextBlock - 1
+	decoder := s.source.State()
+	return syncSnapshot{
+		Blocks:  loader.SubgraphStartBlocks{Swaps: block, Aggs: block, Bal: block, Fee: block, Ko: block, Liq: block},
+		Ids:     s.channels.resumeIds(),
+		Decoder: &decoder,
+	}
+}
+
+func (s *LogSyncer) restoreSyncState(state syncSnapshot) {
+	s.startBlocks = loader.SubgraphStartBlocks{}
+	s.nextBlock = state.Blocks.Liq + 1
+	s.channels.markObserved(state.Ids)
+	if state.Decoder != nil {
+		s.source.RestoreState(*state.Decoder)
+	}
+}
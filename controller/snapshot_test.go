@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPendingSnapshotPublishedWhenFinal(t *testing.T) {
+	c := &ControllerOverNetwork{chainId: "0x1", ctrl: &Controller{snapshotDir: t.TempDir()}}
+	path := snapshotPath(c.ctrl.snapshotDir, c.chainId)
+
+	writePending := func(headBlock int) {
+		if err := os.WriteFile(pendingSnapshotPath(path), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		c.headBlock, c.pendingBlock, c.hasPending = headBlock, headBlock, true
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	writePending(1000)
+	c.headBlock = 1000 + REORG_WINDOW_BLOCKS - 1
+	c.publishSnapshot()
+	if exists(path) || !c.hasPending {
+		t.Fatal("Snapshot published while still inside the reorg window")
+	}
+
+	c.headBlock = 1000 + REORG_WINDOW_BLOCKS
+	c.publishSnapshot()
+	if !exists(path) || exists(pendingSnapshotPath(path)) || c.hasPending {
+		t.Fatal("Snapshot not published once final")
+	}
+
+	// Reorgs after the snapshot's head leave it intact, earlier ones discard it
+	writePending(2000)
+	c.discardPendingSnapshot(2000)
+	if !c.hasPending {
+		t.Fatal("Pending snapshot discarded by reorg after its head")
+	}
+	c.discardPendingSnapshot(1999)
+	if c.hasPending || exists(pendingSnapshotPath(path)) {
+		t.Fatal("Pending snapshot kept after reorg below its head")
+	}
+}
@@ -36,6 +36,7 @@ func LoadStartupCache(startupCacheSource string, syncer SubgraphSyncer) {
 		"liquidityChanges": &lastBlocks.Liq,
 		"feeChanges":       &lastBlocks.Fee,
 		"userBalances":     &lastBlocks.Bal,
+		"knockoutCrosses":  &lastBlocks.Ko,
 	}
 
 	maxBlock := 0 // just for visual output
@@ -56,8 +57,16 @@ func LoadStartupCache(startupCacheSource string, syncer SubgraphSyncer) {
 		}
 	}
 
-	// To prevent slowdown due to sorting when inserting into TX history, we interleave chunks from each table
+	// To prevent slowdown due to sorting when inserting into TX history, we interleave chunks from each table.
+	// Knockout crosses are held until the liq changes pass them, so they're all loaded first.
 	slices.SortFunc(allChunks, func(i, j string) int {
+		iIsKo, jIsKo := strings.HasPrefix(i, "knockoutCrosses_"), strings.HasPrefix(j, "knockoutCrosses_")
+		if iIsKo != jIsKo {
+			if iIsKo {
+				return -1
+			}
+			return 1
+		}
 		iBlockStr := strings.Split(strings.Split(i, "_")[1], "-")[0]
 		iBlock, _ := strconv.Atoi(iBlockStr)
 		jBlockStr := strings.Split(strings.Split(j, "_")[1], "-")[0]
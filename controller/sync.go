@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/CrocSwap/graphcache-go/cache"
 	"github.com/CrocSwap/graphcache-go/loader"
 	"github.com/CrocSwap/graphcache-go/tables"
 	"github.com/CrocSwap/graphcache-go/types"
@@ -27,6 +28,7 @@ type NormalSubgraphSyncer struct {
 	lookbackBlocks int
 	channels       syncChannels
 	startBlocks    loader.SubgraphStartBlocks
+	reorgs         *reorgTracker
 }
 
 type syncChannels struct {
@@ -35,6 +37,7 @@ type syncChannels struct {
 	swaps loader.SyncChannel[tables.Swap, tables.SwapSubGraph]
 	fees  loader.SyncChannel[tables.FeeChange, tables.FeeChangeSubGraph]
 	aggs  loader.SyncChannel[tables.AggEvent, tables.AggEventSubGraph]
+	ko    loader.SyncChannel[tables.KnockoutCross, tables.KnockoutCrossSubGraph]
 }
 
 func NewSubgraphSyncer(controller *Controller, chainConfig loader.ChainConfig, network types.NetworkName, startupCache string) *NormalSubgraphSyncer {
@@ -45,7 +48,7 @@ func NewSubgraphSyncer(controller *Controller, chainConfig loader.ChainConfig, n
 func NewSubgraphSyncerAtStart(controller *Controller, chainConfig loader.ChainConfig, network types.NetworkName, startBlocks loader.SubgraphStartBlocks, startupCache string) *NormalSubgraphSyncer {
 	sync := makeSubgraphSyncer(controller, chainConfig, network)
 	sync.startBlocks = startBlocks
-	if startupCache != "" {
+	if !sync.cntr.loadSnapshot(&sync) && startupCache != "" {
 		LoadStartupCache(startupCache, &sync)
 	}
 	syncNotif := make(chan bool, 1)
@@ -65,6 +68,9 @@ func makeSubgraphSyncer(controller *Controller, chainConfig loader.ChainConfig,
 		cntr:     netCntr,
 		cfg:      cfg,
 		channels: makeSyncChannels(netCntr, cfg),
+		reorgs: newReorgTracker(func(block int) (string, error) {
+			return loader.SubgraphBlockHash(cfg, block)
+		}),
 	}
 }
 
@@ -88,16 +94,22 @@ func (s *NormalSubgraphSyncer) PollSubgraphUpdates() {
 		if hasMore {
 			log.Printf("New subgraph block %d", s.lastSyncBlock)
 		}
+		s.cntr.maybeSnapshot(s)
 	}
 }
 
 func (s *NormalSubgraphSyncer) checkNewSubgraphSync() (bool, error) {
-	metaBlock, err := loader.LatestSubgraphBlock(s.cfg)
+	metaBlock, metaHash, err := loader.LatestSubgraphHead(s.cfg)
 	if err != nil {
 		log.Println("Warning unable to sync subgraph meta query " + err.Error())
 		return false, err
 	}
 
+	if forkBlock, isFork := s.cntr.checkReorg(s.reorgs, &s.channels, metaBlock, metaHash); isFork {
+		s.lookbackBlocks = min(s.lookbackBlocks, forkBlock)
+		s.lastSyncBlock = min(s.lastSyncBlock, forkBlock)
+	}
+
 	if metaBlock > s.lastSyncBlock {
 		time.Sleep(SUBGRAPH_SYNC_DELAY * time.Second)
 		s.syncStep(metaBlock)
@@ -107,49 +119,76 @@ func (s *NormalSubgraphSyncer) checkNewSubgraphSync() (bool, error) {
 }
 
 func (s *NormalSubgraphSyncer) syncStart(notif chan bool) {
-	syncBlock, err := loader.LatestSubgraphBlock(s.cfg)
+	syncBlock, syncHash, err := loader.LatestSubgraphHead(s.cfg)
 
 	if err != nil || syncBlock == 0 {
 		log.Fatalf("Subgraph not responding from %s", s.cntr.chainCfg.Subgraph)
 	}
+	s.cntr.checkReorg(s.reorgs, &s.channels, syncBlock, syncHash)
 
 	s.syncStep(syncBlock)
 	log.Printf("Startup subgraph sync done on chainId=%d", s.cntr.chainCfg.ChainID)
+	s.cntr.ctrl.cache.SetStartupSynced(s.cntr.chainId)
 	notif <- true
 }
 
+func (s *syncChannels) recordStatus(cache *cache.MemoryCache, chainId types.ChainId) {
+	chans := []interface {
+		Table() string
+		LatestIngested() (int, int)
+	}{&s.swaps, &s.aggs, &s.liq, &s.fees, &s.bal, &s.ko}
+	for _, tbl := range chans {
+		if block, rowTime := tbl.LatestIngested(); block > 0 {
+			cache.SetTableSynced(chainId, tbl.Table(), block, rowTime)
+		}
+	}
+}
+
 func makeSyncChannels(cntr *ControllerOverNetwork, cfg loader.SyncChannelConfig) syncChannels {
 	cfg.Query = "./artifacts/graphQueries/liqchanges.query"
+	cfg.Table = "liquidityChanges"
 	tblLiq := tables.LiqChangeTable{}
 	syncLiq := loader.NewSyncChannel[tables.LiqChange, tables.LiqChangeSubGraph](
 		tblLiq, cfg, cntr.IngestLiqChange)
 
 	cfg.Query = "./artifacts/graphQueries/swaps.query"
+	cfg.Table = "swaps"
 	tblSwap := tables.SwapsTable{}
 	syncSwap := loader.NewSyncChannel[tables.Swap, tables.SwapSubGraph](
 		tblSwap, cfg, cntr.IngestSwap)
 
 	cfg.Query = "./artifacts/graphQueries/feechanges.query"
+	cfg.Table = "feeChanges"
 	tblFee := tables.FeeTable{}
 	syncFee := loader.NewSyncChannel[tables.FeeChange, tables.FeeChangeSubGraph](
 		tblFee, cfg, cntr.IngestFee)
 
 	cfg.Query = "./artifacts/graphQueries/aggevent.query"
+	cfg.Table = "aggEvents"
 	tblAgg := tables.AggEventsTable{}
 	syncAgg := loader.NewSyncChannel[tables.AggEvent, tables.AggEventSubGraph](
 		tblAgg, cfg, cntr.IngestAggEvent)
 
 	cfg.Query = "./artifacts/graphQueries/balances.query"
+	cfg.Table = "userBalances"
 	tblBal := tables.BalanceTable{}
 	syncBal := loader.NewSyncChannel[tables.Balance, tables.BalanceSubGraph](
 		tblBal, cfg, cntr.IngestBalance)
 
+	cfg.Query = "./artifacts/graphQueries/knockoutcrosses.query"
+	cfg.Table = "knockoutCrosses"
+	cfg.AllowEmpty = true
+	tblKo := tables.KnockoutTable{}
+	syncKo := loader.NewSyncChannel[tables.KnockoutCross, tables.KnockoutCrossSubGraph](
+		tblKo, cfg, cntr.IngestKnockoutCross)
+
 	return syncChannels{
 		bal:   syncBal,
 		liq:   syncLiq,
 		swaps: syncSwap,
 		fees:  syncFee,
 		aggs:  syncAgg,
+		ko:    syncKo,
 	}
 }
 
@@ -160,9 +199,14 @@ func (s *NormalSubgraphSyncer) syncStep(syncBlock int) {
 	// first pass on the block
 	startBlock := s.lookbackBlocks + 1
 
+	// Crosses are held until the liq changes catch up to them, so they're synced first
+	s.channels.ko.SyncTableToSubgraph(maxBlock(startBlock, s.startBlocks.Ko), syncBlock)
+	// Fee changes set the rates that the agg events accrue fees at
+	s.channels.fees.SyncTableToSubgraph(maxBlock(startBlock, s.startBlocks.Fee), syncBlock)
+
 	var wg sync.WaitGroup
 
-	const N_CHANNELS = 6
+	const N_CHANNELS = 4
 	wg.Add(N_CHANNELS)
 
 	go s.channels.swaps.SyncTableToSubgraphWG(maxBlock(startBlock, s.startBlocks.Swaps), syncBlock, &wg)
@@ -170,9 +214,9 @@ func (s *NormalSubgraphSyncer) syncStep(syncBlock int) {
 	go s.channels.bal.SyncTableToSubgraphWG(maxBlock(startBlock, s.startBlocks.Bal), syncBlock, &wg)
 
 	go s.channels.liq.SyncTableToSubgraphWG(maxBlock(startBlock, s.startBlocks.Liq), syncBlock, &wg)
-	go s.channels.fees.SyncTableToSubgraphWG(maxBlock(startBlock, s.startBlocks.Fee), syncBlock, &wg)
 
 	wg.Wait()
+	s.cntr.FlushSyncCycle(syncBlock, &s.channels)
 
 	s.lookbackBlocks = s.lastSyncBlock
 	s.lastSyncBlock = syncBlock
@@ -194,6 +238,8 @@ func (s *NormalSubgraphSyncer) IngestEntries(table string, entriesData []byte, s
 		return s.channels.fees.IngestEntries(entriesData, startBlock, endBlock)
 	case "userBalances":
 		return s.channels.bal.IngestEntries(entriesData, startBlock, endBlock)
+	case "knockoutCrosses":
+		return s.channels.ko.IngestEntries(entriesData, startBlock, endBlock)
 	default:
 		log.Fatal("Warning: unknown table name in subgraph ingest", table)
 	}
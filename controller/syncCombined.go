@@ -16,6 +16,7 @@ type CombinedSubgraphSyncer struct {
 	cfg        loader.SyncChannelConfig
 	channels   syncChannels
 	lastBlocks loader.SubgraphStartBlocks
+	reorgs     *reorgTracker
 }
 
 func NewCombinedSubgraphSyncer(controller *Controller, chainConfig loader.ChainConfig, network types.NetworkName, startupCacheDir string, startupCache string) *CombinedSubgraphSyncer {
@@ -29,7 +30,8 @@ func NewCombinedSubgraphSyncerAtStart(controller *Controller, chainConfig loader
 	sync.lastBlocks.Swaps = startBlocks.Swaps
 	sync.lastBlocks.Aggs = startBlocks.Aggs
 	sync.lastBlocks.Liq = startBlocks.Liq
-	if startupCache != "" {
+	sync.lastBlocks.Ko = startBlocks.Ko
+	if !sync.cntr.loadSnapshot(&sync) && startupCache != "" {
 		LoadStartupCache(startupCache, &sync)
 	}
 	sync.syncStart()
@@ -47,6 +49,9 @@ func makeCombinedSubgraphSyncer(controller *Controller, chainConfig loader.Chain
 		cntr:     netCntr,
 		cfg:      cfg,
 		channels: makeSyncChannels(netCntr, cfg),
+		reorgs: newReorgTracker(func(block int) (string, error) {
+			return loader.SubgraphBlockHash(cfg, block)
+		}),
 	}
 }
 
@@ -59,6 +64,7 @@ func (s *CombinedSubgraphSyncer) PollSubgraphUpdates() {
 func (s *CombinedSubgraphSyncer) syncStart() {
 	s.syncLoop(true)
 	log.Printf("Startup subgraph sync done on chainId=%d", s.cntr.chainCfg.ChainID)
+	s.cntr.ctrl.cache.SetStartupSynced(s.cntr.chainId)
 }
 
 const MAX_BLOCK = 999999999
@@ -83,20 +89,28 @@ func (s *CombinedSubgraphSyncer) syncLoop(startupSync bool) {
 			continue
 		}
 
+		if forkBlock, isFork := s.cntr.checkReorg(s.reorgs, &s.channels, syncBlock, comboData.Meta.Block.Hash); isFork {
+			s.rewind(forkBlock)
+			continue
+		}
+
+		// Crosses are held until the liq changes catch up to them, so they're ingested first.
+		// Fee changes go before the agg events that accrue fees at their rates.
+		lastObsKo, hasMoreKos, errKos := s.channels.ko.IngestEntries(comboData.Kos, s.lastBlocks.Ko, syncBlock)
+		lastObsFees, hasMoreFees, errFees := s.channels.fees.IngestEntries(comboData.Fees, s.lastBlocks.Fee, syncBlock)
 		lastObsSwaps, hasMoreSwaps, errSwaps := s.channels.swaps.IngestEntries(comboData.Swaps, s.lastBlocks.Swaps, syncBlock)
 		lastObsAgg, hasMoreAggs, errAggs := s.channels.aggs.IngestEntries(comboData.Aggs, s.lastBlocks.Aggs, syncBlock)
 		lastObsBal, hasMoreBals, errBals := s.channels.bal.IngestEntries(comboData.Bals, s.lastBlocks.Bal, syncBlock)
 
 		lastObsLiq, hasMoreLiqs, errLiqs := s.channels.liq.IngestEntries(comboData.Liqs, s.lastBlocks.Liq, syncBlock)
-		lastObsFees, hasMoreFees, errFees := s.channels.fees.IngestEntries(comboData.Fees, s.lastBlocks.Fee, syncBlock)
 
-		if errSwaps != nil || errAggs != nil || errBals != nil || errLiqs != nil || errFees != nil {
-			log.Println("Warning unable to ingest entries:", errSwaps, errAggs, errBals, errLiqs, errFees)
+		if errSwaps != nil || errAggs != nil || errBals != nil || errLiqs != nil || errFees != nil || errKos != nil {
+			log.Println("Warning unable to ingest entries:", errSwaps, errAggs, errBals, errLiqs, errFees, errKos)
 			time.Sleep(pollInterval)
 			continue
 		}
 
-		if lastObsSwaps > s.lastBlocks.Swaps || lastObsAgg > s.lastBlocks.Aggs || lastObsBal > s.lastBlocks.Bal || lastObsLiq > s.lastBlocks.Liq || lastObsFees > s.lastBlocks.Fee {
+		if lastObsSwaps > s.lastBlocks.Swaps || lastObsAgg > s.lastBlocks.Aggs || lastObsBal > s.lastBlocks.Bal || lastObsLiq > s.lastBlocks.Liq || lastObsFees > s.lastBlocks.Fee || lastObsKo > s.lastBlocks.Ko {
 			newRows = true
 		}
 		// Abnormal case, should sleep it off. But also if this happens during non-startup sync, not sleeping
@@ -122,13 +136,24 @@ func (s *CombinedSubgraphSyncer) syncLoop(startupSync bool) {
 		if lastObsFees > s.lastBlocks.Fee {
 			s.lastBlocks.Fee = lastObsFees
 		}
+		if lastObsKo > s.lastBlocks.Ko {
+			s.lastBlocks.Ko = lastObsKo
+		}
+
+		// Rows on the last liq block may be cut off by the page limit, so crosses on that block
+		// wait until there are no more liq changes.
+		if hasMoreLiqs {
+			s.cntr.FlushSyncCycle(s.lastBlocks.Liq-1, &s.channels)
+		} else {
+			s.cntr.FlushSyncCycle(syncBlock, &s.channels)
+		}
 
 		if newRows {
-			log.Printf("Sync step. Swap: %d Agg: %d Bal: %d Liq: %d Fee: %d", s.lastBlocks.Swaps, s.lastBlocks.Aggs, s.lastBlocks.Bal, s.lastBlocks.Liq, s.lastBlocks.Fee)
+			log.Printf("Sync step. Swap: %d Agg: %d Bal: %d Liq: %d Ko: %d Fee: %d", s.lastBlocks.Swaps, s.lastBlocks.Aggs, s.lastBlocks.Bal, s.lastBlocks.Liq, s.lastBlocks.Ko, s.lastBlocks.Fee)
 		}
 
 		// If no more data to backfill, either sleep or exit if it's a startup sync.
-		if !hasMoreSwaps && !hasMoreAggs && !hasMoreBals && !hasMoreLiqs && !hasMoreFees {
+		if !hasMoreSwaps && !hasMoreAggs && !hasMoreBals && !hasMoreLiqs && !hasMoreFees && !hasMoreKos {
 			if startupSync {
 				break
 			}
@@ -136,11 +161,21 @@ func (s *CombinedSubgraphSyncer) syncLoop(startupSync bool) {
 				log.Printf("New subgraph block %d", syncBlock)
 				lastSyncBlock = syncBlock
 			}
+			s.cntr.maybeSnapshot(s)
 			time.Sleep(pollInterval)
 		}
 	}
 }
 
+func (s *CombinedSubgraphSyncer) rewind(forkBlock int) {
+	s.lastBlocks.Swaps = min(s.lastBlocks.Swaps, forkBlock)
+	s.lastBlocks.Aggs = min(s.lastBlocks.Aggs, forkBlock)
+	s.lastBlocks.Bal = min(s.lastBlocks.Bal, forkBlock)
+	s.lastBlocks.Liq = min(s.lastBlocks.Liq, forkBlock)
+	s.lastBlocks.Fee = min(s.lastBlocks.Fee, forkBlock)
+	s.lastBlocks.Ko = min(s.lastBlocks.Ko, forkBlock)
+}
+
 func (s *CombinedSubgraphSyncer) SetStartBlocks(startBlocks loader.SubgraphStartBlocks) {
 	s.lastBlocks = startBlocks
 }
@@ -157,6 +192,8 @@ func (s *CombinedSubgraphSyncer) IngestEntries(table string, entriesData []byte,
 		return s.channels.fees.IngestEntries(entriesData, startBlock, endBlock)
 	case "userBalances":
 		return s.channels.bal.IngestEntries(entriesData, startBlock, endBlock)
+	case "knockoutCrosses":
+		return s.channels.ko.IngestEntries(entriesData, startBlock, endBlock)
 	default:
 		log.Fatal("Warning: unknown table name in subgraph ingest", table)
 	}
@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/loader"
+	"github.com/CrocSwap/graphcache-go/tables"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+// Syncs from the dex event logs over RPC instead of the subgraph. Rows are fed through
+// the same sync channels as the subgraph syncers, so the rest of the pipeline is the same.
+type LogSyncer struct {
+	cntr          *ControllerOverNetwork
+	cfg           loader.SyncChannelConfig
+	channels      syncChannels
+	source        *loader.DexLogSource
+	startBlocks   loader.SubgraphStartBlocks
+	nextBlock     int
+	reorgs        *reorgTracker
+	fetchFailures int
+}
+
+// Failed log fetches are retried on the next poll, backing off up to this long
+const LOG_FETCH_MAX_BACKOFF = 5 * time.Minute
+
+func NewLogSyncer(controller *Controller, client loader.DexLogClient, chainConfig loader.ChainConfig, network types.NetworkName, startupCache string) *LogSyncer {
+	start := loader.SubgraphStartBlocks{}
+	return NewLogSyncerAtStart(controller, client, chainConfig, network, start, startupCache)
+}
+
+func NewLogSyncerAtStart(controller *Controller, client loader.DexLogClient, chainConfig loader.ChainConfig, network types.NetworkName, startBlocks loader.SubgraphStartBlocks, startupCache string) *LogSyncer {
+	sync := makeLogSyncer(controller, client, chainConfig, network)
+	sync.startBlocks = startBlocks
+	if !sync.cntr.loadSnapshot(&sync) {
+		if startupCache != "" {
+			LoadStartupCache(startupCache, &sync)
+		}
+		sync.nextBlock = sync.firstBlock()
+	}
+	sync.syncStart()
+	return &sync
+}
+
+func makeLogSyncer(controller *Controller, client loader.DexLogClient, chainConfig loader.ChainConfig, network types.NetworkName) LogSyncer {
+	cfg := loader.SyncChannelConfig{
+		Chain:   chainConfig,
+		Network: network,
+	}
+	netCntr := controller.OnNetwork(network)
+
+	source := loader.NewDexLogSource(client, chainConfig, network)
+	// Rolled back from the sync loop, which is the goroutine fetching the logs
+	source.SetJournal(netCntr.journal.record)
+
+	return LogSyncer{
+		cntr:     netCntr,
+		cfg:      cfg,
+		channels: makeSyncChannels(netCntr, cfg),
+		source:   source,
+		reorgs:   newReorgTracker(source.BlockHash),
+	}
+}
+
+func (s *LogSyncer) PollSubgraphUpdates() {
+	s.syncLoop(false)
+}
+
+func (s *LogSyncer) syncStart() {
+	s.syncLoop(true)
+	log.Printf("Startup log sync done on chainId=%d", s.cntr.chainCfg.ChainID)
+	s.cntr.ctrl.cache.SetStartupSynced(s.cntr.chainId)
+}
+
+func (s *LogSyncer) syncLoop(startupSync bool) {
+	pollInterval := DEFAULT_SUBGRAPH_POLL_SECS
+	if os.Getenv("SUBGRAPH_POLL_SECS") != "" {
+		pollSecs, err := strconv.Atoi(os.Getenv("SUBGRAPH_POLL_SECS"))
+		if err != nil {
+			log.Panicln("Invalid SUBGRAPH_POLL_SECS value", os.Getenv("SUBGRAPH_POLL_SECS"))
+		}
+		pollInterval = time.Duration(pollSecs) * time.Second
+	}
+
+	for {
+		latestBlock, latestHash, err := s.source.LatestHead()
+		if err != nil {
+			log.Println("Warning unable to query latest block:", err.Error())
+			time.Sleep(pollInterval)
+			continue
+		}
+
+		if forkBlock, isFork := s.cntr.checkReorg(s.reorgs, &s.channels, latestBlock, latestHash); isFork {
+			s.nextBlock = min(s.nextBlock, forkBlock+1)
+			continue
+		}
+
+		if err := s.syncThrough(latestBlock); err != nil {
+			s.fetchFailures += 1
+			s.cntr.ctrl.cache.SetSyncError(s.cntr.chainId, err.Error())
+			time.Sleep(fetchBackoff(pollInterval, s.fetchFailures))
+			continue
+		}
+		if s.fetchFailures > 0 {
+			s.fetchFailures = 0
+			s.cntr.ctrl.cache.SetSyncError(s.cntr.chainId, "")
+		}
+
+		if startupSync {
+			return
+		}
+		s.cntr.maybeSnapshot(s)
+		time.Sleep(pollInterval)
+	}
+}
+
+// Fetches and ingests the logs up to the block. Stops at the first range that fails, so the
+// head and reorgs are checked again before it's retried.
+func (s *LogSyncer) syncThrough(latestBlock int) error {
+	for s.nextBlock <= latestBlock {
+		endBlock := min(s.nextBlock+s.source.BlockRange()-1, latestBlock)
+		rows, err := s.source.FetchRange(s.nextBlock, endBlock)
+		if err != nil {
+			log.Printf("Warning unable to fetch dex logs on block=%d-%d: %s", s.nextBlock, endBlock, err.Error())
+			return fmt.Errorf("unable to fetch dex logs on block=%d-%d: %w", s.nextBlock, endBlock, err)
+		}
+		s.ingestRows(rows, s.nextBlock, endBlock)
+		s.nextBlock = endBlock + 1
+	}
+	return nil
+}
+
+// Doubles the poll interval with each consecutive failure, up to LOG_FETCH_MAX_BACKOFF
+func fetchBackoff(pollInterval time.Duration, failures int) time.Duration {
+	backoff := pollInterval
+	for i := 1; i < failures && backoff < LOG_FETCH_MAX_BACKOFF; i++ {
+		backoff *= 2
+	}
+	return min(backoff, LOG_FETCH_MAX_BACKOFF)
+}
+
+// Same table order as the combined subgraph syncer
+func (s *LogSyncer) ingestRows(rows *loader.DexLogRows, startBlock int, endBlock int) {
+	nKos, _ := s.channels.ko.IngestRows(rowsFromBlock(rows.Kos, s.startBlocks.Ko, tables.KnockoutTable{}.GetBlock))
+	nFees, _ := s.channels.fees.IngestRows(rowsFromBlock(rows.Fees, s.startBlocks.Fee, tables.FeeTable{}.GetBlock))
+	nSwaps, _ := s.channels.swaps.IngestRows(rowsFromBlock(rows.Swaps, s.startBlocks.Swaps, tables.SwapsTable{}.GetBlock))
+	nAggs, _ := s.channels.aggs.IngestRows(rowsFromBlock(rows.Aggs, s.startBlocks.Aggs, tables.AggEventsTable{}.GetBlock))
+	nBals, _ := s.channels.bal.IngestRows(rowsFromBlock(rows.Bals, s.startBlocks.Bal, tables.BalanceTable{}.GetBlock))
+	nLiqs, _ := s.channels.liq.IngestRows(rowsFromBlock(rows.Liqs, s.startBlocks.Liq, tables.LiqChangeTable{}.GetBlock))
+	s.cntr.FlushSyncCycle(endBlock, &s.channels)
+
+	if nSwaps+nAggs+nBals+nLiqs+nKos+nFees > 0 {
+		log.Printf("Loaded dex logs on block=%d-%d. Swap: %d Agg: %d Bal: %d Liq: %d Ko: %d Fee: %d",
+			startBlock, endBlock, nSwaps, nAggs, nBals, nLiqs, nKos, nFees)
+	}
+}
+
+func rowsFromBlock[R any](rows []R, startBlock int, blockOf func(R) int) []R {
+	if startBlock == 0 {
+		return rows
+	}
+	filtered := make([]R, 0, len(rows))
+	for _, row := range rows {
+		if blockOf(row) >= startBlock {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered
+}
+
+// Logs are scanned once for all tables, so start from the earliest table
+func (s *LogSyncer) firstBlock() int {
+	first := min(s.startBlocks.Swaps, s.startBlocks.Aggs, s.startBlocks.Bal, s.startBlocks.Liq, s.startBlocks.Fee)
+	// Crosses are rare enough that the startup cache often has none
+	if s.startBlocks.Ko > 0 {
+		first = min(first, s.startBlocks.Ko)
+	}
+	return max(first, s.cfg.Chain.LogStartBlock)
+}
+
+// Called by the startup cache loader with the last block loaded on each table. Log rows
+// don't share IDs with the cached subgraph rows, so resume after that block instead of
+// re-reading it and relying on de-duplication.
+func (s *LogSyncer) SetStartBlocks(startBlocks loader.SubgraphStartBlocks) {
+	next := func(block int) int {
+		if block == 0 {
+			return 0
+		}
+		return block + 1
+	}
+	s.startBlocks = loader.SubgraphStartBlocks{
+		Swaps: next(startBlocks.Swaps),
+		Aggs:  next(startBlocks.Aggs),
+		Bal:   next(startBlocks.Bal),
+		Fee:   next(startBlocks.Fee),
+		Ko:    next(startBlocks.Ko),
+		Liq:   next(startBlocks.Liq),
+	}
+}
+
+func (s *LogSyncer) IngestEntries(table string, entriesData []byte, startBlock, endBlock int) (int, bool, error) {
+	if err := s.source.ObserveEntries(table, entriesData); err != nil {
+		return 0, false, err
+	}
+	switch table {
+	case "swaps":
+		return s.channels.swaps.IngestEntries(entriesData, startBlock, endBlock)
+	case "aggEvents":
+		return s.channels.aggs.IngestEntries(entriesData, startBlock, endBlock)
+	case "liquidityChanges":
+		return s.channels.liq.IngestEntries(entriesData, startBlock, endBlock)
+	case "feeChanges":
+		return s.channels.fees.IngestEntries(entriesData, startBlock, endBlock)
+	case "userBalances":
+		return s.channels.bal.IngestEntries(entriesData, startBlock, endBlock)
+	case "knockoutCrosses":
+		return s.channels.ko.IngestEntries(entriesData, startBlock, endBlock)
+	default:
+		log.Fatal("Warning: unknown table name in subgraph ingest", table)
+	}
+	return 0, false, fmt.Errorf("unknown table name in subgraph ingest")
+}
+
+func (s *LogSyncer) ChainId() types.ChainId {
+	return types.IntToChainId(s.cfg.Chain.ChainID)
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/CrocSwap/graphcache-go/loader"
@@ -20,7 +21,7 @@ func initWorkers(_ loader.NetworkConfig, query *loader.ICrocQuery) (*workers, *L
 
 	return &workers{
 		omniUpdates:  watchUpdateSeq(liqRefresher),
-		liqRefresher: NewLiquidityRefresher(query),
+		liqRefresher: liqRefresher,
 	}, liqRefresher
 }
 
@@ -41,6 +42,7 @@ type IMsgType interface {
 }
 
 func (msg *posUpdateMsg) processUpdate(lr *LiquidityRefresher) {
+	msg.prior = (msg.pos).Checkpoint()
 	(msg.pos).UpdatePosition(msg.liq)
 	handle := PositionRefreshHandle{location: msg.loc, pos: msg.pos}
 	lr.PushRefresh(&handle, msg.liq.Time)
@@ -57,6 +59,7 @@ func (msg *posImpactMsg) processUpdate(lr *LiquidityRefresher) {
 }
 
 func (msg *koPosUpdateMsg) processUpdate(lr *LiquidityRefresher) {
+	msg.priorUpdateTime, msg.priorFirstMint = (msg.pos).UpdateTimes()
 	cands, isPossiblyLive := (msg.pos).UpdateLiqChange(msg.liq)
 
 	handle := KnockoutAliveHandle{location: msg.loc, pos: msg.pos}
@@ -74,6 +77,9 @@ func (msg *koPosUpdateMsg) processUpdate(lr *LiquidityRefresher) {
 
 func (msg *koCrossUpdateMsg) processUpdate(lr *LiquidityRefresher) {
 	cands := (msg.pos).UpdateCross(msg.cross)
+	if msg.onApplied != nil {
+		msg.onApplied()
+	}
 
 	for _, cand := range cands {
 		claimLoc := msg.loc.ToClaimLoc(cand.User, cand.PivotTime)
@@ -86,20 +92,82 @@ func (msg *koCrossUpdateMsg) processUpdate(lr *LiquidityRefresher) {
 	}
 }
 
+// Revert messages are sent through the same sequence as the updates they undo, so the
+// update has always been processed (and its prior state captured) by the time they run.
+func (msg *posRevertMsg) processUpdate(lr *LiquidityRefresher) {
+	(msg.update.pos).Restore(msg.update.prior)
+	handle := PositionRefreshHandle{location: msg.update.loc, pos: msg.update.pos}
+	lr.PushRefresh(&handle, msg.update.liq.Time)
+}
+
+func (msg *koPosRevertMsg) processUpdate(lr *LiquidityRefresher) {
+	(msg.update.pos).RestoreTimes(msg.update.priorUpdateTime, msg.update.priorFirstMint)
+	handle := KnockoutAliveHandle{location: msg.update.loc, pos: msg.update.pos}
+	lr.PushRefresh(&handle, msg.update.liq.Time)
+}
+
+func (msg *koCrossRevertMsg) processUpdate(lr *LiquidityRefresher) {
+	cands := (msg.pos).RevertCross(msg.cross)
+	if msg.onApplied != nil {
+		msg.onApplied()
+	}
+
+	for _, cand := range cands {
+		subPos := msg.pos.ForUser(cand.User)
+		handle := KnockoutAliveHandle{location: msg.loc.ToPositionLocation(cand.User), pos: subPos}
+		lr.PushRefresh(&handle, msg.cross.Time)
+	}
+}
+
+func (msg *surplusRefreshMsg) processUpdate(lr *LiquidityRefresher) {
+	handle := SurplusRefreshHandle{chainId: msg.chainId, user: msg.user, token: msg.token, surplus: msg.surplus}
+	if msg.isPoll {
+		lr.PushRefreshPoll(&handle)
+	} else {
+		lr.PushRefresh(&handle, msg.eventTime)
+	}
+}
+
+func (msg *flushMsg) processUpdate(lr *LiquidityRefresher) {
+	if msg.fn != nil {
+		msg.fn()
+	}
+	close(msg.done)
+}
+
+// Blocks until every update sent before the call has been processed
+func (w *workers) flush() {
+	w.runInSeq(nil)
+}
+
+// Runs fn on the update worker after every update sent before the call, and blocks until
+// it's done. The position trackers are only written by the worker, so fn can read them.
+func (w *workers) runInSeq(fn func()) {
+	msg := &flushMsg{fn: fn, done: make(chan struct{})}
+	w.omniUpdates <- msg
+	<-msg.done
+}
+
 func (msg *poolInitPriceMsg) processUpdate(lr *LiquidityRefresher) {
 	handle := PoolInitPriceHandle{Pool: msg.pool, Block: msg.block, Hist: msg.hist}
 	lr.PushRefresh(&handle, int(time.Now().Unix()))
 }
 
 func (msg *bumpRefreshMsg) processUpdate(lr *LiquidityRefresher) {
-	handle := BumpRefreshHandle{pool: msg.pool, tick: msg.tick, curve: msg.curve, bump: msg.bump}
+	handle := BumpRefreshHandle{pool: msg.pool, tick: msg.tick, curve: msg.curve, bump: msg.bump, lock: msg.lock}
 	lr.PushRefreshPoll(&handle)
 }
 
 type posUpdateMsg struct {
-	loc types.PositionLocation
-	pos *model.PositionTracker
-	liq tables.LiqChange
+	loc   types.PositionLocation
+	pos   *model.PositionTracker
+	liq   tables.LiqChange
+	prior model.PositionCheckpoint
+}
+
+// Undoes a posUpdateMsg for a row that was rolled back by a reorg
+type posRevertMsg struct {
+	update *posUpdateMsg
 }
 
 // Version of posUpdateMsg that doesn't update the position state, only queries liq and rewards
@@ -115,15 +183,44 @@ type posImpactMsg struct {
 }
 
 type koPosUpdateMsg struct {
-	loc types.PositionLocation
-	pos *model.KnockoutSubplot
-	liq tables.LiqChange
+	loc             types.PositionLocation
+	pos             *model.KnockoutSubplot
+	liq             tables.LiqChange
+	priorUpdateTime int
+	priorFirstMint  int
+}
+
+type koPosRevertMsg struct {
+	update *koPosUpdateMsg
 }
 
+// onApplied runs on the update worker once the saga has the change
 type koCrossUpdateMsg struct {
-	loc   types.BookLocation
-	pos   *model.KnockoutSaga
-	cross tables.LiqChange
+	loc       types.BookLocation
+	pos       *model.KnockoutSaga
+	cross     tables.KnockoutCross
+	onApplied func()
+}
+
+type koCrossRevertMsg struct {
+	loc       types.BookLocation
+	pos       *model.KnockoutSaga
+	cross     tables.KnockoutCross
+	onApplied func()
+}
+
+type surplusRefreshMsg struct {
+	chainId   types.ChainId
+	user      types.EthAddress
+	token     types.EthAddress
+	surplus   *model.SurplusBalance
+	eventTime int
+	isPoll    bool
+}
+
+type flushMsg struct {
+	fn   func()
+	done chan struct{}
 }
 
 type poolInitPriceMsg struct {
@@ -137,4 +234,5 @@ type bumpRefreshMsg struct {
 	tick  int
 	curve *model.LiquidityCurve
 	bump  *model.LiquidityBump
+	lock  *sync.RWMutex
 }
@@ -9,11 +9,11 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/CrocSwap/graphcache-go/metrics"
 	"github.com/CrocSwap/graphcache-go/types"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
 )
 
 type Call3InputType struct {
@@ -36,6 +36,7 @@ type CallJob struct {
 type OnChainLoader struct {
 	Cfg          NetworkConfig
 	jobChans     map[int]chan CallJob
+	pools        map[types.ChainId]*RpcPool
 	callCount    int
 	multicallAbi abi.ABI
 }
@@ -44,8 +45,15 @@ func NewOnChainLoader(cfg NetworkConfig) *OnChainLoader {
 	c := &OnChainLoader{
 		Cfg:          cfg,
 		jobChans:     make(map[int]chan CallJob),
+		pools:        make(map[types.ChainId]*RpcPool),
 		multicallAbi: multicallAbi(),
 	}
+	for _, chain := range cfg {
+		chainId := chain.HexChainID()
+		if chainCfg, ok := cfg.ChainConfig(chainId); ok {
+			c.pools[chainId] = NewRpcPool(chainCfg)
+		}
+	}
 	for key, chain := range cfg {
 		if !chain.MulticallDisabled && chain.MulticallContract != "" {
 			c.jobChans[chain.ChainID] = make(chan CallJob)
@@ -71,28 +79,20 @@ func multicallAbi() abi.ABI {
 	return parsedABI
 }
 
-func (c *OnChainLoader) ethClientForChain(chainId types.ChainId) (*ethclient.Client, error) {
-	cfg, okay := c.Cfg.ChainConfig(chainId)
+func (c *OnChainLoader) rpcPoolForChain(chainId types.ChainId) (*RpcPool, error) {
+	pool, okay := c.pools[chainId]
 
 	if !okay {
 		log.Println("Warning no chain configuration for " + chainId)
 		return nil, fmt.Errorf("chain configuration missing")
 	}
-
-	rpcUrl := cfg.RPCEndpoint
-	client, err := ethclient.DialContext(context.Background(), rpcUrl)
-
-	if err != nil {
-		log.Println("Warning RPC connection error: " + err.Error())
-	}
-
-	return client, err
+	return pool, nil
 }
 
 func (c *OnChainLoader) callContractFn(callData []byte, methodName string, contract types.EthAddress,
-	client *ethclient.Client, chainId types.ChainId, abi abi.ABI, blockNumber *big.Int) ([]interface{}, error) {
+	pool *RpcPool, chainId types.ChainId, abi abi.ABI, blockNumber *big.Int) ([]interface{}, error) {
 
-	result, err := c.contractDataCall(client, chainId, contract, callData, blockNumber)
+	result, err := c.contractDataCall(pool, chainId, contract, callData, blockNumber)
 	if err != nil {
 		log.Printf("Warning calling %s() on contract: %s", methodName, err.Error())
 		return nil, err
@@ -108,13 +108,13 @@ func (c *OnChainLoader) callContractFn(callData []byte, methodName string, contr
 
 const MULTICALL_TIMEOUT_MS = 5000
 
-func (c *OnChainLoader) contractDataCall(client *ethclient.Client, chainId types.ChainId,
+func (c *OnChainLoader) contractDataCall(pool *RpcPool, chainId types.ChainId,
 	contract types.EthAddress, data []byte, blockNumber *big.Int) ([]byte, error) {
 
 	chainIdInt, _ := strconv.ParseInt(string(chainId)[2:], 16, 32)
 	jobChan := c.jobChans[int(chainIdInt)]
 	if jobChan == nil || blockNumber != nil { // if multicall is disabled for this chain or a block is specified
-		return c.singleContractDataCall(client, chainId, contract, data, blockNumber)
+		return c.singleContractDataCall(pool, chainId, contract, data, blockNumber)
 	}
 
 	job := CallJob{
@@ -133,12 +133,12 @@ func (c *OnChainLoader) contractDataCall(client *ethclient.Client, chainId types
 		return result, nil
 	case <-time.After(MULTICALL_TIMEOUT_MS * time.Millisecond):
 		log.Println("Multicall timed out, calling manually")
-		return c.singleContractDataCall(client, chainId, contract, data, nil)
+		return c.singleContractDataCall(pool, chainId, contract, data, nil)
 	}
 }
 
 // Call a contract directly
-func (c *OnChainLoader) singleContractDataCall(client *ethclient.Client, chainId types.ChainId,
+func (c *OnChainLoader) singleContractDataCall(pool *RpcPool, chainId types.ChainId,
 	contract types.EthAddress, data []byte, blockNumber *big.Int) ([]byte, error) {
 	addr := common.HexToAddress(string(contract))
 
@@ -147,9 +147,10 @@ func (c *OnChainLoader) singleContractDataCall(client *ethclient.Client, chainId
 		Data: data,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// Leaves time for the pool to fail over if the first endpoint times out
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	result, err := client.CallContract(ctx, msg, blockNumber)
+	result, err := pool.CallContract(ctx, msg, blockNumber)
 	c.callCount++
 	if c.callCount%100 == 0 {
 		log.Printf("RPC calls for %s: %d", chainId, c.callCount)
@@ -193,7 +194,11 @@ func (c *OnChainLoader) multicallWorker(chainId int, networkName types.NetworkNa
 		}
 		batchTimer.Reset(1<<63 - 1)
 
+		startTime := time.Now()
 		err := c.multicall(jobs, chainId, networkName)
+		if len(jobs) > 0 {
+			metrics.ObserveMulticall(string(types.IntToChainId(chainId)), len(jobs), time.Since(startTime), err)
+		}
 		// Cancel all jobs if the multicall fails
 		if err != nil {
 			log.Println("multicall error:", err)
@@ -233,11 +238,11 @@ func (c *OnChainLoader) multicall(jobs []CallJob, chainId int, networkName types
 		return err
 	}
 
-	client, err := c.ethClientForChain(types.IntToChainId(chainId))
+	pool, err := c.rpcPoolForChain(types.IntToChainId(chainId))
 	if err != nil {
 		return err
 	}
-	multicallResult, err := c.singleContractDataCall(client, types.IntToChainId(chainId), types.EthAddress(c.Cfg[networkName].MulticallContract), packed, nil)
+	multicallResult, err := c.singleContractDataCall(pool, types.IntToChainId(chainId), types.EthAddress(c.Cfg[networkName].MulticallContract), packed, nil)
 	if err != nil {
 		return err
 	}
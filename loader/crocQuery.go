@@ -19,6 +19,7 @@ type ICrocQuery interface {
 	QueryKnockoutLiq(pos types.KOClaimLocation) (KnockoutLiqResp, error)
 	QueryKnockoutPivot(pos types.PositionLocation) (uint32, error)
 	QueryLevel(pool types.PoolLocation, tick int) (LevelResp, error)
+	QuerySurplus(chainId types.ChainId, user types.EthAddress, token types.EthAddress) (*big.Int, error)
 }
 
 type NonCrocQuery struct{}
@@ -47,6 +48,10 @@ func (q *NonCrocQuery) QueryLevel(pool types.PoolLocation, tick int) (LevelResp,
 	return LevelResp{BidLots: big.NewInt(0), AskLots: big.NewInt(0), FeeOdometer: 0}, nil
 }
 
+func (q *NonCrocQuery) QuerySurplus(chainId types.ChainId, user types.EthAddress, token types.EthAddress) (*big.Int, error) {
+	return big.NewInt(0), nil
+}
+
 type CrocQuery struct {
 	queryAbi abi.ABI
 	addrs    map[types.ChainId]types.EthAddress
@@ -210,10 +215,20 @@ func (q *CrocQuery) QueryLevel(pool types.PoolLocation, tick int) (result LevelR
 	return
 }
 
+func (q *CrocQuery) QuerySurplus(chainId types.ChainId, user types.EthAddress, token types.EthAddress) (*big.Int, error) {
+	callData, err := q.queryAbi.Pack("querySurplus",
+		common.HexToAddress(string(user)), common.HexToAddress(string(token)))
+	if err != nil {
+		log.Fatalf("Failed to parse querySurplus on ABI: %s", err.Error())
+	}
+
+	return q.callQueryFirstReturn(chainId, callData, "querySurplus", nil)
+}
+
 func (q *CrocQuery) callQueryResults(chainId types.ChainId,
 	callData []byte, methodName string, blockNumber *big.Int) ([]interface{}, error) {
 
-	client, err := q.chain.ethClientForChain(chainId)
+	pool, err := q.chain.rpcPoolForChain(chainId)
 
 	if err != nil {
 		return make([]interface{}, 0), err
@@ -224,7 +239,7 @@ func (q *CrocQuery) callQueryResults(chainId types.ChainId,
 		return make([]interface{}, 0), err
 	}
 
-	return q.chain.callContractFn(callData, methodName, contractAddr, client, chainId, q.queryAbi, blockNumber)
+	return q.chain.callContractFn(callData, methodName, contractAddr, pool, chainId, q.queryAbi, blockNumber)
 }
 
 func (q *CrocQuery) callQueryFirstReturn(chainId types.ChainId,
@@ -0,0 +1,699 @@
+package loader
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/CrocSwap/graphcache-go/tables"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// User command codes from the CrocSwap contracts (see ProtocolCmd.sol)
+const (
+	warmMintRangeLiq    = 1
+	warmMintRangeBase   = 11
+	warmMintRangeQuote  = 12
+	warmBurnRangeLiq    = 2
+	warmBurnRangeBase   = 21
+	warmBurnRangeQuote  = 22
+	warmMintAmbLiq      = 3
+	warmMintAmbBase     = 31
+	warmMintAmbQuote    = 32
+	warmBurnAmbLiq      = 4
+	warmBurnAmbBase     = 41
+	warmBurnAmbQuote    = 42
+	warmHarvest         = 5
+	coldInitPool        = 71
+	coldDepositSurplus  = 73
+	coldWithdrawSurplus = 74
+	coldTransferSurplus = 75
+	coldSidePocket      = 76
+	coldDepositPermit   = 77
+	koMint              = 91
+	koBurn              = 92
+	koClaim             = 93
+	koRecover           = 94
+	protoPoolTemplate   = 110
+	protoPoolRevise     = 111
+)
+
+const reserveFlagBase = 0x1
+const reserveFlagQuote = 0x2
+
+// Rows decoded from a range of dex logs, in log order within each table.
+type DexLogRows struct {
+	Swaps []tables.Swap
+	Aggs  []tables.AggEvent
+	Liqs  []tables.LiqChange
+	Kos   []tables.KnockoutCross
+	Fees  []tables.FeeChange
+	Bals  []tables.Balance
+}
+
+func (r *DexLogRows) Len() int {
+	return len(r.Swaps) + len(r.Aggs) + len(r.Liqs) + len(r.Kos) + len(r.Fees) + len(r.Bals)
+}
+
+type dexPool struct {
+	base    string
+	quote   string
+	poolIdx int
+}
+
+type koPivotKey struct {
+	pool  common.Hash
+	tick  int
+	isBid bool
+}
+
+// Translates dex event logs into the same rows the subgraph tables produce. Keeps the
+// protocol state that isn't contained in a single event (pool template fees, pool hash
+// preimages and knockout pivots), so logs must be fed in order.
+type dexLogDecoder struct {
+	network      string
+	abi          abi.ABI
+	templateFees map[int]int
+	pools        map[common.Hash]dexPool
+	koPivots     map[koPivotKey]int
+	// Records how to undo state learned from a block, if set
+	journal func(block int, undo func())
+}
+
+// Context of the transaction that emitted a log. The user is the msg.sender of the dex
+// call that emitted it, which is the tx sender unless the tx went through a router.
+type dexLogTx struct {
+	hash      string
+	user      string
+	block     int
+	time      int
+	callIndex int
+	logIndex  int
+}
+
+func newDexLogDecoder(network string, abiPath string) *dexLogDecoder {
+	return &dexLogDecoder{
+		network:      network,
+		abi:          dexEventsAbi(abiPath),
+		templateFees: make(map[int]int),
+		pools:        make(map[common.Hash]dexPool),
+		koPivots:     make(map[koPivotKey]int),
+	}
+}
+
+const DEX_EVENTS_ABI_PATH = "./artifacts/abis/CrocEvents.json"
+
+func dexEventsAbi(filePath string) abi.ABI {
+	file, err := os.Open(filePath)
+
+	if err != nil {
+		log.Fatalln("Failed to read ABI contract at " + filePath)
+	}
+	defer file.Close()
+
+	parsedABI, err := abi.JSON(file)
+	if err != nil {
+		log.Fatalf("Failed to parse contract ABI: %v", err)
+	}
+
+	return parsedABI
+}
+
+func (d *dexLogDecoder) topics() []common.Hash {
+	topics := make([]common.Hash, 0, len(d.abi.Events))
+	for _, event := range d.abi.Events {
+		topics = append(topics, event.ID)
+	}
+	return topics
+}
+
+func (d *dexLogDecoder) decode(l ethtypes.Log, tx dexLogTx, rows *DexLogRows) error {
+	if len(l.Topics) == 0 {
+		return nil
+	}
+	event, err := d.abi.EventByID(l.Topics[0])
+	if err != nil {
+		return nil
+	}
+
+	fields, err := event.Inputs.NonIndexed().Unpack(l.Data)
+	if err != nil {
+		return fmt.Errorf("unable to unpack %s: %w", event.Name, err)
+	}
+
+	switch event.Name {
+	case "CrocSwap":
+		if len(l.Topics) < 3 {
+			return fmt.Errorf("missing indexed CrocSwap topics")
+		}
+		pool := d.registerTxPool(topicAddr(l.Topics[1]), topicAddr(l.Topics[2]),
+			int(fields[0].(*big.Int).Int64()), tx)
+		reserveFlags := int(fields[7].(uint8))
+		d.decodeSwap(pool, fields[1].(bool), fields[2].(bool), reserveFlags,
+			fields[8].(*big.Int), fields[9].(*big.Int), tx, rows)
+
+	case "CrocHotCmd":
+		w := abiWords(fields[0].([]byte))
+		if !w.hasWords(10) {
+			return fmt.Errorf("short hot cmd input")
+		}
+		pool := d.registerTxPool(w.addr(0), w.addr(1), w.int(2), tx)
+		d.decodeSwap(pool, w.bool(3), w.bool(4), w.int(9),
+			fields[1].(*big.Int), fields[2].(*big.Int), tx, rows)
+
+	case "CrocWarmCmd":
+		return d.decodeWarm(abiWords(fields[0].([]byte)), fields[1].(*big.Int), fields[2].(*big.Int), tx, rows)
+
+	case "CrocKnockoutCmd":
+		return d.decodeKnockout(abiWords(fields[0].([]byte)), fields[1].(*big.Int), fields[2].(*big.Int), tx, rows)
+
+	case "CrocKnockoutCross":
+		if len(l.Topics) < 3 {
+			return fmt.Errorf("missing indexed CrocKnockoutCross topics")
+		}
+		tick := abiWords(l.Topics[2].Bytes()).int(0)
+		d.decodeCross(l.Topics[1], tick, fields[0].(bool), int(fields[1].(uint32)),
+			new(big.Int).SetUint64(fields[2].(uint64)), tx, rows)
+
+	case "CrocColdCmd":
+		return d.decodeCold(abiWords(fields[0].([]byte)), tx, rows)
+
+	case "CrocColdProtocolCmd":
+		return d.decodeProtocol(abiWords(fields[0].([]byte)), tx, rows)
+	}
+	return nil
+}
+
+func (d *dexLogDecoder) decodeSwap(pool dexPool, isBuy bool, inBaseQty bool, reserveFlags int,
+	baseFlow *big.Int, quoteFlow *big.Int, tx dexLogTx, rows *DexLogRows) {
+	base, quote := bigToFloat(baseFlow), bigToFloat(quoteFlow)
+
+	rows.Swaps = append(rows.Swaps, tables.Swap{
+		ID:        d.rowId(tx),
+		CallIndex: tx.callIndex,
+		Network:   d.network,
+		TX:        tx.hash,
+		User:      tx.user,
+		Block:     tx.block,
+		Time:      tx.time,
+		Base:      pool.base,
+		Quote:     pool.quote,
+		PoolIdx:   pool.poolIdx,
+		IsBuy:     boolToInt(isBuy),
+		InBaseQty: boolToInt(inBaseQty),
+		BaseFlow:  base,
+		QuoteFlow: quote,
+	})
+
+	agg := d.aggEvent(pool, tx)
+	agg.IsSwap = true
+	agg.InBaseQty = inBaseQty
+	agg.FlowsAtMarket = true
+	agg.BaseFlow = base
+	agg.QuoteFlow = quote
+	rows.Aggs = append(rows.Aggs, agg)
+
+	d.reserveBalances(pool, reserveFlags, tx, rows)
+}
+
+func (d *dexLogDecoder) decodeWarm(w abiWords, baseFlow *big.Int, quoteFlow *big.Int, tx dexLogTx, rows *DexLogRows) error {
+	if !w.hasWords(11) {
+		return fmt.Errorf("short warm cmd input")
+	}
+	pool := d.registerTxPool(w.addr(1), w.addr(2), w.int(3), tx)
+	bidTick, askTick := w.int(4), w.int(5)
+
+	var changeType tables.ChangeType
+	posType := tables.PosTypeConcentrated
+
+	switch w.int(0) {
+	case warmMintRangeLiq, warmMintRangeBase, warmMintRangeQuote:
+		changeType = tables.ChangeTypeMint
+	case warmBurnRangeLiq, warmBurnRangeBase, warmBurnRangeQuote:
+		changeType = tables.ChangeTypeBurn
+	case warmMintAmbLiq, warmMintAmbBase, warmMintAmbQuote:
+		changeType = tables.ChangeTypeMint
+		posType = tables.PosTypeAmbient
+	case warmBurnAmbLiq, warmBurnAmbBase, warmBurnAmbQuote:
+		changeType = tables.ChangeTypeBurn
+		posType = tables.PosTypeAmbient
+	case warmHarvest:
+		changeType = tables.ChangeTypeHarvest
+	default:
+		return nil
+	}
+
+	if posType == tables.PosTypeAmbient {
+		bidTick, askTick = 0, 0
+	}
+
+	// Positions minted through an LP conduit are owned by the conduit contract
+	user := tx.user
+	if conduit := w.addr(10); conduit != zeroAddr {
+		user = conduit
+	}
+
+	var liq *float64
+	if code := w.int(0); code == warmMintRangeLiq || code == warmBurnRangeLiq ||
+		code == warmMintAmbLiq || code == warmBurnAmbLiq {
+		liqVal := bigToFloat(w.uint(6))
+		liq = &liqVal
+	}
+
+	liqRow := d.liqChange(pool, user, posType, changeType, bidTick, askTick, false, baseFlow, quoteFlow, tx)
+	liqRow.Liq = liq
+	rows.Liqs = append(rows.Liqs, liqRow)
+	rows.Aggs = append(rows.Aggs, d.liqAggEvent(pool, posType, bidTick, askTick, baseFlow, quoteFlow, tx))
+	d.reserveBalances(pool, w.int(9), tx, rows)
+	return nil
+}
+
+func (d *dexLogDecoder) decodeKnockout(w abiWords, baseFlow *big.Int, quoteFlow *big.Int, tx dexLogTx, rows *DexLogRows) error {
+	if !w.hasWords(9) {
+		return fmt.Errorf("short knockout cmd input")
+	}
+	pool := d.registerTxPool(w.addr(1), w.addr(2), w.int(3), tx)
+	bidTick, askTick, isBid := w.int(4), w.int(5), w.bool(6)
+
+	var changeType tables.ChangeType
+	var pivotTime *int
+
+	switch w.int(0) {
+	case koMint:
+		changeType = tables.ChangeTypeMint
+	case koBurn:
+		changeType = tables.ChangeTypeBurn
+	case koRecover:
+		changeType = tables.ChangeTypeRecover
+		args := w.dynBytes(8)
+		if !args.hasWords(1) {
+			return fmt.Errorf("short knockout recover args")
+		}
+		pivot := args.int(0)
+		pivotTime = &pivot
+	case koClaim:
+		// Claims identify the pivot through a Merkle proof rather than its time, so use
+		// the latest pivot knocked out at the position's tick.
+		changeType = tables.ChangeTypeClaim
+		pivot := d.koPivots[koPivotKey{d.poolHash(pool), koPivotTick(bidTick, askTick, isBid), isBid}]
+		if pivot == 0 {
+			log.Printf("Warning: knockout claim with no observed cross in tx %s", tx.hash)
+		}
+		pivotTime = &pivot
+	default:
+		return nil
+	}
+
+	liqRow := d.liqChange(pool, tx.user, tables.PosTypeKnockout, changeType, bidTick, askTick, isBid,
+		baseFlow, quoteFlow, tx)
+	liqRow.PivotTime = pivotTime
+	rows.Liqs = append(rows.Liqs, liqRow)
+	rows.Aggs = append(rows.Aggs, d.liqAggEvent(pool, tables.PosTypeKnockout, bidTick, askTick,
+		baseFlow, quoteFlow, tx))
+	d.reserveBalances(pool, w.int(7), tx, rows)
+	return nil
+}
+
+func (d *dexLogDecoder) decodeCross(poolHash common.Hash, tick int, isBid bool, pivotTime int,
+	feeMileage *big.Int, tx dexLogTx, rows *DexLogRows) {
+	pool, ok := d.pools[poolHash]
+	if !ok {
+		log.Printf("Warning: knockout cross on unknown pool %s in tx %s", poolHash.Hex(), tx.hash)
+		return
+	}
+	setLearned(d, d.koPivots, koPivotKey{poolHash, tick, isBid}, pivotTime, tx.block)
+
+	// Same as the subgraph, the cross is also a liquidity change row for the tx history
+	liqRow := d.liqChange(pool, zeroAddr, tables.PosTypeKnockout, tables.ChangeTypeCross,
+		tick, tick, isBid, nil, nil, tx)
+	liqRow.PivotTime = &pivotTime
+	rows.Liqs = append(rows.Liqs, liqRow)
+
+	rows.Kos = append(rows.Kos, tables.KnockoutCross{
+		ID:         d.rowId(tx),
+		Network:    d.network,
+		Tx:         tx.hash,
+		Block:      tx.block,
+		Time:       tx.time,
+		Base:       pool.base,
+		Quote:      pool.quote,
+		PoolIdx:    pool.poolIdx,
+		PoolHash:   poolHash.Hex(),
+		Tick:       tick,
+		IsBid:      boolToInt(isBid),
+		PivotTime:  pivotTime,
+		FeeMileage: bigToFloat(feeMileage),
+	})
+}
+
+func (d *dexLogDecoder) decodeCold(w abiWords, tx dexLogTx, rows *DexLogRows) error {
+	if !w.hasWords(1) {
+		return fmt.Errorf("empty cold cmd input")
+	}
+
+	switch w.int(0) {
+	case coldInitPool:
+		if !w.hasWords(5) {
+			return fmt.Errorf("short init pool input")
+		}
+		pool := d.registerTxPool(w.addr(1), w.addr(2), w.int(3), tx)
+		feeRate, ok := d.templateFees[pool.poolIdx]
+		if !ok {
+			log.Printf("Warning: pool initialized on unobserved template %d in tx %s", pool.poolIdx, tx.hash)
+			return nil
+		}
+		d.feeChange(pool, feeRate, tx, rows)
+
+	case coldDepositSurplus, coldWithdrawSurplus, coldTransferSurplus, coldDepositPermit:
+		if !w.hasWords(4) {
+			return fmt.Errorf("short surplus cmd input")
+		}
+		token := w.addr(3)
+		rows.Bals = append(rows.Bals, d.balance(tx.user, token, tx, 0))
+		if recv := w.addr(1); recv != tx.user && recv != zeroAddr {
+			rows.Bals = append(rows.Bals, d.balance(recv, token, tx, 1))
+		}
+
+	case coldSidePocket:
+		if !w.hasWords(5) {
+			return fmt.Errorf("short side pocket input")
+		}
+		rows.Bals = append(rows.Bals, d.balance(tx.user, w.addr(4), tx, 0))
+	}
+	return nil
+}
+
+func (d *dexLogDecoder) decodeProtocol(w abiWords, tx dexLogTx, rows *DexLogRows) error {
+	if !w.hasWords(1) {
+		return fmt.Errorf("empty protocol cmd input")
+	}
+
+	switch w.int(0) {
+	case protoPoolTemplate:
+		if !w.hasWords(3) {
+			return fmt.Errorf("short pool template input")
+		}
+		setLearned(d, d.templateFees, w.int(1), w.int(2), tx.block)
+
+	case protoPoolRevise:
+		if !w.hasWords(5) {
+			return fmt.Errorf("short pool revise input")
+		}
+		pool := d.registerTxPool(w.addr(1), w.addr(2), w.int(3), tx)
+		d.feeChange(pool, w.int(4), tx, rows)
+	}
+	return nil
+}
+
+// Rows loaded from the startup cache are never decoded from logs, so their pools, template
+// fees and knockout pivots are taken from the rows instead. A pool's first fee change is its
+// initialization, so it has its template's fee rate at the time.
+func (d *dexLogDecoder) observeFee(row tables.FeeChange) {
+	pool := dexPool{base: row.Base, quote: row.Quote, poolIdx: row.PoolIdx}
+	if _, ok := d.pools[d.poolHash(pool)]; !ok {
+		d.templateFees[row.PoolIdx] = row.FeeRate
+	}
+	d.registerPool(row.Base, row.Quote, row.PoolIdx)
+}
+
+func (d *dexLogDecoder) observeCross(row tables.KnockoutCross) {
+	pool := d.registerPool(row.Base, row.Quote, row.PoolIdx)
+	d.koPivots[koPivotKey{d.poolHash(pool), row.Tick, row.IsBid != 0}] = row.PivotTime
+}
+
+// Pool state the decoder builds up from earlier logs, saved with the state snapshots so
+// that the log sync can resume without them
+type DexLogState struct {
+	TemplateFees map[int]int
+	Pools        []DexLogPool
+	KoPivots     []DexLogPivot
+}
+
+type DexLogPool struct {
+	Base    string
+	Quote   string
+	PoolIdx int
+}
+
+type DexLogPivot struct {
+	Pool      common.Hash
+	Tick      int
+	IsBid     bool
+	PivotTime int
+}
+
+func (d *dexLogDecoder) state() DexLogState {
+	state := DexLogState{
+		TemplateFees: maps.Clone(d.templateFees),
+		Pools:        make([]DexLogPool, 0, len(d.pools)),
+		KoPivots:     make([]DexLogPivot, 0, len(d.koPivots)),
+	}
+	for _, pool := range d.pools {
+		state.Pools = append(state.Pools, DexLogPool{pool.base, pool.quote, pool.poolIdx})
+	}
+	for key, pivotTime := range d.koPivots {
+		state.KoPivots = append(state.KoPivots, DexLogPivot{key.pool, key.tick, key.isBid, pivotTime})
+	}
+	return state
+}
+
+func (d *dexLogDecoder) restoreState(state DexLogState) {
+	maps.Copy(d.templateFees, state.TemplateFees)
+	for _, pool := range state.Pools {
+		d.registerPool(pool.Base, pool.Quote, pool.PoolIdx)
+	}
+	for _, pivot := range state.KoPivots {
+		d.koPivots[koPivotKey{pivot.Pool, pivot.Tick, pivot.IsBid}] = pivot.PivotTime
+	}
+}
+
+func (d *dexLogDecoder) feeChange(pool dexPool, feeRate int, tx dexLogTx, rows *DexLogRows) {
+	rows.Fees = append(rows.Fees, tables.FeeChange{
+		ID:        d.rowId(tx),
+		CallIndex: tx.callIndex,
+		Network:   d.network,
+		Tx:        tx.hash,
+		Block:     tx.block,
+		Time:      tx.time,
+		Base:      pool.base,
+		Quote:     pool.quote,
+		PoolIdx:   pool.poolIdx,
+		PoolHash:  d.poolHash(pool).Hex(),
+		FeeRate:   feeRate,
+	})
+
+	agg := d.aggEvent(pool, tx)
+	agg.IsFeeChange = true
+	agg.FeeRate = feeRate
+	rows.Aggs = append(rows.Aggs, agg)
+}
+
+func (d *dexLogDecoder) liqChange(pool dexPool, user string, posType tables.PosType, changeType tables.ChangeType,
+	bidTick int, askTick int, isBid bool, baseFlow *big.Int, quoteFlow *big.Int, tx dexLogTx) tables.LiqChange {
+	return tables.LiqChange{
+		ID:           d.rowId(tx),
+		CallIndex:    tx.callIndex,
+		Network:      d.network,
+		TX:           tx.hash,
+		Base:         pool.base,
+		Quote:        pool.quote,
+		PoolIdx:      pool.poolIdx,
+		PoolHash:     d.poolHash(pool).Hex(),
+		User:         user,
+		Block:        tx.block,
+		Time:         tx.time,
+		PositionType: posType,
+		ChangeType:   changeType,
+		BidTick:      bidTick,
+		AskTick:      askTick,
+		IsBid:        boolToInt(isBid),
+		BaseFlow:     nullableBigToFloat(baseFlow),
+		QuoteFlow:    nullableBigToFloat(quoteFlow),
+		Source:       "rpc",
+	}
+}
+
+func (d *dexLogDecoder) liqAggEvent(pool dexPool, posType tables.PosType, bidTick int, askTick int,
+	baseFlow *big.Int, quoteFlow *big.Int, tx dexLogTx) tables.AggEvent {
+	agg := d.aggEvent(pool, tx)
+	agg.IsLiq = true
+	agg.BidTick = bidTick
+	agg.AskTick = askTick
+	agg.IsTickSkewed = posType == tables.PosTypeConcentrated
+	// Knockout flows are at the order's limit price, not the pool price
+	agg.FlowsAtMarket = posType != tables.PosTypeKnockout
+	agg.BaseFlow = bigToFloat(baseFlow)
+	agg.QuoteFlow = bigToFloat(quoteFlow)
+	return agg
+}
+
+func (d *dexLogDecoder) aggEvent(pool dexPool, tx dexLogTx) tables.AggEvent {
+	return tables.AggEvent{
+		ID:         d.rowId(tx),
+		Network:    d.network,
+		Base:       pool.base,
+		Quote:      pool.quote,
+		PoolIdx:    pool.poolIdx,
+		Block:      tx.block,
+		Time:       tx.time,
+		EventIndex: tx.logIndex,
+	}
+}
+
+func (d *dexLogDecoder) balance(user string, token string, tx dexLogTx, idx int) tables.Balance {
+	return tables.Balance{
+		ID:      d.rowId(tx) + "-" + strconv.Itoa(idx),
+		Network: d.network,
+		Tx:      tx.hash,
+		Block:   tx.block,
+		Time:    tx.time,
+		User:    user,
+		Token:   token,
+	}
+}
+
+// Commands that settle against the user's surplus collateral touch their balances
+func (d *dexLogDecoder) reserveBalances(pool dexPool, reserveFlags int, tx dexLogTx, rows *DexLogRows) {
+	if reserveFlags&reserveFlagBase != 0 {
+		rows.Bals = append(rows.Bals, d.balance(tx.user, pool.base, tx, 0))
+	}
+	if reserveFlags&reserveFlagQuote != 0 {
+		rows.Bals = append(rows.Bals, d.balance(tx.user, pool.quote, tx, 1))
+	}
+}
+
+func (d *dexLogDecoder) rowId(tx dexLogTx) string {
+	return d.network + tx.hash + "-" + strconv.Itoa(tx.logIndex)
+}
+
+func (d *dexLogDecoder) registerPool(base string, quote string, poolIdx int) dexPool {
+	pool := dexPool{base: base, quote: quote, poolIdx: poolIdx}
+	d.pools[d.poolHash(pool)] = pool
+	return pool
+}
+
+// Same as registerPool for a pool seen in a log, so the pool is forgotten if the log's
+// block is rolled back
+func (d *dexLogDecoder) registerTxPool(base string, quote string, poolIdx int, tx dexLogTx) dexPool {
+	pool := dexPool{base: base, quote: quote, poolIdx: poolIdx}
+	setLearned(d, d.pools, d.poolHash(pool), pool, tx.block)
+	return pool
+}
+
+// Sets protocol state learned from a log. Unless the value is unchanged, the previous value
+// is journaled so that it's restored if the block is reorged out.
+func setLearned[K comparable, V comparable](d *dexLogDecoder, state map[K]V, key K, val V, block int) {
+	prev, existed := state[key]
+	if existed && prev == val {
+		return
+	}
+	state[key] = val
+	if d.journal == nil {
+		return
+	}
+	d.journal(block, func() {
+		if existed {
+			state[key] = prev
+		} else {
+			delete(state, key)
+		}
+	})
+}
+
+// Same as PoolSpecs::encodeKey() in the dex contract
+func (d *dexLogDecoder) poolHash(pool dexPool) common.Hash {
+	buf := make([]byte, 96)
+	copy(buf[12:32], common.HexToAddress(pool.base).Bytes())
+	copy(buf[44:64], common.HexToAddress(pool.quote).Bytes())
+	big.NewInt(int64(pool.poolIdx)).FillBytes(buf[64:96])
+	return crypto.Keccak256Hash(buf)
+}
+
+// Knockout pivots are keyed by the tick the order is knocked out at
+func koPivotTick(bidTick int, askTick int, isBid bool) int {
+	if isBid {
+		return bidTick
+	}
+	return askTick
+}
+
+const zeroAddr = "0x0000000000000000000000000000000000000000"
+
+// ABI encoded static arguments, one 32 byte word each
+type abiWords []byte
+
+func (w abiWords) hasWords(n int) bool {
+	return len(w) >= 32*n
+}
+
+func (w abiWords) word(i int) []byte {
+	return w[32*i : 32*(i+1)]
+}
+
+func (w abiWords) uint(i int) *big.Int {
+	return new(big.Int).SetBytes(w.word(i))
+}
+
+func (w abiWords) int(i int) int {
+	val := w.uint(i)
+	if val.Bit(255) == 1 {
+		val.Sub(val, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+	return int(val.Int64())
+}
+
+func (w abiWords) bool(i int) bool {
+	return w.word(i)[31] != 0
+}
+
+func (w abiWords) addr(i int) string {
+	return strings.ToLower(common.BytesToAddress(w.word(i)).Hex())
+}
+
+// Dynamic bytes argument whose offset is stored at word i
+func (w abiWords) dynBytes(i int) abiWords {
+	offset := w.int(i)
+	if offset < 0 || len(w) < offset+32 {
+		return nil
+	}
+	size := int(new(big.Int).SetBytes(w[offset : offset+32]).Int64())
+	start := offset + 32
+	if size < 0 || len(w) < start+size {
+		return nil
+	}
+	return w[start : start+size]
+}
+
+func topicAddr(topic common.Hash) string {
+	return strings.ToLower(common.BytesToAddress(topic.Bytes()).Hex())
+}
+
+func bigToFloat(val *big.Int) float64 {
+	if val == nil {
+		return 0
+	}
+	result, _ := new(big.Float).SetInt(val).Float64()
+	return result
+}
+
+func nullableBigToFloat(val *big.Int) *float64 {
+	if val == nil {
+		return nil
+	}
+	result := bigToFloat(val)
+	return &result
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,313 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/tables"
+	"github.com/CrocSwap/graphcache-go/types"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+)
+
+// Subset of the node API needed to read dex events. Satisfied by ethclient.Client, RpcPool
+// and the go-ethereum simulated backend.
+type DexLogClient interface {
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]ethtypes.Log, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*ethtypes.Header, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (tx *ethtypes.Transaction, isPending bool, err error)
+}
+
+// Optional node API for finding the dex's direct caller on txs sent through a router or
+// another contract. Satisfied by RpcPool on nodes that serve the debug namespace.
+type DexTraceClient interface {
+	TraceTransaction(ctx context.Context, hash common.Hash) (*CallFrame, error)
+}
+
+// Call frame returned by the callTracer with withLog enabled
+type CallFrame struct {
+	Type  string         `json:"type"`
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Logs  []CallFrameLog `json:"logs"`
+	Calls []CallFrame    `json:"calls"`
+}
+
+type CallFrameLog struct {
+	Address common.Address `json:"address"`
+	Topics  []common.Hash  `json:"topics"`
+	// Number of sub-calls made by the frame before the log was emitted
+	Position hexutil.Uint `json:"position"`
+}
+
+const DEFAULT_LOG_BLOCK_RANGE = 2000
+const LOG_RPC_TIMEOUT = 30 * time.Second
+
+// Reads the CrocSwap dex event logs over RPC and decodes them into table rows, as an
+// alternative to querying the subgraph.
+type DexLogSource struct {
+	client     DexLogClient
+	dex        common.Address
+	blockRange int
+	decoder    *dexLogDecoder
+	warnTrace  sync.Once
+}
+
+func NewDexLogSource(client DexLogClient, chain ChainConfig, network types.NetworkName) *DexLogSource {
+	return newDexLogSource(client, chain, network, DEX_EVENTS_ABI_PATH)
+}
+
+func newDexLogSource(client DexLogClient, chain ChainConfig, network types.NetworkName, abiPath string) *DexLogSource {
+	if !common.IsHexAddress(chain.DexContract) {
+		log.Fatalf("Log event source on %s requires crocswap_contract", network)
+	}
+	blockRange := chain.LogBlockRange
+	if blockRange <= 0 {
+		blockRange = DEFAULT_LOG_BLOCK_RANGE
+	}
+	return &DexLogSource{
+		client:     client,
+		dex:        common.HexToAddress(chain.DexContract),
+		blockRange: blockRange,
+		decoder:    newDexLogDecoder(string(network), abiPath),
+	}
+}
+
+func (s *DexLogSource) BlockRange() int {
+	return s.blockRange
+}
+
+func (s *DexLogSource) LatestBlock() (int, error) {
+	block, _, err := s.LatestHead()
+	return block, err
+}
+
+// Returns the number and hash of the latest block on the node
+func (s *DexLogSource) LatestHead() (int, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), LOG_RPC_TIMEOUT)
+	defer cancel()
+	header, err := s.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	return int(header.Number.Int64()), strings.ToLower(header.Hash().Hex()), nil
+}
+
+// Fetches and decodes all dex events in the inclusive block range. Ranges must be
+// fetched in ascending order, because the decoder tracks protocol state across events.
+func (s *DexLogSource) FetchRange(fromBlock int, toBlock int) (*DexLogRows, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), LOG_RPC_TIMEOUT)
+	defer cancel()
+
+	logs, err := s.client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: big.NewInt(int64(fromBlock)),
+		ToBlock:   big.NewInt(int64(toBlock)),
+		Addresses: []common.Address{s.dex},
+		Topics:    [][]common.Hash{s.decoder.topics()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+
+	rows := &DexLogRows{}
+	blockTimes := make(map[uint64]int)
+	callers := make(map[common.Hash]*dexTxCallers)
+	callIndices := make(map[common.Hash]int)
+
+	for _, l := range logs {
+		if l.Removed {
+			continue
+		}
+
+		blockTime, ok := blockTimes[l.BlockNumber]
+		if !ok {
+			header, err := s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(l.BlockNumber))
+			if err != nil {
+				return nil, err
+			}
+			blockTime = int(header.Time)
+			blockTimes[l.BlockNumber] = blockTime
+		}
+
+		txCallers, ok := callers[l.TxHash]
+		if !ok {
+			txCallers, err = s.txCallers(ctx, l.TxHash)
+			if err != nil {
+				return nil, err
+			}
+			callers[l.TxHash] = txCallers
+		}
+
+		tx := dexLogTx{
+			hash:      strings.ToLower(l.TxHash.Hex()),
+			user:      txCallers.user(callIndices[l.TxHash]),
+			block:     int(l.BlockNumber),
+			time:      blockTime,
+			callIndex: callIndices[l.TxHash],
+			logIndex:  int(l.Index),
+		}
+		callIndices[l.TxHash] += 1
+
+		if err := s.decoder.decode(l, tx, rows); err != nil {
+			log.Printf("Warning unable to decode dex log %s-%d: %s", tx.hash, tx.logIndex, err.Error())
+		}
+	}
+	return rows, nil
+}
+
+// Callers of the dex for each of a tx's dex logs, in log order. Falls back to the tx sender
+// for logs that couldn't be traced.
+type dexTxCallers struct {
+	sender  string
+	callers []string
+}
+
+func (c *dexTxCallers) user(logIdx int) string {
+	if logIdx < len(c.callers) {
+		return c.callers[logIdx]
+	}
+	return c.sender
+}
+
+// The tx sender is the dex's msg.sender when the tx calls the dex directly. Otherwise the
+// caller of each dex call is found by tracing the tx, if the node supports it.
+func (s *DexLogSource) txCallers(ctx context.Context, hash common.Hash) (*dexTxCallers, error) {
+	tx, _, err := s.client.TransactionByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := ethtypes.Sender(ethtypes.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to recover sender of %s: %w", hash.Hex(), err)
+	}
+	result := &dexTxCallers{sender: strings.ToLower(sender.Hex())}
+	if tx.To() == nil || *tx.To() == s.dex {
+		return result, nil
+	}
+
+	tracer, ok := s.client.(DexTraceClient)
+	if !ok {
+		s.warnTrace.Do(func() {
+			log.Printf("Warning: RPC client can't trace txs, routed dex calls are attributed to the tx sender")
+		})
+		return result, nil
+	}
+	frame, err := tracer.TraceTransaction(ctx, hash)
+	if err != nil {
+		s.warnTrace.Do(func() {
+			log.Printf("Warning: unable to trace routed dex calls, attributing them to the tx sender: %s", err.Error())
+		})
+		return result, nil
+	}
+	result.callers = dexLogCallers(frame, s.dex, s.decoder.topics())
+	return result, nil
+}
+
+// Walks the call tree in execution order and returns the msg.sender of the dex call that
+// emitted each dex event. Logs from the dex's delegate calls into its sidecar contracts are
+// emitted from the dex's address, so they're attributed to the enclosing call into the dex.
+func dexLogCallers(frame *CallFrame, dex common.Address, topics []common.Hash) []string {
+	events := make(map[common.Hash]bool, len(topics))
+	for _, topic := range topics {
+		events[topic] = true
+	}
+
+	callers := make([]string, 0)
+	var walk func(frame *CallFrame, caller string)
+	walk = func(frame *CallFrame, caller string) {
+		if frame.To == dex && frame.Type != "DELEGATECALL" {
+			caller = strings.ToLower(frame.From.Hex())
+		}
+		logIdx := 0
+		for callIdx := 0; callIdx <= len(frame.Calls); callIdx++ {
+			for ; logIdx < len(frame.Logs) && int(frame.Logs[logIdx].Position) <= callIdx; logIdx++ {
+				l := frame.Logs[logIdx]
+				if l.Address == dex && len(l.Topics) > 0 && events[l.Topics[0]] {
+					callers = append(callers, caller)
+				}
+			}
+			if callIdx < len(frame.Calls) {
+				walk(&frame.Calls[callIdx], caller)
+			}
+		}
+	}
+	walk(frame, "")
+	return callers
+}
+
+// Rebuilds the decoder's protocol state from subgraph rows loaded from the startup cache,
+// since the log sync resumes after them.
+func (s *DexLogSource) ObserveEntries(table string, data []byte) error {
+	switch table {
+	case "feeChanges":
+		tbl := tables.FeeTable{}
+		entries, err := tbl.ParseSubGraphRespUnwrapped(data)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			s.decoder.observeFee(tbl.ConvertSubGraphRow(entry, s.decoder.network))
+		}
+	case "knockoutCrosses":
+		tbl := tables.KnockoutTable{}
+		entries, err := tbl.ParseSubGraphRespUnwrapped(data)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			s.decoder.observeCross(tbl.ConvertSubGraphRow(entry, s.decoder.network))
+		}
+	}
+	return nil
+}
+
+// Journals the protocol state the decoder learns from each block with the undo function, so
+// it's rolled back with the block's rows on a reorg. Undos must be run on the goroutine
+// fetching the logs.
+func (s *DexLogSource) SetJournal(record func(block int, undo func())) {
+	s.decoder.journal = record
+}
+
+// Should only be called from the goroutine fetching the logs
+func (s *DexLogSource) State() DexLogState {
+	return s.decoder.state()
+}
+
+func (s *DexLogSource) RestoreState(state DexLogState) {
+	s.decoder.restoreState(state)
+}
+
+// Returns a client for reading dex logs on the chain's RPC endpoint
+func (c *OnChainLoader) DexLogClient(chainId types.ChainId) (DexLogClient, error) {
+	pool, err := c.rpcPoolForChain(chainId)
+	if err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// Returns the hash of the block currently on the canonical chain, used for reorg checks
+func (s *DexLogSource) BlockHash(block int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), LOG_RPC_TIMEOUT)
+	defer cancel()
+	header, err := s.client.HeaderByNumber(ctx, big.NewInt(int64(block)))
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(header.Hash().Hex()), nil
+}
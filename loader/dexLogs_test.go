@@ -0,0 +1,397 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/gob"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/tables"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Stand-in for the dex contract. Emits LOG3 with the first three calldata words as the
+// topics and the rest of the calldata as the log data.
+const logEmitterRuntime = "604035602035600035606036038060606000376000a300"
+const logEmitterInit = "601780600b6000396000f3"
+
+const testEventsAbi = "../artifacts/abis/CrocEvents.json"
+
+const simBase = "0x0000000000000000000000000000000000000000"
+const simQuote = "0x1111111111111111111111111111111111111111"
+const simPoolIdx = 36000
+
+type simDex struct {
+	t      *testing.T
+	sim    *backends.SimulatedBackend
+	key    *ecdsa.PrivateKey
+	from   common.Address
+	addr   common.Address
+	nonce  uint64
+	signer ethtypes.Signer
+	abi    abi.ABI
+}
+
+func newSimDex(t *testing.T) *simDex {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	alloc := core.GenesisAlloc{from: {Balance: new(big.Int).Lsh(big.NewInt(1), 100)}}
+
+	d := &simDex{
+		t:      t,
+		sim:    backends.NewSimulatedBackend(alloc, 30_000_000),
+		key:    key,
+		from:   from,
+		signer: ethtypes.LatestSignerForChainID(big.NewInt(1337)),
+		abi:    dexEventsAbi(testEventsAbi),
+	}
+
+	hash := d.sendTx(nil, common.FromHex(logEmitterInit+logEmitterRuntime))
+	receipt, err := d.sim.TransactionReceipt(context.Background(), hash)
+	if err != nil || receipt.Status != ethtypes.ReceiptStatusSuccessful {
+		t.Fatalf("Log emitter deploy failed: %v", err)
+	}
+	d.addr = receipt.ContractAddress
+	return d
+}
+
+func (d *simDex) sendTx(to *common.Address, data []byte) common.Hash {
+	gasPrice, _ := d.sim.SuggestGasPrice(context.Background())
+	tx := ethtypes.NewTx(&ethtypes.LegacyTx{
+		Nonce:    d.nonce,
+		To:       to,
+		Gas:      1_000_000,
+		GasPrice: gasPrice,
+		Data:     data,
+	})
+	signed, err := ethtypes.SignTx(tx, d.signer, d.key)
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	if err := d.sim.SendTransaction(context.Background(), signed); err != nil {
+		d.t.Fatal(err)
+	}
+	d.sim.Commit()
+	d.nonce++
+	return signed.Hash()
+}
+
+func (d *simDex) emit(event string, topics []common.Hash, args ...interface{}) common.Hash {
+	data, err := d.abi.Events[event].Inputs.NonIndexed().Pack(args...)
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	words := make([]common.Hash, 3)
+	words[0] = d.abi.Events[event].ID
+	copy(words[1:], topics)
+
+	calldata := make([]byte, 0, 96+len(data))
+	for _, word := range words {
+		calldata = append(calldata, word.Bytes()...)
+	}
+	return d.sendTx(&d.addr, append(calldata, data...))
+}
+
+func encodeCmd(t *testing.T, argTypes []string, vals ...interface{}) []byte {
+	args := abi.Arguments{}
+	for _, argType := range argTypes {
+		typ, err := abi.NewType(argType, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args = append(args, abi.Argument{Type: typ})
+	}
+	packed, err := args.Pack(vals...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packed
+}
+
+func TestDexLogSource(t *testing.T) {
+	d := newSimDex(t)
+
+	base, quote := common.HexToAddress(simBase), common.HexToAddress(simQuote)
+	poolIdx := big.NewInt(simPoolIdx)
+
+	template := encodeCmd(t, []string{"uint8", "uint256", "uint16", "uint16", "uint8", "uint8", "uint8"},
+		uint8(110), poolIdx, uint16(500), uint16(16), uint8(0), uint8(0), uint8(0))
+	d.emit("CrocColdProtocolCmd", nil, template)
+
+	initPool := encodeCmd(t, []string{"uint8", "address", "address", "uint256", "uint128"},
+		uint8(71), base, quote, poolIdx, big.NewInt(1<<50))
+	d.emit("CrocColdCmd", nil, initPool)
+
+	mint := encodeCmd(t, []string{"uint8", "address", "address", "uint256", "int24", "int24", "uint128",
+		"uint128", "uint128", "uint8", "address"},
+		uint8(1), base, quote, poolIdx, big.NewInt(-100), big.NewInt(200), big.NewInt(1000000),
+		big.NewInt(0), big.NewInt(0), uint8(0), common.Address{})
+	mintTx := d.emit("CrocWarmCmd", nil, mint, big.NewInt(5000), big.NewInt(7000))
+
+	d.emit("CrocSwap", []common.Hash{common.BytesToHash(base.Bytes()), common.BytesToHash(quote.Bytes())},
+		poolIdx, true, false, big.NewInt(100), uint16(0), big.NewInt(0), big.NewInt(0), uint8(2),
+		big.NewInt(-90), big.NewInt(100))
+
+	koMintCmd := encodeCmd(t, []string{"uint8", "address", "address", "uint256", "int24", "int24", "bool",
+		"uint8", "bytes"},
+		uint8(91), base, quote, poolIdx, big.NewInt(-64), big.NewInt(0), true, uint8(0),
+		encodeCmd(t, []string{"uint128", "bool"}, big.NewInt(1000), false))
+	d.emit("CrocKnockoutCmd", nil, koMintCmd, big.NewInt(1000), big.NewInt(0))
+
+	poolHash := newDexLogDecoder("", testEventsAbi).poolHash(dexPool{simBase, simQuote, simPoolIdx})
+	tickTopic := common.BigToHash(new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(64)))
+	d.emit("CrocKnockoutCross", []common.Hash{poolHash, tickTopic}, true, uint32(12345), uint64(777), big.NewInt(0))
+
+	koClaimCmd := encodeCmd(t, []string{"uint8", "address", "address", "uint256", "int24", "int24", "bool",
+		"uint8", "bytes"},
+		uint8(93), base, quote, poolIdx, big.NewInt(-64), big.NewInt(0), true, uint8(0), []byte{})
+	d.emit("CrocKnockoutCmd", nil, koClaimCmd, big.NewInt(0), big.NewInt(-990))
+
+	deposit := encodeCmd(t, []string{"uint8", "address", "uint128", "address"},
+		uint8(73), common.HexToAddress("0x2222222222222222222222222222222222222222"), big.NewInt(10), quote)
+	d.emit("CrocColdCmd", nil, deposit)
+
+	chain := ChainConfig{DexContract: d.addr.Hex(), LogBlockRange: 3}
+	source := newDexLogSource(d.sim, chain, "sim", testEventsAbi)
+
+	latest, err := source.LatestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := &DexLogRows{}
+	for start := 0; start <= latest; start += source.BlockRange() {
+		fetched, err := source.FetchRange(start, min(start+source.BlockRange()-1, latest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Swaps = append(rows.Swaps, fetched.Swaps...)
+		rows.Aggs = append(rows.Aggs, fetched.Aggs...)
+		rows.Liqs = append(rows.Liqs, fetched.Liqs...)
+		rows.Kos = append(rows.Kos, fetched.Kos...)
+		rows.Fees = append(rows.Fees, fetched.Fees...)
+		rows.Bals = append(rows.Bals, fetched.Bals...)
+	}
+
+	user := strings.ToLower(d.from.Hex())
+
+	if len(rows.Fees) != 1 || rows.Fees[0].FeeRate != 500 || rows.Fees[0].PoolIdx != simPoolIdx {
+		t.Fatalf("Expected init pool fee change from template: %+v", rows.Fees)
+	}
+
+	if len(rows.Swaps) != 1 {
+		t.Fatalf("Expected one swap: %+v", rows.Swaps)
+	}
+	swap := rows.Swaps[0]
+	if swap.User != user || swap.Base != simBase || swap.Quote != simQuote || swap.IsBuy != 1 ||
+		swap.InBaseQty != 0 || swap.BaseFlow != -90 || swap.QuoteFlow != 100 {
+		t.Fatalf("Bad swap row: %+v", swap)
+	}
+
+	// Range mint, knockout mint, cross and knockout claim
+	if len(rows.Liqs) != 4 {
+		t.Fatalf("Expected 4 liq changes: %+v", rows.Liqs)
+	}
+	mintRow := rows.Liqs[0]
+	if mintRow.TX != strings.ToLower(mintTx.Hex()) || mintRow.User != user || mintRow.PositionType != tables.PosTypeConcentrated ||
+		mintRow.ChangeType != tables.ChangeTypeMint || mintRow.BidTick != -100 || mintRow.AskTick != 200 ||
+		*mintRow.Liq != 1000000 || *mintRow.BaseFlow != 5000 || *mintRow.QuoteFlow != 7000 {
+		t.Fatalf("Bad mint row: %+v", mintRow)
+	}
+
+	if len(rows.Kos) != 1 {
+		t.Fatalf("Expected one knockout cross: %+v", rows.Kos)
+	}
+	cross := rows.Kos[0]
+	if cross.Tick != -64 || cross.IsBid != 1 || cross.PivotTime != 12345 || cross.FeeMileage != 777 ||
+		cross.Base != simBase || cross.PoolIdx != simPoolIdx {
+		t.Fatalf("Bad knockout cross row: %+v", cross)
+	}
+	crossRow := rows.Liqs[2]
+	if crossRow.ChangeType != tables.ChangeTypeCross || crossRow.ID != cross.ID || crossRow.TX != cross.Tx ||
+		crossRow.BidTick != -64 || crossRow.IsBid != 1 || *crossRow.PivotTime != 12345 {
+		t.Fatalf("Bad knockout cross liq row: %+v", crossRow)
+	}
+	claim := rows.Liqs[3]
+	if claim.ChangeType != tables.ChangeTypeClaim || claim.PositionType != tables.PosTypeKnockout ||
+		*claim.PivotTime != 12345 {
+		t.Fatalf("Bad knockout claim row: %+v", claim)
+	}
+
+	// Fee change, range mint, swap, knockout mint and knockout claim
+	if len(rows.Aggs) != 5 || !rows.Aggs[0].IsFeeChange || !rows.Aggs[1].IsTickSkewed ||
+		!rows.Aggs[2].IsSwap || rows.Aggs[3].FlowsAtMarket {
+		t.Fatalf("Bad agg events: %+v", rows.Aggs)
+	}
+
+	// Quote surplus on the swap, then the sender and recipient of the deposit
+	if len(rows.Bals) != 3 || rows.Bals[0].Token != simQuote || rows.Bals[2].User != "0x2222222222222222222222222222222222222222" {
+		t.Fatalf("Bad balance rows: %+v", rows.Bals)
+	}
+
+	ids := make(map[string]bool)
+	for _, row := range rows.Liqs {
+		if ids[row.ID] {
+			t.Fatalf("Duplicate row ID %s", row.ID)
+		}
+		ids[row.ID] = true
+	}
+}
+
+func TestDexLogCallers(t *testing.T) {
+	dex := common.HexToAddress("0xdddddddddddddddddddddddddddddddddddddddd")
+	sidecar := common.HexToAddress("0x5555555555555555555555555555555555555555")
+	router := common.HexToAddress("0x7777777777777777777777777777777777777777")
+	user := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	token := common.HexToAddress("0x2222222222222222222222222222222222222222")
+
+	events := dexEventsAbi(testEventsAbi).Events
+	warm, swap := events["CrocWarmCmd"].ID, events["CrocSwap"].ID
+	transfer := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+
+	// The user calls a router, which calls the dex twice. The first call delegates to a
+	// sidecar that emits the event, and the token transfer in between isn't a dex event.
+	frame := &CallFrame{
+		Type: "CALL", From: user, To: router,
+		Calls: []CallFrame{
+			{Type: "CALL", From: router, To: dex, Calls: []CallFrame{
+				{Type: "DELEGATECALL", From: dex, To: sidecar,
+					Logs: []CallFrameLog{{Address: dex, Topics: []common.Hash{warm}}}},
+			}},
+			{Type: "CALL", From: router, To: token,
+				Logs: []CallFrameLog{{Address: token, Topics: []common.Hash{transfer}}}},
+			{Type: "CALL", From: router, To: dex,
+				Logs: []CallFrameLog{{Address: dex, Topics: []common.Hash{swap}}}},
+		},
+		// Emitted by the router after its calls, so it's not from the dex
+		Logs: []CallFrameLog{{Address: router, Topics: []common.Hash{swap}, Position: 3}},
+	}
+	callers := dexLogCallers(frame, dex, []common.Hash{warm, swap})
+	routerAddr := strings.ToLower(router.Hex())
+	if len(callers) != 2 || callers[0] != routerAddr || callers[1] != routerAddr {
+		t.Fatalf("Expected both dex events attributed to the router: %v", callers)
+	}
+
+	// Logs are ordered against the frame's sub-calls by their position
+	frame = &CallFrame{
+		Type: "CALL", From: user, To: dex,
+		Calls: []CallFrame{{Type: "CALL", From: dex, To: router, Calls: []CallFrame{
+			{Type: "CALL", From: router, To: dex,
+				Logs: []CallFrameLog{{Address: dex, Topics: []common.Hash{swap}}}},
+		}}},
+		Logs: []CallFrameLog{
+			{Address: dex, Topics: []common.Hash{warm}, Position: 0},
+			{Address: dex, Topics: []common.Hash{warm}, Position: 1},
+		},
+	}
+	callers = dexLogCallers(frame, dex, []common.Hash{warm, swap})
+	userAddr := strings.ToLower(user.Hex())
+	if len(callers) != 3 || callers[0] != userAddr || callers[1] != routerAddr || callers[2] != userAddr {
+		t.Fatalf("Bad callers on nested dex call: %v", callers)
+	}
+}
+
+func TestDexLogObserveStartupRows(t *testing.T) {
+	d := newDexLogDecoder("sim", testEventsAbi)
+	pool := dexPool{simBase, simQuote, simPoolIdx}
+	poolHash := d.poolHash(pool)
+
+	// The second fee change is a revision, so the template fee is from the first
+	d.observeFee(tables.FeeChange{Base: simBase, Quote: simQuote, PoolIdx: simPoolIdx, FeeRate: 500})
+	d.observeFee(tables.FeeChange{Base: simBase, Quote: simQuote, PoolIdx: simPoolIdx, FeeRate: 900})
+	d.observeCross(tables.KnockoutCross{Base: simBase, Quote: simQuote, PoolIdx: simPoolIdx,
+		PoolHash: poolHash.Hex(), Tick: -64, IsBid: 1, PivotTime: 12345})
+
+	if d.templateFees[simPoolIdx] != 500 {
+		t.Fatalf("Bad template fee: %d", d.templateFees[simPoolIdx])
+	}
+	if d.pools[poolHash] != pool {
+		t.Fatalf("Pool not registered: %+v", d.pools)
+	}
+	if d.koPivots[koPivotKey{poolHash, -64, true}] != 12345 {
+		t.Fatalf("Bad knockout pivot: %+v", d.koPivots)
+	}
+
+	// A claim after the restart finds the pivot from the cached cross
+	rows := &DexLogRows{}
+	claim := encodeCmd(t, []string{"uint8", "address", "address", "uint256", "int24", "int24", "bool",
+		"uint8", "bytes"},
+		uint8(93), common.HexToAddress(simBase), common.HexToAddress(simQuote), big.NewInt(simPoolIdx),
+		big.NewInt(-64), big.NewInt(0), true, uint8(0), []byte{})
+	if err := d.decodeKnockout(abiWords(claim), big.NewInt(0), big.NewInt(-990), dexLogTx{}, rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows.Liqs) != 1 || *rows.Liqs[0].PivotTime != 12345 {
+		t.Fatalf("Bad claim row after startup rows: %+v", rows.Liqs)
+	}
+}
+
+func TestDexLogStateRoundTrip(t *testing.T) {
+	d := newDexLogDecoder("sim", testEventsAbi)
+	d.observeFee(tables.FeeChange{Base: simBase, Quote: simQuote, PoolIdx: simPoolIdx, FeeRate: 500})
+	d.observeCross(tables.KnockoutCross{Base: simBase, Quote: simQuote, PoolIdx: simPoolIdx,
+		Tick: -64, IsBid: 1, PivotTime: 12345})
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(d.state()); err != nil {
+		t.Fatal(err)
+	}
+	var state DexLogState
+	if err := gob.NewDecoder(&buf).Decode(&state); err != nil {
+		t.Fatal(err)
+	}
+	restored := newDexLogDecoder("sim", testEventsAbi)
+	restored.restoreState(state)
+
+	if !reflect.DeepEqual(restored.templateFees, d.templateFees) ||
+		!reflect.DeepEqual(restored.pools, d.pools) || !reflect.DeepEqual(restored.koPivots, d.koPivots) {
+		t.Fatalf("Bad restored decoder state %+v %+v %+v", restored.templateFees, restored.pools, restored.koPivots)
+	}
+}
+
+func TestDexLogStateRollback(t *testing.T) {
+	d := newDexLogDecoder("sim", testEventsAbi)
+	d.observeFee(tables.FeeChange{Base: simBase, Quote: simQuote, PoolIdx: simPoolIdx, FeeRate: 500})
+	d.observeCross(tables.KnockoutCross{Base: simBase, Quote: simQuote, PoolIdx: simPoolIdx,
+		Tick: -64, IsBid: 1, PivotTime: 100})
+	before := d.state()
+
+	type undoAt struct {
+		block int
+		undo  func()
+	}
+	var journal []undoAt
+	d.journal = func(block int, undo func()) { journal = append(journal, undoAt{block, undo}) }
+
+	// Learned from blocks that are then reorged out
+	rows := &DexLogRows{}
+	template := encodeCmd(t, []string{"uint8", "uint256", "uint16"}, uint8(110), big.NewInt(simPoolIdx), uint16(900))
+	if err := d.decodeProtocol(abiWords(template), dexLogTx{block: 10}, rows); err != nil {
+		t.Fatal(err)
+	}
+	otherPool := d.registerTxPool(simBase, simQuote, simPoolIdx+1, dexLogTx{block: 11})
+	poolHash := d.poolHash(dexPool{simBase, simQuote, simPoolIdx})
+	d.decodeCross(poolHash, -64, true, 200, big.NewInt(0), dexLogTx{block: 12}, rows)
+	// Already known, so there's nothing to undo
+	d.registerTxPool(simBase, simQuote, simPoolIdx, dexLogTx{block: 12})
+
+	if len(journal) != 3 || d.templateFees[simPoolIdx] != 900 || d.koPivots[koPivotKey{poolHash, -64, true}] != 200 {
+		t.Fatalf("Expected three journaled changes, got %d", len(journal))
+	}
+	for i := len(journal) - 1; i >= 0; i-- {
+		journal[i].undo()
+	}
+	if _, ok := d.pools[d.poolHash(otherPool)]; ok || !reflect.DeepEqual(d.state().TemplateFees, before.TemplateFees) ||
+		d.koPivots[koPivotKey{poolHash, -64, true}] != 100 || len(d.pools) != 1 {
+		t.Fatalf("Decoder state not rolled back %+v", d.state())
+	}
+}
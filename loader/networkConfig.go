@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/CrocSwap/graphcache-go/types"
@@ -11,16 +12,58 @@ import (
 
 type ChainConfig struct {
 	NetworkName         string
-	ChainID             int    `json:"chain_id"`
-	RPCEndpoint         string `json:"rpc"`
-	Subgraph            string `json:"subgraph"`
-	QueryContract       string `json:"query_contract"`
-	QueryContractABI    string `json:"query_contract_abi"`
-	KnockoutTickWidth   int    `json:"knockout_tick_width"`
-	MulticallDisabled   bool   `json:"multicall_disabled"`
-	MulticallContract   string `json:"multicall_contract"`
-	MulticallMaxBatch   int    `json:"multicall_max_batch"`
-	MulticallIntervalMs int    `json:"multicall_interval_ms"`
+	ChainID             int      `json:"chain_id"`
+	RPCEndpoint         string   `json:"rpc"`
+	RPCEndpoints        []string `json:"rpcs"`
+	RPCHedgeMs          int      `json:"rpc_hedge_ms"`
+	Subgraph            string   `json:"subgraph"`
+	QueryContract       string   `json:"query_contract"`
+	QueryContractABI    string   `json:"query_contract_abi"`
+	KnockoutTickWidth   int      `json:"knockout_tick_width"`
+	MulticallDisabled   bool     `json:"multicall_disabled"`
+	MulticallContract   string   `json:"multicall_contract"`
+	MulticallMaxBatch   int      `json:"multicall_max_batch"`
+	MulticallIntervalMs int      `json:"multicall_interval_ms"`
+	DexContract         string   `json:"crocswap_contract"`
+	EventSource         string   `json:"event_source"`
+	LogStartBlock       int      `json:"log_start_block"`
+	LogBlockRange       int      `json:"log_block_range"`
+	// USD pricing anchors. Stables are valued at $1, and the wrapped native token is
+	// priced the same as the native token.
+	UsdStables    []types.EthAddress `json:"usd_stables"`
+	WrappedNative types.EthAddress   `json:"wrapped_native"`
+	// Takes precedence over the token metadata read on-chain, keyed by token address
+	TokenMetadata map[types.EthAddress]types.TokenMetadata `json:"token_metadata"`
+	// Metadata of the chain's native token, which is at the zero address. Defaults to Ether.
+	NativeToken *types.TokenMetadata `json:"native_token"`
+}
+
+var DEFAULT_NATIVE_TOKEN = types.TokenMetadata{Decimals: 18, Symbol: "ETH", Name: "Ether"}
+
+func (c *ChainConfig) NativeTokenMetadata() types.TokenMetadata {
+	if c.NativeToken != nil {
+		return *c.NativeToken
+	}
+	return DEFAULT_NATIVE_TOKEN
+}
+
+const EVENT_SOURCE_RPC_LOGS = "rpc"
+
+// Chains default to syncing from the subgraph unless "event_source" is set to "rpc", in
+// which case events are read directly from the dex contract logs.
+func (c *ChainConfig) UsesLogEvents() bool {
+	return c.EventSource == EVENT_SOURCE_RPC_LOGS
+}
+
+// All of the chain's RPC endpoints, "rpc" followed by any in "rpcs", without duplicates
+func (c *ChainConfig) RPCEndpointList() []string {
+	urls := make([]string, 0)
+	for _, url := range append([]string{c.RPCEndpoint}, c.RPCEndpoints...) {
+		if url != "" && !slices.Contains(urls, url) {
+			urls = append(urls, url)
+		}
+	}
+	return urls
 }
 
 type NetworkConfig map[types.NetworkName]ChainConfig
@@ -57,7 +100,13 @@ func (c *ChainConfig) envVarOverride(netName types.NetworkName) {
 	envVar := "RPC_" + strings.ToUpper(string(netName))
 	envVal := os.Getenv(string(envVar))
 	if envVal != "" {
-		c.RPCEndpoint = envVal
+		// Multiple endpoints can be set as a comma separated list
+		urls := strings.Split(envVal, ",")
+		c.RPCEndpoint = strings.TrimSpace(urls[0])
+		c.RPCEndpoints = make([]string, 0)
+		for _, url := range urls[1:] {
+			c.RPCEndpoints = append(c.RPCEndpoints, strings.TrimSpace(url))
+		}
 	}
 
 	envVar = "SUBGRAPH_" + strings.ToUpper(string(netName))
@@ -93,6 +142,19 @@ func (c *NetworkConfig) RequireChainID(network types.NetworkName) types.ChainId
 	return types.IntToChainId(lookup.ChainID)
 }
 
+// Every chain in the config, in chain ID order
+func (c *NetworkConfig) ChainIDs() []types.ChainId {
+	chainIds := make([]types.ChainId, 0, len(*c))
+	for _, cfg := range *c {
+		chainId := types.IntToChainId(cfg.ChainID)
+		if !slices.Contains(chainIds, chainId) {
+			chainIds = append(chainIds, chainId)
+		}
+	}
+	slices.SortFunc(chainIds, types.CompareChainIds)
+	return chainIds
+}
+
 func (c *ChainConfig) HexChainID() types.ChainId {
 	return types.IntToChainId(c.ChainID)
 }
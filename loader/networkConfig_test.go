@@ -0,0 +1,23 @@
+package loader
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestChainIDsNumericOrder(t *testing.T) {
+	cfg := NetworkConfig{
+		"blast":    ChainConfig{ChainID: 81457},
+		"scroll":   ChainConfig{ChainID: 534352},
+		"ethereum": ChainConfig{ChainID: 1},
+		"swell":    ChainConfig{ChainID: 1923},
+		"mainnet":  ChainConfig{ChainID: 1},
+		"plume":    ChainConfig{ChainID: 98866},
+	}
+	expected := []types.ChainId{"0x1", "0x783", "0x13e31", "0x18232", "0x82750"}
+	if chainIds := cfg.ChainIDs(); !slices.Equal(chainIds, expected) {
+		t.Fatalf("Expected %v, got %v", expected, chainIds)
+	}
+}
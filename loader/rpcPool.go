@@ -0,0 +1,285 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/metrics"
+	"github.com/CrocSwap/graphcache-go/types"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const DEFAULT_RPC_HEDGE_MS = 1500
+const RPC_ATTEMPT_TIMEOUT = 15 * time.Second
+
+// Endpoints are taken out of rotation after this many consecutive failures, for a cooldown
+// that doubles on every further failure.
+const RPC_FAILS_BEFORE_COOLDOWN = 3
+const RPC_MAX_COOLDOWN = time.Minute
+
+// Weight of the latest request in the moving averages of latency and error rate
+const RPC_SCORE_DECAY = 0.2
+
+// An endpoint that always fails ranks like one with this much extra latency
+const RPC_ERROR_PENALTY_MS = 5000
+
+// Spreads requests for a single chain across its RPC endpoints. Requests go to the
+// healthiest endpoint first, based on recent latency and error rate. If it fails the next
+// one is tried, and if it's slower than the hedge delay the request is also sent to the
+// next one and the first response wins.
+type RpcPool struct {
+	chainId    types.ChainId
+	endpoints  []*rpcEndpoint
+	hedgeDelay time.Duration
+}
+
+type rpcEndpoint struct {
+	url         string
+	client      *rpcConn
+	latencyMs   float64
+	errRate     float64
+	consecFails int
+	downUntil   time.Time
+	lock        sync.Mutex
+}
+
+func NewRpcPool(chain ChainConfig) *RpcPool {
+	pool := &RpcPool{
+		chainId:    chain.HexChainID(),
+		endpoints:  make([]*rpcEndpoint, 0),
+		hedgeDelay: DEFAULT_RPC_HEDGE_MS * time.Millisecond,
+	}
+	if chain.RPCHedgeMs < 0 {
+		pool.hedgeDelay = 0
+	} else if chain.RPCHedgeMs > 0 {
+		pool.hedgeDelay = time.Duration(chain.RPCHedgeMs) * time.Millisecond
+	}
+	for _, url := range chain.RPCEndpointList() {
+		pool.endpoints = append(pool.endpoints, &rpcEndpoint{url: url})
+	}
+	return pool
+}
+
+func (p *RpcPool) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return rpcPoolDo(p, ctx, "CallContract", func(ctx context.Context, client *rpcConn) ([]byte, error) {
+		return client.CallContract(ctx, msg, blockNumber)
+	})
+}
+
+func (p *RpcPool) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]ethtypes.Log, error) {
+	return rpcPoolDo(p, ctx, "FilterLogs", func(ctx context.Context, client *rpcConn) ([]ethtypes.Log, error) {
+		return client.FilterLogs(ctx, q)
+	})
+}
+
+func (p *RpcPool) HeaderByNumber(ctx context.Context, number *big.Int) (*ethtypes.Header, error) {
+	return rpcPoolDo(p, ctx, "HeaderByNumber", func(ctx context.Context, client *rpcConn) (*ethtypes.Header, error) {
+		return client.HeaderByNumber(ctx, number)
+	})
+}
+
+type txByHashResp struct {
+	tx        *ethtypes.Transaction
+	isPending bool
+}
+
+func (p *RpcPool) TransactionByHash(ctx context.Context, hash common.Hash) (*ethtypes.Transaction, bool, error) {
+	resp, err := rpcPoolDo(p, ctx, "TransactionByHash", func(ctx context.Context, client *rpcConn) (txByHashResp, error) {
+		tx, isPending, err := client.TransactionByHash(ctx, hash)
+		return txByHashResp{tx, isPending}, err
+	})
+	return resp.tx, resp.isPending, err
+}
+
+func (p *RpcPool) TraceTransaction(ctx context.Context, hash common.Hash) (*CallFrame, error) {
+	return rpcPoolDo(p, ctx, "TraceTransaction", func(ctx context.Context, client *rpcConn) (*CallFrame, error) {
+		var frame CallFrame
+		tracer := map[string]interface{}{"tracer": "callTracer", "tracerConfig": map[string]bool{"withLog": true}}
+		err := client.raw.CallContext(ctx, &frame, "debug_traceTransaction", hash, tracer)
+		return &frame, err
+	})
+}
+
+type rpcAttempt[T any] struct {
+	endpoint *rpcEndpoint
+	val      T
+	err      error
+}
+
+// Runs the request against the ranked endpoints, failing over on errors and hedging on
+// slow responses. Returns the first successful response, or the last error.
+func rpcPoolDo[T any](p *RpcPool, ctx context.Context, method string,
+	call func(context.Context, *rpcConn) (T, error)) (val T, err error) {
+	startTime := time.Now()
+	defer func() { metrics.ObserveRpc(string(p.chainId), method, time.Since(startTime), err) }()
+
+	var zero T
+	ranked := p.ranked()
+	if len(ranked) == 0 {
+		return zero, fmt.Errorf("no RPC endpoints configured for %s", p.chainId)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan rpcAttempt[T], len(ranked))
+	launch := func(endpoint *rpcEndpoint) {
+		go func() {
+			attemptCtx, attemptCancel := context.WithTimeout(ctx, RPC_ATTEMPT_TIMEOUT)
+			defer attemptCancel()
+			startTime := time.Now()
+			var val T
+			client, err := endpoint.dial(attemptCtx)
+			if err == nil {
+				val, err = call(attemptCtx, client)
+			}
+			// Attempts cancelled because another endpoint won the hedge don't count against it
+			if err == nil || ctx.Err() == nil {
+				endpoint.record(time.Since(startTime), err, p.chainId)
+			}
+			results <- rpcAttempt[T]{endpoint, val, err}
+		}()
+	}
+
+	var hedge <-chan time.Time
+	if p.hedgeDelay > 0 && len(ranked) > 1 {
+		timer := time.NewTimer(p.hedgeDelay)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	launch(ranked[0])
+	next, inFlight := 1, 1
+	var lastErr error
+
+	for inFlight > 0 {
+		select {
+		case result := <-results:
+			inFlight -= 1
+			if result.err == nil || isNodeResponse(result.err) {
+				return result.val, result.err
+			}
+			lastErr = result.err
+			if ctx.Err() != nil {
+				return zero, lastErr
+			}
+			if next < len(ranked) {
+				log.Printf("Warning RPC request to %s failed, trying next endpoint: %s", result.endpoint.url, result.err.Error())
+				launch(ranked[next])
+				next, inFlight = next+1, inFlight+1
+			}
+		case <-hedge:
+			hedge = nil
+			if next < len(ranked) {
+				launch(ranked[next])
+				next, inFlight = next+1, inFlight+1
+			}
+		}
+	}
+	return zero, lastErr
+}
+
+// Reverted calls and missing blocks or txs would be the same on any other endpoint, so
+// they're returned as is without failing over. Other JSON-RPC errors, like rate limits or
+// pruned state, may succeed elsewhere.
+func isNodeResponse(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.ErrorCode() == 3 || strings.Contains(rpcErr.Error(), "execution reverted")
+	}
+	return errors.Is(err, ethereum.NotFound)
+}
+
+// Endpoints in cooldown go last, otherwise lowest latency plus error penalty goes first.
+// If every endpoint is in cooldown they're still all tried.
+func (p *RpcPool) ranked() []*rpcEndpoint {
+	type scored struct {
+		endpoint *rpcEndpoint
+		isDown   bool
+		score    float64
+	}
+	now := time.Now()
+	cands := make([]scored, 0, len(p.endpoints))
+	for _, endpoint := range p.endpoints {
+		endpoint.lock.Lock()
+		cands = append(cands, scored{
+			endpoint: endpoint,
+			isDown:   now.Before(endpoint.downUntil),
+			score:    endpoint.latencyMs + endpoint.errRate*RPC_ERROR_PENALTY_MS,
+		})
+		endpoint.lock.Unlock()
+	}
+
+	sort.SliceStable(cands, func(i, j int) bool {
+		if cands[i].isDown != cands[j].isDown {
+			return !cands[i].isDown
+		}
+		return cands[i].score < cands[j].score
+	})
+
+	ranked := make([]*rpcEndpoint, len(cands))
+	for i, cand := range cands {
+		ranked[i] = cand.endpoint
+	}
+	return ranked
+}
+
+// Keeps the raw connection for methods that ethclient doesn't wrap, like tracing
+type rpcConn struct {
+	*ethclient.Client
+	raw *rpc.Client
+}
+
+// Connections are reused across requests
+func (e *rpcEndpoint) dial(ctx context.Context) (*rpcConn, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.client == nil {
+		raw, err := rpc.DialContext(ctx, e.url)
+		if err != nil {
+			return nil, err
+		}
+		e.client = &rpcConn{ethclient.NewClient(raw), raw}
+	}
+	return e.client, nil
+}
+
+func (e *rpcEndpoint) record(latency time.Duration, err error, chainId types.ChainId) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if err != nil && !isNodeResponse(err) {
+		e.errRate = e.errRate*(1-RPC_SCORE_DECAY) + RPC_SCORE_DECAY
+		e.consecFails += 1
+		if e.consecFails >= RPC_FAILS_BEFORE_COOLDOWN {
+			cooldown := min(time.Second<<min(e.consecFails-RPC_FAILS_BEFORE_COOLDOWN, 6), RPC_MAX_COOLDOWN)
+			e.downUntil = time.Now().Add(cooldown)
+			log.Printf("Warning RPC endpoint %s on %s failed %d times in a row. Cooling down for %s",
+				e.url, chainId, e.consecFails, cooldown)
+		}
+		return
+	}
+
+	if e.consecFails >= RPC_FAILS_BEFORE_COOLDOWN {
+		log.Printf("RPC endpoint %s on %s recovered", e.url, chainId)
+	}
+	e.consecFails = 0
+	e.downUntil = time.Time{}
+	e.errRate = e.errRate * (1 - RPC_SCORE_DECAY)
+	latencyMs := float64(latency.Milliseconds())
+	if e.latencyMs == 0 {
+		e.latencyMs = latencyMs
+	} else {
+		e.latencyMs = e.latencyMs*(1-RPC_SCORE_DECAY) + latencyMs*RPC_SCORE_DECAY
+	}
+}
@@ -0,0 +1,73 @@
+package loader
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+)
+
+// JSON-RPC stub that answers every request with the result after the delay, or with an
+// HTTP error if the status isn't OK
+func rpcStub(t *testing.T, status int, delay time.Duration, result string, hits *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		var req struct {
+			ID json.RawMessage `json:"id"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &req)
+		time.Sleep(delay)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":` + string(req.ID) + `,"result":"` + result + `"}`))
+	}))
+}
+
+func TestRpcPoolFailover(t *testing.T) {
+	var badHits, goodHits int32
+	bad := rpcStub(t, http.StatusServiceUnavailable, 0, "", &badHits)
+	defer bad.Close()
+	good := rpcStub(t, http.StatusOK, 0, "0x01", &goodHits)
+	defer good.Close()
+
+	pool := NewRpcPool(ChainConfig{ChainID: 1, RPCEndpoint: bad.URL, RPCEndpoints: []string{good.URL}, RPCHedgeMs: -1})
+	for i := 0; i < RPC_FAILS_BEFORE_COOLDOWN+2; i++ {
+		result, err := pool.CallContract(context.Background(), ethereum.CallMsg{}, nil)
+		if err != nil || len(result) != 1 || result[0] != 1 {
+			t.Fatalf("Expected failover to healthy endpoint: %v %v", result, err)
+		}
+	}
+
+	// After the first failure the healthy endpoint is ranked first
+	if badHits != 1 || goodHits != RPC_FAILS_BEFORE_COOLDOWN+2 {
+		t.Fatalf("Unexpected endpoint usage bad=%d good=%d", badHits, goodHits)
+	}
+}
+
+func TestRpcPoolHedge(t *testing.T) {
+	var slowHits, fastHits int32
+	slow := rpcStub(t, http.StatusOK, time.Second, "0x01", &slowHits)
+	defer slow.Close()
+	fast := rpcStub(t, http.StatusOK, 0, "0x02", &fastHits)
+	defer fast.Close()
+
+	pool := NewRpcPool(ChainConfig{ChainID: 1, RPCEndpoint: slow.URL, RPCEndpoints: []string{fast.URL}, RPCHedgeMs: 50})
+	startTime := time.Now()
+	result, err := pool.CallContract(context.Background(), ethereum.CallMsg{}, nil)
+	if err != nil || len(result) != 1 || result[0] != 2 {
+		t.Fatalf("Expected hedged response from fast endpoint: %v %v", result, err)
+	}
+	if time.Since(startTime) > 500*time.Millisecond {
+		t.Fatal("Hedged request waited for the slow endpoint")
+	}
+}
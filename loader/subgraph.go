@@ -12,7 +12,7 @@ import (
 	"time"
 )
 
-type GraphRequest[V GraphReqVars | CombinedGraphReqVars] struct {
+type GraphRequest[V GraphReqVars | CombinedGraphReqVars | BlockReqVars] struct {
 	Query     SubgraphQuery `json:"query"`
 	Variables V             `json:"variables"`
 }
@@ -39,6 +39,11 @@ type CombinedGraphReqVars struct {
 	KoMaxBlock        int    `json:"koMaxBlock"`
 }
 
+// Used to query the subgraph state at a historical block
+type BlockReqVars struct {
+	Block int `json:"block"`
+}
+
 type SubgraphQuery string
 
 type SubgraphError struct {
@@ -121,7 +126,7 @@ func queryFromSubgraphCombined(cfg ChainConfig, query SubgraphQuery, isAsc bool,
 	return result, err
 }
 
-func queryFromSubgraphTry[V GraphReqVars | CombinedGraphReqVars](cfg ChainConfig, request GraphRequest[V]) ([]byte, error) {
+func queryFromSubgraphTry[V GraphReqVars | CombinedGraphReqVars | BlockReqVars](cfg ChainConfig, request GraphRequest[V]) ([]byte, error) {
 	jsonBody, err := json.Marshal(request)
 	if err != nil {
 		log.Println("Subgraph Query Request Error:" + err.Error())
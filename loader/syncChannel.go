@@ -2,60 +2,111 @@ package loader
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"math"
 	"sync"
 	"time"
 
+	"github.com/CrocSwap/graphcache-go/metrics"
 	"github.com/CrocSwap/graphcache-go/tables"
 	"github.com/CrocSwap/graphcache-go/types"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type SyncChannel[R any, S any] struct {
 	RowsIngested int
+	rowsGauge    prometheus.Gauge
 	idsObserved  map[string]bool
 	consumeFn    func(R)
 	config       SyncChannelConfig
 	tbl          tables.ITable[R, S]
+
+	// IDs of rows ingested above the reorg floor, by block, so that they can be
+	// forgotten and re-ingested if the blocks are rolled back.
+	recentIds  map[int][]string
+	reorgFloor int
+
+	// IDs of the rows on the latest block ingested. Syncs resume from that block, so
+	// these are needed in addition to the recent IDs when restoring from a snapshot.
+	lastBlock    int
+	lastBlockIds []string
+	lastTime     int
 }
 
 type SyncChannelConfig struct {
 	Chain   ChainConfig
 	Network types.NetworkName
 	Query   string
+	// Subgraph table name, used to label the channel in metrics and the sync status
+	Table string
+	// Set for tables that legitimately have no rows, e.g. knockout crosses on a new chain
+	AllowEmpty bool
 }
 
 func NewSyncChannel[R any, S any](tbl tables.ITable[R, S], config SyncChannelConfig,
 	consumeFn func(R)) SyncChannel[R, S] {
 	return SyncChannel[R, S]{
+		rowsGauge:   metrics.RowsIngestedGauge(string(config.Chain.HexChainID()), config.Table),
 		idsObserved: make(map[string]bool),
 		consumeFn:   consumeFn,
 		config:      config,
 		tbl:         tbl,
+		recentIds:   make(map[int][]string),
+		reorgFloor:  math.MaxInt,
 	}
 }
 
 func LatestSubgraphBlock(cfg SyncChannelConfig) (int, error) {
+	block, _, err := LatestSubgraphHead(cfg)
+	return block, err
+}
+
+// Returns the number and hash of the latest block indexed by the subgraph
+func LatestSubgraphHead(cfg SyncChannelConfig) (int, string, error) {
 	cfg.Query = "./artifacts/graphQueries/meta.query"
 	metaQuery := readQueryPath(cfg.Query)
 
 	resp, err := queryFromSubgraph(cfg.Chain, metaQuery, 0, 0, false)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 
 	result, err := parseSubGraphMeta(resp)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 
 	if result.Block.Number == 0 {
 		log.Println("Warning subgraph latest block number is 0. Retrying ", cfg.Network)
-		return LatestSubgraphBlock(cfg)
+		return LatestSubgraphHead(cfg)
 	} else {
-		return result.Block.Number, nil
+		return result.Block.Number, result.Block.Hash, nil
 	}
 }
 
+// Returns the hash of the block as currently seen by the subgraph. Unlike the other
+// queries this isn't retried, because it's only used to check for reorgs.
+func SubgraphBlockHash(cfg SyncChannelConfig, block int) (string, error) {
+	req := GraphRequest[BlockReqVars]{
+		Query:     readQueryPath("./artifacts/graphQueries/metaAtBlock.query"),
+		Variables: BlockReqVars{Block: block},
+	}
+	resp, err := queryFromSubgraphTry(cfg.Chain, req)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := parseSubGraphMeta(resp)
+	if err != nil {
+		return "", err
+	}
+	if result.Block.Number != block || result.Block.Hash == "" {
+		return "", fmt.Errorf("subgraph returned block %d for hash query on %d", result.Block.Number, block)
+	}
+	return result.Block.Hash, nil
+}
+
 type metaEntry struct {
 	Block struct {
 		Time   int    `json:"timestamp"`
@@ -143,10 +194,96 @@ func (s *SyncChannel[R, S]) ingestEntry(r R) (bool, int) {
 
 	if !hasEntry {
 		s.idsObserved[s.tbl.GetID(r)] = true
+		block := s.tbl.GetBlock(r)
+		if block > s.reorgFloor {
+			s.recentIds[block] = append(s.recentIds[block], s.tbl.GetID(r))
+		}
+		if block > s.lastBlock {
+			s.lastBlock = block
+			s.lastBlockIds = s.lastBlockIds[:0]
+			s.lastTime = s.tbl.GetTime(r)
+		}
+		if block == s.lastBlock {
+			s.lastBlockIds = append(s.lastBlockIds, s.tbl.GetID(r))
+		}
 		s.consumeFn(r)
 		s.RowsIngested += 1
+		s.rowsGauge.Set(float64(s.RowsIngested))
 		return true, s.tbl.GetBlock(r)
 	} else {
 		return false, -1
 	}
 }
+
+// Ingests rows that were decoded outside the subgraph, e.g. from dex event logs.
+// Returns the number of fresh rows and the latest block observed.
+func (s *SyncChannel[R, S]) IngestRows(rows []R) (nIngested int, lastObs int) {
+	for _, row := range rows {
+		isFreshPoint, eventBlock := s.ingestEntry(row)
+		if isFreshPoint {
+			nIngested += 1
+		}
+		if eventBlock > lastObs {
+			lastObs = eventBlock
+		}
+	}
+	return nIngested, lastObs
+}
+
+// Rows at or below the floor are considered final and are no longer tracked for rollback
+func (s *SyncChannel[R, S]) SetReorgFloor(block int) {
+	s.reorgFloor = block
+	for recentBlock := range s.recentIds {
+		if recentBlock <= block {
+			delete(s.recentIds, recentBlock)
+		}
+	}
+}
+
+// Forgets the rows ingested after the fork block, so that the canonical versions of those
+// blocks are ingested on the next sync, even if they have the same IDs.
+func (s *SyncChannel[R, S]) Rollback(forkBlock int) int {
+	nForgotten := 0
+	for recentBlock, ids := range s.recentIds {
+		if recentBlock > forkBlock {
+			for _, id := range ids {
+				delete(s.idsObserved, id)
+			}
+			nForgotten += len(ids)
+			delete(s.recentIds, recentBlock)
+		}
+	}
+	if s.lastBlock > forkBlock {
+		s.lastBlock = 0
+		s.lastBlockIds = nil
+	}
+	s.RowsIngested -= nForgotten
+	s.rowsGauge.Set(float64(s.RowsIngested))
+	return nForgotten
+}
+
+// Latest block and row time ingested on the table. Zero if nothing has been ingested since
+// the last rollback.
+func (s *SyncChannel[R, S]) LatestIngested() (block int, rowTime int) {
+	return s.lastBlock, s.lastTime
+}
+
+func (s *SyncChannel[R, S]) Table() string {
+	return s.config.Table
+}
+
+// IDs of the rows that a sync resumed from the current position may return again
+func (s *SyncChannel[R, S]) ResumeIds() []string {
+	ids := append([]string{}, s.lastBlockIds...)
+	for _, blockIds := range s.recentIds {
+		ids = append(ids, blockIds...)
+	}
+	return ids
+}
+
+// Marks rows that were already ingested before a restart, so that they're skipped
+func (s *SyncChannel[R, S]) MarkObserved(ids []string) {
+	for _, id := range ids {
+		s.idsObserved[id] = true
+	}
+}
@@ -84,6 +84,10 @@ func (s *SyncChannel[R, S]) IngestEntries(data []byte, queryStartBlock, queryEnd
 		return 0, true, err
 	}
 
+	if len(entries) == 0 && s.config.AllowEmpty {
+		return 0, false, nil
+	}
+
 	if len(entries) == 0 {
 		log.Printf("Warning subgraph data for %s at %d-%d returned no rows, last seen row was expected", s.config.Query, queryStartBlock, queryEndBlock)
 		// Returning `true` here doesn't change anything during startup sync,
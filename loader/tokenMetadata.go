@@ -0,0 +1,328 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/types"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+const NATIVE_TOKEN_ADDR = types.EthAddress("0x0000000000000000000000000000000000000000")
+
+// Tokens that failed to load (e.g. not an ERC20) aren't retried until after this
+const TOKEN_METADATA_RETRY = 10 * time.Minute
+const TOKEN_METADATA_PERSIST_INTERVAL = time.Minute
+const TOKEN_METADATA_MAX_FETCHES = 16
+
+type TokenKey struct {
+	ChainId types.ChainId
+	Token   types.EthAddress
+}
+
+type TokenMetadataEntry struct {
+	ChainId types.ChainId    `json:"chainId"`
+	Token   types.EthAddress `json:"address"`
+	types.TokenMetadata
+}
+
+// Lazily loads and caches ERC20 decimals, symbol and name for every token that's looked up.
+// Lookups never block: unknown tokens are fetched in the background through the multicall
+// path and are returned by later lookups. Entries in the chain's network config override
+// whatever is on-chain.
+type TokenRegistry struct {
+	chain     *OnChainLoader
+	erc20Abi  abi.ABI
+	path      string
+	entries   map[TokenKey]types.TokenMetadata
+	overrides map[TokenKey]types.TokenMetadata
+	natives   map[types.ChainId]types.TokenMetadata
+	pending   map[TokenKey]bool
+	failedAt  map[TokenKey]time.Time
+	dirty     bool
+	fetchSem  chan struct{}
+	lock      sync.RWMutex
+}
+
+// If chain is nil metadata is never read on-chain, and only the config overrides and
+// the persisted file are served. If path is empty metadata isn't persisted.
+func NewTokenRegistry(cfg NetworkConfig, chain *OnChainLoader, path string) *TokenRegistry {
+	return newTokenRegistry(cfg, chain, path, ERC20_ABI_PATH)
+}
+
+func newTokenRegistry(cfg NetworkConfig, chain *OnChainLoader, path string, abiPath string) *TokenRegistry {
+	r := &TokenRegistry{
+		chain:     chain,
+		erc20Abi:  erc20Abi(abiPath),
+		path:      path,
+		entries:   make(map[TokenKey]types.TokenMetadata),
+		overrides: make(map[TokenKey]types.TokenMetadata),
+		natives:   make(map[types.ChainId]types.TokenMetadata),
+		pending:   make(map[TokenKey]bool),
+		failedAt:  make(map[TokenKey]time.Time),
+		fetchSem:  make(chan struct{}, TOKEN_METADATA_MAX_FETCHES),
+	}
+
+	for _, chainCfg := range cfg {
+		chainId := chainCfg.HexChainID()
+		r.natives[chainId] = chainCfg.NativeTokenMetadata()
+		for token, meta := range chainCfg.TokenMetadata {
+			r.overrides[TokenKey{chainId, normTokenAddr(token)}] = meta
+		}
+	}
+
+	if path != "" {
+		r.load()
+		go r.persistLoop()
+	}
+	return r
+}
+
+func (r *TokenRegistry) Lookup(chainId types.ChainId, token types.EthAddress) (types.TokenMetadata, bool) {
+	key := TokenKey{chainId, normTokenAddr(token)}
+	if meta, ok := r.overrides[key]; ok {
+		return meta, true
+	}
+	if key.Token == NATIVE_TOKEN_ADDR {
+		if meta, ok := r.natives[key.ChainId]; ok {
+			return meta, true
+		}
+		return DEFAULT_NATIVE_TOKEN, true
+	}
+
+	r.lock.RLock()
+	meta, ok := r.entries[key]
+	r.lock.RUnlock()
+	if !ok {
+		r.request(key)
+	}
+	return meta, ok
+}
+
+// Pair metadata is only returned once both tokens are known
+func (r *TokenRegistry) LookupPair(pool types.PoolLocation) *types.TokenPairMetadata {
+	base, okBase := r.Lookup(pool.ChainId, pool.Base)
+	quote, okQuote := r.Lookup(pool.ChainId, pool.Quote)
+	if !okBase || !okQuote {
+		return nil
+	}
+	pair := types.PairTokenMetadata(base, quote)
+	return &pair
+}
+
+// Starts loading the metadata of every token in the pools that isn't known yet
+func (r *TokenRegistry) RequestPools(pools []types.PoolLocation) {
+	for _, pool := range pools {
+		r.Lookup(pool.ChainId, pool.Base)
+		r.Lookup(pool.ChainId, pool.Quote)
+	}
+}
+
+func (r *TokenRegistry) request(key TokenKey) {
+	if r.chain == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.pending[key] {
+		return
+	}
+	if failTime, ok := r.failedAt[key]; ok && time.Since(failTime) < TOKEN_METADATA_RETRY {
+		return
+	}
+	r.pending[key] = true
+	go r.fetch(key)
+}
+
+func (r *TokenRegistry) fetch(key TokenKey) {
+	r.fetchSem <- struct{}{}
+	meta, err := r.fetchOnChain(key)
+	<-r.fetchSem
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.pending, key)
+	if err != nil {
+		log.Printf("Warning unable to load token metadata for %s on %s: %s", key.Token, key.ChainId, err.Error())
+		r.failedAt[key] = time.Now()
+		return
+	}
+	delete(r.failedAt, key)
+	r.entries[key] = meta
+	r.dirty = true
+}
+
+type tokenCallResult struct {
+	data []byte
+	err  error
+}
+
+// The three calls are issued concurrently so that they end up in the same multicall batch
+func (r *TokenRegistry) fetchOnChain(key TokenKey) (types.TokenMetadata, error) {
+	pool, err := r.chain.rpcPoolForChain(key.ChainId)
+	if err != nil {
+		return types.TokenMetadata{}, err
+	}
+
+	methods := []string{"decimals", "symbol", "name"}
+	results := make([]chan tokenCallResult, len(methods))
+	for i, method := range methods {
+		callData, err := r.erc20Abi.Pack(method)
+		if err != nil {
+			log.Fatalf("Failed to pack %s on ERC20 ABI: %s", method, err.Error())
+		}
+		results[i] = make(chan tokenCallResult, 1)
+		go func(result chan tokenCallResult) {
+			data, err := r.chain.contractDataCall(pool, key.ChainId, key.Token, callData, nil)
+			result <- tokenCallResult{data, err}
+		}(results[i])
+	}
+
+	decimals := <-results[0]
+	symbol := <-results[1]
+	name := <-results[2]
+
+	if decimals.err != nil {
+		return types.TokenMetadata{}, decimals.err
+	}
+	unpacked, err := r.erc20Abi.Unpack("decimals", decimals.data)
+	if err != nil || len(unpacked) == 0 {
+		return types.TokenMetadata{}, errors.New("unable to decode decimals")
+	}
+	decimalsVal, ok := unpacked[0].(uint8)
+	if !ok {
+		return types.TokenMetadata{}, errors.New("unexpected decimals type")
+	}
+
+	// Symbol and name are optional in ERC20, so failures there leave them empty
+	meta := types.TokenMetadata{Decimals: int(decimalsVal)}
+	if symbol.err == nil {
+		meta.Symbol = r.decodeTokenString("symbol", symbol.data)
+	}
+	if name.err == nil {
+		meta.Name = r.decodeTokenString("name", name.data)
+	}
+	return meta, nil
+}
+
+// Some older tokens (e.g. MKR) return bytes32 instead of string for symbol and name
+func (r *TokenRegistry) decodeTokenString(method string, data []byte) string {
+	unpacked, err := r.erc20Abi.Unpack(method, data)
+	if err == nil && len(unpacked) > 0 {
+		if str, ok := unpacked[0].(string); ok {
+			return str
+		}
+	}
+	if len(data) == 32 {
+		return string(bytes.TrimRight(data, "\x00"))
+	}
+	return ""
+}
+
+// All known tokens on the chain, including the overrides
+func (r *TokenRegistry) ChainTokens(chainId types.ChainId) []TokenMetadataEntry {
+	tokens := make(map[types.EthAddress]types.TokenMetadata)
+	r.lock.RLock()
+	for key, meta := range r.entries {
+		if key.ChainId == chainId {
+			tokens[key.Token] = meta
+		}
+	}
+	r.lock.RUnlock()
+	for key, meta := range r.overrides {
+		if key.ChainId == chainId {
+			tokens[key.Token] = meta
+		}
+	}
+
+	result := make([]TokenMetadataEntry, 0, len(tokens))
+	for token, meta := range tokens {
+		result = append(result, TokenMetadataEntry{ChainId: chainId, Token: token, TokenMetadata: meta})
+	}
+	return result
+}
+
+func (r *TokenRegistry) load() {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning unable to read token metadata from %s: %s", r.path, err.Error())
+		}
+		return
+	}
+
+	var entries []TokenMetadataEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Printf("Warning unable to parse token metadata from %s: %s", r.path, err.Error())
+		return
+	}
+	for _, entry := range entries {
+		r.entries[TokenKey{entry.ChainId, normTokenAddr(entry.Token)}] = entry.TokenMetadata
+	}
+	log.Printf("Loaded metadata for %d tokens from %s", len(entries), r.path)
+}
+
+func (r *TokenRegistry) persistLoop() {
+	for {
+		time.Sleep(TOKEN_METADATA_PERSIST_INTERVAL)
+		r.persist()
+	}
+}
+
+// Overrides aren't persisted, since they're always read from the config
+func (r *TokenRegistry) persist() {
+	r.lock.Lock()
+	if !r.dirty {
+		r.lock.Unlock()
+		return
+	}
+	entries := make([]TokenMetadataEntry, 0, len(r.entries))
+	for key, meta := range r.entries {
+		entries = append(entries, TokenMetadataEntry{ChainId: key.ChainId, Token: key.Token, TokenMetadata: meta})
+	}
+	r.dirty = false
+	r.lock.Unlock()
+
+	data, err := json.Marshal(entries)
+	if err == nil {
+		tmpPath := r.path + ".tmp"
+		err = os.WriteFile(tmpPath, data, 0644)
+		if err == nil {
+			err = os.Rename(tmpPath, r.path)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning unable to save token metadata to %s: %s", r.path, err.Error())
+		r.lock.Lock()
+		r.dirty = true
+		r.lock.Unlock()
+	}
+}
+
+func normTokenAddr(token types.EthAddress) types.EthAddress {
+	return types.EthAddress(strings.ToLower(string(token)))
+}
+
+const ERC20_ABI_PATH = "./artifacts/abis/ERC20.json"
+
+func erc20Abi(filePath string) abi.ABI {
+	file, err := os.Open(filePath)
+
+	if err != nil {
+		log.Fatalf("Failed to read ABI contract at %s", filePath)
+	}
+
+	parsedABI, err := abi.JSON(file)
+	if err != nil {
+		log.Fatalf("Failed to parse contract ABI: %v", err)
+	}
+
+	return parsedABI
+}
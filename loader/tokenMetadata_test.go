@@ -0,0 +1,41 @@
+package loader
+
+import (
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+const testErc20Abi = "../artifacts/abis/ERC20.json"
+
+func TestNativeTokenMetadata(t *testing.T) {
+	cfg := LoadNetworkConfig("../config/plume.json")
+	cfg["ethereum"] = ChainConfig{ChainID: 1}
+	cfg["overridden"] = ChainConfig{ChainID: 2, NativeToken: &types.TokenMetadata{Decimals: 18, Symbol: "PLUME", Name: "Plume"},
+		TokenMetadata: map[types.EthAddress]types.TokenMetadata{
+			NATIVE_TOKEN_ADDR: {Decimals: 6, Symbol: "GAS", Name: "Gas"},
+		}}
+	r := newTokenRegistry(cfg, nil, "", testErc20Abi)
+
+	tests := []struct {
+		chainId types.ChainId
+		symbol  string
+	}{
+		{"0x18231", "PLUME"},
+		{"0x1", "ETH"},
+		// The per-token overrides still take precedence
+		{"0x2", "GAS"},
+		// Chains missing from the config default to Ether
+		{"0x3", "ETH"},
+	}
+	for _, test := range tests {
+		meta, ok := r.Lookup(test.chainId, NATIVE_TOKEN_ADDR)
+		if !ok || meta.Symbol != test.symbol {
+			t.Errorf("Native token on %s: expected %s, got %+v", test.chainId, test.symbol, meta)
+		}
+	}
+
+	if _, ok := r.Lookup("0x18231", "0x1111111111111111111111111111111111111111"); ok {
+		t.Error("Unknown ERC20 token returned metadata without a chain to read it from")
+	}
+}
@@ -3,12 +3,16 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log"
 	"runtime/metrics"
+	"strings"
+	"time"
 
 	"github.com/CrocSwap/graphcache-go/cache"
 	"github.com/CrocSwap/graphcache-go/controller"
 	"github.com/CrocSwap/graphcache-go/loader"
 	"github.com/CrocSwap/graphcache-go/server"
+	"github.com/CrocSwap/graphcache-go/types"
 	"github.com/CrocSwap/graphcache-go/views"
 )
 
@@ -36,7 +40,15 @@ func main() {
 	var extendedApi = flag.Bool("extendedApi", false, "Expose additional methods in the API")
 	var combinedQuery = flag.Bool("combinedQuery", false, "Use the combined subgraph query instead of individual ones")
 	var startupCache = flag.String("startupCache", "", "Either directory or HTTP URL to load startup cache from")
-
+	var snapshotDir = flag.String("snapshotDir", "", "Directory to periodically save state snapshots to and restore from on startup")
+	var snapshotMins = flag.Int("snapshotMins", 30, "Minutes between state snapshots")
+	var tokenMetadataFile = flag.String("tokenMetadataFile", "", "JSON file to persist token metadata to and load it from on startup")
+	var readyMaxLag = flag.Int("readyMaxLagBlocks", 50, "Blocks behind the subgraph or chain head before the readiness probe fails, 0 to disable")
+	var readyMaxStall = flag.Int("readyMaxStallSecs", 600, "Seconds without a new head block before the readiness probe fails, 0 to disable")
+	var readyMaxBacklog = flag.Int("readyMaxBacklog", 0, "Urgent liquidity refreshes queued before the readiness probe fails, 0 to disable")
+	var apiKeysFile = flag.String("apiKeys", "", "JSON file of API keys and rate limits, reloaded on change or SIGHUP. Empty leaves the API open")
+	var trustedProxies = flag.String("trustedProxies", "", "Comma separated IPs or CIDRs of proxies trusted to set X-Forwarded-For, for per-IP rate limits")
+	var streamOrigins = flag.String("streamOrigins", "", "Comma separated browser origins allowed to open tx streams, or * for any")
 	flag.Parse()
 
 	netCfg := loader.LoadNetworkConfig(*netCfgPath)
@@ -50,6 +62,41 @@ func main() {
 		cntrl = controller.NewOnQuery(netCfg, cache, &nonQuery)
 	}
 
+	tokenLoader := onChain
+	if *noRpcMode {
+		tokenLoader = nil
+	}
+	tokens := loader.NewTokenRegistry(netCfg, tokenLoader, *tokenMetadataFile)
+
+	if *snapshotDir != "" {
+		cntrl.EnableSnapshots(*snapshotDir, time.Duration(*snapshotMins)*time.Minute)
+	}
+
+	views := views.Views{Cache: cache, OnChain: onChain, Tokens: tokens,
+		Prices: views.NewUsdPriceOracle(cache, netCfg, tokens),
+		Readiness: views.ReadinessThresholds{
+			MaxLagBlocks: *readyMaxLag,
+			MaxStallSecs: *readyMaxStall,
+			MaxBacklog:   *readyMaxBacklog,
+		}}
+	apiServer := server.APIWebServer{Views: &views}
+	if *streamOrigins != "" {
+		apiServer.StreamOrigins = strings.Split(*streamOrigins, ",")
+	}
+	if *trustedProxies != "" {
+		apiServer.TrustedProxies = strings.Split(*trustedProxies, ",")
+	}
+	if *apiKeysFile != "" {
+		apiServer.Keys = server.NewApiKeyGate(*apiKeysFile)
+	}
+
+	// The server comes up before the startup sync, so the readiness probe can report it and
+	// requests for chains that are still syncing get a 503
+	for _, chainCfg := range netCfg {
+		cache.AddSyncingChain(types.IntToChainId(chainCfg.ChainID))
+	}
+	go apiServer.Serve(*apiPath, *listenAddr, *extendedApi)
+
 	syncs := make([]controller.SubgraphSyncer, 0)
 
 	for network, chainCfg := range netCfg {
@@ -59,7 +106,13 @@ func main() {
 			Bal:   *balStart,
 		}
 		var syncer controller.SubgraphSyncer
-		if *combinedQuery {
+		if chainCfg.UsesLogEvents() {
+			client, err := onChain.DexLogClient(types.IntToChainId(chainCfg.ChainID))
+			if err != nil {
+				log.Fatalf("Unable to connect to RPC for log sync on %s: %s", network, err.Error())
+			}
+			syncer = controller.NewLogSyncerAtStart(cntrl, client, chainCfg, network, startBlocks, *startupCache)
+		} else if *combinedQuery {
 			syncer = controller.NewCombinedSubgraphSyncerAtStart(cntrl, chainCfg, network, startBlocks, *startupCache)
 		} else {
 			syncer = controller.NewSubgraphSyncerAtStart(cntrl, chainCfg, network, startBlocks, *startupCache)
@@ -70,12 +123,11 @@ func main() {
 	if *noRpcMode == false {
 		cntrl.StartupSubgraphSyncDone()
 	}
+	tokens.RequestPools(cache.RetrievePoolSet())
 
 	for _, syncer := range syncs {
 		go syncer.PollSubgraphUpdates()
 	}
 
-	views := views.Views{Cache: cache, OnChain: onChain}
-	apiServer := server.APIWebServer{Views: &views}
-	apiServer.Serve(*apiPath, *listenAddr, *extendedApi)
+	select {}
 }
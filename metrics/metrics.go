@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	rowsIngested = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "graphcache_rows_ingested",
+		Help: "Rows ingested per table, net of rows rolled back on reorgs",
+	}, []string{"chain_id", "table"})
+
+	syncedBlock = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "graphcache_synced_block",
+		Help: "Latest block that all tables have been synced through",
+	}, []string{"chain_id"})
+
+	headBlock = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "graphcache_head_block",
+		Help: "Latest block reported by the subgraph meta query, or the chain head when syncing from logs",
+	}, []string{"chain_id"})
+
+	rpcCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphcache_rpc_calls_total",
+		Help: "RPC requests, including failovers and hedges as a single request",
+	}, []string{"chain_id", "method"})
+
+	rpcErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphcache_rpc_errors_total",
+		Help: "RPC requests that returned an error",
+	}, []string{"chain_id", "method"})
+
+	rpcLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "graphcache_rpc_latency_seconds",
+		Help:    "Latency of RPC requests",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"chain_id", "method"})
+
+	multicallBatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphcache_multicall_batches_total",
+		Help: "Batches sent to the multicall contract",
+	}, []string{"chain_id"})
+
+	multicallJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphcache_multicall_calls_total",
+		Help: "Contract calls aggregated into multicall batches",
+	}, []string{"chain_id"})
+
+	multicallErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphcache_multicall_errors_total",
+		Help: "Multicall batches that failed as a whole",
+	}, []string{"chain_id"})
+
+	multicallLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "graphcache_multicall_latency_seconds",
+		Help:    "Latency of multicall batches",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"chain_id"})
+
+	httpLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "graphcache_http_request_duration_seconds",
+		Help:    "Latency of API requests by route",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"route", "method", "status"})
+
+	apiRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphcache_api_requests_total",
+		Help: "API requests by client key name, or anonymous, and whether they were admitted",
+	}, []string{"client", "result"})
+)
+
+// Gauge for a sync channel's ingested row count, so that the channel can keep it up to date
+func RowsIngestedGauge(chainId string, table string) prometheus.Gauge {
+	return rowsIngested.WithLabelValues(chainId, table)
+}
+
+func SetSyncedBlock(chainId string, block int) {
+	syncedBlock.WithLabelValues(chainId).Set(float64(block))
+}
+
+func SetHeadBlock(chainId string, block int) {
+	headBlock.WithLabelValues(chainId).Set(float64(block))
+}
+
+func ObserveRpc(chainId string, method string, latency time.Duration, err error) {
+	rpcCalls.WithLabelValues(chainId, method).Inc()
+	rpcLatency.WithLabelValues(chainId, method).Observe(latency.Seconds())
+	if err != nil {
+		rpcErrors.WithLabelValues(chainId, method).Inc()
+	}
+}
+
+func ObserveMulticall(chainId string, nCalls int, latency time.Duration, err error) {
+	multicallBatches.WithLabelValues(chainId).Inc()
+	multicallJobs.WithLabelValues(chainId).Add(float64(nCalls))
+	multicallLatency.WithLabelValues(chainId).Observe(latency.Seconds())
+	if err != nil {
+		multicallErrors.WithLabelValues(chainId).Inc()
+	}
+}
+
+// Queue lengths are read when scraped, rather than updated on every push and pop
+func RegisterRefreshQueues(urgentLen func() int, slowLen func() int, pendingLen func() int) {
+	gauges := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "graphcache_refresh_urgent_queue_len",
+			Help: "Liquidity refreshes waiting in the urgent queue",
+		}, func() float64 { return float64(urgentLen()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "graphcache_refresh_slow_queue_len",
+			Help: "Liquidity refreshes waiting in the slow queue",
+		}, func() float64 { return float64(slowLen()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "graphcache_refresh_pending",
+			Help: "Distinct positions and pools with a refresh pending",
+		}, func() float64 { return float64(pendingLen()) }),
+	}
+	for _, gauge := range gauges {
+		if err := prometheus.Register(gauge); err != nil {
+			log.Println("Warning unable to register refresh queue metric:", err)
+		}
+	}
+}
+
+// Records the latency of every request under its route pattern, so that path parameters
+// don't create a series per value. Unmatched requests are grouped together.
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startTime := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpLatency.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(startTime).Seconds())
+	}
+}
+
+func CountApiRequest(client string, result string) {
+	apiRequests.WithLabelValues(client, result).Inc()
+}
+
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
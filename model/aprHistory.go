@@ -0,0 +1,81 @@
+package model
+
+import (
+	"sync"
+)
+
+type AprSnap struct {
+	Time int     `json:"time"`
+	Apr  float64 `json:"apr"`
+}
+
+// Periodic APR estimates of a single position, oldest first. Snapshots older than the
+// retention window are dropped.
+type AprHistory struct {
+	Snaps []AprSnap
+	lock  sync.RWMutex
+}
+
+func (h *AprHistory) Record(time int, apr float64, minTime int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.Snaps = append(h.Snaps, AprSnap{time, apr})
+	h.prune(minTime)
+}
+
+// Drops the snapshots before minTime. Returns true if none are left.
+func (h *AprHistory) Prune(minTime int) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.prune(minTime)
+	return len(h.Snaps) == 0
+}
+
+func (h *AprHistory) prune(minTime int) {
+	i := 0
+	for i < len(h.Snaps) && h.Snaps[i].Time < minTime {
+		i++
+	}
+	if i > 0 {
+		h.Snaps = append(h.Snaps[:0], h.Snaps[i:]...)
+	}
+}
+
+func (h *AprHistory) Series() []AprSnap {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return append([]AprSnap{}, h.Snaps...)
+}
+
+const YEAR_SECS = 3600 * 24 * 365
+
+// Annualized fees earned over TVL between two points in the pool's history, with both
+// sides valued in the base token at the later price. Returns 0 if the pool has no TVL or
+// price.
+func PoolFeeApr(open AccumPoolStats, close AccumPoolStats, duration int) float64 {
+	price := close.LastPriceIndic
+	tvl := close.BaseTvl + close.QuoteTvl*price
+	if duration <= 0 || price <= 0 || tvl <= 0 {
+		return 0
+	}
+	fees := (close.BaseFees - open.BaseFees) + (close.QuoteFees-open.QuoteFees)*price
+	apr := fees / tvl * YEAR_SECS / float64(duration)
+	if apr < 0 {
+		return 0
+	}
+	return apr
+}
+
+// Exponential moving average over the series, to smooth out the noise of individual
+// estimates. Alpha is the weight of the latest value.
+func SmoothAprs(aprs []float64, alpha float64) []float64 {
+	smoothed := make([]float64, len(aprs))
+	for i, apr := range aprs {
+		if i == 0 {
+			smoothed[i] = apr
+		} else {
+			smoothed[i] = alpha*apr + (1-alpha)*smoothed[i-1]
+		}
+	}
+	return smoothed
+}
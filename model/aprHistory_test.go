@@ -0,0 +1,21 @@
+package model
+
+import "testing"
+
+func TestAprHistoryRetention(t *testing.T) {
+	h := &AprHistory{}
+	for time := 100; time <= 500; time += 100 {
+		h.Record(time, float64(time), time-250)
+	}
+	snaps := h.Series()
+	if len(snaps) != 3 || snaps[0].Time != 300 || snaps[2].Time != 500 {
+		t.Fatalf("Expected the snapshots within the window, got %+v", snaps)
+	}
+
+	if h.Prune(400) || len(h.Series()) != 2 {
+		t.Fatalf("Bad pruned history %+v", h.Series())
+	}
+	if !h.Prune(501) {
+		t.Fatalf("Expected empty history, got %+v", h.Series())
+	}
+}
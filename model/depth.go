@@ -0,0 +1,165 @@
+package model
+
+import (
+	"math"
+	"sort"
+)
+
+type CurveDepth struct {
+	Price        float64         `json:"price"`
+	Tick         int             `json:"tick"`
+	Bids         []DepthLevel    `json:"bids"`
+	Asks         []DepthLevel    `json:"asks"`
+	KnockoutBids []KnockoutLevel `json:"knockoutBids"`
+	KnockoutAsks []KnockoutLevel `json:"knockoutAsks"`
+}
+
+// Token amounts the curve trades between the previous level and this one. Bids pay out
+// base for quote as the price falls, asks pay out quote for base as it rises. Tick and
+// price are at the edge of the bucket further from the current price.
+type DepthLevel struct {
+	Tick     int     `json:"tick"`
+	Price    float64 `json:"price"`
+	BaseQty  float64 `json:"baseQty"`
+	QuoteQty float64 `json:"quoteQty"`
+	CumBase  float64 `json:"cumBase"`
+	CumQuote float64 `json:"cumQuote"`
+}
+
+// Resting knockout liquidity. Bids are filled as the price falls from the join tick to the
+// knockout tick, and asks as it rises from the join tick to the knockout tick.
+type KnockoutLevel struct {
+	Tick     int     `json:"tick"`
+	JoinTick int     `json:"joinTick"`
+	Price    float64 `json:"price"`
+	Liq      float64 `json:"liq"`
+	BaseQty  float64 `json:"baseQty"`
+	QuoteQty float64 `json:"quoteQty"`
+}
+
+// Converts the curve into order book style levels of bucketTicks width, nBuckets on each side
+// of the price. Knockout liquidity is taken out of the curve and listed separately.
+func (c *LiquidityCurve) Depth(price float64, bucketTicks int, nBuckets int) CurveDepth {
+	depth := CurveDepth{
+		Price:        price,
+		Tick:         priceToTick(price),
+		Bids:         make([]DepthLevel, 0, nBuckets),
+		Asks:         make([]DepthLevel, 0, nBuckets),
+		KnockoutBids: make([]KnockoutLevel, 0),
+		KnockoutAsks: make([]KnockoutLevel, 0),
+	}
+	if price <= 0 || bucketTicks <= 0 || nBuckets <= 0 {
+		return depth
+	}
+	minTick := depth.Tick - bucketTicks*(nBuckets+1)
+	maxTick := depth.Tick + bucketTicks*(nBuckets+1)
+
+	deltas := make(map[int]float64, len(c.Bumps))
+	for _, bump := range c.Bumps {
+		deltas[bump.Tick] += bump.LiquidityDelta
+
+		if bump.KnockoutBidLiq != 0 {
+			liq := math.Abs(bump.KnockoutBidLiq)
+			joinTick := bump.Tick + bump.KnockoutBidWidth
+			deltas[bump.Tick] -= liq
+			deltas[joinTick] += liq
+			if bump.Tick >= minTick && bump.Tick <= maxTick {
+				depth.KnockoutBids = append(depth.KnockoutBids, knockoutLevel(bump.Tick, joinTick, liq))
+			}
+		}
+		if bump.KnockoutAskLiq != 0 {
+			liq := math.Abs(bump.KnockoutAskLiq)
+			joinTick := bump.Tick - bump.KnockoutAskWidth
+			deltas[joinTick] -= liq
+			deltas[bump.Tick] += liq
+			if bump.Tick >= minTick && bump.Tick <= maxTick {
+				depth.KnockoutAsks = append(depth.KnockoutAsks, knockoutLevel(bump.Tick, joinTick, liq))
+			}
+		}
+	}
+	sort.Slice(depth.KnockoutBids, func(i, j int) bool { return depth.KnockoutBids[i].Tick > depth.KnockoutBids[j].Tick })
+	sort.Slice(depth.KnockoutAsks, func(i, j int) bool { return depth.KnockoutAsks[i].Tick < depth.KnockoutAsks[j].Tick })
+
+	ticks := make([]int, 0, len(deltas))
+	for tick := range deltas {
+		ticks = append(ticks, tick)
+	}
+	sort.Ints(ticks)
+
+	startLiq := c.AmbientLiq
+	above := 0
+	for above < len(ticks) && ticks[above] <= depth.Tick {
+		startLiq += deltas[ticks[above]]
+		above++
+	}
+	startSqrt := math.Sqrt(price)
+	bucketFloor := int(math.Floor(float64(depth.Tick)/float64(bucketTicks))) * bucketTicks
+
+	// Asks, walking up from the price
+	liq, sqrtP, idx := startLiq, startSqrt, above
+	var cumBase, cumQuote float64
+	for i := 0; i < nBuckets; i++ {
+		upperTick := bucketFloor + (i+1)*bucketTicks
+		var baseQty, quoteQty float64
+		for idx < len(ticks) && ticks[idx] <= upperTick {
+			sqrtNext := math.Sqrt(tickToPrice(ticks[idx]))
+			b, q := rangeTokens(liq, sqrtP, sqrtNext)
+			baseQty, quoteQty = baseQty+b, quoteQty+q
+			sqrtP = sqrtNext
+			liq += deltas[ticks[idx]]
+			idx++
+		}
+		sqrtNext := math.Sqrt(tickToPrice(upperTick))
+		b, q := rangeTokens(liq, sqrtP, sqrtNext)
+		baseQty, quoteQty = baseQty+b, quoteQty+q
+		sqrtP = sqrtNext
+
+		cumBase, cumQuote = cumBase+baseQty, cumQuote+quoteQty
+		depth.Asks = append(depth.Asks, DepthLevel{upperTick, tickToPrice(upperTick), baseQty, quoteQty, cumBase, cumQuote})
+	}
+
+	// Bids, walking down from the price
+	liq, sqrtP, idx = startLiq, startSqrt, above-1
+	cumBase, cumQuote = 0, 0
+	for i := 0; i < nBuckets; i++ {
+		lowerTick := bucketFloor - i*bucketTicks
+		var baseQty, quoteQty float64
+		for idx >= 0 && ticks[idx] >= lowerTick {
+			sqrtNext := math.Sqrt(tickToPrice(ticks[idx]))
+			b, q := rangeTokens(liq, sqrtNext, sqrtP)
+			baseQty, quoteQty = baseQty+b, quoteQty+q
+			sqrtP = sqrtNext
+			liq -= deltas[ticks[idx]]
+			idx--
+		}
+		sqrtNext := math.Sqrt(tickToPrice(lowerTick))
+		b, q := rangeTokens(liq, sqrtNext, sqrtP)
+		baseQty, quoteQty = baseQty+b, quoteQty+q
+		sqrtP = sqrtNext
+
+		cumBase, cumQuote = cumBase+baseQty, cumQuote+quoteQty
+		depth.Bids = append(depth.Bids, DepthLevel{lowerTick, tickToPrice(lowerTick), baseQty, quoteQty, cumBase, cumQuote})
+	}
+	return depth
+}
+
+// Base and quote tokens in a constant liquidity range between two root prices
+func rangeTokens(liq float64, sqrtLower float64, sqrtUpper float64) (float64, float64) {
+	if liq <= 0 || sqrtUpper <= sqrtLower {
+		return 0, 0
+	}
+	return liq * (sqrtUpper - sqrtLower), liq * (1/sqrtLower - 1/sqrtUpper)
+}
+
+func knockoutLevel(tick int, joinTick int, liq float64) KnockoutLevel {
+	lower, upper := min(tick, joinTick), max(tick, joinTick)
+	base, quote := rangeTokens(liq, math.Sqrt(tickToPrice(lower)), math.Sqrt(tickToPrice(upper)))
+	return KnockoutLevel{
+		Tick:     tick,
+		JoinTick: joinTick,
+		Price:    tickToPrice(tick),
+		Liq:      liq,
+		BaseQty:  base,
+		QuoteQty: quote,
+	}
+}
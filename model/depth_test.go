@@ -0,0 +1,39 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDepthSeparatesKnockouts(t *testing.T) {
+	curve := NewLiquidityCurve()
+	curve.AmbientLiq = 1e18
+	// Knockout bid from tick -50 to -40, which is also part of the curve's bumps
+	curve.Bumps[-50] = &LiquidityBump{Tick: -50, LiquidityDelta: 2e18, KnockoutBidLiq: 2e18, KnockoutBidWidth: 10}
+	curve.Bumps[-40] = &LiquidityBump{Tick: -40, LiquidityDelta: -2e18}
+
+	depth := curve.Depth(1.0, 10, 10)
+	if len(depth.Asks) != 10 || len(depth.Bids) != 10 {
+		t.Fatalf("Expected 10 levels per side, got %d asks and %d bids", len(depth.Asks), len(depth.Bids))
+	}
+
+	// Every bid level is ambient only once the knockout is taken out
+	for _, level := range depth.Bids {
+		upper := math.Sqrt(tickToPrice(level.Tick + 10))
+		if level.Tick == 0 {
+			upper = 1.0
+		}
+		expected := 1e18 * (upper - math.Sqrt(tickToPrice(level.Tick)))
+		if math.Abs(level.BaseQty-expected) > 1e-6*expected+1 {
+			t.Fatalf("Bid level at %d has %g base, expected %g", level.Tick, level.BaseQty, expected)
+		}
+	}
+
+	if len(depth.KnockoutBids) != 1 || depth.KnockoutBids[0].Tick != -50 || depth.KnockoutBids[0].JoinTick != -40 {
+		t.Fatalf("Unexpected knockout bids %+v", depth.KnockoutBids)
+	}
+	last := depth.Asks[len(depth.Asks)-1]
+	if last.CumQuote <= 0 || last.CumBase <= 0 {
+		t.Fatalf("Empty cumulative asks %+v", last)
+	}
+}
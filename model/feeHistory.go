@@ -0,0 +1,91 @@
+package model
+
+import (
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/CrocSwap/graphcache-go/tables"
+)
+
+// On-chain fee rates are in hundredths of a basis point
+const FEE_RATE_MULTIPLIER = 10000.0 * 100
+
+type FeeRateChange struct {
+	ID      string  `json:"-"`
+	Time    int     `json:"time"`
+	Block   int     `json:"block"`
+	TxHash  string  `json:"txHash"`
+	FeeRate float64 `json:"feeRate"`
+}
+
+// Timeline of a pool's fee rate, including governance driven revisions, in time order
+type FeeHistory struct {
+	Changes []FeeRateChange
+	lock    sync.RWMutex
+}
+
+// Returns false if the change was already recorded
+func (h *FeeHistory) Record(r tables.FeeChange) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if slices.ContainsFunc(h.Changes, func(c FeeRateChange) bool { return c.ID == r.ID }) {
+		return false
+	}
+	change := FeeRateChange{
+		ID:      r.ID,
+		Time:    r.Time,
+		Block:   r.Block,
+		TxHash:  r.Tx,
+		FeeRate: float64(r.FeeRate) / FEE_RATE_MULTIPLIER,
+	}
+	i := sort.Search(len(h.Changes), func(i int) bool {
+		return h.Changes[i].Block > r.Block
+	})
+	h.Changes = slices.Insert(h.Changes, i, change)
+	return true
+}
+
+func (h *FeeHistory) Remove(id string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.Changes = slices.DeleteFunc(h.Changes, func(c FeeRateChange) bool { return c.ID == id })
+}
+
+func (h *FeeHistory) Series() []FeeRateChange {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return slices.Clone(h.Changes)
+}
+
+// Fee rate in effect at the given time, or false if no change was recorded by then
+func (h *FeeHistory) RateAt(time int) (float64, bool) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return rateAt(h.Changes, time)
+}
+
+// Replaces the candles' fee rates, which only change on agg events, with the rates from
+// the exact fee change times. Candles from before the first recorded change are left as is.
+func (h *FeeHistory) ApplyToCandles(candles []Candle) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	for i := range candles {
+		if rate, ok := rateAt(h.Changes, candles[i].Time); ok {
+			candles[i].FeeRateOpen = rate
+		}
+		if rate, ok := rateAt(h.Changes, candles[i].Time+candles[i].Period-1); ok {
+			candles[i].FeeRateClose = rate
+		}
+	}
+}
+
+func rateAt(changes []FeeRateChange, time int) (float64, bool) {
+	i := sort.Search(len(changes), func(i int) bool {
+		return changes[i].Time > time
+	})
+	if i == 0 {
+		return 0, false
+	}
+	return changes[i-1].FeeRate, true
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/tables"
+)
+
+func TestFeeHistoryRates(t *testing.T) {
+	hist := FeeHistory{}
+	hist.Record(tables.FeeChange{ID: "b", Block: 20, Time: 2000, FeeRate: 3000})
+	hist.Record(tables.FeeChange{ID: "a", Block: 10, Time: 1000, FeeRate: 500})
+	if hist.Record(tables.FeeChange{ID: "a", Block: 10, Time: 1000, FeeRate: 500}) {
+		t.Fatal("Duplicate fee change recorded")
+	}
+
+	if _, ok := hist.RateAt(999); ok {
+		t.Fatal("Rate before first change")
+	}
+	if rate, _ := hist.RateAt(1000); rate != 0.0005 {
+		t.Fatalf("Rate at first change is %g", rate)
+	}
+	if rate, _ := hist.RateAt(5000); rate != 0.003 {
+		t.Fatalf("Rate after second change is %g", rate)
+	}
+
+	candles := []Candle{{Time: 1800, Period: 600}}
+	hist.ApplyToCandles(candles)
+	if candles[0].FeeRateOpen != 0.0005 || candles[0].FeeRateClose != 0.003 {
+		t.Fatalf("Candle fee rates %g %g", candles[0].FeeRateOpen, candles[0].FeeRateClose)
+	}
+
+	hist.Remove("b")
+	if rate, _ := hist.RateAt(5000); rate != 0.0005 {
+		t.Fatalf("Rate after removing change is %g", rate)
+	}
+}
@@ -43,8 +43,10 @@ type KnockoutSagaTx struct {
 }
 
 type KnockoutSagaCross struct {
-	CrossTime int
-	PivotTime int
+	CrossTime  int
+	CrossBlock int
+	PivotTime  int
+	FeeMileage float64
 }
 
 type KnockoutPivotCands struct {
@@ -65,13 +67,13 @@ func (k *KnockoutSubplot) IsActiveEmpty() bool {
 	return k.Liq.Active.AmbientLiq.Cmp(zero) == 0
 }
 
-func (k *KnockoutSubplot) GetCrossForPivotTime(pivotTime int) (int, bool) {
+func (k *KnockoutSubplot) GetCrossForPivotTime(pivotTime int) (KnockoutSagaCross, bool) {
 	for _, cross := range k.saga.crosses {
 		if cross.PivotTime == pivotTime {
-			return cross.CrossTime, true
+			return cross, true
 		}
 	}
-	return -1, false
+	return KnockoutSagaCross{CrossTime: -1}, false
 }
 
 func (k *KnockoutSaga) ForUser(user types.EthAddress) *KnockoutSubplot {
@@ -137,19 +139,113 @@ func (k *KnockoutSubplot) AppendBurn(burn KnockoutSagaTx) {
 	k.Burns = append(k.Burns, burn)
 }
 
+// State of the subplot before a liquidity change, used to undo the change on a reorg.
+// Update times are captured separately by the ingestion worker that applies them.
+type KnockoutCheckpoint struct {
+	nMints     int
+	nBurns     int
+	activeLiq  big.Int
+	knockedOut map[int]PositionLiquidity
+}
+
+func (k *KnockoutSubplot) Checkpoint() KnockoutCheckpoint {
+	k.lock.Lock()
+	cp := KnockoutCheckpoint{
+		nMints: len(k.Mints),
+		nBurns: len(k.Burns),
+	}
+	k.lock.Unlock()
+
+	k.Liq.lock.Lock()
+	defer k.Liq.lock.Unlock()
+	cp.activeLiq.Set(&k.Liq.Active.ConcLiq)
+	cp.knockedOut = make(map[int]PositionLiquidity, len(k.Liq.KnockedOut))
+	for pivotTime, liq := range k.Liq.KnockedOut {
+		cp.knockedOut[pivotTime] = *liq
+	}
+	return cp
+}
+
+func (k *KnockoutSubplot) Restore(cp KnockoutCheckpoint) {
+	k.lock.Lock()
+	if cp.nMints < len(k.Mints) {
+		k.Mints = k.Mints[:cp.nMints]
+	}
+	if cp.nBurns < len(k.Burns) {
+		k.Burns = k.Burns[:cp.nBurns]
+	}
+	k.lock.Unlock()
+
+	k.Liq.lock.Lock()
+	defer k.Liq.lock.Unlock()
+	k.Liq.Active.ConcLiq.Set(&cp.activeLiq)
+	for pivotTime := range k.Liq.KnockedOut {
+		if _, ok := cp.knockedOut[pivotTime]; !ok {
+			delete(k.Liq.KnockedOut, pivotTime)
+		}
+	}
+	for pivotTime, liq := range cp.knockedOut {
+		saved := liq
+		k.Liq.KnockedOut[pivotTime] = &saved
+	}
+}
+
+func (k *KnockoutSubplot) UpdateTimes() (latestUpdateTime int, timeFirstMint int) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.LatestUpdateTime, k.Liq.TimeFirstMint
+}
+
+func (k *KnockoutSubplot) RestoreTimes(latestUpdateTime int, timeFirstMint int) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.LatestUpdateTime = latestUpdateTime
+	k.Liq.TimeFirstMint = timeFirstMint
+}
+
 func (k *KnockoutSubplot) Time() int {
 	return k.LatestUpdateTime
 }
 
-func (k *KnockoutSaga) UpdateCross(l tables.LiqChange) []KnockoutPivotCands {
+func (k *KnockoutSaga) UpdateCross(x tables.KnockoutCross) []KnockoutPivotCands {
 	k.lock.Lock()
 	defer k.lock.Unlock()
 	event := KnockoutSagaCross{
-		CrossTime: l.Time,
-		PivotTime: *l.PivotTime,
+		CrossTime:  x.Time,
+		CrossBlock: x.Block,
+		PivotTime:  x.PivotTime,
+		FeeMileage: x.FeeMileage,
 	}
 	k.crosses = append(k.crosses, event)
-	return k.scrapePivotsCandsOnCross(*l.PivotTime, l.Time)
+	return k.scrapePivotsCandsOnCross(x.PivotTime, x.Time)
+}
+
+// Crosses at the saga's tick, in the order they were applied
+func (k *KnockoutSaga) Crosses() []KnockoutSagaCross {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return slices.Clone(k.crosses)
+}
+
+// Undoes a cross that was rolled back. Liquidity that was moved to the post-knockout
+// series for the pivot is made active again. Returns the affected users.
+func (k *KnockoutSaga) RevertCross(x tables.KnockoutCross) []KnockoutPivotCands {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.crosses = slices.DeleteFunc(k.crosses, func(cross KnockoutSagaCross) bool {
+		return cross.CrossTime == x.Time && cross.PivotTime == x.PivotTime
+	})
+
+	cands := make([]KnockoutPivotCands, 0)
+	for userAddr, subplot := range k.users {
+		if subplot.Liq.revertPostKOLiq(x.PivotTime) {
+			cands = append(cands, KnockoutPivotCands{
+				PivotTime: x.PivotTime,
+				User:      userAddr,
+			})
+		}
+	}
+	return cands
 }
 
 func (k *KnockoutSubplot) scrapePivotsCandsOnMint(mintTime int, user types.EthAddress) []KnockoutPivotCands {
@@ -201,6 +297,26 @@ func (k *KnockoutLiquiditySeries) UpdateActiveLiq(liqQty big.Int, refreshTime in
 	k.Active.RefreshTime = refreshTime
 }
 
+func (k *KnockoutLiquiditySeries) revertPostKOLiq(pivotTime int) bool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	posKoLiq, ok := k.KnockedOut[pivotTime]
+	if !ok {
+		return false
+	}
+	k.Active.ConcLiq.Set(&posKoLiq.ConcLiq)
+	delete(k.KnockedOut, pivotTime)
+	return true
+}
+
+// Whether the liquidity knocked out at the pivot has been claimed or recovered
+func (k *KnockoutLiquiditySeries) IsClaimed(pivotTime int) bool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	posKoLiq, ok := k.KnockedOut[pivotTime]
+	return ok && posKoLiq.IsEmpty()
+}
+
 func (k *KnockoutLiquiditySeries) UpdatePostKOLiq(pivotTime int, liqQty big.Int, refreshTime int64) {
 	k.lock.Lock()
 	defer k.lock.Unlock()
@@ -212,3 +328,58 @@ func (k *KnockoutLiquiditySeries) UpdatePostKOLiq(pivotTime int, liqQty big.Int,
 	posKoLiq.ConcLiq = liqQty
 	k.Active.RefreshTime = refreshTime
 }
+
+// Serializable form of a saga, for state snapshots. The users' subplots are stored with
+// the saga, because they hold a back reference to it that's only restored here.
+type KnockoutSagaSnapshot struct {
+	Users   map[types.EthAddress]*KnockoutSubplot
+	Crosses []KnockoutSagaCross
+}
+
+func (k *KnockoutSaga) Snapshot() KnockoutSagaSnapshot {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	snap := KnockoutSagaSnapshot{
+		Users:   make(map[types.EthAddress]*KnockoutSubplot, len(k.users)),
+		Crosses: slices.Clone(k.crosses),
+	}
+	for user, subplot := range k.users {
+		snap.Users[user] = subplot.snapshotCopy()
+	}
+	return snap
+}
+
+// Copies the subplot under its locks, without the back reference to the saga
+func (k *KnockoutSubplot) snapshotCopy() *KnockoutSubplot {
+	k.lock.Lock()
+	cp := &KnockoutSubplot{
+		Mints:            slices.Clone(k.Mints),
+		Burns:            slices.Clone(k.Burns),
+		LatestUpdateTime: k.LatestUpdateTime,
+	}
+	k.lock.Unlock()
+
+	k.Liq.lock.Lock()
+	defer k.Liq.lock.Unlock()
+	cp.Liq.Active = k.Liq.Active.copy()
+	cp.Liq.TimeFirstMint = k.Liq.TimeFirstMint
+	cp.Liq.KnockedOut = make(map[int]*PositionLiquidity, len(k.Liq.KnockedOut))
+	for pivotTime, liq := range k.Liq.KnockedOut {
+		liqCp := liq.copy()
+		cp.Liq.KnockedOut[pivotTime] = &liqCp
+	}
+	return cp
+}
+
+func RestoreKnockoutSaga(snap KnockoutSagaSnapshot) *KnockoutSaga {
+	saga := NewKnockoutSaga()
+	saga.crosses = append(saga.crosses, snap.Crosses...)
+	for user, subplot := range snap.Users {
+		subplot.saga = saga
+		if subplot.Liq.KnockedOut == nil {
+			subplot.Liq.KnockedOut = make(map[int]*PositionLiquidity, 0)
+		}
+		saga.users[user] = subplot
+	}
+	return saga
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 
 	"github.com/CrocSwap/graphcache-go/tables"
+	"github.com/CrocSwap/graphcache-go/types"
 )
 
 type LiquidityCurve struct {
@@ -28,6 +29,18 @@ func NewLiquidityCurve() *LiquidityCurve {
 	}
 }
 
+func (c *LiquidityCurve) Copy() *LiquidityCurve {
+	cp := &LiquidityCurve{
+		AmbientLiq: c.AmbientLiq,
+		Bumps:      make(map[int]*LiquidityBump, len(c.Bumps)),
+	}
+	for tick, bump := range c.Bumps {
+		bumpCp := *bump
+		cp.Bumps[tick] = &bumpCp
+	}
+	return cp
+}
+
 func (c *LiquidityCurve) UpdateLiqChange(l tables.LiqChange) {
 	if l.PositionType == tables.PosTypeAmbient {
 		liqMagn := determineLiquidityMagn(l)
@@ -42,7 +55,120 @@ func (c *LiquidityCurve) UpdateLiqChange(l tables.LiqChange) {
 	}
 
 	if l.ChangeType == tables.ChangeTypeCross {
-		c.updateKOCross(l)
+		if l.IsBid > 0 {
+			c.updateKOCross(l.BidTick, true, l.Time)
+		} else {
+			c.updateKOCross(l.AskTick, false, l.Time)
+		}
+	}
+}
+
+// Knockout cross replayed onto a historical curve
+type CurveCross struct {
+	Tick  int
+	IsBid bool
+	Block int
+	Time  int
+}
+
+// Applies a liquidity change from the pool's tx history when rebuilding a historical curve.
+// Cross rows are skipped, because only some chains have them. Crosses are applied from the
+// knockout sagas with ApplyCross instead.
+func (c *LiquidityCurve) ApplyPoolTx(tx types.PoolTxEvent) {
+	if tx.EntityType != tables.EntityTypeLiqChange && tx.EntityType != tables.EntityTypeLimit {
+		return
+	}
+	if tx.ChangeType == tables.ChangeTypeCross {
+		return
+	}
+	baseFlow, quoteFlow := tx.BaseFlow, tx.QuoteFlow
+	isBid := 0
+	if tx.IsBuy {
+		isBid = 1
+	}
+	c.UpdateLiqChange(tables.LiqChange{
+		Time:         tx.TxTime,
+		Block:        tx.BlockNum,
+		PositionType: tx.PositionType,
+		ChangeType:   tx.ChangeType,
+		BidTick:      tx.BidTick,
+		AskTick:      tx.AskTick,
+		IsBid:        isBid,
+		BaseFlow:     &baseFlow,
+		QuoteFlow:    &quoteFlow,
+	})
+}
+
+func (c *LiquidityCurve) ApplyCross(x CurveCross) {
+	c.updateKOCross(x.Tick, x.IsBid, x.Time)
+}
+
+func (c *LiquidityCurve) UpdateKnockoutCross(k tables.KnockoutCross) {
+	c.updateKOCross(k.Tick, k.IsBid > 0, k.Time)
+}
+
+// Copies of the bumps touched by a liquidity change, taken before the change. Bumps that
+// didn't exist yet are nil.
+type LiquidityCurveCheckpoint struct {
+	ambientLiq float64
+	bumps      map[int]*LiquidityBump
+}
+
+func (c *LiquidityCurve) Checkpoint(l tables.LiqChange) LiquidityCurveCheckpoint {
+	ticks := []int{l.BidTick, l.AskTick}
+	if l.ChangeType == tables.ChangeTypeCross {
+		if l.IsBid > 0 {
+			ticks = append(ticks, c.crossJoinTick(l.BidTick, true))
+		} else {
+			ticks = append(ticks, c.crossJoinTick(l.AskTick, false))
+		}
+	}
+	return c.checkpointTicks(ticks)
+}
+
+func (c *LiquidityCurve) CheckpointCross(k tables.KnockoutCross) LiquidityCurveCheckpoint {
+	return c.checkpointTicks([]int{k.Tick, c.crossJoinTick(k.Tick, k.IsBid > 0)})
+}
+
+// The tick that knocked out liquidity at the pivot tick is moved to when it's crossed
+func (c *LiquidityCurve) crossJoinTick(tick int, isBid bool) int {
+	bump, ok := c.Bumps[tick]
+	if !ok {
+		return tick
+	}
+	if isBid {
+		return bump.Tick + bump.KnockoutBidWidth
+	}
+	return bump.Tick - bump.KnockoutAskWidth
+}
+
+func (c *LiquidityCurve) checkpointTicks(ticks []int) LiquidityCurveCheckpoint {
+	cp := LiquidityCurveCheckpoint{
+		ambientLiq: c.AmbientLiq,
+		bumps:      make(map[int]*LiquidityBump, len(ticks)),
+	}
+	for _, tick := range ticks {
+		if bump, ok := c.Bumps[tick]; ok {
+			saved := *bump
+			cp.bumps[tick] = &saved
+		} else {
+			cp.bumps[tick] = nil
+		}
+	}
+	return cp
+}
+
+// Bumps are restored in place, because refresh handles hold pointers to them
+func (c *LiquidityCurve) Restore(cp LiquidityCurveCheckpoint) {
+	c.AmbientLiq = cp.ambientLiq
+	for tick, saved := range cp.bumps {
+		if saved == nil {
+			delete(c.Bumps, tick)
+		} else if bump, ok := c.Bumps[tick]; ok {
+			*bump = *saved
+		} else {
+			c.Bumps[tick] = saved
+		}
 	}
 }
 
@@ -67,20 +193,20 @@ func (c *LiquidityCurve) updateUserLiq(l tables.LiqChange) {
 	}
 }
 
-func (c *LiquidityCurve) updateKOCross(k tables.LiqChange) {
-	if k.IsBid > 0 {
-		bidBump := c.materializeBump(k.BidTick)
-		koLiq, joinTick := bidBump.KnockoutBid(k.Time)
+func (c *LiquidityCurve) updateKOCross(tick int, isBid bool, time int) {
+	if isBid {
+		bidBump := c.materializeBump(tick)
+		askBump := c.materializeBump(c.crossJoinTick(tick, true))
 
-		askBump := c.materializeBump(joinTick)
-		askBump.IncrLiquidity(koLiq, k.Time)
+		koLiq, _ := bidBump.KnockoutBid(time)
+		askBump.IncrLiquidity(koLiq, time)
 
 	} else {
-		askBump := c.materializeBump(k.AskTick)
-		koLiq, joinTick := askBump.KnockoutAsk(k.Time)
+		askBump := c.materializeBump(tick)
+		bidBump := c.materializeBump(c.crossJoinTick(tick, false))
 
-		bidBump := c.materializeBump(joinTick)
-		bidBump.IncrLiquidity(koLiq, k.Time)
+		koLiq, _ := askBump.KnockoutAsk(time)
+		bidBump.IncrLiquidity(koLiq, time)
 	}
 }
 
@@ -14,7 +14,7 @@ type LiquidityDeltaHist struct {
 type LiquidityDelta struct {
 	Time         int
 	LiqChange    float64
-	resetRewards bool
+	ResetRewards bool `json:"-"`
 }
 
 func (l *LiquidityDeltaHist) netCumulativeLiquidity() float64 {
@@ -41,7 +41,7 @@ func (l *LiquidityDeltaHist) weightedAverageTime() int {
 	openTime := 0.0
 
 	for _, delta := range l.Hist {
-		if delta.resetRewards {
+		if delta.ResetRewards {
 			openTime = float64(delta.Time)
 		}
 
@@ -71,7 +71,7 @@ func (l *LiquidityDeltaHist) appendChange(r tables.LiqChange) {
 	if r.ChangeType == tables.ChangeTypeHarvest {
 		l.Hist = append(l.Hist, LiquidityDelta{
 			Time:         r.Time,
-			resetRewards: true,
+			ResetRewards: true,
 		})
 
 	} else {
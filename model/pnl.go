@@ -0,0 +1,85 @@
+package model
+
+import (
+	"math"
+
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+// Token amounts are in wei, and values are in base token wei at the current pool price.
+type PositionPnL struct {
+	PoolPrice       float64 `json:"poolPrice"`
+	DepositBase     float64 `json:"depositBase"`
+	DepositQuote    float64 `json:"depositQuote"`
+	WithdrawBase    float64 `json:"withdrawBase"`
+	WithdrawQuote   float64 `json:"withdrawQuote"`
+	CurrentBase     float64 `json:"currentBase"`
+	CurrentQuote    float64 `json:"currentQuote"`
+	FeesBase        float64 `json:"feesBase"`
+	FeesQuote       float64 `json:"feesQuote"`
+	PnlInBase       float64 `json:"pnlInBase"`
+	ImpermanentLoss float64 `json:"impLoss"`
+}
+
+// Fees are the rewards still in the position plus those already harvested. Ambient
+// positions compound their fees into liquidity, so their fees are the liquidity above
+// what was deposited. Concentrated burns pay out accrued rewards along with the
+// liquidity, so fees claimed that way are counted as withdrawals.
+//
+// Impermanent loss compares the position's principal, including what was withdrawn,
+// against holding the deposited tokens, both at the current price. Returns nil if the
+// pool has no price yet.
+func (p *PositionTracker) CalcPnL(loc types.PositionLocation, poolPrice float64) *PositionPnL {
+	if poolPrice <= 0 || math.IsInf(poolPrice, 0) || math.IsNaN(poolPrice) {
+		return nil
+	}
+
+	pnl := &PositionPnL{
+		PoolPrice:     poolPrice,
+		DepositBase:   p.Flows.DepositBase,
+		DepositQuote:  p.Flows.DepositQuote,
+		WithdrawBase:  p.Flows.WithdrawBase,
+		WithdrawQuote: p.Flows.WithdrawQuote,
+		FeesBase:      p.Flows.HarvestBase,
+		FeesQuote:     p.Flows.HarvestQuote,
+	}
+
+	if p.IsConcentrated() {
+		pnl.CurrentBase, pnl.CurrentQuote = concTokens(castBigToFloat(&p.ConcLiq), loc.BidTick, loc.AskTick, poolPrice)
+		feesBase, feesQuote := ambTokens(castBigToFloat(&p.RewardLiq), poolPrice)
+		pnl.FeesBase += feesBase
+		pnl.FeesQuote += feesQuote
+	} else {
+		ambLiq := castBigToFloat(&p.AmbientLiq)
+		principalLiq := math.Min(p.LiqHist.netCumulativeLiquidity(), ambLiq)
+		pnl.CurrentBase, pnl.CurrentQuote = ambTokens(principalLiq, poolPrice)
+		feesBase, feesQuote := ambTokens(ambLiq-principalLiq, poolPrice)
+		pnl.FeesBase += feesBase
+		pnl.FeesQuote += feesQuote
+	}
+
+	valueOf := func(base float64, quote float64) float64 {
+		return base + quote*poolPrice
+	}
+	depositValue := valueOf(pnl.DepositBase, pnl.DepositQuote)
+	principalValue := valueOf(pnl.CurrentBase+pnl.WithdrawBase, pnl.CurrentQuote+pnl.WithdrawQuote)
+
+	pnl.PnlInBase = principalValue + valueOf(pnl.FeesBase, pnl.FeesQuote) - depositValue
+	if depositValue > 0 {
+		pnl.ImpermanentLoss = principalValue/depositValue - 1
+	}
+	return pnl
+}
+
+func concTokens(liq float64, bidTick int, askTick int, price float64) (float64, float64) {
+	base, quote := DeriveTokensFromConcLiquidity(liq, bidTick, askTick, price)
+	return castBigToFloat(base), castBigToFloat(quote)
+}
+
+func ambTokens(liq float64, price float64) (float64, float64) {
+	if liq <= 0 {
+		return 0, 0
+	}
+	base, quote := DeriveTokensFromAmbLiquidity(liq, price)
+	return castBigToFloat(base), castBigToFloat(quote)
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/tables"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestAmbientPnL(t *testing.T) {
+	baseFlow := 4e18
+	quoteFlow := 1e18
+	pos := PositionTracker{}
+	pos.UpdatePosition(tables.LiqChange{
+		Time:         1000,
+		ChangeType:   tables.ChangeTypeMint,
+		PositionType: tables.PosTypeAmbient,
+		BaseFlow:     &baseFlow,
+		QuoteFlow:    &quoteFlow,
+	})
+	// 10% of fees compounded into the position
+	ambLiq, _ := big.NewFloat(2.2e18).Int(nil)
+	pos.UpdateAmbient(*ambLiq)
+
+	assertNear := func(name string, val float64, expected float64) {
+		if math.Abs(val-expected) > 1e-6*math.Max(math.Abs(expected), 1e18) {
+			t.Fatalf("%s is %g, expected %g", name, val, expected)
+		}
+	}
+
+	pnl := pos.CalcPnL(types.PositionLocation{}, 4.0)
+	assertNear("currentBase", pnl.CurrentBase, 4e18)
+	assertNear("currentQuote", pnl.CurrentQuote, 1e18)
+	assertNear("feesBase", pnl.FeesBase, 0.4e18)
+	assertNear("feesQuote", pnl.FeesQuote, 0.1e18)
+	assertNear("pnlInBase", pnl.PnlInBase, 0.8e18)
+	assertNear("impLoss", pnl.ImpermanentLoss*1e18, 0)
+
+	// Price quadruples: holding is worth 20 base, the LP principal 16 base
+	pnl = pos.CalcPnL(types.PositionLocation{}, 16.0)
+	assertNear("impLoss", pnl.ImpermanentLoss*1e18, -0.2e18)
+
+	if pos.CalcPnL(types.PositionLocation{}, 0) != nil {
+		t.Fatal("PnL calculated without a pool price")
+	}
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"math/big"
+	"slices"
 	"time"
 
 	"github.com/CrocSwap/graphcache-go/tables"
@@ -15,6 +16,19 @@ type PositionTracker struct {
 	PositionType     tables.PosType `json:"positionType"`
 	PositionLiquidity
 	LiqHist LiquidityDeltaHist `json:"-"`
+	Flows   PositionFlows      `json:"-"`
+}
+
+// Cumulative token amounts moved by the position's liquidity changes. All amounts are
+// positive: deposits are paid into the pool by mints, withdrawals paid out by burns and
+// harvests.
+type PositionFlows struct {
+	DepositBase   float64
+	DepositQuote  float64
+	WithdrawBase  float64
+	WithdrawQuote float64
+	HarvestBase   float64
+	HarvestQuote  float64
 }
 
 func (p *PositionTracker) UpdatePosition(l tables.LiqChange) {
@@ -33,6 +47,75 @@ func (p *PositionTracker) UpdatePosition(l tables.LiqChange) {
 	p.PositionType = l.PositionType
 
 	p.LiqHist.appendChange(l)
+	p.Flows.appendChange(l)
+}
+
+func (f *PositionFlows) appendChange(l tables.LiqChange) {
+	if l.BaseFlow == nil || l.QuoteFlow == nil {
+		return
+	}
+	baseMagn, quoteMagn := flowMagns(&l)
+
+	switch l.ChangeType {
+	case tables.ChangeTypeMint:
+		f.DepositBase += baseMagn
+		f.DepositQuote += quoteMagn
+	case tables.ChangeTypeBurn:
+		f.WithdrawBase += baseMagn
+		f.WithdrawQuote += quoteMagn
+	case tables.ChangeTypeHarvest:
+		f.HarvestBase += baseMagn
+		f.HarvestQuote += quoteMagn
+	}
+}
+
+// State of the tracker before a liquidity change, used to undo the change on a reorg
+type PositionCheckpoint struct {
+	timeFirstMint    int
+	latestUpdateTime int
+	lastMintTx       string
+	firstMintTx      string
+	positionType     tables.PosType
+	nHist            int
+	flows            PositionFlows
+}
+
+func (p *PositionTracker) Checkpoint() PositionCheckpoint {
+	return PositionCheckpoint{
+		timeFirstMint:    p.TimeFirstMint,
+		latestUpdateTime: p.LatestUpdateTime,
+		lastMintTx:       p.LastMintTx,
+		firstMintTx:      p.FirstMintTx,
+		positionType:     p.PositionType,
+		nHist:            len(p.LiqHist.Hist),
+		flows:            p.Flows,
+	}
+}
+
+func (p *PositionTracker) Restore(cp PositionCheckpoint) {
+	p.TimeFirstMint = cp.timeFirstMint
+	p.LatestUpdateTime = cp.latestUpdateTime
+	p.LastMintTx = cp.lastMintTx
+	p.FirstMintTx = cp.firstMintTx
+	p.PositionType = cp.positionType
+	p.Flows = cp.flows
+	if cp.nHist < len(p.LiqHist.Hist) {
+		p.LiqHist.Hist = p.LiqHist.Hist[:cp.nHist]
+	}
+}
+
+// Copies the position's event history for a state snapshot. The liquidity is left out,
+// because the refresher writes it without a lock and it's refreshed after a restore anyway.
+func (p *PositionTracker) CopyHistory() *PositionTracker {
+	return &PositionTracker{
+		TimeFirstMint:    p.TimeFirstMint,
+		LatestUpdateTime: p.LatestUpdateTime,
+		LastMintTx:       p.LastMintTx,
+		FirstMintTx:      p.FirstMintTx,
+		PositionType:     p.PositionType,
+		LiqHist:          LiquidityDeltaHist{Hist: slices.Clone(p.LiqHist.Hist)},
+		Flows:            p.Flows,
+	}
 }
 
 func (p *PositionTracker) UpdateAmbient(liq big.Int) {
@@ -55,6 +138,15 @@ func (p *PositionTracker) Time() int {
 	return p.LatestUpdateTime
 }
 
+// Copies the big.Int values, which would otherwise share their backing arrays
+func (p *PositionLiquidity) copy() PositionLiquidity {
+	cp := PositionLiquidity{RefreshTime: p.RefreshTime}
+	cp.AmbientLiq.Set(&p.AmbientLiq)
+	cp.ConcLiq.Set(&p.ConcLiq)
+	cp.RewardLiq.Set(&p.RewardLiq)
+	return cp
+}
+
 func (p *PositionLiquidity) IsEmpty() bool {
 	zero := big.NewInt(0)
 	return p.AmbientLiq.Cmp(zero) == 0 &&
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+// A pool's price and liquidity as an edge between its two tokens. Price is in base
+// token wei per quote token wei, same as AccumPoolStats.
+type PriceEdge struct {
+	Base     types.EthAddress
+	Quote    types.EthAddress
+	Price    float64
+	BaseTvl  float64
+	QuoteTvl float64
+}
+
+func PriceEdgeFromAccum(loc types.PoolLocation, accum AccumPoolStats) PriceEdge {
+	return PriceEdge{
+		Base:     loc.Base,
+		Quote:    loc.Quote,
+		Price:    accum.LastPriceIndic,
+		BaseTvl:  accum.BaseTvl,
+		QuoteTvl: accum.QuoteTvl,
+	}
+}
+
+// Derives the USD value of one wei of every token reachable from the anchors. Anchors map a
+// token to its known USD value per wei. Each token is priced through the pool with the most
+// USD liquidity that connects it to an already priced token, so thin pools never override
+// a deep one. Pools with less than minLiqUsd of liquidity aren't used.
+func RouteUsdPrices(anchors map[types.EthAddress]float64, edges []PriceEdge, minLiqUsd float64) map[types.EthAddress]float64 {
+	prices := make(map[types.EthAddress]float64, len(anchors))
+	byToken := make(map[types.EthAddress][]int)
+	for i, edge := range edges {
+		if !isUsablePrice(edge.Price) {
+			continue
+		}
+		byToken[edge.Base] = append(byToken[edge.Base], i)
+		byToken[edge.Quote] = append(byToken[edge.Quote], i)
+	}
+
+	cands := &priceCandHeap{}
+	pushEdges := func(token types.EthAddress) {
+		for _, i := range byToken[token] {
+			edge := edges[i]
+			if edge.Base == token {
+				liqUsd := 2 * edge.BaseTvl * prices[token]
+				heap.Push(cands, priceCand{edge.Quote, edge.Price * prices[token], liqUsd})
+			} else {
+				liqUsd := 2 * edge.QuoteTvl * prices[token]
+				heap.Push(cands, priceCand{edge.Base, prices[token] / edge.Price, liqUsd})
+			}
+		}
+	}
+
+	for token, price := range anchors {
+		prices[token] = price
+	}
+	for token := range anchors {
+		pushEdges(token)
+	}
+
+	for cands.Len() > 0 {
+		cand := heap.Pop(cands).(priceCand)
+		if cand.liqUsd < minLiqUsd {
+			break
+		}
+		if _, ok := prices[cand.token]; ok || !isUsablePrice(cand.price) {
+			continue
+		}
+		prices[cand.token] = cand.price
+		pushEdges(cand.token)
+	}
+	return prices
+}
+
+func isUsablePrice(price float64) bool {
+	return price > 0 && !math.IsInf(price, 0) && !math.IsNaN(price)
+}
+
+type priceCand struct {
+	token  types.EthAddress
+	price  float64
+	liqUsd float64
+}
+
+// Max-heap by liquidity
+type priceCandHeap []priceCand
+
+func (h priceCandHeap) Len() int           { return len(h) }
+func (h priceCandHeap) Less(i, j int) bool { return h[i].liqUsd > h[j].liqUsd }
+func (h priceCandHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *priceCandHeap) Push(x any)        { *h = append(*h, x.(priceCand)) }
+
+func (h *priceCandHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
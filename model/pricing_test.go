@@ -0,0 +1,46 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestRouteUsdPrices(t *testing.T) {
+	usdc := types.EthAddress("0xusdc")
+	eth := types.EthAddress("0x0000")
+	tkn := types.EthAddress("0xtkn")
+	dust := types.EthAddress("0xdust")
+
+	anchors := map[types.EthAddress]float64{usdc: 1e-6}
+	edges := []PriceEdge{
+		// 2000 USDC per ETH, $2M deep
+		{Base: eth, Quote: usdc, Price: 1e18 / 2000 / 1e6, BaseTvl: 500 * 1e18, QuoteTvl: 1e6 * 1e6},
+		// Thin pool with a bad ETH price that should be ignored
+		{Base: eth, Quote: usdc, Price: 1e18 / 1000 / 1e6, BaseTvl: 1e18, QuoteTvl: 1000 * 1e6},
+		// 0.01 ETH per token
+		{Base: eth, Quote: tkn, Price: 0.01, BaseTvl: 100 * 1e18, QuoteTvl: 10000 * 1e18},
+		// Below the liquidity threshold
+		{Base: eth, Quote: dust, Price: 1.0, BaseTvl: 1e12, QuoteTvl: 1e12},
+	}
+
+	prices := RouteUsdPrices(anchors, edges, 100)
+
+	assertNear := func(token types.EthAddress, expected float64) {
+		price, ok := prices[token]
+		if !ok {
+			t.Fatalf("No price for %s", token)
+		}
+		if math.Abs(price-expected)/expected > 1e-9 {
+			t.Fatalf("Price for %s is %g, expected %g", token, price, expected)
+		}
+	}
+	assertNear(usdc, 1e-6)
+	assertNear(eth, 2000/1e18)
+	assertNear(tkn, 20/1e18)
+
+	if _, ok := prices[dust]; ok {
+		t.Fatal("Token priced through pool below the liquidity threshold")
+	}
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"math/big"
+	"sync"
+)
+
+// Surplus collateral a user holds in a single token on the dex, as last queried over RPC
+type SurplusBalance struct {
+	Balance     big.Int
+	RefreshTime int64
+	lock        sync.Mutex
+}
+
+func (s *SurplusBalance) Update(balance big.Int, refreshTime int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Balance = balance
+	s.RefreshTime = refreshTime
+}
+
+func (s *SurplusBalance) Read() (balance *big.Int, refreshTime int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return new(big.Int).Set(&s.Balance), s.RefreshTime
+}
+
+func (s *SurplusBalance) LastRefreshTime() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.RefreshTime
+}
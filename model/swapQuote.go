@@ -0,0 +1,160 @@
+package model
+
+import (
+	"math"
+	"sort"
+)
+
+type SwapQuote struct {
+	IsBuy        bool              `json:"isBuy"`
+	InputQty     float64           `json:"inputQty"`
+	OutputQty    float64           `json:"outputQty"`
+	FeeQty       float64           `json:"feeQty"`
+	UnfilledQty  float64           `json:"unfilledQty"`
+	StartPrice   float64           `json:"startPrice"`
+	AvgPrice     float64           `json:"avgPrice"`
+	FinalPrice   float64           `json:"finalPrice"`
+	PriceImpact  float64           `json:"priceImpact"`
+	StartTick    int               `json:"startTick"`
+	FinalTick    int               `json:"finalTick"`
+	CrossedTicks []int             `json:"crossedTicks"`
+	Knockouts    []KnockoutTrigger `json:"knockouts"`
+}
+
+type KnockoutTrigger struct {
+	Tick  int     `json:"tick"`
+	IsBid bool    `json:"isBid"`
+	Liq   float64 `json:"liq"`
+}
+
+// Most swaps only cross a handful of bumps, this only guards against pathological curves
+const MAX_SWAP_QUOTE_CROSSES = 10000
+
+// Walks the liquidity curve from the current price to estimate the result of a swap with a
+// fixed input quantity. Buys pay base and receive quote, moving the price (base per quote)
+// up. Sells pay quote and receive base, moving the price down. The fee is taken from the
+// input at the pool's current rate.
+//
+// The curve only holds the liquidity indexed from events, so the quote is an estimate. If the
+// curve runs out of liquidity the rest of the input is returned as unfilled.
+func (c *LiquidityCurve) SimulateSwap(price float64, feeRate float64, isBuy bool, qty float64) SwapQuote {
+	quote := SwapQuote{
+		IsBuy:        isBuy,
+		InputQty:     qty,
+		StartPrice:   price,
+		StartTick:    priceToTick(price),
+		CrossedTicks: make([]int, 0),
+		Knockouts:    make([]KnockoutTrigger, 0),
+	}
+	if price <= 0 || qty <= 0 {
+		quote.UnfilledQty = qty
+		quote.FinalPrice = price
+		quote.FinalTick = quote.StartTick
+		return quote
+	}
+
+	bumps := make([]LiquidityBump, 0, len(c.Bumps))
+	for _, bump := range c.Bumps {
+		bumps = append(bumps, *bump)
+	}
+	sort.Slice(bumps, func(i, j int) bool { return bumps[i].Tick < bumps[j].Tick })
+
+	// Concentrated liquidity is active from the bid tick up to, not including, the ask tick
+	liq := c.AmbientLiq
+	next := 0
+	for next < len(bumps) && bumps[next].Tick <= quote.StartTick {
+		liq += bumps[next].LiquidityDelta
+		next++
+	}
+	if !isBuy {
+		next--
+	}
+
+	quote.FeeQty = qty * feeRate
+	remaining := qty - quote.FeeQty
+	sqrtP := math.Sqrt(price)
+
+	for remaining > 0 && len(quote.CrossedTicks) < MAX_SWAP_QUOTE_CROSSES {
+		hasBump := next >= 0 && next < len(bumps)
+		activeLiq := math.Max(liq, 0)
+
+		if isBuy {
+			if activeLiq > 0 {
+				maxIn := math.Inf(1)
+				if hasBump {
+					maxIn = activeLiq * (math.Sqrt(tickToPrice(bumps[next].Tick)) - sqrtP)
+				}
+				if remaining < maxIn {
+					sqrtEnd := sqrtP + remaining/activeLiq
+					quote.OutputQty += activeLiq * (1/sqrtP - 1/sqrtEnd)
+					sqrtP, remaining = sqrtEnd, 0
+					break
+				}
+				sqrtEnd := math.Sqrt(tickToPrice(bumps[next].Tick))
+				quote.OutputQty += activeLiq * (1/sqrtP - 1/sqrtEnd)
+				remaining -= maxIn
+			}
+			if !hasBump {
+				break
+			}
+			bump := bumps[next]
+			sqrtP = math.Sqrt(tickToPrice(bump.Tick))
+			liq += bump.LiquidityDelta
+			quote.CrossedTicks = append(quote.CrossedTicks, bump.Tick)
+			if bump.KnockoutAskLiq != 0 {
+				quote.Knockouts = append(quote.Knockouts, KnockoutTrigger{bump.Tick, false, math.Abs(bump.KnockoutAskLiq)})
+			}
+			next++
+
+		} else {
+			if activeLiq > 0 {
+				maxIn := math.Inf(1)
+				if hasBump {
+					maxIn = activeLiq * (1/math.Sqrt(tickToPrice(bumps[next].Tick)) - 1/sqrtP)
+				}
+				if remaining < maxIn {
+					sqrtEnd := 1 / (1/sqrtP + remaining/activeLiq)
+					quote.OutputQty += activeLiq * (sqrtP - sqrtEnd)
+					sqrtP, remaining = sqrtEnd, 0
+					break
+				}
+				sqrtEnd := math.Sqrt(tickToPrice(bumps[next].Tick))
+				quote.OutputQty += activeLiq * (sqrtP - sqrtEnd)
+				remaining -= maxIn
+			}
+			if !hasBump {
+				break
+			}
+			bump := bumps[next]
+			sqrtP = math.Sqrt(tickToPrice(bump.Tick))
+			liq -= bump.LiquidityDelta
+			quote.CrossedTicks = append(quote.CrossedTicks, bump.Tick)
+			if bump.KnockoutBidLiq != 0 {
+				quote.Knockouts = append(quote.Knockouts, KnockoutTrigger{bump.Tick, true, math.Abs(bump.KnockoutBidLiq)})
+			}
+			next--
+		}
+	}
+
+	quote.UnfilledQty = remaining
+	quote.FinalPrice = sqrtP * sqrtP
+	quote.FinalTick = priceToTick(quote.FinalPrice)
+	quote.PriceImpact = quote.FinalPrice/price - 1
+
+	filledIn := qty - remaining
+	if quote.OutputQty > 0 {
+		if isBuy {
+			quote.AvgPrice = filledIn / quote.OutputQty
+		} else {
+			quote.AvgPrice = quote.OutputQty / filledIn
+		}
+	}
+	return quote
+}
+
+func priceToTick(price float64) int {
+	if price <= 0 {
+		return 0
+	}
+	return int(math.Floor(math.Log(price) / math.Log(1.0001)))
+}
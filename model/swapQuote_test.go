@@ -0,0 +1,50 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSwapQuoteAmbient(t *testing.T) {
+	curve := NewLiquidityCurve()
+	curve.AmbientLiq = 1e18
+
+	quote := curve.SimulateSwap(1.0, 0, true, 1e16)
+	expected := 1e18 * (1 - 1/1.01)
+	if math.Abs(quote.OutputQty-expected)/expected > 1e-9 {
+		t.Fatalf("Buy output %g, expected %g", quote.OutputQty, expected)
+	}
+	if math.Abs(quote.FinalPrice-1.01*1.01) > 1e-9 || quote.UnfilledQty != 0 {
+		t.Fatalf("Unexpected final state %+v", quote)
+	}
+
+	sell := curve.SimulateSwap(1.0, 0.01, false, 1e16)
+	if sell.FeeQty != 1e14 || sell.FinalPrice >= 1.0 || sell.AvgPrice >= 1.0 {
+		t.Fatalf("Unexpected sell quote %+v", sell)
+	}
+}
+
+func TestSwapQuoteCrossesKnockout(t *testing.T) {
+	curve := NewLiquidityCurve()
+	curve.Bumps[-100] = &LiquidityBump{Tick: -100, LiquidityDelta: 1e18}
+	curve.Bumps[100] = &LiquidityBump{Tick: 100, LiquidityDelta: -1e18, KnockoutAskLiq: -5e17}
+
+	// Draining all the base side of the range runs through the ask tick and out of liquidity
+	quote := curve.SimulateSwap(1.0, 0, true, 1e17)
+	if len(quote.CrossedTicks) != 1 || quote.CrossedTicks[0] != 100 {
+		t.Fatalf("Expected to cross tick 100, got %v", quote.CrossedTicks)
+	}
+	if len(quote.Knockouts) != 1 || quote.Knockouts[0].IsBid || quote.Knockouts[0].Liq != 5e17 {
+		t.Fatalf("Expected ask knockout at tick 100, got %+v", quote.Knockouts)
+	}
+	maxIn := 1e18 * (math.Sqrt(tickToPrice(100)) - 1)
+	if math.Abs(quote.UnfilledQty-(1e17-maxIn))/1e17 > 1e-9 {
+		t.Fatalf("Unfilled %g, expected %g", quote.UnfilledQty, 1e17-maxIn)
+	}
+
+	// A small swap stays within the range
+	small := curve.SimulateSwap(1.0, 0, false, 1e15)
+	if len(small.CrossedTicks) != 0 || small.UnfilledQty != 0 {
+		t.Fatalf("Unexpected small swap quote %+v", small)
+	}
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"math"
+	"slices"
 
 	"github.com/CrocSwap/graphcache-go/tables"
 )
@@ -29,6 +30,13 @@ func NewPoolTradingHistory() *PoolTradingHistory {
 	}
 }
 
+func (h *PoolTradingHistory) Copy() *PoolTradingHistory {
+	return &PoolTradingHistory{
+		StatsCounter: h.StatsCounter,
+		TimeSnaps:    slices.Clone(h.TimeSnaps),
+	}
+}
+
 func (h *PoolTradingHistory) NextEvent(r tables.AggEvent) {
 	if r.Time != h.StatsCounter.LatestTime && h.StatsCounter.LatestTime != 0 {
 		h.TimeSnaps = append(h.TimeSnaps, h.StatsCounter)
@@ -36,6 +44,26 @@ func (h *PoolTradingHistory) NextEvent(r tables.AggEvent) {
 	h.StatsCounter.Accumulate(r)
 }
 
+// State of the history before an event, used to undo the event on a reorg
+type TradingHistCheckpoint struct {
+	statsCounter AccumPoolStats
+	nSnaps       int
+}
+
+func (h *PoolTradingHistory) Checkpoint() TradingHistCheckpoint {
+	return TradingHistCheckpoint{
+		statsCounter: h.StatsCounter,
+		nSnaps:       len(h.TimeSnaps),
+	}
+}
+
+func (h *PoolTradingHistory) Restore(cp TradingHistCheckpoint) {
+	h.StatsCounter = cp.statsCounter
+	if cp.nSnaps < len(h.TimeSnaps) {
+		h.TimeSnaps = h.TimeSnaps[:cp.nSnaps]
+	}
+}
+
 func (h *PoolTradingHistory) Len() int {
 	return len(h.TimeSnaps)
 }
@@ -75,7 +103,6 @@ func (a *AccumPoolStats) Accumulate(e tables.AggEvent) {
 }
 
 func (a *AccumPoolStats) accumFeeType(r tables.AggEvent) {
-	FEE_RATE_MULTIPLIER := 10000.0 * 100
 	a.FeeRate = float64(r.FeeRate) / FEE_RATE_MULTIPLIER
 }
 
@@ -18,8 +18,8 @@ func NewHistoryWriter(netCfg loader.NetworkConfig, commitFn func(types.PoolTxEve
 	}
 }
 
-func (h *HistoryWriter) CommitSwap(s tables.Swap) {
-	h.commitEventFn(types.PoolTxEvent{
+func (h *HistoryWriter) CommitSwap(s tables.Swap) types.PoolTxEvent {
+	tx := types.PoolTxEvent{
 		EthTxHeader: types.EthTxHeader{
 			BlockNum:  s.Block,
 			TxHash:    types.ValidateEthHash(s.TX),
@@ -50,10 +50,12 @@ func (h *HistoryWriter) CommitSwap(s tables.Swap) {
 			IsBuy:     s.IsBuy > 0,
 			InBaseQty: s.InBaseQty > 0,
 		},
-	})
+	}
+	h.commitEventFn(tx)
+	return tx
 }
 
-func (h *HistoryWriter) CommitLiqChange(s tables.LiqChange) {
+func (h *HistoryWriter) CommitLiqChange(s tables.LiqChange) types.PoolTxEvent {
 	baseFlow := float64(0)
 	quoteFlow := float64(0)
 
@@ -69,7 +71,7 @@ func (h *HistoryWriter) CommitLiqChange(s tables.LiqChange) {
 		entityType = tables.EntityTypeLimit
 	}
 
-	h.commitEventFn(types.PoolTxEvent{
+	tx := types.PoolTxEvent{
 		EthTxHeader: types.EthTxHeader{
 			BlockNum:  s.Block,
 			TxHash:    types.ValidateEthHash(s.TX),
@@ -102,5 +104,7 @@ func (h *HistoryWriter) CommitLiqChange(s tables.LiqChange) {
 			BidTick:   s.BidTick,
 			AskTick:   s.AskTick,
 		},
-	})
+	}
+	h.commitEventFn(tx)
+	return tx
 }
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Limits for a client. Zero leaves the dimension unlimited.
+type ClientLimits struct {
+	RatePerSec float64 `json:"rate_per_sec"`
+	Burst      int     `json:"burst"`
+	DailyQuota int     `json:"daily_quota"`
+	// Raises the cap on `n` and other result sizes for the client
+	MaxResults int `json:"max_results"`
+}
+
+type ApiKeyConfig struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	ClientLimits
+	// Applied to each IP using the key, on top of the key's own limits, so a leaked key
+	// can't be spread across many clients at the key's full rate
+	PerIp ClientLimits `json:"per_ip"`
+}
+
+// Key file layout. Anonymous limits apply per IP to requests without a key. If
+// requireKey is set, requests without a key are rejected.
+type apiKeyFile struct {
+	Keys       []ApiKeyConfig `json:"keys"`
+	Anonymous  ClientLimits   `json:"anonymous"`
+	RequireKey bool           `json:"require_key"`
+}
+
+const API_KEY_HEADER = "X-Api-Key"
+const API_KEY_RELOAD_INTERVAL = 30 * time.Second
+const API_CLIENT_IDLE_EXPIRY = 10 * time.Minute
+
+// Authenticates API keys and applies per-client rate limits and daily quotas. Keys are
+// read from a JSON file, which is reloaded when it changes or on SIGHUP.
+type ApiKeyGate struct {
+	path    string
+	modTime time.Time
+	file    apiKeyFile
+	byKey   map[string]ApiKeyConfig
+	clients map[string]*clientState
+	lock    sync.Mutex
+}
+
+type clientState struct {
+	tokens    float64
+	refilled  time.Time
+	quotaDay  int64
+	quotaUsed int
+}
+
+func NewApiKeyGate(path string) *ApiKeyGate {
+	g := &ApiKeyGate{
+		path:    path,
+		clients: make(map[string]*clientState),
+	}
+	if err := g.reload(); err != nil {
+		log.Fatalf("Unable to load API keys from %s: %s", path, err.Error())
+	}
+	go g.watchReload()
+	return g
+}
+
+func (g *ApiKeyGate) reload() error {
+	info, err := os.Stat(g.path)
+	if err != nil {
+		return err
+	}
+	contents, err := os.ReadFile(g.path)
+	if err != nil {
+		return err
+	}
+	var file apiKeyFile
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return err
+	}
+
+	byKey := make(map[string]ApiKeyConfig, len(file.Keys))
+	for _, key := range file.Keys {
+		if key.Key == "" || key.Name == "" {
+			return fmt.Errorf("API key entries need both a name and a key")
+		}
+		byKey[key.Key] = key
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.file = file
+	g.byKey = byKey
+	g.modTime = info.ModTime()
+	log.Printf("Loaded %d API keys from %s", len(byKey), g.path)
+	return nil
+}
+
+// Errors on reload keep the previous keys in place
+func (g *ApiKeyGate) watchReload() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(API_KEY_RELOAD_INTERVAL)
+
+	for {
+		select {
+		case <-hup:
+		case <-ticker.C:
+			g.pruneIdle()
+			info, err := os.Stat(g.path)
+			g.lock.Lock()
+			unchanged := err == nil && info.ModTime().Equal(g.modTime)
+			g.lock.Unlock()
+			if unchanged {
+				continue
+			}
+		}
+		if err := g.reload(); err != nil {
+			log.Printf("Warning unable to reload API keys from %s: %s", g.path, err.Error())
+		}
+	}
+}
+
+// Anonymous clients are tracked per IP, so idle ones are dropped to bound memory
+func (g *ApiKeyGate) pruneIdle() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for id, client := range g.clients {
+		if time.Since(client.refilled) > API_CLIENT_IDLE_EXPIRY && client.quotaDay != utcDay(time.Now()) {
+			delete(g.clients, id)
+		}
+	}
+}
+
+func utcDay(t time.Time) int64 {
+	return t.Unix() / (24 * 3600)
+}
+
+// Takes one request from the client's token bucket and daily quota. On failure returns
+// the error and how long until a retry could succeed.
+func (g *ApiKeyGate) admit(clientId string, limits ClientLimits) (*apiError, time.Duration) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	now := time.Now()
+
+	client, ok := g.clients[clientId]
+	if !ok {
+		client = &clientState{tokens: float64(max(limits.Burst, 1)), refilled: now}
+		g.clients[clientId] = client
+	}
+
+	if limits.RatePerSec > 0 {
+		burst := float64(max(limits.Burst, 1))
+		elapsed := now.Sub(client.refilled).Seconds()
+		client.tokens = math.Min(burst, client.tokens+elapsed*limits.RatePerSec)
+		client.refilled = now
+		if client.tokens < 1 {
+			wait := time.Duration((1 - client.tokens) / limits.RatePerSec * float64(time.Second))
+			return &apiError{http.StatusTooManyRequests, "rate_limited", "Rate limit exceeded", ""}, wait
+		}
+	} else {
+		client.refilled = now
+	}
+
+	if limits.DailyQuota > 0 {
+		today := utcDay(now)
+		if client.quotaDay != today {
+			client.quotaDay = today
+			client.quotaUsed = 0
+		}
+		if client.quotaUsed >= limits.DailyQuota {
+			nextDay := time.Unix((today+1)*24*3600, 0)
+			return &apiError{http.StatusTooManyRequests, "quota_exceeded", "Daily quota exceeded", ""}, nextDay.Sub(now)
+		}
+		client.quotaUsed += 1
+	}
+
+	if limits.RatePerSec > 0 {
+		client.tokens -= 1
+	}
+	return nil, 0
+}
+
+const MAX_RESULTS_CTX_KEY = "maxResults"
+
+func rejectOverLimit(c *gin.Context, clientName string, err *apiError, retryAfter time.Duration) {
+	metrics.CountApiRequest(clientName, err.Code)
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	wrapApiErr(c, err)
+}
+
+func (g *ApiKeyGate) Middleware(exemptPaths ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if slices.Contains(exemptPaths, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		// Only read from the header, since query strings end up in the access logs
+		key := c.GetHeader(API_KEY_HEADER)
+
+		g.lock.Lock()
+		keyCfg, known := g.byKey[key]
+		anonymous := g.file.Anonymous
+		requireKey := g.file.RequireKey
+		g.lock.Unlock()
+
+		var clientId, clientName string
+		var limits ClientLimits
+		if key != "" {
+			if !known {
+				metrics.CountApiRequest("invalid_key", "unauthorized")
+				wrapApiErr(c, &apiError{http.StatusUnauthorized, "invalid_api_key", "Unknown API key", API_KEY_HEADER})
+				return
+			}
+			// Requests over the IP's limits don't count against the key
+			if keyCfg.PerIp != (ClientLimits{}) {
+				ipId := "key:" + keyCfg.Name + ":ip:" + c.ClientIP()
+				if err, retryAfter := g.admit(ipId, keyCfg.PerIp); err != nil {
+					rejectOverLimit(c, keyCfg.Name, err, retryAfter)
+					return
+				}
+			}
+			clientId, clientName, limits = "key:"+keyCfg.Name, keyCfg.Name, keyCfg.ClientLimits
+		} else {
+			if requireKey {
+				metrics.CountApiRequest("anonymous", "unauthorized")
+				wrapApiErr(c, &apiError{http.StatusUnauthorized, "missing_api_key",
+					"An API key is required in the " + API_KEY_HEADER + " header", API_KEY_HEADER})
+				return
+			}
+			clientId, clientName, limits = "ip:"+c.ClientIP(), "anonymous", anonymous
+		}
+
+		if err, retryAfter := g.admit(clientId, limits); err != nil {
+			rejectOverLimit(c, clientName, err, retryAfter)
+			return
+		}
+
+		metrics.CountApiRequest(clientName, "ok")
+		if limits.MaxResults > 0 {
+			c.Set(MAX_RESULTS_CTX_KEY, limits.MaxResults)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testKeyGate(file apiKeyFile) *ApiKeyGate {
+	g := &ApiKeyGate{file: file, byKey: make(map[string]ApiKeyConfig), clients: make(map[string]*clientState)}
+	for _, key := range file.Keys {
+		g.byKey[key.Key] = key
+	}
+	return g
+}
+
+func TestAdmitRateLimit(t *testing.T) {
+	g := testKeyGate(apiKeyFile{})
+	limits := ClientLimits{RatePerSec: 0.5, Burst: 3}
+	for i := 0; i < 3; i++ {
+		if err, _ := g.admit("a", limits); err != nil {
+			t.Fatalf("Request %d within the burst rejected: %v", i, err)
+		}
+	}
+	err, wait := g.admit("a", limits)
+	if err == nil || err.Code != "rate_limited" || wait <= 0 || wait > 2*time.Second {
+		t.Fatalf("Expected rate limited with a wait under 2s, got %v %s", err, wait)
+	}
+	if err, _ := g.admit("b", limits); err != nil {
+		t.Fatalf("Other client shares the bucket: %v", err)
+	}
+
+	// Refills at the rate
+	g.clients["a"].refilled = g.clients["a"].refilled.Add(-2 * time.Second)
+	if err, _ := g.admit("a", limits); err != nil {
+		t.Fatalf("Request after refill rejected: %v", err)
+	}
+	if err, _ := g.admit("a", limits); err == nil {
+		t.Fatal("Refill went past the elapsed time")
+	}
+}
+
+func TestAdmitDailyQuota(t *testing.T) {
+	g := testKeyGate(apiKeyFile{})
+	limits := ClientLimits{DailyQuota: 2}
+	for i := 0; i < 2; i++ {
+		if err, _ := g.admit("a", limits); err != nil {
+			t.Fatalf("Request %d within the quota rejected: %v", i, err)
+		}
+	}
+	err, wait := g.admit("a", limits)
+	if err == nil || err.Code != "quota_exceeded" || wait <= 0 || wait > 24*time.Hour {
+		t.Fatalf("Expected quota exceeded until the next UTC day, got %v %s", err, wait)
+	}
+
+	// Resets on the next day
+	g.clients["a"].quotaDay -= 1
+	if err, _ := g.admit("a", limits); err != nil {
+		t.Fatalf("Quota not reset on a new day: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if err, _ := g.admit("open", ClientLimits{}); err != nil {
+			t.Fatalf("Unlimited client rejected: %v", err)
+		}
+	}
+}
+
+func testKeyRequest(r *gin.Engine, remoteAddr string, key string, forwardedFor string) int {
+	req := httptest.NewRequest(http.MethodGet, "/data", nil)
+	req.RemoteAddr = remoteAddr
+	if key != "" {
+		req.Header.Set(API_KEY_HEADER, key)
+	}
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func testKeyRouter(g *ApiKeyGate, trustedProxies []string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.SetTrustedProxies(trustedProxies)
+	r.Use(g.Middleware())
+	r.GET("/data", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func TestForwardedForOnlyFromTrustedProxies(t *testing.T) {
+	g := testKeyGate(apiKeyFile{Anonymous: ClientLimits{RatePerSec: 0.001, Burst: 1}})
+
+	// Spoofed headers from an untrusted address all share the address's bucket
+	r := testKeyRouter(g, nil)
+	if code := testKeyRequest(r, "1.1.1.1:1000", "", "9.9.9.1"); code != http.StatusOK {
+		t.Fatalf("First request rejected with %d", code)
+	}
+	if code := testKeyRequest(r, "1.1.1.1:1000", "", "9.9.9.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("Spoofed X-Forwarded-For got a fresh bucket, %d", code)
+	}
+
+	// Behind a trusted proxy each forwarded client has its own bucket
+	r = testKeyRouter(g, []string{"10.0.0.0/8"})
+	if code := testKeyRequest(r, "10.0.0.1:1000", "", "9.9.9.3"); code != http.StatusOK {
+		t.Fatalf("First forwarded request rejected with %d", code)
+	}
+	if code := testKeyRequest(r, "10.0.0.1:1000", "", "9.9.9.4"); code != http.StatusOK {
+		t.Fatalf("Forwarded client shares a bucket, %d", code)
+	}
+}
+
+func TestKeyPerIpLimits(t *testing.T) {
+	g := testKeyGate(apiKeyFile{Keys: []ApiKeyConfig{{
+		Name: "partner", Key: "secret",
+		ClientLimits: ClientLimits{RatePerSec: 0.001, Burst: 3},
+		PerIp:        ClientLimits{RatePerSec: 0.001, Burst: 1},
+	}}})
+	r := testKeyRouter(g, nil)
+
+	if code := testKeyRequest(r, "1.1.1.1:1000", "secret", ""); code != http.StatusOK {
+		t.Fatalf("First keyed request rejected with %d", code)
+	}
+	if code := testKeyRequest(r, "1.1.1.1:1000", "secret", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the IP limit, got %d", code)
+	}
+	// Rejections by the IP limit don't use up the key's bucket
+	if code := testKeyRequest(r, "2.2.2.2:1000", "secret", ""); code != http.StatusOK {
+		t.Fatalf("Keyed request from another IP rejected with %d", code)
+	}
+	if code := testKeyRequest(r, "3.3.3.3:1000", "secret", ""); code != http.StatusOK {
+		t.Fatalf("Keyed request from another IP rejected with %d", code)
+	}
+	if code := testKeyRequest(r, "4.4.4.4:1000", "secret", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the key limit, got %d", code)
+	}
+
+	if code := testKeyRequest(r, "1.1.1.1:1000", "wrong", ""); code != http.StatusUnauthorized {
+		t.Fatalf("Unknown key got %d", code)
+	}
+}
+
+func TestKeyOnlyFromHeader(t *testing.T) {
+	g := testKeyGate(apiKeyFile{RequireKey: true, Keys: []ApiKeyConfig{{Name: "partner", Key: "secret"}}})
+	r := testKeyRouter(g, nil)
+
+	if code := testKeyRequest(r, "1.1.1.1:1000", "secret", ""); code != http.StatusOK {
+		t.Fatalf("Key in the header rejected with %d", code)
+	}
+	// Query strings are written to the access logs, so keys there aren't read
+	req := httptest.NewRequest(http.MethodGet, "/data?apiKey=secret", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Key in the query param accepted with %d", rec.Code)
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const MAX_BATCH_QUERIES = 25
+
+const BATCH_RESULT_CTX_KEY = "batchResult"
+
+type batchQuery struct {
+	Name   string         `json:"name"`
+	Route  string         `json:"route"`
+	Params map[string]any `json:"params"`
+}
+
+type batchResult struct {
+	Name       string     `json:"name"`
+	Status     int        `json:"status"`
+	Data       any        `json:"data,omitempty"`
+	NextCursor *string    `json:"nextCursor,omitempty"`
+	Error      *errorBody `json:"error,omitempty"`
+}
+
+// Routes that don't return a single response in the data envelope, or that would nest batches
+func batchableRoute(route string) bool {
+	return route != "" && route != "batch" && route != "graphql" && route != "plume_task" &&
+		!strings.HasSuffix(route, "_stream")
+}
+
+// Result that a batch sub-query's response is recorded on, or nil for standalone requests
+func batchResultOf(c *gin.Context) *batchResult {
+	if batched, ok := c.Get(BATCH_RESULT_CTX_KEY); ok {
+		return batched.(*batchResult)
+	}
+	return nil
+}
+
+// Runs an array of named sub-queries concurrently, each through the same GET handler and params as a
+// standalone request, so validation, caps and rate limits all apply per sub-query. The handlers record
+// their results on the batch rather than writing a response. Errors are returned per item and don't
+// fail the batch.
+func (s *APIWebServer) queryBatch(r *gin.Engine, prefix string) gin.HandlerFunc {
+	// Run ahead of each sub-query the same as on a standalone request
+	checks := []gin.HandlerFunc{s.chainSyncMiddleware()}
+	if s.Keys != nil {
+		checks = append([]gin.HandlerFunc{s.Keys.Middleware()}, checks...)
+	}
+
+	return func(c *gin.Context) {
+		var queries []batchQuery
+		// Numbers are kept as their JSON text, so large ints aren't formatted as floats
+		decoder := json.NewDecoder(c.Request.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&queries); err != nil {
+			wrapErrMsg(c, "Batch body must be a JSON array of {name, route, params} queries")
+			return
+		}
+		if len(queries) == 0 || len(queries) > MAX_BATCH_QUERIES {
+			wrapErrMsg(c, fmt.Sprintf("Batch must have between 1 and %d queries", MAX_BATCH_QUERIES))
+			return
+		}
+		names := make(map[string]bool, len(queries))
+		for _, q := range queries {
+			if q.Name == "" || names[q.Name] {
+				wrapErrMsg(c, "Every batch query needs a unique name")
+				return
+			}
+			names[q.Name] = true
+		}
+
+		handlers := make(map[string]gin.HandlerFunc)
+		for _, route := range r.Routes() {
+			if route.Method == http.MethodGet {
+				handlers[route.Path] = route.HandlerFunc
+			}
+		}
+
+		// Routes are registered relative to the root
+		routeBase := "/" + strings.TrimPrefix(prefix, "/") + "/"
+		results := make([]batchResult, len(queries))
+		var wg sync.WaitGroup
+		for i, q := range queries {
+			results[i] = batchResult{Name: q.Name}
+			route := strings.TrimPrefix(q.Route, "/")
+			handler, ok := handlers[routeBase+route]
+			if !ok || !batchableRoute(route) {
+				results[i].Status = http.StatusBadRequest
+				results[i].Error = &errorBody{"invalid_param", "Unknown or unbatchable route " + q.Route, "route"}
+				continue
+			}
+			sub, err := batchContext(c, routeBase+route, q.Params, &results[i])
+			if err != nil {
+				results[i].Status = http.StatusBadRequest
+				results[i].Error = &errorBody{"invalid_param", err.Error(), "params"}
+				continue
+			}
+
+			wg.Add(1)
+			go func(sub *gin.Context, result *batchResult, handler gin.HandlerFunc) {
+				defer wg.Done()
+				for _, check := range checks {
+					if check(sub); result.Error != nil {
+						return
+					}
+				}
+				handler(sub)
+			}(sub, &results[i], handler)
+		}
+		wg.Wait()
+
+		wrapDataResp(c, results)
+	}
+}
+
+// Context for a sub-query with the batch caller's headers and client address, and the sub-query's
+// params. Its response is recorded on the result.
+func batchContext(c *gin.Context, path string, params map[string]any, result *batchResult) (*gin.Context, error) {
+	query := url.Values{}
+	for k, v := range params {
+		switch v := v.(type) {
+		case string:
+			query.Set(k, v)
+		case json.Number:
+			query.Set(k, v.String())
+		case bool:
+			query.Set(k, fmt.Sprint(v))
+		default:
+			return nil, fmt.Errorf("Param %s must be a string, number or bool", k)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.RemoteAddr = c.Request.RemoteAddr
+	req.Header = c.Request.Header.Clone()
+
+	sub := c.Copy()
+	sub.Request = req
+	sub.Writer = &batchWriter{ResponseWriter: c.Writer, header: make(http.Header)}
+	sub.Set(BATCH_RESULT_CTX_KEY, result)
+	return sub, nil
+}
+
+// Discards the headers and anything written by a sub-query, whose response is recorded on its
+// batch result instead
+type batchWriter struct {
+	gin.ResponseWriter
+	header http.Header
+	status int
+}
+
+func (w *batchWriter) Header() http.Header                  { return w.header }
+func (w *batchWriter) WriteHeader(code int)                 { w.status = code }
+func (w *batchWriter) WriteHeaderNow()                      {}
+func (w *batchWriter) Write(data []byte) (int, error)       { return len(data), nil }
+func (w *batchWriter) WriteString(data string) (int, error) { return len(data), nil }
+func (w *batchWriter) Written() bool                        { return false }
+func (w *batchWriter) Status() int                          { return w.status }
+func (w *batchWriter) Size() int                            { return 0 }
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/types"
+	"github.com/CrocSwap/graphcache-go/views"
+	"github.com/gin-gonic/gin"
+)
+
+func testBatch(t *testing.T, s *APIWebServer, body string) map[string]batchResult {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/gcgo/batch", strings.NewReader(body))
+	s.router("gcgo", false).ServeHTTP(rec, req)
+
+	var resp struct {
+		Data []struct {
+			batchResult
+			Data json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("Batch failed with %d: %s", rec.Code, rec.Body.String())
+	}
+	results := make(map[string]batchResult)
+	for _, item := range resp.Data {
+		item.batchResult.Data = item.Data
+		results[item.Name] = item.batchResult
+	}
+	return results
+}
+
+const testBatchPool = `"chainId": "0x1", "base": "0x000000000000000000000000000000000000000a",
+	"quote": "0x000000000000000000000000000000000000000b", "poolIdx": 420`
+
+func TestBatchRunsSubQueries(t *testing.T) {
+	fake := &fakeViews{syncing: map[types.ChainId]bool{"0x2": true},
+		positions: []views.UserPosition{testGqlPosition()}}
+	results := testBatch(t, &APIWebServer{Views: fake}, `[
+		{"name": "curve", "route": "pool_liq_curve", "params": {`+testBatchPool+`, "histTime": 1700000000}},
+		{"name": "positions", "route": "/pool_positions", "params": {`+testBatchPool+`, "n": 10}},
+		{"name": "paged", "route": "user_txs", "params": {"chainId": "0x1", "user": "`+testUser+`", "n": 10, "cursor": ""}},
+		{"name": "missing", "route": "user_txs", "params": {"chainId": "0x1", "n": 10}},
+		{"name": "syncing", "route": "user_txs", "params": {"chainId": "0x2", "user": "`+testUser+`", "n": 10}},
+		{"name": "unknown", "route": "no_such_route", "params": {}},
+		{"name": "nested", "route": "graphql", "params": {}},
+		{"name": "list", "route": "user_txs", "params": {"chainId": ["0x1"], "user": "`+testUser+`", "n": 10}}
+	]`)
+
+	cases := []struct {
+		name   string
+		status int
+		code   string
+		param  string
+	}{
+		{"curve", http.StatusOK, "", ""},
+		{"positions", http.StatusOK, "", ""},
+		{"paged", http.StatusOK, "", ""},
+		{"missing", http.StatusBadRequest, "missing_param", "user"},
+		{"syncing", http.StatusServiceUnavailable, "syncing", "chainId"},
+		{"unknown", http.StatusBadRequest, "invalid_param", "route"},
+		{"nested", http.StatusBadRequest, "invalid_param", "route"},
+		{"list", http.StatusBadRequest, "invalid_param", "params"},
+	}
+	for _, tc := range cases {
+		result := results[tc.name]
+		var errBody errorBody
+		if result.Error != nil {
+			errBody = *result.Error
+		}
+		if result.Status != tc.status || errBody.Code != tc.code || errBody.Param != tc.param {
+			t.Errorf("%s: expected %d %s on %q, got %d %+v", tc.name, tc.status, tc.code, tc.param, result.Status, errBody)
+		}
+	}
+
+	// Data is the same as the standalone response's
+	expected, _ := json.Marshal(fake.positions)
+	if string(results["positions"].Data.(json.RawMessage)) != string(expected) {
+		t.Errorf("Expected positions %s, got %s", expected, results["positions"].Data)
+	}
+	// Ran as historical, so the time wasn't passed as 1.7e+09
+	expected, _ = json.Marshal((&fakeViews{}).QueryPoolLiquidityCurveAt("0x1", "", "", 420, 1700000000, 0))
+	if string(results["curve"].Data.(json.RawMessage)) != string(expected) {
+		t.Errorf("Expected curve %s, got %s", expected, results["curve"].Data)
+	}
+	if next := results["paged"].NextCursor; next == nil || *next != "next" {
+		t.Errorf("Expected the next cursor, got %v", next)
+	}
+	if len(fake.calls) != 3 {
+		t.Errorf("Expected only the valid sub-queries to run, got %v", fake.calls)
+	}
+}
+
+func TestBatchSubQueriesCountAgainstKey(t *testing.T) {
+	g := testKeyGate(apiKeyFile{Keys: []ApiKeyConfig{{
+		Name: "partner", Key: "secret", ClientLimits: ClientLimits{RatePerSec: 0.001, Burst: 3}}}})
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/gcgo/batch", strings.NewReader(`[
+		{"name": "a", "route": "pool_txs", "params": {`+testBatchPool+`, "n": 10}},
+		{"name": "b", "route": "pool_txs", "params": {`+testBatchPool+`, "n": 10}},
+		{"name": "c", "route": "pool_txs", "params": {`+testBatchPool+`, "n": 10}}
+	]`))
+	req.Header.Set(API_KEY_HEADER, "secret")
+	fake := &fakeViews{}
+	(&APIWebServer{Views: fake, Keys: g}).router("gcgo", false).ServeHTTP(rec, req)
+
+	var resp struct{ Data []batchResult }
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	// The batch itself takes one request from the bucket, leaving two for the sub-queries
+	limited := 0
+	for _, result := range resp.Data {
+		if result.Status == http.StatusTooManyRequests && result.Error.Code == "rate_limited" {
+			limited++
+		}
+	}
+	if rec.Code != http.StatusOK || limited != 1 || len(fake.calls) != 2 {
+		t.Fatalf("Expected one sub-query over the key's limit, got %d %s", rec.Code, rec.Body.String())
+	}
+}
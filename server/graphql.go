@@ -0,0 +1,289 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/CrocSwap/graphcache-go/types"
+	"github.com/CrocSwap/graphcache-go/views"
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+)
+
+// Total rows a single query can return across all its list fields. Nested lists are charged
+// per parent, so a pool's positions with their owners' txs costs positions * txs.
+const GQL_MAX_COST = 5000
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+type graphqlCtxKey struct{}
+
+// Per-request state for the resolvers
+type graphqlBudget struct {
+	gin  *gin.Context
+	cost int
+}
+
+type graphqlApi struct {
+	schema graphql.Schema
+}
+
+func newGraphqlApi(v views.IViews) *graphqlApi {
+	return &graphqlApi{schema: buildGraphqlSchema(v)}
+}
+
+// Accepts the standard GraphQL POST body, or query and variables params on GET
+func (g *graphqlApi) serve(c *gin.Context) {
+	var req graphqlRequest
+	if c.Request.Method == http.MethodPost {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			wrapErrMsg(c, "Invalid GraphQL request body")
+			return
+		}
+	} else {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if vars := c.Query("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				wrapInvalidParam(c, "variables", "Invalid GraphQL variables")
+				return
+			}
+		}
+	}
+	if req.Query == "" {
+		wrapMissingParam(c, "query")
+		return
+	}
+
+	budget := &graphqlBudget{gin: c}
+	result := graphql.Do(graphql.Params{
+		Schema:         g.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        context.WithValue(c.Request.Context(), graphqlCtxKey{}, budget),
+	})
+	c.JSON(http.StatusOK, result)
+}
+
+func chargeCost(p graphql.ResolveParams, rows int) error {
+	budget := p.Context.Value(graphqlCtxKey{}).(*graphqlBudget)
+	maxCost, unrestricted := resultsCap(budget.gin, GQL_MAX_COST)
+	budget.cost += rows
+	if budget.cost > maxCost && !unrestricted {
+		return fmt.Errorf("query exceeds max cost of %d rows", maxCost)
+	}
+	return nil
+}
+
+// Checks a field's `n` against the same cap as the REST endpoint, then charges it to the query
+func chargeN(p graphql.ResolveParams, maxSize int) (int, error) {
+	budget := p.Context.Value(graphqlCtxKey{}).(*graphqlBudget)
+	n := p.Args["n"].(int)
+	maxSize, unrestricted := resultsCap(budget.gin, maxSize)
+	if n <= 0 {
+		return 0, fmt.Errorf("n must be positive")
+	}
+	if n > maxSize && !unrestricted {
+		return 0, fmt.Errorf("n exceeds max size of %d", maxSize)
+	}
+	return n, chargeCost(p, n)
+}
+
+// Same defaults as the REST time, timeBefore params
+func timeWindow(p graphql.ResolveParams) (afterTime int, beforeTime int) {
+	afterTime, beforeTime = p.Args["time"].(int), p.Args["timeBefore"].(int)
+	if afterTime > 0 && beforeTime == 0 {
+		beforeTime = 1999999999
+	}
+	return
+}
+
+func chainArg(p graphql.ResolveParams, v views.IViews) (types.ChainId, error) {
+	chainId := types.ValidateChainId(p.Args["chainId"].(string))
+	if chainId == "" {
+		return "", fmt.Errorf("invalid ChainID arg=%s", p.Args["chainId"])
+	}
+	if v.QueryChainSyncing(chainId) {
+		return "", fmt.Errorf("chain %s is still syncing", chainId)
+	}
+	return chainId, nil
+}
+
+func sourcePool(p graphql.ResolveParams) types.PoolLocation {
+	src := p.Source.(map[string]interface{})
+	poolIdx, _ := strconv.Atoi(fmt.Sprint(src["poolIdx"]))
+	return types.PoolLocation{
+		ChainId: types.ChainId(fmt.Sprint(src["chainId"])),
+		Base:    types.EthAddress(fmt.Sprint(src["base"])),
+		Quote:   types.EthAddress(fmt.Sprint(src["quote"])),
+		PoolIdx: poolIdx,
+	}
+}
+
+func sourceUser(p graphql.ResolveParams) (types.ChainId, types.EthAddress) {
+	src := p.Source.(map[string]interface{})
+	return types.ChainId(fmt.Sprint(src["chainId"])), types.EthAddress(fmt.Sprint(src["address"]))
+}
+
+// Converts a view result to maps keyed by its REST JSON field names, which the default
+// resolvers read. Embedded structs are flattened and omitempty is honored, the same as
+// encoding/json. Values with their own JSON encoding are kept as their JSON text, so that
+// big integer liquidity values aren't rounded.
+func asGraph(val interface{}) (interface{}, error) {
+	if val == nil {
+		return nil, nil
+	}
+	// Copied so that fields are addressable, since big.Int only marshals through a pointer
+	ptr := reflect.New(reflect.TypeOf(val))
+	ptr.Elem().Set(reflect.ValueOf(val))
+	return graphValue(ptr.Elem())
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func graphValue(v reflect.Value) (interface{}, error) {
+	if v.Type().Implements(jsonMarshalerType) || (v.CanAddr() && v.Addr().Type().Implements(jsonMarshalerType)) {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return nil, nil
+		}
+		if v.CanAddr() {
+			v = v.Addr()
+		}
+		return marshaledGraphValue(v.Interface().(json.Marshaler))
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return graphValue(v.Elem())
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		return fields, addGraphFields(fields, v)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		elems := make([]interface{}, v.Len())
+		for i := range elems {
+			elem, err := graphValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		return elems, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		entries := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, err := graphValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			entries[fmt.Sprint(iter.Key().Interface())] = elem
+		}
+		return entries, nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		if math.IsNaN(v.Float()) || math.IsInf(v.Float(), 0) {
+			return nil, fmt.Errorf("unsupported value %v", v.Float())
+		}
+		return v.Float(), nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func addGraphFields(fields map[string]interface{}, v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := v.Field(i)
+			if embedded.Kind() == reflect.Pointer {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if err := addGraphFields(fields, embedded); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.Contains(","+opts+",", ",omitempty,") && isEmptyJson(v.Field(i)) {
+			continue
+		}
+		elem, err := graphValue(v.Field(i))
+		if err != nil {
+			return err
+		}
+		fields[name] = elem
+	}
+	return nil
+}
+
+// Same as the omitempty check in encoding/json
+func isEmptyJson(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+// Strings are unquoted and numbers are kept as their text, which the GraphQL scalars parse
+func marshaledGraphValue(m json.Marshaler) (interface{}, error) {
+	encoded, err := m.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	if num, ok := decoded.(json.Number); ok {
+		return num.String(), nil
+	}
+	return decoded, nil
+}
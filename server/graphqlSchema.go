@@ -0,0 +1,353 @@
+package server
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/CrocSwap/graphcache-go/types"
+	"github.com/CrocSwap/graphcache-go/views"
+	"github.com/graphql-go/graphql"
+)
+
+// Caps on `n` for list fields, the same as the matching REST endpoints
+const (
+	GQL_MAX_POSITIONS = 200
+	GQL_MAX_LIMITS    = 200
+	GQL_MAX_TXS       = 200
+	GQL_MAX_CANDLES   = 3000
+)
+
+// Charged as rows for fields that do more work than their result size suggests. Historical
+// curves replay the pool's liquidity changes, historical stats search its history, and USD
+// stats price both tokens through the oracle's pools.
+const (
+	GQL_HIST_CURVE_COST = 1000
+	GQL_HIST_STATS_COST = 200
+	GQL_USD_STATS_COST  = 50
+)
+
+func scalarFields(fields graphql.Fields, typ graphql.Output, names ...string) graphql.Fields {
+	for _, name := range names {
+		fields[name] = &graphql.Field{Type: typ}
+	}
+	return fields
+}
+
+func poolLocFields(fields graphql.Fields) graphql.Fields {
+	scalarFields(fields, graphql.String, "chainId", "base", "quote")
+	return scalarFields(fields, graphql.Int, "poolIdx")
+}
+
+var windowArgs = graphql.FieldConfigArgument{
+	"n":          &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+	"time":       &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+	"timeBefore": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+}
+
+func withArgs(base graphql.FieldConfigArgument, extra graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args := graphql.FieldConfigArgument{}
+	for name, arg := range base {
+		args[name] = arg
+	}
+	for name, arg := range extra {
+		args[name] = arg
+	}
+	return args
+}
+
+// Result objects are resolved from their REST JSON representation, so the field names
+// and encodings match the REST API. Pools and users are the joins between them.
+func buildGraphqlSchema(v views.IViews) graphql.Schema {
+	pool := graphql.NewObject(graphql.ObjectConfig{Name: "Pool", Fields: poolLocFields(graphql.Fields{})})
+	user := graphql.NewObject(graphql.ObjectConfig{Name: "User", Fields: graphql.Fields{
+		"chainId": &graphql.Field{Type: graphql.String},
+		"address": &graphql.Field{Type: graphql.String},
+	}})
+
+	pnl := graphql.NewObject(graphql.ObjectConfig{Name: "PositionPnL", Fields: scalarFields(graphql.Fields{},
+		graphql.Float, "poolPrice", "depositBase", "depositQuote", "withdrawBase", "withdrawQuote",
+		"currentBase", "currentQuote", "feesBase", "feesQuote", "pnlInBase", "impLoss")})
+
+	positionFields := poolLocFields(graphql.Fields{})
+	scalarFields(positionFields, graphql.String, "user", "positionId", "positionType", "firstMintTx", "lastMintTx",
+		"ambientLiq", "concLiq", "rewardLiq")
+	scalarFields(positionFields, graphql.Int, "bidTick", "askTick", "timeFirstMint", "latestUpdateTime", "liqRefreshTime")
+	scalarFields(positionFields, graphql.Float, "aprDuration", "aprPostLiq", "aprContributedLiq", "aprEst")
+	scalarFields(positionFields, graphql.Boolean, "isBid")
+	positionFields["pnl"] = &graphql.Field{Type: pnl}
+	position := graphql.NewObject(graphql.ObjectConfig{Name: "Position", Fields: positionFields})
+
+	limitFields := poolLocFields(graphql.Fields{})
+	scalarFields(limitFields, graphql.String, "user", "limitOrderId", "ambientLiq", "concLiq", "rewardLiq", "claimableLiq")
+	scalarFields(limitFields, graphql.Int, "bidTick", "askTick", "pivotTime", "crossTime", "timeFirstMint",
+		"latestUpdateTime", "liqRefreshTime")
+	scalarFields(limitFields, graphql.Float, "feeMileage")
+	scalarFields(limitFields, graphql.Boolean, "isBid")
+	limit := graphql.NewObject(graphql.ObjectConfig{Name: "LimitOrder", Fields: limitFields})
+
+	txFields := poolLocFields(graphql.Fields{})
+	scalarFields(txFields, graphql.String, "txId", "txHash", "user", "entityType", "changeType", "positionType")
+	scalarFields(txFields, graphql.Int, "blockNum", "txTime", "callIndex", "bidTick", "askTick")
+	scalarFields(txFields, graphql.Float, "baseFlow", "quoteFlow")
+	scalarFields(txFields, graphql.Boolean, "isBuy", "inBaseQty")
+	tx := graphql.NewObject(graphql.ObjectConfig{Name: "Tx", Fields: txFields})
+
+	candle := graphql.NewObject(graphql.ObjectConfig{Name: "Candle", Fields: scalarFields(
+		scalarFields(graphql.Fields{}, graphql.Int, "period", "time"),
+		graphql.Float, "priceOpen", "priceClose", "minPrice", "maxPrice", "volumeBase", "volumeQuote",
+		"tvlBase", "tvlQuote", "feeRateOpen", "feeRateClose")})
+
+	poolUsd := graphql.NewObject(graphql.ObjectConfig{Name: "PoolUsdStats", Fields: scalarFields(graphql.Fields{},
+		graphql.Float, "baseUsdPrice", "quoteUsdPrice", "tvlUsd", "volumeUsd", "feesUsd")})
+
+	statsFields := scalarFields(graphql.Fields{}, graphql.Int, "latestTime", "initTime", "events")
+	scalarFields(statsFields, graphql.Float, "baseTvl", "quoteTvl", "baseVolume", "quoteVolume", "baseFees",
+		"quoteFees", "lastPriceSwap", "lastPriceLiq", "lastPriceIndic", "feeRate")
+	statsFields["usd"] = &graphql.Field{Type: poolUsd}
+	stats := graphql.NewObject(graphql.ObjectConfig{Name: "PoolStats", Fields: statsFields})
+
+	tokens := graphql.NewObject(graphql.ObjectConfig{Name: "TokenPair", Fields: scalarFields(
+		scalarFields(graphql.Fields{}, graphql.Int, "baseDecimals", "quoteDecimals"),
+		graphql.String, "baseSymbol", "baseName", "quoteSymbol", "quoteName")})
+
+	bump := graphql.NewObject(graphql.ObjectConfig{Name: "LiquidityBump", Fields: scalarFields(
+		scalarFields(graphql.Fields{}, graphql.Int, "bumpTick", "knockoutBidWidth", "knockoutAskWidth", "latestUpdateTime"),
+		graphql.Float, "liquidityDelta", "knockoutBidLiq", "knockoutAskLiq")})
+	curve := graphql.NewObject(graphql.ObjectConfig{Name: "LiquidityCurve", Fields: graphql.Fields{
+		"ambientLiq":     &graphql.Field{Type: graphql.Float},
+		"liquidityBumps": &graphql.Field{Type: graphql.NewList(bump)},
+	}})
+
+	feeChange := graphql.NewObject(graphql.ObjectConfig{Name: "FeeRateChange", Fields: scalarFields(
+		scalarFields(graphql.Fields{"txHash": &graphql.Field{Type: graphql.String}}, graphql.Int, "time", "block"),
+		graphql.Float, "feeRate")})
+
+	// Joins back to the pool and the user, so that e.g. pool -> positions -> user -> txs can be
+	// selected in one query
+	for _, obj := range []*graphql.Object{position, limit, tx} {
+		obj.AddFieldConfig("pool", &graphql.Field{Type: pool, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source, nil
+		}})
+		obj.AddFieldConfig("owner", &graphql.Field{Type: user, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			src := p.Source.(map[string]interface{})
+			return map[string]interface{}{"chainId": src["chainId"], "address": src["user"]}, nil
+		}})
+	}
+
+	pool.AddFieldConfig("tokens", &graphql.Field{Type: tokens,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return asGraph(v.QueryPoolTokens(sourcePool(p)))
+		}})
+	pool.AddFieldConfig("stats", &graphql.Field{Type: stats,
+		Args: graphql.FieldConfigArgument{
+			"histTime": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+			"withUsd":  &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			loc := sourcePool(p)
+			histTime, withUsd := p.Args["histTime"].(int), p.Args["withUsd"].(bool)
+			cost := 1
+			if histTime > 0 {
+				cost += GQL_HIST_STATS_COST
+			}
+			if withUsd {
+				cost += GQL_USD_STATS_COST
+			}
+			if err := chargeCost(p, cost); err != nil {
+				return nil, err
+			}
+			if histTime > 0 {
+				return asGraph(v.QueryPoolStatsFrom(loc.ChainId, loc.Base, loc.Quote, loc.PoolIdx, histTime, withUsd))
+			}
+			return asGraph(v.QueryPoolStats(loc.ChainId, loc.Base, loc.Quote, loc.PoolIdx, false, withUsd))
+		}})
+	pool.AddFieldConfig("candles", &graphql.Field{Type: graphql.NewList(candle),
+		Args: graphql.FieldConfigArgument{
+			"period": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"n":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"time":   &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			loc := sourcePool(p)
+			n, err := chargeN(p, GQL_MAX_CANDLES)
+			if err != nil {
+				return nil, err
+			}
+			period, startTime := p.Args["period"].(int), p.Args["time"].(int)
+			if period <= 0 || period > 604800 || (period > 3600 && period%3600 != 0) {
+				return nil, fmt.Errorf("period must be at most 604800, and a multiple of 3600 if over 3600")
+			}
+			timeRange := views.CandleRangeArgs{N: n, Period: period}
+			if startTime > 0 {
+				timeRange.StartTime = &startTime
+			}
+			return asGraph(v.QueryPoolCandles(loc.ChainId, loc.Base, loc.Quote, loc.PoolIdx, timeRange))
+		}})
+	pool.AddFieldConfig("positions", &graphql.Field{Type: graphql.NewList(position),
+		Args: withArgs(windowArgs, graphql.FieldConfigArgument{
+			"omitEmpty": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+		}),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			loc := sourcePool(p)
+			n, err := chargeN(p, GQL_MAX_POSITIONS)
+			if err != nil {
+				return nil, err
+			}
+			afterTime, beforeTime := timeWindow(p)
+			return asGraph(v.QueryPoolPositions(loc.ChainId, loc.Base, loc.Quote, loc.PoolIdx, n,
+				p.Args["omitEmpty"].(bool), afterTime, beforeTime))
+		}})
+	pool.AddFieldConfig("limitOrders", &graphql.Field{Type: graphql.NewList(limit), Args: windowArgs,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			loc := sourcePool(p)
+			n, err := chargeN(p, GQL_MAX_LIMITS)
+			if err != nil {
+				return nil, err
+			}
+			afterTime, beforeTime := timeWindow(p)
+			return asGraph(v.QueryPoolLimits(loc.ChainId, loc.Base, loc.Quote, loc.PoolIdx, n, afterTime, beforeTime))
+		}})
+	pool.AddFieldConfig("txs", &graphql.Field{Type: graphql.NewList(tx), Args: windowArgs,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			loc := sourcePool(p)
+			n, err := chargeN(p, GQL_MAX_TXS)
+			if err != nil {
+				return nil, err
+			}
+			afterTime, beforeTime := timeWindow(p)
+			return asGraph(v.QueryPoolTxHist(loc.ChainId, loc.Base, loc.Quote, loc.PoolIdx, n, afterTime, beforeTime))
+		}})
+	pool.AddFieldConfig("liquidityCurve", &graphql.Field{Type: curve,
+		Args: graphql.FieldConfigArgument{
+			"histTime": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			loc := sourcePool(p)
+			var resp views.PoolLiqCurve
+			if histTime := p.Args["histTime"].(int); histTime > 0 {
+				if err := chargeCost(p, GQL_HIST_CURVE_COST); err != nil {
+					return nil, err
+				}
+				resp = v.QueryPoolLiquidityCurveAt(loc.ChainId, loc.Base, loc.Quote, loc.PoolIdx, histTime, 0)
+			} else {
+				resp = v.QueryPoolLiquidityCurve(loc.ChainId, loc.Base, loc.Quote, loc.PoolIdx)
+			}
+			if err := chargeCost(p, len(resp.Bumps)); err != nil {
+				return nil, err
+			}
+			return asGraph(resp)
+		}})
+	pool.AddFieldConfig("feeHistory", &graphql.Field{Type: graphql.NewList(feeChange),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			loc := sourcePool(p)
+			return asGraph(v.QueryPoolFeeHistory(loc.ChainId, loc.Base, loc.Quote, loc.PoolIdx))
+		}})
+
+	// A user's positions and limit orders are unbounded, so they're charged by their size
+	user.AddFieldConfig("positions", &graphql.Field{Type: graphql.NewList(position),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			chainId, addr := sourceUser(p)
+			resp := v.QueryUserPositions(chainId, addr)
+			if err := chargeCost(p, len(resp)); err != nil {
+				return nil, err
+			}
+			return asGraph(resp)
+		}})
+	user.AddFieldConfig("limitOrders", &graphql.Field{Type: graphql.NewList(limit),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			chainId, addr := sourceUser(p)
+			resp := v.QueryUserLimits(chainId, addr)
+			if err := chargeCost(p, len(resp)); err != nil {
+				return nil, err
+			}
+			return asGraph(resp)
+		}})
+	user.AddFieldConfig("txs", &graphql.Field{Type: graphql.NewList(tx), Args: windowArgs,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			chainId, addr := sourceUser(p)
+			n, err := chargeN(p, GQL_MAX_TXS)
+			if err != nil {
+				return nil, err
+			}
+			afterTime, beforeTime := timeWindow(p)
+			return asGraph(v.QueryUserTxHist(chainId, addr, n, afterTime, beforeTime))
+		}})
+
+	query := graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: graphql.Fields{
+		"pool": &graphql.Field{Type: pool,
+			Args: graphql.FieldConfigArgument{
+				"chainId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"base":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"quote":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"poolIdx": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				chainId, err := chainArg(p, v)
+				if err != nil {
+					return nil, err
+				}
+				base, quote := types.ValidateEthAddr(p.Args["base"].(string)), types.ValidateEthAddr(p.Args["quote"].(string))
+				if base == "" || quote == "" {
+					return nil, fmt.Errorf("invalid base or quote address")
+				}
+				return asGraph(types.PoolLocation{ChainId: chainId, Base: base, Quote: quote, PoolIdx: p.Args["poolIdx"].(int)})
+			}},
+		"pools": &graphql.Field{Type: graphql.NewList(pool),
+			Args: graphql.FieldConfigArgument{
+				"chainId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				chainId, err := chainArg(p, v)
+				if err != nil {
+					return nil, err
+				}
+				resp := v.QueryPoolSet(chainId)
+				if err := chargeCost(p, len(resp)); err != nil {
+					return nil, err
+				}
+				return asGraph(resp)
+			}},
+		"tx": &graphql.Field{Type: graphql.NewList(tx),
+			Args: graphql.FieldConfigArgument{
+				"chainId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"txHash":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				chainId, err := chainArg(p, v)
+				if err != nil {
+					return nil, err
+				}
+				txHash := types.ValidateEthHash(p.Args["txHash"].(string))
+				if txHash == "" {
+					return nil, fmt.Errorf("invalid transaction hash arg=%s", p.Args["txHash"])
+				}
+				resp := v.QueryTx(chainId, txHash)
+				if err := chargeCost(p, len(resp)); err != nil {
+					return nil, err
+				}
+				return asGraph(resp)
+			}},
+		"user": &graphql.Field{Type: user,
+			Args: graphql.FieldConfigArgument{
+				"chainId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"address": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				chainId, err := chainArg(p, v)
+				if err != nil {
+					return nil, err
+				}
+				addr := types.ValidateEthAddr(p.Args["address"].(string))
+				if addr == "" {
+					return nil, fmt.Errorf("invalid Ethereum address arg=%s", p.Args["address"])
+				}
+				return map[string]interface{}{"chainId": string(chainId), "address": string(addr)}, nil
+			}},
+	}})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		log.Fatal("Invalid GraphQL schema: ", err)
+	}
+	return schema
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/types"
+	"github.com/CrocSwap/graphcache-go/views"
+)
+
+func (v *fakeViews) QueryPoolLiquidityCurve(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+	poolIdx int) views.PoolLiqCurve {
+	v.record("QueryPoolLiquidityCurve")
+	return views.PoolLiqCurve{AmbientLiq: 5, Bumps: []*model.LiquidityBump{{Tick: 100}, {Tick: 200}}}
+}
+
+func (v *fakeViews) QueryPoolLiquidityCurveAt(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+	poolIdx int, histTime int, histBlock int) views.PoolLiqCurve {
+	v.record("QueryPoolLiquidityCurveAt")
+	return views.PoolLiqCurve{AmbientLiq: 5, Bumps: []*model.LiquidityBump{{Tick: 100}}}
+}
+
+func (v *fakeViews) QueryPoolStatsFrom(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+	poolIdx int, histTime int, withUsd bool) views.PoolStats {
+	v.record("QueryPoolStatsFrom")
+	return views.PoolStats{Events: 3}
+}
+
+const testGqlPool = `pool(chainId: "0x1", base: "0x000000000000000000000000000000000000000a",
+	quote: "0x000000000000000000000000000000000000000b", poolIdx: 420)`
+
+func testGraphql(t *testing.T, fake *fakeViews, query string) (map[string]interface{}, []string) {
+	t.Helper()
+	_, body := testGet(t, &APIWebServer{Views: fake}, "/gcgo/graphql?query="+url.QueryEscape(query))
+	var data map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body["data"]))
+	decoder.UseNumber()
+	decoder.Decode(&data)
+	var errs []struct{ Message string }
+	json.Unmarshal(body["errors"], &errs)
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Message)
+	}
+	return data, msgs
+}
+
+func testGqlPosition() views.UserPosition {
+	loc := types.PositionLocation{
+		PoolLocation:      types.PoolLocation{ChainId: "0x1", Base: "0x000000000000000000000000000000000000000a", Quote: "0x000000000000000000000000000000000000000b", PoolIdx: 420},
+		LiquidityLocation: types.RangeLiquidityLocation(-100, 100),
+		User:              testUser,
+	}
+	pos := views.UserPosition{PositionLocation: loc, PositionId: "pos_01"}
+	// Past the precision of a float64
+	pos.ConcLiq.SetString("1208925819614629174706177", 10)
+	pos.APRCalcResult.Apr = 0.25
+	return pos
+}
+
+func TestGraphqlPositionResolvers(t *testing.T) {
+	fake := &fakeViews{positions: []views.UserPosition{testGqlPosition()}}
+	data, errs := testGraphql(t, fake, `{ `+testGqlPool+` {
+		positions(n: 10) { positionId concLiq bidTick aprEst pnl { impLoss } owner { address } pool { poolIdx } } } }`)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected errors %v", errs)
+	}
+	positions := data["pool"].(map[string]interface{})["positions"].([]interface{})
+	got := positions[0].(map[string]interface{})
+	want := map[string]interface{}{
+		"positionId": "pos_01",
+		"concLiq":    "1208925819614629174706177",
+		"bidTick":    json.Number("-100"),
+		"aprEst":     json.Number("0.25"),
+		"pnl":        nil,
+		"owner":      map[string]interface{}{"address": testUser},
+		"pool":       map[string]interface{}{"poolIdx": json.Number("420")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+}
+
+// Field names and values match the REST encoding of the same result
+func TestAsGraphMatchesJson(t *testing.T) {
+	pos := testGqlPosition()
+	pos.PnL = &model.PositionPnL{PoolPrice: 1.5}
+	stats := views.PoolStats{AdditionalPoolStatsFields: &views.AdditionalPoolStatsFields{
+		PoolLocation: &types.PoolLocation{ChainId: "0x1", PoolIdx: 420}}, Events: 3}
+	// Pointers, so the JSON encoding uses the big.Int marshaler
+	for _, val := range []interface{}{&pos, &stats, []types.PoolLocation{{ChainId: "0x1"}}, &views.PoolLiqCurve{}} {
+		graph, err := asGraph(val)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		encoded, _ := json.Marshal(val)
+		var decoded interface{}
+		decoder := json.NewDecoder(bytes.NewReader(encoded))
+		decoder.UseNumber()
+		decoder.Decode(&decoded)
+		if !reflect.DeepEqual(normalizeGraph(graph), normalizeGraph(decoded)) {
+			t.Errorf("Graph value differs from the JSON\n%v\n%v", graph, decoded)
+		}
+	}
+}
+
+// Compares numbers by their text, since asGraph keeps big integers as strings
+func normalizeGraph(val interface{}) interface{} {
+	switch val := val.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, elem := range val {
+			out[k] = normalizeGraph(elem)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, elem := range val {
+			out[i] = normalizeGraph(elem)
+		}
+		return out
+	case float64:
+		return new(big.Float).SetFloat64(val).Text('f', -1)
+	case int:
+		return fmt.Sprint(val)
+	case json.Number:
+		return normalizeGraph(val.String())
+	case string:
+		if f, ok := new(big.Float).SetString(val); ok {
+			return f.Text('f', -1)
+		}
+	}
+	return val
+}
+
+func TestGraphqlHistoricalCost(t *testing.T) {
+	aliased := func(n int, field string) string {
+		fields := make([]string, n)
+		for i := range fields {
+			fields[i] = fmt.Sprintf("f%d: %s", i, field)
+		}
+		return "{ " + testGqlPool + " { " + strings.Join(fields, " ") + " } }"
+	}
+	countCalls := func(fake *fakeViews, call string) int {
+		n := 0
+		for _, c := range fake.calls {
+			if c == call {
+				n++
+			}
+		}
+		return n
+	}
+
+	cases := []struct {
+		field    string
+		call     string
+		maxCount int // Most that fit in the cost cap
+	}{
+		// Each is the historical cost plus its one bump
+		{"liquidityCurve(histTime: 100) { ambientLiq }", "QueryPoolLiquidityCurveAt",
+			GQL_MAX_COST / (GQL_HIST_CURVE_COST + 1)},
+		{"stats(histTime: 100, withUsd: true) { events }", "QueryPoolStatsFrom",
+			GQL_MAX_COST / (GQL_HIST_STATS_COST + GQL_USD_STATS_COST + 1)},
+	}
+	for _, tc := range cases {
+		fake := &fakeViews{}
+		if _, errs := testGraphql(t, fake, aliased(tc.maxCount, tc.field)); len(errs) > 0 {
+			t.Errorf("%s: %d within the cap failed %v", tc.field, tc.maxCount, errs)
+		}
+
+		fake = &fakeViews{}
+		_, errs := testGraphql(t, fake, aliased(tc.maxCount+1, tc.field))
+		if len(errs) != 1 || !strings.Contains(errs[0], "max cost") {
+			t.Errorf("%s: expected one max cost error past the cap, got %v", tc.field, errs)
+		}
+		// The field over the cap is rejected before it runs its query
+		if n := countCalls(fake, tc.call); n > tc.maxCount {
+			t.Errorf("%s: %d queries ran past the cap", tc.field, n)
+		}
+	}
+
+	// Latest curves are charged by their bumps
+	fake := &fakeViews{}
+	if _, errs := testGraphql(t, fake, aliased(GQL_MAX_COST/2+1, "liquidityCurve { ambientLiq }")); len(errs) != 1 {
+		t.Errorf("Expected the curve bumps to be charged, got %v", errs)
+	}
+}
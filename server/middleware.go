@@ -1,12 +1,15 @@
 package server
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/CrocSwap/graphcache-go/types"
+	"github.com/gin-gonic/gin"
+)
 
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Api-Key")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
 
 		if c.Request.Method == "OPTIONS" {
@@ -17,3 +20,16 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// Requests for a chain that's still on its startup sync fail with a 503 rather than
+// returning partial data
+func (s *APIWebServer) chainSyncMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chainId := types.ValidateChainId(c.Query("chainId"))
+		if chainId != "" && s.Views.QueryChainSyncing(chainId) {
+			wrapChainSyncing(c, chainId)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/types"
+	"github.com/CrocSwap/graphcache-go/views"
+	"github.com/gin-gonic/gin"
+)
+
+func (v *fakeViews) QueryPositionById(id string) (*views.UserPosition, error) {
+	v.record("QueryPositionById:" + id)
+	switch id {
+	case "pos_bad":
+		return nil, views.ErrInvalidId
+	case "pos_fail":
+		return nil, errors.New("query failed")
+	}
+	return nil, nil
+}
+
+func (v *fakeViews) QueryChainIds() []types.ChainId {
+	return []types.ChainId{"0x1", "0x2"}
+}
+
+func TestErrorEnvelopes(t *testing.T) {
+	syncing := map[types.ChainId]bool{"0x2": true}
+	cases := []struct {
+		path   string
+		status int
+		code   string
+		param  string
+	}{
+		{"/gcgo/user_txs?chainId=0x1&n=10", http.StatusBadRequest, "missing_param", "user"},
+		{"/gcgo/user_txs?chainId=0x1&user=0x12&n=10", http.StatusBadRequest, "invalid_param", "user"},
+		{"/gcgo/position?id=pos_bad", http.StatusBadRequest, "invalid_param", "id"},
+		{"/gcgo/position?id=pos_00", http.StatusNotFound, "not_found", ""},
+		{"/gcgo/position?id=pos_fail", http.StatusInternalServerError, "internal_error", ""},
+		{"/gcgo/user_txs?chainId=0x2&user=" + testUser + "&n=10", http.StatusServiceUnavailable, "syncing", "chainId"},
+		{"/gcgo/user_txs?chainId=0x1,0x2&user=" + testUser + "&n=10", http.StatusServiceUnavailable, "syncing", "chainId"},
+		{"/gcgo/user_txs?chainId=all&user=" + testUser + "&n=10", http.StatusServiceUnavailable, "syncing", "chainId"},
+	}
+	for _, tc := range cases {
+		fake := &fakeViews{syncing: syncing}
+		status, body := testGet(t, &APIWebServer{Views: fake}, tc.path)
+		var errBody errorBody
+		json.Unmarshal(body["error"], &errBody)
+		if status != tc.status || errBody.Code != tc.code || errBody.Param != tc.param {
+			t.Errorf("%s: expected %d %s on %q, got %d %+v", tc.path, tc.status, tc.code, tc.param, status, errBody)
+		}
+		if _, ok := body["provenance"]; !ok {
+			t.Errorf("%s: error envelope has no provenance", tc.path)
+		}
+		if tc.status == http.StatusServiceUnavailable && len(fake.calls) > 0 {
+			t.Errorf("%s: query ran on a syncing chain %v", tc.path, fake.calls)
+		}
+	}
+}
+
+func TestParseChainsParam(t *testing.T) {
+	cases := []struct {
+		arg      string
+		chainIds []types.ChainId
+		multi    bool
+		errCode  string
+	}{
+		{"0x10", []types.ChainId{"0x10"}, false, ""},
+		{"0x1,0x10", []types.ChainId{"0x1", "0x10"}, true, ""},
+		// Trimmed and deduplicated, in the order requested
+		{" 0x2 ,0x1,0x2", []types.ChainId{"0x2", "0x1"}, true, ""},
+		{"all", []types.ChainId{"0x1", "0x2"}, true, ""},
+		{"", nil, false, "missing_param"},
+		{"0x1,bad", nil, true, "invalid_param"},
+		{"0x1,0x3", nil, true, "syncing"},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tc := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/?chainId="+url.QueryEscape(tc.arg), nil)
+		s := &APIWebServer{Views: &fakeViews{syncing: map[types.ChainId]bool{"0x3": true}}}
+		chainIds, multi := s.parseChainsParam(c, "chainId")
+
+		errCode := ""
+		if len(c.Errors) > 0 {
+			errCode = c.Errors[0].Err.(*apiError).Code
+		}
+		if errCode != tc.errCode || multi != tc.multi || (tc.errCode == "" && !slices.Equal(chainIds, tc.chainIds)) {
+			t.Errorf("%q: expected %v %v %q, got %v %v %q", tc.arg, tc.chainIds, tc.multi, tc.errCode,
+				chainIds, multi, errCode)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package server
 
 import (
+	"math"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/CrocSwap/graphcache-go/types"
 	"github.com/gin-gonic/gin"
@@ -17,13 +20,27 @@ func parseAddrParam(c *gin.Context, paramName string) types.EthAddress {
 
 	parsed := types.ValidateEthAddr(arg)
 	if parsed == "" {
-		wrapErrMsgFmt(c, "Invalid Ethereum address arg=%s", arg)
+		wrapInvalidParam(c, paramName, "Invalid Ethereum address arg=%s", arg)
 		return ""
 	}
 
 	return parsed
 }
 
+func parseTxHashParam(c *gin.Context, paramName string) types.EthTxHash {
+	arg := c.Query(paramName)
+	if arg == "" {
+		wrapMissingParam(c, paramName)
+		return ""
+	}
+
+	parsed := types.ValidateEthHash(arg)
+	if parsed == "" {
+		wrapInvalidParam(c, paramName, "Invalid transaction hash arg=%s", arg)
+	}
+	return parsed
+}
+
 func parseChainParam(c *gin.Context, paramName string) types.ChainId {
 	arg := c.Query(paramName)
 	if arg == "" {
@@ -33,11 +50,44 @@ func parseChainParam(c *gin.Context, paramName string) types.ChainId {
 
 	parsed := types.ValidateChainId(arg)
 	if parsed == "" {
-		wrapErrMsgFmt(c, "Invalid ChainID arg=%s", paramName)
+		wrapInvalidParam(c, paramName, "Invalid ChainID arg=%s", arg)
 	}
 	return parsed
 }
 
+// Accepts a comma separated list of chains, or "all" for every chain served. Returns
+// false for a single chain, so that handlers keep their single chain response.
+func (s *APIWebServer) parseChainsParam(c *gin.Context, paramName string) ([]types.ChainId, bool) {
+	arg := c.Query(paramName)
+	if arg != "all" && !strings.Contains(arg, ",") {
+		return []types.ChainId{parseChainParam(c, paramName)}, false
+	}
+
+	var chainIds []types.ChainId
+	if arg == "all" {
+		chainIds = s.Views.QueryChainIds()
+	} else {
+		for _, elem := range strings.Split(arg, ",") {
+			parsed := types.ValidateChainId(strings.TrimSpace(elem))
+			if parsed == "" {
+				wrapInvalidParam(c, paramName, "Invalid ChainID arg=%s", elem)
+				return nil, true
+			}
+			if !slices.Contains(chainIds, parsed) {
+				chainIds = append(chainIds, parsed)
+			}
+		}
+	}
+
+	for _, chainId := range chainIds {
+		if s.Views.QueryChainSyncing(chainId) {
+			wrapChainSyncing(c, chainId)
+			break
+		}
+	}
+	return chainIds, true
+}
+
 func parseIntParam(c *gin.Context, paramName string) int {
 	arg := c.Query(paramName)
 	if arg == "" {
@@ -47,7 +97,25 @@ func parseIntParam(c *gin.Context, paramName string) int {
 
 	parsed, err := strconv.Atoi(arg)
 	if err != nil {
-		wrapErrMsgFmt(c, "Invalid int arg=%s", arg)
+		wrapInvalidParam(c, paramName, "Invalid int arg=%s", arg)
+		return -1
+	}
+
+	return parsed
+}
+
+// Token quantities in wei can exceed an int, so they're parsed as floats
+func parseFloatParam(c *gin.Context, paramName string) float64 {
+	arg := c.Query(paramName)
+	if arg == "" {
+		wrapMissingParam(c, paramName)
+		return -1
+	}
+
+	// ParseFloat accepts "NaN" and "Inf", which slip past range checks downstream
+	parsed, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		wrapInvalidParam(c, paramName, "Invalid number arg=%s", arg)
 		return -1
 	}
 
@@ -62,7 +130,7 @@ func parseIntOptional(c *gin.Context, paramName string, dflt int) int {
 
 	parsed, err := strconv.Atoi(arg)
 	if err != nil {
-		wrapErrMsgFmt(c, "Invalid int arg=%s", arg)
+		wrapInvalidParam(c, paramName, "Invalid int arg=%s", arg)
 		return -1
 	}
 
@@ -71,16 +139,26 @@ func parseIntOptional(c *gin.Context, paramName string, dflt int) int {
 
 func parseIntMaxParam(c *gin.Context, paramName string, maxSize int) int {
 	parsed := parseIntParam(c, paramName)
-	// If the unrestricted password is set and the unr param is set to it, then we allow the max size to be exceeded
-	unrestricted := (os.Getenv("UNRESTRICT_PASSWORD") != "" && c.Query("unr") == os.Getenv("UNRESTRICT_PASSWORD"))
+	maxSize, unrestricted := resultsCap(c, maxSize)
 
 	if parsed > maxSize && !unrestricted {
-		wrapErrMsgFmt(c, "n Exceeds max size of %d", maxSize)
+		wrapInvalidParam(c, paramName, "%s exceeds max size of %d", paramName, maxSize)
 	}
 
 	return parsed
 }
 
+// Cap on a result size for the request, raised by the API key's own cap if it's higher
+func resultsCap(c *gin.Context, maxSize int) (int, bool) {
+	// If the unrestricted password is set and the unr param is set to it, then we allow the max size to be exceeded
+	unrestricted := (os.Getenv("UNRESTRICT_PASSWORD") != "" && c.Query("unr") == os.Getenv("UNRESTRICT_PASSWORD"))
+
+	if keyMax := c.GetInt(MAX_RESULTS_CTX_KEY); keyMax > maxSize {
+		maxSize = keyMax
+	}
+	return maxSize, unrestricted
+}
+
 func parseBoolParam(c *gin.Context, paramName string) bool {
 	arg := c.Query(paramName)
 	if arg == "" {
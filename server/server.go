@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/CrocSwap/graphcache-go/metrics"
 	"github.com/CrocSwap/graphcache-go/types"
 	"github.com/CrocSwap/graphcache-go/views"
 	"github.com/gin-contrib/gzip"
@@ -14,59 +15,124 @@ import (
 
 type APIWebServer struct {
 	Views views.IViews
+	Keys  *ApiKeyGate // Nil leaves the API open without rate limits
+	// Browser origins allowed to open tx streams, besides the server's own host
+	StreamOrigins []string
+	// Proxies whose X-Forwarded-For header is trusted for the client IP that anonymous
+	// limits are applied by. Empty uses the connection's remote address.
+	TrustedProxies []string
 }
 
 func (s *APIWebServer) Serve(basePrefix string, listenAddr string, extendedApi bool) {
 	gin.SetMode(gin.ReleaseMode)
+	r := s.router(basePrefix, extendedApi)
+	log.Println("API Serving at", listenAddr+"/"+basePrefix)
+	if err := r.Run(listenAddr); err != nil {
+		log.Fatalf("API server failed: %s", err)
+	}
+}
+
+func (s *APIWebServer) router(basePrefix string, extendedApi bool) *gin.Engine {
 	r := gin.Default()
+	if err := r.SetTrustedProxies(s.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies %v: %s", s.TrustedProxies, err)
+	}
 	r.Use(CORSMiddleware())
-	r.Use(gzip.Gzip(gzip.DefaultCompression))
+	// The metrics handler compresses its own responses
+	r.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{"/metrics"})))
+	r.Use(metrics.GinMiddleware())
+	if s.Keys != nil {
+		// Probes and scrapes are left out of the limits
+		r.Use(s.Keys.Middleware("/", "/metrics", "/ready"))
+	}
+	r.Use(s.chainSyncMiddleware())
 	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/metrics", metrics.Handler())
+	r.GET("/ready", s.queryReady)
+	gql := newGraphqlApi(s.Views)
 	for _, prefix := range []string{basePrefix, basePrefix + "-canary"} {
 		r.GET(prefix+"/", func(c *gin.Context) { c.Status(http.StatusOK) })
 		r.GET(prefix+"/user_balance_tokens", s.queryUserTokens)
+		r.GET(prefix+"/user_balances", s.queryUserBalances)
 		r.GET(prefix+"/user_positions", s.queryUserPositions)
 		r.GET(prefix+"/pool_positions", s.queryPoolPositions)
 		r.GET(prefix+"/pool_position_apy_leaders", s.queryPoolPositionsApyLeaders)
 		r.GET(prefix+"/user_pool_positions", s.queryUserPoolPositions)
 		r.GET(prefix+"/position_stats", s.querySinglePosition)
+		r.GET(prefix+"/position", s.queryPositionById)
+		r.GET(prefix+"/position_apr_hist", s.queryPositionAprHist)
 		r.GET(prefix+"/user_limit_orders", s.queryUserLimits)
 		r.GET(prefix+"/pool_limit_orders", s.queryPoolLimits)
 		r.GET(prefix+"/user_pool_limit_orders", s.queryUserPoolLimits)
 		r.GET(prefix+"/user_pool_txs", s.queryUserPoolTxHist)
 		r.GET(prefix+"/limit_stats", s.querySingleLimit)
+		r.GET(prefix+"/limit", s.queryLimitById)
 		r.GET(prefix+"/user_txs", s.queryUserTxHist)
 		r.GET(prefix+"/pool_txs", s.queryPoolTxHist)
+		r.GET(prefix+"/tx", s.queryTx)
 		r.GET(prefix+"/pool_liq_curve", s.queryPoolLiqCurve)
+		r.GET(prefix+"/swap_quote", s.querySwapQuote)
+		r.GET(prefix+"/pool_depth", s.queryPoolDepth)
 		r.GET(prefix+"/pool_stats", s.queryPoolStats)
+		r.GET(prefix+"/pool_apr_hist", s.queryPoolAprHist)
 		r.GET(prefix+"/all_pool_stats", s.queryAllPoolStats)
 		r.GET(prefix+"/pool_candles", s.queryPoolCandles)
+		r.GET(prefix+"/pool_fee_history", s.queryPoolFeeHistory)
 		r.GET(prefix+"/pool_list", s.queryPoolList)
+		r.GET(prefix+"/token_list", s.queryTokenList)
+		r.GET(prefix+"/token_prices", s.queryTokenPrices)
+		r.GET(prefix+"/token_price_hist", s.queryTokenPriceHist)
 		r.GET(prefix+"/chain_stats", s.queryChainStats)
+		r.GET(prefix+"/sync_status", s.querySyncStatus)
 		r.GET(prefix+"/plume_task", s.queryPlumeTask)
+		r.GET(prefix+"/pool_txs_stream", s.streamPoolTxs)
+		r.GET(prefix+"/user_txs_stream", s.streamUserTxs)
+		r.GET(prefix+"/graphql", gql.serve)
+		r.POST(prefix+"/graphql", gql.serve)
+		r.POST(prefix+"/batch", s.queryBatch(r, prefix))
 		if extendedApi {
 			r.GET(prefix+"/historic_positions", s.queryHistoricPositions)
 		}
 	}
+	return r
+}
 
-	log.Println("API Serving at", listenAddr+"/"+basePrefix)
-	r.Run(listenAddr)
+func (s *APIWebServer) querySyncStatus(c *gin.Context) {
+	resp := s.Views.QuerySyncStatus()
+	c.Header("Cache-Control", "no-store")
+	wrapDataErrResp(c, resp, nil)
+}
+
+// Readiness probe, fails with 503 while any chain is starting up or lagging
+func (s *APIWebServer) queryReady(c *gin.Context) {
+	resp := s.Views.QuerySyncStatus()
+	c.Header("Cache-Control", "no-store")
+	if resp.Ready {
+		c.JSON(http.StatusOK, resp)
+	} else {
+		c.JSON(http.StatusServiceUnavailable, resp)
+	}
 }
 
 func (s *APIWebServer) queryUserTokens(c *gin.Context) {
-	chainId := parseChainParam(c, "chainId")
+	chainIds, multiChain := s.parseChainsParam(c, "chainId")
 	user := parseAddrParam(c, "user")
 
 	if len(c.Errors) > 0 {
 		return
 	}
 
-	resp := s.Views.QueryUserTokens(chainId, user)
 	c.Header("Cache-Control", "public, max-age=60")
-	wrapDataErrResp(c, resp, nil)
+	if multiChain {
+		resp := s.Views.QueryMultiUserTokens(chainIds, user)
+		wrapDataErrResp(c, resp, nil)
+	} else {
+		resp := s.Views.QueryUserTokens(chainIds[0], user)
+		wrapDataErrResp(c, resp, nil)
+	}
 }
 
-func (s *APIWebServer) queryUserPositions(c *gin.Context) {
+func (s *APIWebServer) queryUserBalances(c *gin.Context) {
 	chainId := parseChainParam(c, "chainId")
 	user := parseAddrParam(c, "user")
 
@@ -74,33 +140,95 @@ func (s *APIWebServer) queryUserPositions(c *gin.Context) {
 		return
 	}
 
-	resp := s.Views.QueryUserPositions(chainId, user)
+	resp := s.Views.QueryUserBalances(chainId, user)
 	wrapDataErrResp(c, resp, nil)
 }
 
+func (s *APIWebServer) queryUserPositions(c *gin.Context) {
+	chainIds, multiChain := s.parseChainsParam(c, "chainId")
+	user := parseAddrParam(c, "user")
+
+	if len(c.Errors) > 0 {
+		return
+	}
+
+	if multiChain {
+		resp := s.Views.QueryMultiUserPositions(chainIds, user)
+		wrapDataErrResp(c, resp, nil)
+	} else {
+		resp := s.Views.QueryUserPositions(chainIds[0], user)
+		wrapDataErrResp(c, resp, nil)
+	}
+}
+
 func (s *APIWebServer) queryUserLimits(c *gin.Context) {
-	chainId := parseChainParam(c, "chainId")
+	chainIds, multiChain := s.parseChainsParam(c, "chainId")
 	user := parseAddrParam(c, "user")
 
 	if len(c.Errors) > 0 {
 		return
 	}
 
-	resp := s.Views.QueryUserLimits(chainId, user)
-	wrapDataErrResp(c, resp, nil)
+	if multiChain {
+		resp := s.Views.QueryMultiUserLimits(chainIds, user)
+		wrapDataErrResp(c, resp, nil)
+	} else {
+		resp := s.Views.QueryUserLimits(chainIds[0], user)
+		wrapDataErrResp(c, resp, nil)
+	}
 }
 
 func (s *APIWebServer) queryUserTxHist(c *gin.Context) {
-	chainId := parseChainParam(c, "chainId")
+	chainIds, multiChain := s.parseChainsParam(c, "chainId")
 	user := parseAddrParam(c, "user")
 	n := parseIntMaxParam(c, "n", 200)
 	afterTime, beforeTime := getTimeParameters(c)
+	cursor, paged := parseCursorParam(c, afterTime, beforeTime)
+	groupByTx := parseBoolOptional(c, "groupByTx", false)
+
+	// Cursors are positions in a single chain's history
+	if multiChain && paged {
+		wrapErrMsg(c, "Cannot specify cursor with multiple chains")
+	}
 
 	if len(c.Errors) > 0 {
 		return
 	}
 
-	resp := s.Views.QueryUserTxHist(chainId, user, n, afterTime, beforeTime)
+	if multiChain {
+		resp := s.Views.QueryMultiUserTxHist(chainIds, user, n, afterTime, beforeTime)
+		wrapDataErrResp(c, s.groupTxs(resp, groupByTx), nil)
+	} else if paged {
+		resp, nextCursor, err := s.Views.QueryUserTxHistPage(chainIds[0], user, n, cursor)
+		wrapPagedResp(c, s.groupTxs(resp, groupByTx), nextCursor, err)
+	} else {
+		resp := s.Views.QueryUserTxHist(chainIds[0], user, n, afterTime, beforeTime)
+		wrapDataErrResp(c, s.groupTxs(resp, groupByTx), nil)
+	}
+}
+
+// Events are grouped after the history is fetched, so n still counts events
+func (s *APIWebServer) groupTxs(resp []views.UserTxHistory, groupByTx bool) any {
+	if groupByTx {
+		return s.Views.QueryTxGroups(resp)
+	}
+	return resp
+}
+
+func (s *APIWebServer) queryTx(c *gin.Context) {
+	chainId := parseChainParam(c, "chainId")
+	txHash := parseTxHashParam(c, "txHash")
+
+	if len(c.Errors) > 0 {
+		return
+	}
+
+	resp := s.Views.QueryTx(chainId, txHash)
+	if len(resp) == 0 {
+		wrapApiErr(c, &apiError{http.StatusNotFound, "not_found", "Transaction not found", ""})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=60")
 	wrapDataErrResp(c, resp, nil)
 }
 
@@ -112,6 +240,7 @@ func (s *APIWebServer) queryPoolPositions(c *gin.Context) {
 	n := parseIntMaxParam(c, "n", 200)
 	omitEmpty := parseBoolOptional(c, "omitEmpty", false)
 	afterTime, beforeTime := getTimeParameters(c)
+	cursor, paged := parseCursorParam(c, afterTime, beforeTime)
 	if len(c.Errors) > 0 {
 		return
 	}
@@ -120,9 +249,14 @@ func (s *APIWebServer) queryPoolPositions(c *gin.Context) {
 		return
 	}
 
-	resp := s.Views.QueryPoolPositions(chainId, base, quote, poolIdx, n, omitEmpty, afterTime, beforeTime)
 	c.Header("Cache-Control", "public, max-age=5")
-	wrapDataErrResp(c, resp, nil)
+	if paged {
+		resp, nextCursor, err := s.Views.QueryPoolPositionsPage(chainId, base, quote, poolIdx, n, omitEmpty, cursor)
+		wrapPagedResp(c, resp, nextCursor, err)
+	} else {
+		resp := s.Views.QueryPoolPositions(chainId, base, quote, poolIdx, n, omitEmpty, afterTime, beforeTime)
+		wrapDataErrResp(c, resp, nil)
+	}
 }
 
 func (s *APIWebServer) queryPoolPositionsApyLeaders(c *gin.Context) {
@@ -148,13 +282,20 @@ func (s *APIWebServer) queryPoolTxHist(c *gin.Context) {
 	poolIdx := parseIntParam(c, "poolIdx")
 	n := parseIntMaxParam(c, "n", 200)
 	afterTime, beforeTime := getTimeParameters(c)
+	cursor, paged := parseCursorParam(c, afterTime, beforeTime)
+	groupByTx := parseBoolOptional(c, "groupByTx", false)
 	if len(c.Errors) > 0 {
 		return
 	}
 
-	resp := s.Views.QueryPoolTxHist(chainId, base, quote, poolIdx, n, afterTime, beforeTime)
 	c.Header("Cache-Control", "public, max-age=5")
-	wrapDataErrResp(c, resp, nil)
+	if paged {
+		resp, nextCursor, err := s.Views.QueryPoolTxHistPage(chainId, base, quote, poolIdx, n, cursor)
+		wrapPagedResp(c, s.groupTxs(resp, groupByTx), nextCursor, err)
+	} else {
+		resp := s.Views.QueryPoolTxHist(chainId, base, quote, poolIdx, n, afterTime, beforeTime)
+		wrapDataErrResp(c, s.groupTxs(resp, groupByTx), nil)
+	}
 }
 
 func (s *APIWebServer) queryHistoricPositions(c *gin.Context) {
@@ -213,13 +354,70 @@ func (s *APIWebServer) queryPoolLiqCurve(c *gin.Context) {
 	base := parseAddrParam(c, "base")
 	quote := parseAddrParam(c, "quote")
 	poolIdx := parseIntParam(c, "poolIdx")
+	histTime := parseIntOptional(c, "histTime", 0)
+	histBlock := parseIntOptional(c, "histBlock", 0)
+
+	if histTime > 0 && histBlock > 0 {
+		wrapErrMsg(c, "Cannot specify both histTime and histBlock")
+	}
 
 	if len(c.Errors) > 0 {
 		return
 	}
 
-	resp := s.Views.QueryPoolLiquidityCurve(chainId, base, quote, poolIdx)
-	c.Header("Cache-Control", "public, max-age=60")
+	if histTime > 0 || histBlock > 0 {
+		resp := s.Views.QueryPoolLiquidityCurveAt(chainId, base, quote, poolIdx, histTime, histBlock)
+		c.Header("Cache-Control", "public, max-age=300")
+		wrapDataErrResp(c, resp, nil)
+	} else {
+		resp := s.Views.QueryPoolLiquidityCurve(chainId, base, quote, poolIdx)
+		c.Header("Cache-Control", "public, max-age=60")
+		wrapDataErrResp(c, resp, nil)
+	}
+}
+
+func (s *APIWebServer) querySwapQuote(c *gin.Context) {
+	chainId := parseChainParam(c, "chainId")
+	base := parseAddrParam(c, "base")
+	quote := parseAddrParam(c, "quote")
+	poolIdx := parseIntParam(c, "poolIdx")
+	isBuy := parseBoolParam(c, "isBuy")
+	qty := parseFloatParam(c, "qty")
+
+	if qty <= 0 {
+		wrapInvalidParam(c, "qty", "qty must be positive")
+	}
+
+	if len(c.Errors) > 0 {
+		return
+	}
+
+	resp := s.Views.QuerySwapQuote(chainId, base, quote, poolIdx, isBuy, qty)
+	c.Header("Cache-Control", "public, max-age=5")
+	wrapDataErrResp(c, resp, nil)
+}
+
+func (s *APIWebServer) queryPoolDepth(c *gin.Context) {
+	chainId := parseChainParam(c, "chainId")
+	base := parseAddrParam(c, "base")
+	quote := parseAddrParam(c, "quote")
+	poolIdx := parseIntParam(c, "poolIdx")
+	bucketTicks := parseIntOptional(c, "bucketTicks", 10)
+	n := parseIntOptional(c, "n", 100)
+
+	if bucketTicks <= 0 {
+		wrapInvalidParam(c, "bucketTicks", "bucketTicks must be positive")
+	}
+	if n <= 0 || n > 1000 {
+		wrapInvalidParam(c, "n", "n must be between 1 and 1000")
+	}
+
+	if len(c.Errors) > 0 {
+		return
+	}
+
+	resp := s.Views.QueryPoolDepth(chainId, base, quote, poolIdx, bucketTicks, n)
+	c.Header("Cache-Control", "public, max-age=10")
 	wrapDataErrResp(c, resp, nil)
 }
 
@@ -230,6 +428,8 @@ func (s *APIWebServer) queryPoolStats(c *gin.Context) {
 	poolIdx := parseIntParam(c, "poolIdx")
 	histTime := parseIntOptional(c, "histTime", 0)
 	with24hPrices := parseBoolOptional(c, "with24hPrices", false)
+	withTokens := parseBoolOptional(c, "withTokens", false)
+	withUsd := parseBoolOptional(c, "withUsd", false)
 
 	if histTime > 0 && with24hPrices {
 		wrapErrMsg(c, "Cannot specify both histTime and with24hPrices")
@@ -239,8 +439,14 @@ func (s *APIWebServer) queryPoolStats(c *gin.Context) {
 		return
 	}
 
+	var tokens *types.TokenPairMetadata
+	if withTokens {
+		tokens = s.Views.QueryPoolTokens(types.PoolLocation{ChainId: chainId, Base: base, Quote: quote, PoolIdx: poolIdx})
+	}
+
 	if histTime > 0 {
-		resp := s.Views.QueryPoolStatsFrom(chainId, base, quote, poolIdx, histTime)
+		resp := s.Views.QueryPoolStatsFrom(chainId, base, quote, poolIdx, histTime, withUsd)
+		resp.Tokens = tokens
 		if int64(histTime) < time.Now().Unix()-60 {
 			c.Header("Cache-Control", "public, max-age=60")
 		} else {
@@ -248,7 +454,8 @@ func (s *APIWebServer) queryPoolStats(c *gin.Context) {
 		}
 		wrapDataErrResp(c, resp, nil)
 	} else {
-		resp := s.Views.QueryPoolStats(chainId, base, quote, poolIdx, with24hPrices)
+		resp := s.Views.QueryPoolStats(chainId, base, quote, poolIdx, with24hPrices, withUsd)
+		resp.Tokens = tokens
 		c.Header("Cache-Control", "public, max-age=5")
 		wrapDataErrResp(c, resp, nil)
 	}
@@ -265,11 +472,11 @@ func (s *APIWebServer) queryPoolCandles(c *gin.Context) {
 
 	if period > 3600 {
 		if period%3600 != 0 {
-			wrapErrMsg(c, "Period over 3600 must be a multiple of 3600")
+			wrapInvalidParam(c, "period", "Period over 3600 must be a multiple of 3600")
 		}
 	}
 	if period > 604800 {
-		wrapErrMsg(c, "Period must be less than 604800")
+		wrapInvalidParam(c, "period", "Period must be less than 604800")
 	}
 
 	if len(c.Errors) > 0 {
@@ -292,12 +499,30 @@ func (s *APIWebServer) queryPoolCandles(c *gin.Context) {
 
 func (s *APIWebServer) queryPoolList(c *gin.Context) {
 	chainId := parseChainParam(c, "chainId")
+	withTokens := parseBoolOptional(c, "withTokens", false)
+
+	if len(c.Errors) > 0 {
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=60")
+	if withTokens {
+		resp := s.Views.QueryPoolSetWithTokens(chainId)
+		wrapDataErrResp(c, resp, nil)
+	} else {
+		resp := s.Views.QueryPoolSet(chainId)
+		wrapDataErrResp(c, resp, nil)
+	}
+}
+
+func (s *APIWebServer) queryTokenList(c *gin.Context) {
+	chainId := parseChainParam(c, "chainId")
 
 	if len(c.Errors) > 0 {
 		return
 	}
 
-	resp := s.Views.QueryPoolSet(chainId)
+	resp := s.Views.QueryTokenList(chainId)
 	c.Header("Cache-Control", "public, max-age=60")
 	wrapDataErrResp(c, resp, nil)
 }
@@ -306,6 +531,8 @@ func (s *APIWebServer) queryAllPoolStats(c *gin.Context) {
 	chainId := parseChainParam(c, "chainId")
 	histTime := parseIntOptional(c, "histTime", 0)
 	with24hPrices := parseBoolOptional(c, "with24hPrices", false)
+	withTokens := parseBoolOptional(c, "withTokens", false)
+	withUsd := parseBoolOptional(c, "withUsd", false)
 
 	if histTime > 0 && with24hPrices {
 		wrapErrMsg(c, "Cannot specify both histTime and with24hPrices")
@@ -315,7 +542,14 @@ func (s *APIWebServer) queryAllPoolStats(c *gin.Context) {
 		return
 	}
 
-	resp := s.Views.QueryAllPoolStats(chainId, histTime, with24hPrices)
+	resp := s.Views.QueryAllPoolStats(chainId, histTime, with24hPrices, withUsd)
+	if withTokens {
+		for i := range resp {
+			if resp[i].AdditionalPoolStatsFields != nil && resp[i].PoolLocation != nil {
+				resp[i].Tokens = s.Views.QueryPoolTokens(*resp[i].PoolLocation)
+			}
+		}
+	}
 	c.Header("Cache-Control", "public, max-age=60")
 	wrapDataErrResp(c, resp, nil)
 }
@@ -323,12 +557,44 @@ func (s *APIWebServer) queryAllPoolStats(c *gin.Context) {
 func (s *APIWebServer) queryChainStats(c *gin.Context) {
 	chainId := parseChainParam(c, "chainId")
 	n := parseIntMaxParam(c, "n", 200)
+	withUsd := parseBoolOptional(c, "withUsd", false)
+
+	if len(c.Errors) > 0 {
+		return
+	}
+
+	resp := s.Views.QueryChainStats(chainId, n, withUsd)
+	c.Header("Cache-Control", "public, max-age=60")
+	wrapDataErrResp(c, resp, nil)
+}
+
+func (s *APIWebServer) queryTokenPrices(c *gin.Context) {
+	chainId := parseChainParam(c, "chainId")
+
+	if len(c.Errors) > 0 {
+		return
+	}
+
+	resp := s.Views.QueryTokenPrices(chainId)
+	c.Header("Cache-Control", "public, max-age=60")
+	wrapDataErrResp(c, resp, nil)
+}
+
+func (s *APIWebServer) queryTokenPriceHist(c *gin.Context) {
+	chainId := parseChainParam(c, "chainId")
+	token := parseAddrParam(c, "token")
+	period := parseIntParam(c, "period")
+	n := parseIntMaxParam(c, "n", 500)
+
+	if period < 300 {
+		wrapInvalidParam(c, "period", "Period must be at least 300")
+	}
 
 	if len(c.Errors) > 0 {
 		return
 	}
 
-	resp := s.Views.QueryChainStats(chainId, n)
+	resp := s.Views.QueryTokenPriceHist(chainId, token, period, n)
 	c.Header("Cache-Control", "public, max-age=60")
 	wrapDataErrResp(c, resp, nil)
 }
@@ -361,7 +627,7 @@ func (s *APIWebServer) queryUserPoolTxHist(c *gin.Context) {
 	if nStr != "" {
 		n, err = strconv.Atoi(nStr)
 		if err != nil {
-			wrapErrMsg(c, "Invalid int arg="+nStr)
+			wrapInvalidParam(c, "n", "Invalid int arg=%s", nStr)
 		}
 	}
 	afterTime, beforeTime := getTimeParameters(c)
@@ -388,6 +654,76 @@ func (s *APIWebServer) querySinglePosition(c *gin.Context) {
 	}
 
 	resp := s.Views.QuerySinglePosition(chainId, user, base, quote, poolIdx, bidTick, askTick)
+	wrapFoundResp(c, resp, "Position")
+}
+
+// Position by its positionId, for shareable links
+func (s *APIWebServer) queryPositionById(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		wrapMissingParam(c, "id")
+		return
+	}
+
+	resp, err := s.Views.QueryPositionById(id)
+	if err != nil {
+		wrapErrResp(c, err)
+		return
+	}
+	wrapFoundResp(c, resp, "Position")
+}
+
+func (s *APIWebServer) queryPositionAprHist(c *gin.Context) {
+	chainId := parseChainParam(c, "chainId")
+	user := parseAddrParam(c, "user")
+	base := parseAddrParam(c, "base")
+	quote := parseAddrParam(c, "quote")
+	poolIdx := parseIntParam(c, "poolIdx")
+	bidTick := parseIntParam(c, "bidTick")
+	askTick := parseIntParam(c, "askTick")
+
+	if len(c.Errors) > 0 {
+		return
+	}
+
+	resp := s.Views.QueryPositionAprHist(chainId, user, base, quote, poolIdx, bidTick, askTick)
+	c.Header("Cache-Control", "public, max-age=60")
+	wrapDataErrResp(c, resp, nil)
+}
+
+func (s *APIWebServer) queryPoolAprHist(c *gin.Context) {
+	chainId := parseChainParam(c, "chainId")
+	base := parseAddrParam(c, "base")
+	quote := parseAddrParam(c, "quote")
+	poolIdx := parseIntParam(c, "poolIdx")
+	period := parseIntParam(c, "period")
+	n := parseIntMaxParam(c, "n", 1000)
+
+	if period < 3600 || period%3600 != 0 {
+		wrapInvalidParam(c, "period", "Period must be a multiple of 3600")
+	}
+
+	if len(c.Errors) > 0 {
+		return
+	}
+
+	resp := s.Views.QueryPoolAprHist(chainId, base, quote, poolIdx, period, n)
+	c.Header("Cache-Control", "public, max-age=60")
+	wrapDataErrResp(c, resp, nil)
+}
+
+func (s *APIWebServer) queryPoolFeeHistory(c *gin.Context) {
+	chainId := parseChainParam(c, "chainId")
+	base := parseAddrParam(c, "base")
+	quote := parseAddrParam(c, "quote")
+	poolIdx := parseIntParam(c, "poolIdx")
+
+	if len(c.Errors) > 0 {
+		return
+	}
+
+	resp := s.Views.QueryPoolFeeHistory(chainId, base, quote, poolIdx)
+	c.Header("Cache-Control", "public, max-age=60")
 	wrapDataErrResp(c, resp, nil)
 }
 
@@ -408,7 +744,23 @@ func (s *APIWebServer) querySingleLimit(c *gin.Context) {
 
 	resp := s.Views.QuerySingleLimit(chainId, user, base, quote, poolIdx,
 		bidTick, askTick, isBid, pivotTime)
-	wrapDataErrResp(c, resp, nil)
+	wrapFoundResp(c, resp, "Limit order")
+}
+
+// Limit order by its limitOrderId
+func (s *APIWebServer) queryLimitById(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		wrapMissingParam(c, "id")
+		return
+	}
+
+	resp, err := s.Views.QueryLimitById(id)
+	if err != nil {
+		wrapErrResp(c, err)
+		return
+	}
+	wrapFoundResp(c, resp, "Limit order")
 }
 
 func getTimeParameters(c *gin.Context) (afterTime int, beforeTime int) {
@@ -424,7 +776,7 @@ func getTimeParameters(c *gin.Context) (afterTime int, beforeTime int) {
 	}
 
 	if afterTime > 0 && beforeTime > 0 && afterTime > beforeTime {
-		wrapErrMsg(c, "afterTime must be less than beforeTime")
+		wrapInvalidParam(c, "timeBefore", "afterTime must be less than beforeTime")
 		return
 	}
 	if afterTime > 0 && beforeTime == 0 {
@@ -433,6 +785,17 @@ func getTimeParameters(c *gin.Context) (afterTime int, beforeTime int) {
 	return
 }
 
+// Listings are only paged if the cursor param is present. It's passed empty for the first
+// page. Cursors page backwards from the newest element, so they can't be combined with a
+// time window.
+func parseCursorParam(c *gin.Context, afterTime int, beforeTime int) (cursor string, paged bool) {
+	cursor, paged = c.GetQuery("cursor")
+	if paged && (afterTime != 0 || beforeTime != 0) {
+		wrapErrMsg(c, "Cannot specify both cursor and time range")
+	}
+	return
+}
+
 func (s *APIWebServer) queryPlumeTask(c *gin.Context) {
 	task := c.Query("task")
 	user := types.ValidateEthAddr(c.Query("address"))
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/types"
+	"github.com/CrocSwap/graphcache-go/views"
+	"github.com/gin-gonic/gin"
+)
+
+// Views stub that records which queries were run. Queries that aren't overridden panic.
+type fakeViews struct {
+	views.IViews
+	calls     []string
+	syncing   map[types.ChainId]bool
+	positions []views.UserPosition // Returned by the pool position queries if set
+	lock      sync.Mutex           // Batch sub-queries run concurrently
+}
+
+func (v *fakeViews) record(call string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.calls = append(v.calls, call)
+}
+
+func (v *fakeViews) QueryChainSyncing(chainId types.ChainId) bool {
+	return v.syncing[chainId]
+}
+
+func (v *fakeViews) QueryUserTxHist(chainId types.ChainId, user types.EthAddress,
+	nResults int, afterTime int, beforeTime int) []views.UserTxHistory {
+	v.record("QueryUserTxHist")
+	return []views.UserTxHistory{}
+}
+
+func (v *fakeViews) QueryUserTxHistPage(chainId types.ChainId, user types.EthAddress,
+	nResults int, cursor string) ([]views.UserTxHistory, string, error) {
+	v.record("QueryUserTxHistPage:" + cursor)
+	if cursor == "bad" {
+		return nil, "", views.ErrInvalidCursor
+	}
+	return []views.UserTxHistory{}, "next", nil
+}
+
+func (v *fakeViews) QueryPoolTxHist(chainId types.ChainId, base types.EthAddress, quote types.EthAddress, poolIdx int,
+	nResults int, afterTime int, beforeTime int) []views.UserTxHistory {
+	v.record("QueryPoolTxHist")
+	return []views.UserTxHistory{}
+}
+
+func (v *fakeViews) QueryPoolTxHistPage(chainId types.ChainId, base types.EthAddress, quote types.EthAddress, poolIdx int,
+	nResults int, cursor string) ([]views.UserTxHistory, string, error) {
+	v.record("QueryPoolTxHistPage:" + cursor)
+	return []views.UserTxHistory{}, "", nil
+}
+
+func (v *fakeViews) QueryPoolPositions(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+	poolIdx int, nResults int, omitEmpty bool, afterTime int, beforeTime int) []views.UserPosition {
+	v.record("QueryPoolPositions")
+	if v.positions != nil {
+		return v.positions
+	}
+	return []views.UserPosition{}
+}
+
+func (v *fakeViews) QueryPoolPositionsPage(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+	poolIdx int, nResults int, omitEmpty bool, cursor string) ([]views.UserPosition, string, error) {
+	v.record("QueryPoolPositionsPage:" + cursor)
+	return []views.UserPosition{}, "next", nil
+}
+
+func (v *fakeViews) QueryTx(chainId types.ChainId, txHash types.EthTxHash) []views.UserTxHistory {
+	v.record("QueryTx:" + string(txHash))
+	if txHash != testTxHash {
+		return nil
+	}
+	return []views.UserTxHistory{{EventId: "tx_01"}, {EventId: "tx_02"}}
+}
+
+const testTxHash = "0x00000000000000000000000000000000000000000000000000000000000000aa"
+const testUser = "0x000000000000000000000000000000000000000c"
+const testPool = "chainId=0x1&base=0x000000000000000000000000000000000000000a" +
+	"&quote=0x000000000000000000000000000000000000000b&poolIdx=420"
+
+func testGet(t *testing.T, s *APIWebServer, path string) (int, map[string]json.RawMessage) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	s.router("gcgo", false).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Bad response body for %s: %s", path, rec.Body.String())
+	}
+	return rec.Code, body
+}
+
+func TestCursorOnlyWhenRequested(t *testing.T) {
+	cases := []struct {
+		path       string
+		call       string
+		nextCursor string // Empty if the response has none
+	}{
+		{"/gcgo/user_txs?chainId=0x1&user=" + testUser + "&n=10", "QueryUserTxHist", ""},
+		{"/gcgo/user_txs?chainId=0x1&user=" + testUser + "&n=10&cursor=", "QueryUserTxHistPage:", `"next"`},
+		{"/gcgo/user_txs?chainId=0x1&user=" + testUser + "&n=10&cursor=abc", "QueryUserTxHistPage:abc", `"next"`},
+		{"/gcgo/pool_txs?" + testPool + "&n=10", "QueryPoolTxHist", ""},
+		{"/gcgo/pool_txs?" + testPool + "&n=10&cursor=", "QueryPoolTxHistPage:", `""`},
+		{"/gcgo/pool_positions?" + testPool + "&n=10", "QueryPoolPositions", ""},
+		{"/gcgo/pool_positions?" + testPool + "&n=10&cursor=", "QueryPoolPositionsPage:", `"next"`},
+	}
+	for _, tc := range cases {
+		fake := &fakeViews{}
+		status, body := testGet(t, &APIWebServer{Views: fake}, tc.path)
+		if status != http.StatusOK || len(fake.calls) != 1 || fake.calls[0] != tc.call {
+			t.Errorf("%s: expected %s, got %d %v", tc.path, tc.call, status, fake.calls)
+		}
+		if string(body["nextCursor"]) != tc.nextCursor {
+			t.Errorf("%s: expected nextCursor %q, got %q", tc.path, tc.nextCursor, body["nextCursor"])
+		}
+	}
+}
+
+func TestCursorErrors(t *testing.T) {
+	cases := []struct {
+		path  string
+		param string
+	}{
+		{"/gcgo/user_txs?chainId=0x1&user=" + testUser + "&n=10&cursor=bad", "cursor"},
+		{"/gcgo/user_txs?chainId=0x1&user=" + testUser + "&n=10&cursor=&time=100", ""},
+		{"/gcgo/user_txs?chainId=0x1,0x2&user=" + testUser + "&n=10&cursor=", ""},
+		{"/gcgo/pool_positions?" + testPool + "&n=10&cursor=&timeBefore=100", ""},
+	}
+	for _, tc := range cases {
+		status, body := testGet(t, &APIWebServer{Views: &fakeViews{}}, tc.path)
+		var errBody errorBody
+		json.Unmarshal(body["error"], &errBody)
+		if status != http.StatusBadRequest || errBody.Param != tc.param {
+			t.Errorf("%s: expected 400 on %q, got %d %+v", tc.path, tc.param, status, errBody)
+		}
+	}
+}
+
+func TestFloatParamRejectsNonFinite(t *testing.T) {
+	for _, qty := range []string{"NaN", "nan", "Inf", "-Inf", "+Infinity", "1e400", "abc"} {
+		path := "/gcgo/swap_quote?" + testPool + "&isBuy=true&qty=" + qty
+		status, body := testGet(t, &APIWebServer{Views: &fakeViews{}}, path)
+		var errBody errorBody
+		json.Unmarshal(body["error"], &errBody)
+		if status != http.StatusBadRequest || errBody.Param != "qty" {
+			t.Errorf("qty=%s: expected 400 on qty, got %d %+v", qty, status, errBody)
+		}
+	}
+}
+
+func TestTxEndpoint(t *testing.T) {
+	cases := []struct {
+		path   string
+		status int
+		call   string // Empty if no query runs
+	}{
+		{"/gcgo/tx?chainId=0x1&txHash=" + testTxHash, http.StatusOK, "QueryTx:" + testTxHash},
+		// Hashes are matched in lower case
+		{"/gcgo/tx?chainId=0x1&txHash=0x00000000000000000000000000000000000000000000000000000000000000AA",
+			http.StatusOK, "QueryTx:" + testTxHash},
+		{"/gcgo/tx?chainId=0x1&txHash=0x00000000000000000000000000000000000000000000000000000000000000bb",
+			http.StatusNotFound, "QueryTx:0x00000000000000000000000000000000000000000000000000000000000000bb"},
+		{"/gcgo/tx?chainId=0x1&txHash=0xaa", http.StatusBadRequest, ""},
+		{"/gcgo/tx?chainId=0x1", http.StatusBadRequest, ""},
+	}
+	for _, tc := range cases {
+		fake := &fakeViews{}
+		status, body := testGet(t, &APIWebServer{Views: fake}, tc.path)
+		if status != tc.status || (tc.call == "" && len(fake.calls) > 0) ||
+			(tc.call != "" && (len(fake.calls) != 1 || fake.calls[0] != tc.call)) {
+			t.Errorf("%s: expected %d %q, got %d %v", tc.path, tc.status, tc.call, status, fake.calls)
+		}
+		if status == http.StatusOK {
+			var events []views.UserTxHistory
+			if json.Unmarshal(body["data"], &events); len(events) != 2 || events[0].EventId != "tx_01" {
+				t.Errorf("%s: expected the tx's events, got %s", tc.path, body["data"])
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/views"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const STREAM_PING_INTERVAL = 30 * time.Second
+const STREAM_WRITE_TIMEOUT = 10 * time.Second
+
+// Browsers send their page's origin on websocket upgrades but don't apply CORS to them, so
+// streams are only opened for the server's own host, allowed origins, or non-browser
+// clients that send no origin at all. "*" in the allowed origins accepts every origin.
+func (s *APIWebServer) checkStreamOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if slices.Contains(s.StreamOrigins, "*") || slices.ContainsFunc(s.StreamOrigins, func(allowed string) bool {
+		return strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin)
+	}) {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(parsed.Host, r.Host)
+}
+
+func (s *APIWebServer) upgradeStream(c *gin.Context) (*websocket.Conn, error) {
+	upgrader := websocket.Upgrader{CheckOrigin: s.checkStreamOrigin}
+	return upgrader.Upgrade(c.Writer, c.Request, nil)
+}
+
+type streamMessage struct {
+	// "tx" for an event, "resync" if events were dropped and the client should
+	// re-query the tx history endpoints before resuming.
+	Type string               `json:"type"`
+	Data *views.UserTxHistory `json:"data,omitempty"`
+}
+
+func (s *APIWebServer) streamPoolTxs(c *gin.Context) {
+	chainId := parseChainParam(c, "chainId")
+	base := parseAddrParam(c, "base")
+	quote := parseAddrParam(c, "quote")
+	poolIdx := parseIntParam(c, "poolIdx")
+	resume := parseStreamResume(c)
+
+	if len(c.Errors) > 0 {
+		return
+	}
+
+	conn, err := s.upgradeStream(c)
+	if err != nil {
+		log.Println("Websocket upgrade failed", err)
+		return
+	}
+
+	stream := s.Views.SubscribePoolTxs(chainId, base, quote, poolIdx, resume)
+	defer s.Views.CloseTxStream(stream)
+	serveTxStream(conn, stream)
+}
+
+func (s *APIWebServer) streamUserTxs(c *gin.Context) {
+	chainId := parseChainParam(c, "chainId")
+	user := parseAddrParam(c, "user")
+	resume := parseStreamResume(c)
+
+	if len(c.Errors) > 0 {
+		return
+	}
+
+	conn, err := s.upgradeStream(c)
+	if err != nil {
+		log.Println("Websocket upgrade failed", err)
+		return
+	}
+
+	stream := s.Views.SubscribeUserTxs(chainId, user, resume)
+	defer s.Views.CloseTxStream(stream)
+	serveTxStream(conn, stream)
+}
+
+func parseStreamResume(c *gin.Context) *views.TxStreamResume {
+	if c.Query("txTime") == "" {
+		return nil
+	}
+	return &views.TxStreamResume{
+		TxTime:    parseIntParam(c, "txTime"),
+		CallIndex: parseIntOptional(c, "callIndex", 0),
+	}
+}
+
+func serveTxStream(conn *websocket.Conn, stream *views.TxStream) {
+	defer conn.Close()
+
+	// Clients don't send anything, but the read loop is needed to process control
+	// frames and notice when the connection is closed.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(msg streamMessage) bool {
+		conn.SetWriteDeadline(time.Now().Add(STREAM_WRITE_TIMEOUT))
+		return conn.WriteJSON(msg) == nil
+	}
+
+	for i := range stream.Backfill {
+		if !send(streamMessage{Type: "tx", Data: &stream.Backfill[i]}) {
+			return
+		}
+	}
+	if stream.Truncated && !send(streamMessage{Type: "resync"}) {
+		return
+	}
+
+	ticker := time.NewTicker(STREAM_PING_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case tx, ok := <-stream.Events:
+			if !ok {
+				send(streamMessage{Type: "resync"})
+				return
+			}
+			if entry, isNew := stream.Tag(tx); isNew {
+				if !send(streamMessage{Type: "tx", Data: &entry}) {
+					return
+				}
+			}
+		case <-ticker.C:
+			deadline := time.Now().Add(STREAM_WRITE_TIMEOUT)
+			if conn.WriteControl(websocket.PingMessage, nil, deadline) != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
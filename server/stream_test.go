@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/types"
+	"github.com/CrocSwap/graphcache-go/views"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+type streamViews struct {
+	views.IViews
+	stream *views.TxStream
+}
+
+func (v *streamViews) SubscribePoolTxs(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+	poolIdx int, resume *views.TxStreamResume) *views.TxStream {
+	return v.stream
+}
+
+func (v *streamViews) CloseTxStream(stream *views.TxStream) {}
+
+func TestStreamOrigin(t *testing.T) {
+	s := &APIWebServer{StreamOrigins: []string{"https://app.example"}}
+	cases := []struct {
+		origin string
+		host   string
+		ok     bool
+	}{
+		{"", "api.example", true},
+		{"https://app.example", "api.example", true},
+		{"HTTPS://APP.EXAMPLE", "api.example", true},
+		{"https://api.example", "api.example", true},
+		{"https://evil.example", "api.example", false},
+		{"https://app.example.evil.example", "api.example", false},
+		{"null", "api.example", false},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = tc.host
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		if s.checkStreamOrigin(req) != tc.ok {
+			t.Errorf("Origin %q on host %q expected allowed=%v", tc.origin, tc.host, tc.ok)
+		}
+	}
+
+	s.StreamOrigins = []string{"*"}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	if !s.checkStreamOrigin(req) {
+		t.Error("Wildcard should allow any origin")
+	}
+}
+
+func TestStreamHandshake(t *testing.T) {
+	events := make(chan types.PoolTxEvent)
+	fake := &streamViews{stream: &views.TxStream{
+		Backfill:  []views.UserTxHistory{{EventId: "backfilled"}},
+		Truncated: true,
+		Events:    events,
+	}}
+	s := &APIWebServer{Views: fake, StreamOrigins: []string{"https://app.example"}}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/pool_txs_stream", s.streamPoolTxs)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/pool_txs_stream?chainId=0x1&base=0x0000000000000000000000000000000000000000" +
+		"&quote=0x0000000000000000000000000000000000000001&poolIdx=420&txTime=1"
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example"}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected cross-site handshake to be rejected, got %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://app.example"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var msg struct {
+		Type string
+		Data struct {
+			TxId string
+		}
+	}
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "tx" || msg.Data.TxId != "backfilled" {
+		t.Fatalf("Expected backfilled tx, got %+v %v", msg, err)
+	}
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "resync" {
+		t.Fatalf("Expected resync after truncated backfill, got %+v %v", msg, err)
+	}
+	close(events)
+}
@@ -1,11 +1,14 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/CrocSwap/graphcache-go/types"
+	"github.com/CrocSwap/graphcache-go/views"
 	"github.com/gin-gonic/gin"
 )
 
@@ -15,11 +18,21 @@ type responseProvenance struct {
 }
 
 type fullResponse struct {
-	Data     any                `json:"data"`
-	Metadata responseProvenance `json:"provenance"`
+	Data       any                `json:"data"`
+	Metadata   responseProvenance `json:"provenance"`
+	NextCursor *string            `json:"nextCursor,omitempty"`
 }
 
 func wrapDataResp(c *gin.Context, result any) {
+	writeDataResp(c, result, nil)
+}
+
+func writeDataResp(c *gin.Context, result any, nextCursor *string) {
+	if batched := batchResultOf(c); batched != nil {
+		batched.Status, batched.Data, batched.NextCursor = http.StatusOK, result, nextCursor
+		return
+	}
+
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "getHostnameError"
@@ -30,30 +43,118 @@ func wrapDataResp(c *gin.Context, result any) {
 		ServeTime: int(time.Now().UnixMilli()),
 	}
 
-	c.JSON(http.StatusOK, fullResponse{Data: result, Metadata: prov})
+	c.JSON(http.StatusOK, fullResponse{Data: result, Metadata: prov, NextCursor: nextCursor})
 }
 
 func wrapDataErrResp(c *gin.Context, result any, err error) {
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		wrapErrResp(c, err)
 	} else {
 		wrapDataResp(c, result)
 	}
 }
 
-func wrapErrResp(c *gin.Context, err error) {
-	c.String(http.StatusInternalServerError, err.Error())
+// Paged listings also return the cursor for the next page. An empty cursor is still
+// returned so clients can tell the listing is exhausted.
+func wrapPagedResp(c *gin.Context, result any, next string, err error) {
+	if err != nil {
+		wrapErrResp(c, err)
+	} else {
+		writeDataResp(c, result, &next)
+	}
+}
+
+// Same as wrapDataResp, but a nil result is returned as a 404
+func wrapFoundResp[T any](c *gin.Context, result *T, what string) {
+	if result == nil {
+		wrapApiErr(c, &apiError{http.StatusNotFound, "not_found", what + " not found", ""})
+	} else {
+		wrapDataResp(c, result)
+	}
+}
+
+// Error with its HTTP status and a stable code for clients to match on. Param is the
+// request parameter at fault, if any.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+	Param   string
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+}
+
+type errorResponse struct {
+	Error    errorBody          `json:"error"`
+	Metadata responseProvenance `json:"provenance"`
+}
+
+// Every error is recorded on the context, so handlers can check c.Errors after parsing
+// all their parameters. Only the first is written to the response.
+func wrapApiErr(c *gin.Context, err *apiError) {
 	c.Error(err)
+	if batched := batchResultOf(c); batched != nil {
+		if batched.Error == nil {
+			batched.Status, batched.Error = err.Status, &errorBody{err.Code, err.Message, err.Param}
+		}
+		c.Abort()
+		return
+	}
+	if c.Writer.Written() {
+		return
+	}
+
+	hostname, hostErr := os.Hostname()
+	if hostErr != nil {
+		hostname = "getHostnameError"
+	}
+
+	prov := responseProvenance{
+		Hostname:  hostname,
+		ServeTime: int(time.Now().UnixMilli()),
+	}
+
+	c.AbortWithStatusJSON(err.Status, errorResponse{
+		Error:    errorBody{err.Code, err.Message, err.Param},
+		Metadata: prov,
+	})
+}
+
+func wrapErrResp(c *gin.Context, err error) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		wrapApiErr(c, apiErr)
+	} else if errors.Is(err, views.ErrInvalidCursor) {
+		wrapApiErr(c, &apiError{http.StatusBadRequest, "invalid_param", err.Error(), "cursor"})
+	} else if errors.Is(err, views.ErrInvalidId) {
+		wrapApiErr(c, &apiError{http.StatusBadRequest, "invalid_param", err.Error(), "id"})
+	} else {
+		wrapApiErr(c, &apiError{http.StatusInternalServerError, "internal_error", err.Error(), ""})
+	}
 }
 
+// Request errors that aren't down to a single parameter
 func wrapErrMsg(c *gin.Context, err string) {
-	wrapErrResp(c, fmt.Errorf(err))
+	wrapApiErr(c, &apiError{http.StatusBadRequest, "invalid_request", err, ""})
 }
 
-func wrapErrMsgFmt(c *gin.Context, err string, a ...any) {
-	wrapErrResp(c, fmt.Errorf(err+". ", a...))
+func wrapInvalidParam(c *gin.Context, paramName string, err string, a ...any) {
+	wrapApiErr(c, &apiError{http.StatusBadRequest, "invalid_param", fmt.Sprintf(err, a...), paramName})
 }
 
 func wrapMissingParam(c *gin.Context, paramName string) {
-	wrapErrMsgFmt(c, "Missing parameter=%s", paramName)
+	wrapApiErr(c, &apiError{http.StatusBadRequest, "missing_param", "Missing parameter=" + paramName, paramName})
+}
+
+func wrapChainSyncing(c *gin.Context, chainId types.ChainId) {
+	wrapApiErr(c, &apiError{http.StatusServiceUnavailable, "syncing",
+		fmt.Sprintf("Chain %s is still syncing", chainId), "chainId"})
 }
@@ -2,6 +2,7 @@ package types
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/hex"
 	"log"
 	"strconv"
@@ -67,3 +68,14 @@ func intToHex(num int) string {
 func IntToChainId(num int) ChainId {
 	return ChainId(intToHex(num))
 }
+
+// Orders chain IDs by their numeric value, since the hex strings sort 0x10 before 0x2. IDs
+// that don't parse fall back to string order.
+func CompareChainIds(a ChainId, b ChainId) int {
+	aNum, aErr := strconv.ParseUint(strings.TrimPrefix(string(a), "0x"), 16, 64)
+	bNum, bErr := strconv.ParseUint(strings.TrimPrefix(string(b), "0x"), 16, 64)
+	if aErr != nil || bErr != nil {
+		return cmp.Compare(a, b)
+	}
+	return cmp.Or(cmp.Compare(aNum, bNum), cmp.Compare(a, b))
+}
@@ -10,21 +10,26 @@ type UserBalance struct {
 type TokenMetadata struct {
 	Decimals int    `json:"decimals"`
 	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
 }
 
 type TokenPairMetadata struct {
 	BaseDecimals  int    `json:"baseDecimals"`
 	BaseSymbol    string `json:"baseSymbol"`
+	BaseName      string `json:"baseName"`
 	QuoteDecimals int    `json:"quoteDecimals"`
 	QuoteSymbol   string `json:"quoteSymbol"`
+	QuoteName     string `json:"quoteName"`
 }
 
 func PairTokenMetadata(base TokenMetadata, quote TokenMetadata) TokenPairMetadata {
 	return TokenPairMetadata{
 		BaseSymbol:    base.Symbol,
 		BaseDecimals:  base.Decimals,
+		BaseName:      base.Name,
 		QuoteSymbol:   quote.Symbol,
 		QuoteDecimals: quote.Decimals,
+		QuoteName:     quote.Name,
 	}
 }
 
@@ -12,9 +12,15 @@ type TokenDexAgg struct {
 	DexFees    float64          `json:"dexFees"`
 	DexTvl     float64          `json:"dexTvl"`
 	LatestTime int              `json:"latestTime"`
+
+	// Optional, only set when requested and the token has a USD price
+	UsdPrice     *float64 `json:"usdPrice,omitempty"`
+	DexTvlUsd    *float64 `json:"dexTvlUsd,omitempty"`
+	DexVolumeUsd *float64 `json:"dexVolumeUsd,omitempty"`
+	DexFeesUsd   *float64 `json:"dexFeesUsd,omitempty"`
 }
 
-func (v *Views) QueryChainStats(chainId types.ChainId, nResults int) []TokenDexAgg {
+func (v *Views) QueryChainStats(chainId types.ChainId, nResults int, withUsd bool) []TokenDexAgg {
 
 	poolAggs := v.Cache.RetrieveChainAccums(chainId)
 	basin := make(map[types.EthAddress]*TokenDexAgg, 0)
@@ -47,6 +53,21 @@ func (v *Views) QueryChainStats(chainId types.ChainId, nResults int) []TokenDexA
 		quoteAgg.DexFees += poolAgg.QuoteFees
 	}
 
+	if withUsd && v.Prices != nil {
+		weiPrices := v.Prices.WeiPrices(chainId)
+		for token, tokenAgg := range basin {
+			if weiPrice, ok := weiPrices[token]; ok {
+				tvlUsd := tokenAgg.DexTvl * weiPrice
+				volumeUsd := tokenAgg.DexVolume * weiPrice
+				feesUsd := tokenAgg.DexFees * weiPrice
+				tokenAgg.DexTvlUsd = &tvlUsd
+				tokenAgg.DexVolumeUsd = &volumeUsd
+				tokenAgg.DexFeesUsd = &feesUsd
+				tokenAgg.UsdPrice = v.Prices.TokenPrice(chainId, token, weiPrices)
+			}
+		}
+	}
+
 	collected := make([]TokenDexAgg, 0)
 	for _, tokenAgg := range basin {
 		collected = append(collected, *tokenAgg)
@@ -12,8 +12,10 @@ import (
 type PoolStats struct {
 	*AdditionalPoolStatsFields // Optional, only set when all pool stats are requested
 	model.AccumPoolStats
-	InitTime int `json:"initTime"`
-	Events   int `json:"events"`
+	InitTime int                      `json:"initTime"`
+	Events   int                      `json:"events"`
+	Tokens   *types.TokenPairMetadata `json:"tokens,omitempty"` // Optional, only set when requested
+	Usd      *PoolUsdStats            `json:"usd,omitempty"`    // Optional, only set when requested
 }
 
 type AdditionalPoolStatsFields struct {
@@ -28,7 +30,7 @@ type AdditionalPoolStatsFields struct {
 }
 
 func (v *Views) QueryPoolStats(chainId types.ChainId,
-	base types.EthAddress, quote types.EthAddress, poolIdx int, with24hPrices bool) PoolStats {
+	base types.EthAddress, quote types.EthAddress, poolIdx int, with24hPrices bool, withUsd bool) PoolStats {
 
 	loc := types.PoolLocation{
 		ChainId: chainId,
@@ -45,9 +47,10 @@ func (v *Views) QueryPoolStats(chainId types.ChainId,
 		AccumPoolStats: accum,
 		Events:         eventCount,
 	}
+	v.applyFeeHistToStats(loc, &stats, int(time.Now().Unix()))
 
 	if with24hPrices {
-		stats24hAgo := v.QueryPoolStatsFrom(chainId, base, quote, poolIdx, int(time.Now().Unix())-24*3600)
+		stats24hAgo := v.QueryPoolStatsFrom(chainId, base, quote, poolIdx, int(time.Now().Unix())-24*3600, false)
 		stats.AdditionalPoolStatsFields = &AdditionalPoolStatsFields{
 			PriceSwap24hAgo:   &stats24hAgo.LastPriceSwap,
 			PriceLiq24hAgo:    &stats24hAgo.LastPriceLiq,
@@ -59,11 +62,15 @@ func (v *Views) QueryPoolStats(chainId types.ChainId,
 		}
 	}
 
+	if withUsd && v.Prices != nil {
+		stats.Usd = v.Prices.poolUsdStats(loc, stats, v.Prices.WeiPrices(chainId))
+	}
+
 	return stats
 }
 
 func (v *Views) QueryPoolStatsFrom(chainId types.ChainId,
-	base types.EthAddress, quote types.EthAddress, poolIdx int, histTime int) PoolStats {
+	base types.EthAddress, quote types.EthAddress, poolIdx int, histTime int, withUsd bool) PoolStats {
 
 	loc := types.PoolLocation{
 		ChainId: chainId,
@@ -74,11 +81,18 @@ func (v *Views) QueryPoolStatsFrom(chainId types.ChainId,
 	accum, eventCount := v.Cache.RetrievePoolAccumBefore(loc, histTime)
 	firstAccum := v.Cache.RetrievePoolAccumFirst(loc)
 
-	return PoolStats{
+	stats := PoolStats{
 		InitTime:       firstAccum.LatestTime,
 		AccumPoolStats: accum,
 		Events:         eventCount,
 	}
+	v.applyFeeHistToStats(loc, &stats, histTime)
+
+	if withUsd && v.Prices != nil {
+		stats.Usd = v.Prices.poolUsdStats(loc, stats, v.Prices.WeiPricesAt(chainId, histTime))
+	}
+
+	return stats
 }
 
 type CandleRangeArgs struct {
@@ -108,7 +122,9 @@ func (v *Views) QueryPoolCandles(chainId types.ChainId, base types.EthAddress, q
 	endTime = endTime - endTime%timeRange.Period
 
 	if timeRange.Period >= 3600 && timeRange.Period%3600 == 0 {
-		return v.fastHourlyCandles(loc, timeRange, startTime, endTime)
+		candles := v.fastHourlyCandles(loc, timeRange, startTime, endTime)
+		v.applyFeeHistToCandles(loc, candles)
+		return candles
 	}
 
 	start := time.Now()
@@ -128,6 +144,7 @@ func (v *Views) QueryPoolCandles(chainId types.ChainId, base types.EthAddress, q
 		log.Println("Slow buildCandles:", diff)
 	}
 	candles := builder.Close(endTime)
+	v.applyFeeHistToCandles(loc, candles)
 	return candles
 }
 
@@ -210,16 +227,29 @@ func (v *Views) QueryPoolSet(chainId types.ChainId) []types.PoolLocation {
 	return poolSet
 }
 
-func (v *Views) QueryAllPoolStats(chainId types.ChainId, histTime int, with24hPrices bool) (result []PoolStats) {
+func (v *Views) QueryAllPoolStats(chainId types.ChainId, histTime int, with24hPrices bool, withUsd bool) (result []PoolStats) {
 	fullSet := v.Cache.RetrievePoolSet()
 
+	// Prices are routed once for all pools rather than per pool
+	var weiPrices map[types.EthAddress]float64
+	if withUsd && v.Prices != nil {
+		if histTime <= 0 {
+			weiPrices = v.Prices.WeiPrices(chainId)
+		} else {
+			weiPrices = v.Prices.WeiPricesAt(chainId, histTime)
+		}
+	}
+
 	for _, pool := range fullSet {
 		if pool.ChainId == chainId {
 			var stats PoolStats
 			if histTime <= 0 {
-				stats = v.QueryPoolStats(pool.ChainId, pool.Base, pool.Quote, pool.PoolIdx, with24hPrices)
+				stats = v.QueryPoolStats(pool.ChainId, pool.Base, pool.Quote, pool.PoolIdx, with24hPrices, false)
 			} else {
-				stats = v.QueryPoolStatsFrom(pool.ChainId, pool.Base, pool.Quote, pool.PoolIdx, histTime)
+				stats = v.QueryPoolStatsFrom(pool.ChainId, pool.Base, pool.Quote, pool.PoolIdx, histTime, false)
+			}
+			if weiPrices != nil {
+				stats.Usd = v.Prices.poolUsdStats(pool, stats, weiPrices)
 			}
 			if stats.AdditionalPoolStatsFields == nil {
 				stats.AdditionalPoolStatsFields = &AdditionalPoolStatsFields{}
@@ -0,0 +1,88 @@
+package views
+
+import (
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+// Weight of the latest point in the smoothed APR
+const APR_SMOOTHING_ALPHA = 0.2
+
+type AprPoint struct {
+	Time        int     `json:"time"`
+	Apr         float64 `json:"apr"`
+	AprSmoothed float64 `json:"aprSmoothed"`
+}
+
+func (v *Views) QueryPositionAprHist(chainId types.ChainId, user types.EthAddress,
+	base types.EthAddress, quote types.EthAddress, poolIdx int, bidTick int, askTick int) []AprPoint {
+	loc := types.PoolLocation{
+		ChainId: chainId,
+		PoolIdx: poolIdx,
+		Base:    base,
+		Quote:   quote,
+	}
+
+	for posLoc := range v.Cache.RetrieveUserPoolPositions(user, loc) {
+		if posLoc.BidTick == bidTick && posLoc.AskTick == askTick {
+			return formAprPoints(v.Cache.RetrievePositionAprs(posLoc))
+		}
+	}
+	return []AprPoint{}
+}
+
+// Fee APR of the pool over each of the last n periods, oldest first. Periods before the
+// pool's first event are left out.
+func (v *Views) QueryPoolAprHist(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+	poolIdx int, period int, n int) []AprPoint {
+	loc := types.PoolLocation{
+		ChainId: chainId,
+		PoolIdx: poolIdx,
+		Base:    base,
+		Quote:   quote,
+	}
+
+	endTime := int(time.Now().Unix())
+	endTime = endTime - endTime%period
+
+	snaps := make([]model.AprSnap, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		closeTime := endTime - i*period
+		close, eventCount := v.Cache.RetrievePoolAccumBefore(loc, closeTime)
+		if eventCount == 0 {
+			continue
+		}
+		open, _ := v.Cache.RetrievePoolAccumBefore(loc, closeTime-period)
+		snaps = append(snaps, model.AprSnap{Time: closeTime, Apr: model.PoolFeeApr(open, close, period)})
+	}
+	return formAprPoints(snaps)
+}
+
+// Smoothed APR over the position's recorded history, with the current estimate as the
+// latest point. Keeps a single spike in fees from putting a position at the top.
+func (v *Views) smoothedPositionApr(pos UserPosition) float64 {
+	snaps := v.Cache.RetrievePositionAprs(pos.PositionLocation)
+	aprs := make([]float64, 0, len(snaps)+1)
+	for _, snap := range snaps {
+		aprs = append(aprs, snap.Apr)
+	}
+	aprs = append(aprs, pos.APRCalcResult.Apr)
+	smoothed := model.SmoothAprs(aprs, APR_SMOOTHING_ALPHA)
+	return smoothed[len(smoothed)-1]
+}
+
+func formAprPoints(snaps []model.AprSnap) []AprPoint {
+	aprs := make([]float64, len(snaps))
+	for i, snap := range snaps {
+		aprs[i] = snap.Apr
+	}
+	smoothed := model.SmoothAprs(aprs, APR_SMOOTHING_ALPHA)
+
+	points := make([]AprPoint, len(snaps))
+	for i, snap := range snaps {
+		points[i] = AprPoint{Time: snap.Time, Apr: snap.Apr, AprSmoothed: smoothed[i]}
+	}
+	return points
+}
@@ -0,0 +1,47 @@
+package views
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestApyLeadersUseAprHistory(t *testing.T) {
+	pool := types.PoolLocation{ChainId: "0x1", Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420}
+	mintTime := int(time.Now().Unix()) - 3600*24*365
+	c := cache.New()
+	openPos := func(user types.EthAddress) (types.PositionLocation, *model.PositionTracker) {
+		book := types.BookLocation{PoolLocation: pool, LiquidityLocation: types.RangeLiquidityLocation(-100, 100)}
+		loc := book.ToPositionLocation(user)
+		pos := c.MaterializePosition(loc)
+		pos.ConcLiq.SetInt64(1000)
+		pos.LiqHist.Hist = []model.LiquidityDelta{{Time: mintTime, LiqChange: 1000}}
+		return loc, pos
+	}
+
+	// A had a high APR for a while and then a single period with no rewards
+	locA, posA := openPos("0xcccc")
+	posA.RewardLiq.SetInt64(1e9)
+	for snapTime := 1000; snapTime <= 3000; snapTime += 1000 {
+		c.RecordPositionAprs(snapTime, 0)
+	}
+	posA.RewardLiq.SetInt64(0)
+
+	locB, posB := openPos("0xdddd")
+	posB.RewardLiq.SetInt64(1)
+	if apr := posB.CalcAPR(locB).Apr; apr <= 0 || apr >= 1 {
+		t.Fatalf("Bad test setup, B APR %f", apr)
+	}
+
+	v := Views{Cache: c}
+	leaders := v.QueryPoolApyLeaders(pool.ChainId, pool.Base, pool.Quote, pool.PoolIdx, 10, true)
+	if len(leaders) != 2 || leaders[0].User != locA.User {
+		t.Fatalf("Expected A to lead on its smoothed APR, got %+v", leaders)
+	}
+	if leaders[0].APRCalcResult.Apr != 0 || leaders[0].AprSmoothed == nil || *leaders[0].AprSmoothed != 8 {
+		t.Fatalf("Bad smoothed APR for A %+v", leaders[0])
+	}
+}
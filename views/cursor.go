@@ -0,0 +1,48 @@
+package views
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursors are opaque to clients: base64 of the varint time and call index followed by
+// the element hash. Empty string means the start (for requests) or the end (for responses).
+func encodeCursor(cursor *cache.ArrayCursor) string {
+	if cursor == nil {
+		return ""
+	}
+	buf := make([]byte, 0, 2*binary.MaxVarintLen64+32)
+	buf = binary.AppendVarint(buf, int64(cursor.Time))
+	buf = binary.AppendVarint(buf, int64(cursor.CallIndex))
+	buf = append(buf, cursor.Hash[:]...)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decodeCursor(cursor string) (*cache.ArrayCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	txTime, n := binary.Varint(raw)
+	if n <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	raw = raw[n:]
+	callIndex, n := binary.Varint(raw)
+	if n <= 0 || len(raw[n:]) != 32 {
+		return nil, ErrInvalidCursor
+	}
+
+	result := &cache.ArrayCursor{Time: int(txTime), CallIndex: int(callIndex)}
+	copy(result.Hash[:], raw[n:])
+	return result, nil
+}
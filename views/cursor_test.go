@@ -0,0 +1,112 @@
+package views
+
+import (
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/tables"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := &cache.ArrayCursor{Time: 1700000000, CallIndex: -3, Hash: [32]byte{1, 2, 3}}
+	decoded, err := decodeCursor(encodeCursor(cursor))
+	if err != nil || *decoded != *cursor {
+		t.Fatalf("Bad round trip %+v %v", decoded, err)
+	}
+	if decoded, err := decodeCursor(""); decoded != nil || err != nil {
+		t.Fatal("Empty cursor should start from the newest element")
+	}
+	for _, bad := range []string{"!!", "AA", encodeCursor(cursor) + "AA"} {
+		if _, err := decodeCursor(bad); err != ErrInvalidCursor {
+			t.Fatalf("Expected invalid cursor for %q", bad)
+		}
+	}
+}
+
+func TestPoolTxHistPages(t *testing.T) {
+	pool := types.PoolLocation{ChainId: "0x1", Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420}
+	c := cache.New()
+	// Several events share each timestamp, so page boundaries fall inside a block
+	for i := 0; i < 20; i++ {
+		c.AddPoolEvent(types.PoolTxEvent{
+			EthTxHeader:  types.EthTxHeader{TxTime: 100 + i/4, TxHash: "0x01", User: "0xcccc", CallIndex: i % 4},
+			PoolLocation: pool,
+		})
+	}
+	v := Views{Cache: c}
+
+	unpaged := v.QueryPoolTxHist(pool.ChainId, pool.Base, pool.Quote, pool.PoolIdx, 100, 0, 0)
+	// Including a page size that divides the events, so the last page is full
+	for _, n := range []int{3, 4} {
+		var paged []UserTxHistory
+		cursor := ""
+		for i := 0; ; i++ {
+			page, next, err := v.QueryPoolTxHistPage(pool.ChainId, pool.Base, pool.Quote, pool.PoolIdx, n, cursor)
+			if err != nil || i > 10 {
+				t.Fatalf("Paging didn't finish %v", err)
+			}
+			if len(page) == 0 {
+				t.Fatalf("Cursor pointed to an empty page at %d", len(paged))
+			}
+			paged = append(paged, page...)
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+
+		if len(paged) != len(unpaged) {
+			t.Fatalf("Expected %d events across pages, got %d", len(unpaged), len(paged))
+		}
+		for i := range paged {
+			if paged[i].EventId != unpaged[i].EventId {
+				t.Fatalf("Page order differs at %d: %+v vs %+v", i, paged[i].PoolTxEvent, unpaged[i].PoolTxEvent)
+			}
+		}
+	}
+}
+
+func TestPoolPositionPages(t *testing.T) {
+	pool := types.PoolLocation{ChainId: "0x1", Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420}
+	c := cache.New()
+	for i := 0; i < 7; i++ {
+		loc := types.PositionLocation{PoolLocation: pool, LiquidityLocation: types.RangeLiquidityLocation(-100*i, 100), User: "0xcccc"}
+		loc.CachedHash = loc.Hash(nil)
+		c.MaterializePosition(loc).UpdatePosition(tables.LiqChange{Time: 100 + i/2, ChangeType: tables.ChangeTypeHarvest,
+			PositionType: tables.PosTypeConcentrated})
+	}
+	v := Views{Cache: c}
+
+	seen := make(map[string]bool)
+	cursor := ""
+	for i := 0; ; i++ {
+		page, next, err := v.QueryPoolPositionsPage(pool.ChainId, pool.Base, pool.Quote, pool.PoolIdx, 2, false, cursor)
+		if err != nil || i > 10 {
+			t.Fatalf("Paging didn't finish %v", err)
+		}
+		for _, pos := range page {
+			if seen[pos.PositionId] {
+				t.Fatalf("Position %s returned twice", pos.PositionId)
+			}
+			seen[pos.PositionId] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != 7 {
+		t.Fatalf("Expected 7 positions across pages, got %d", len(seen))
+	}
+
+	// Exactly a page left has no next page
+	page, next, err := v.QueryPoolPositionsPage(pool.ChainId, pool.Base, pool.Quote, pool.PoolIdx, 7, false, "")
+	if len(page) != 7 || next != "" || err != nil {
+		t.Fatalf("Expected one full page, got %d positions and cursor %q", len(page), next)
+	}
+
+	if _, _, err := v.QueryPoolPositionsPage(pool.ChainId, pool.Base, pool.Quote, pool.PoolIdx, 2, false, "!!"); err != ErrInvalidCursor {
+		t.Fatal("Expected invalid cursor error")
+	}
+}
@@ -30,6 +30,29 @@ func (v *Views) QueryPoolLiquidityCurve(chainId types.ChainId,
 	}
 }
 
+// Curve as of histTime, or histBlock if non-zero, rebuilt from the pool's history
+func (v *Views) QueryPoolLiquidityCurveAt(chainId types.ChainId, base types.EthAddress,
+	quote types.EthAddress, poolIdx int, histTime int, histBlock int) PoolLiqCurve {
+	loc := types.PoolLocation{
+		ChainId: chainId,
+		PoolIdx: poolIdx,
+		Base:    base,
+		Quote:   quote,
+	}
+	curve := v.Cache.RetrievePoolLiqCurveAt(loc, histTime, histBlock)
+
+	bumps := make([]*model.LiquidityBump, 0, len(curve.Bumps))
+	for _, bump := range curve.Bumps {
+		bumps = append(bumps, bump)
+	}
+	sort.Sort(byTick(bumps))
+
+	return PoolLiqCurve{
+		AmbientLiq: curve.AmbientLiq,
+		Bumps:      bumps,
+	}
+}
+
 type byTick []*model.LiquidityBump
 
 func (a byTick) Len() int      { return len(a) }
@@ -38,3 +61,27 @@ func (a byTick) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
 func (a byTick) Less(i, j int) bool {
 	return a[i].Tick < a[j].Tick
 }
+
+func (v *Views) QuerySwapQuote(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+	poolIdx int, isBuy bool, qty float64) model.SwapQuote {
+	loc := types.PoolLocation{
+		ChainId: chainId,
+		PoolIdx: poolIdx,
+		Base:    base,
+		Quote:   quote,
+	}
+	accum, _ := v.Cache.RetrievePoolAccum(loc)
+	return v.Cache.SimulatePoolSwap(loc, accum.LastPriceIndic, accum.FeeRate, isBuy, qty)
+}
+
+func (v *Views) QueryPoolDepth(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+	poolIdx int, bucketTicks int, nBuckets int) model.CurveDepth {
+	loc := types.PoolLocation{
+		ChainId: chainId,
+		PoolIdx: poolIdx,
+		Base:    base,
+		Quote:   quote,
+	}
+	accum, _ := v.Cache.RetrievePoolAccum(loc)
+	return v.Cache.RetrievePoolDepth(loc, accum.LastPriceIndic, bucketTicks, nBuckets)
+}
@@ -0,0 +1,37 @@
+package views
+
+import (
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func (v *Views) QueryPoolFeeHistory(chainId types.ChainId, base types.EthAddress,
+	quote types.EthAddress, poolIdx int) []model.FeeRateChange {
+	loc := types.PoolLocation{
+		ChainId: chainId,
+		PoolIdx: poolIdx,
+		Base:    base,
+		Quote:   quote,
+	}
+	hist := v.Cache.RetrievePoolFeeHist(loc)
+	if hist == nil {
+		return []model.FeeRateChange{}
+	}
+	return hist.Series()
+}
+
+// The fee rate in the accumulated stats only changes on the next agg event, so the rate
+// at the exact time is taken from the fee history when there is one
+func (v *Views) applyFeeHistToStats(loc types.PoolLocation, stats *PoolStats, time int) {
+	if hist := v.Cache.RetrievePoolFeeHist(loc); hist != nil {
+		if rate, ok := hist.RateAt(time); ok {
+			stats.FeeRate = rate
+		}
+	}
+}
+
+func (v *Views) applyFeeHistToCandles(loc types.PoolLocation, candles []model.Candle) {
+	if hist := v.Cache.RetrievePoolFeeHist(loc); hist != nil {
+		hist.ApplyToCandles(candles)
+	}
+}
@@ -22,6 +22,7 @@ type userLimitExtras struct {
 	LimitId          string  `json:"limitOrderId"`
 	ClaimableLiq     big.Int `json:"claimableLiq"`
 	CrossTime        int     `json:"crossTime"`
+	FeeMileage       float64 `json:"feeMileage"`
 	LatestUpdateTime int     `json:"latestUpdateTime"`
 	TimeFirstMint    int     `json:"timeFirstMint"`
 }
@@ -143,7 +144,7 @@ func unrollSubplot(pos types.PositionLocation, subplot *model.KnockoutSubplot) [
 		if !claim.IsEmpty() {
 			claimLoc := pos.ToClaimLoc(pivotTime)
 
-			crossTime, ok := subplot.GetCrossForPivotTime(pivotTime)
+			cross, ok := subplot.GetCrossForPivotTime(pivotTime)
 			if !ok {
 				log.Fatalf("PivotTime=%d missing cross time", pivotTime)
 			}
@@ -155,7 +156,8 @@ func unrollSubplot(pos types.PositionLocation, subplot *model.KnockoutSubplot) [
 				},
 				userLimitExtras{
 					LimitId:          formLimitId(claimLoc),
-					CrossTime:        crossTime,
+					CrossTime:        cross.CrossTime,
+					FeeMileage:       cross.FeeMileage,
 					ClaimableLiq:     claim.ConcLiq,
 					LatestUpdateTime: subplot.LatestUpdateTime,
 					TimeFirstMint:    subplot.Liq.TimeFirstMint,
@@ -171,6 +173,25 @@ func formLimitId(loc types.KOClaimLocation) string {
 	return "limit_" + hex.EncodeToString(hash[:])
 }
 
+// Nil if no limit order has the ID, including orders that have been fully claimed
+func (v *Views) QueryLimitById(id string) (*UserLimitOrder, error) {
+	hash, err := parseEntityId(id, "limit_")
+	if err != nil {
+		return nil, err
+	}
+	claim, subplot, ok := v.Cache.RetrieveLimitById(hash)
+	if !ok {
+		return nil, nil
+	}
+	// Matched on the decoded hash, since the ID's hex may be in either case
+	for _, order := range unrollSubplot(claim.PositionLocation, subplot) {
+		if order.KOClaimLocation.Hash(nil) == hash {
+			return &order, nil
+		}
+	}
+	return nil, nil
+}
+
 type byTimeLO []UserLimitOrder
 
 func (a byTimeLO) Len() int      { return len(a) }
@@ -0,0 +1,65 @@
+package views
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/tables"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestQueryLimitById(t *testing.T) {
+	pool := types.PoolLocation{ChainId: "0x1", Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420}
+	book := types.BookLocation{PoolLocation: pool, LiquidityLocation: types.KnockoutRangeLocation(-64, 0, true)}
+	loc := book.ToPositionLocation("0xcccc")
+	c := cache.New()
+	v := Views{Cache: c}
+
+	// Knocked out at the first pivot, then minted again at a second
+	c.MaterializeKnockoutSaga(book).UpdateCross(tables.KnockoutCross{Block: 10, Time: 100, Tick: -64, IsBid: 1, PivotTime: 20})
+	pos := c.MaterializeKnockoutPos(loc)
+	for _, pivotTime := range []int{20, 200} {
+		pos.AppendMint(model.KnockoutSagaTx{TxTime: pivotTime, PivotTime: pivotTime})
+		c.IndexLimitClaim(loc, pivotTime)
+	}
+	pos.Liq.UpdatePostKOLiq(20, *big.NewInt(500), 0)
+	pos.Liq.UpdateActiveLiq(*big.NewInt(1000), 0)
+
+	knockedOutId, activeId := formLimitId(loc.ToClaimLoc(20)), formLimitId(loc.ToClaimLoc(200))
+	if order, err := v.QueryLimitById(activeId); err != nil || order == nil || order.LimitId != activeId ||
+		order.ConcLiq.Int64() != 1000 {
+		t.Fatalf("Active limit order not found by its ID %+v %v", order, err)
+	}
+	if order, err := v.QueryLimitById(knockedOutId); err != nil || order == nil || order.ClaimableLiq.Int64() != 500 ||
+		order.CrossTime != 100 {
+		t.Fatalf("Knocked out limit order not found by its ID %+v %v", order, err)
+	}
+	upperId := "limit_" + strings.ToUpper(strings.TrimPrefix(activeId, "limit_"))
+	if order, err := v.QueryLimitById(upperId); err != nil || order == nil || order.LimitId != activeId {
+		t.Fatalf("Limit order not found by its uppercase ID %+v %v", order, err)
+	}
+
+	// Claimed orders are removed from the index
+	pos.Liq.UpdatePostKOLiq(20, *big.NewInt(0), 0)
+	if !c.UnindexLimitClaim(loc, 20) || c.UnindexLimitClaim(loc, 20) {
+		t.Fatal("Expected the claim to be unindexed once")
+	}
+	if order, err := v.QueryLimitById(knockedOutId); order != nil || err != nil {
+		t.Fatalf("Expected no claimed order, got %+v %v", order, err)
+	}
+
+	// Burned orders stay indexed, but aren't returned
+	pos.Liq.UpdateActiveLiq(*big.NewInt(0), 0)
+	if order, err := v.QueryLimitById(activeId); order != nil || err != nil {
+		t.Fatalf("Expected no burned order, got %+v %v", order, err)
+	}
+
+	for _, bad := range []string{"limit_12", formPositionId(loc)} {
+		if _, err := v.QueryLimitById(bad); err != ErrInvalidId {
+			t.Errorf("Expected invalid id for %q, got %v", bad, err)
+		}
+	}
+}
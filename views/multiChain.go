@@ -0,0 +1,79 @@
+package views
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+// Chains served by this process, in chain ID order
+func (v *Views) QueryChainIds() []types.ChainId {
+	return v.OnChain.Cfg.ChainIDs()
+}
+
+type UserChainToken struct {
+	ChainId types.ChainId    `json:"chainId"`
+	Token   types.EthAddress `json:"token"`
+}
+
+type MultiUserTokensResponse struct {
+	User   types.EthAddress        `json:"user"`
+	Blocks map[types.ChainId]int64 `json:"blocks"`
+	Tokens []UserChainToken        `json:"tokens"`
+}
+
+func (v *Views) QueryMultiUserTokens(chainIds []types.ChainId, user types.EthAddress) MultiUserTokensResponse {
+	resp := MultiUserTokensResponse{
+		User:   user,
+		Blocks: make(map[types.ChainId]int64),
+		Tokens: make([]UserChainToken, 0),
+	}
+	for _, chainId := range chainIds {
+		chainResp := v.QueryUserTokens(chainId, user)
+		resp.Blocks[chainId] = chainResp.Block
+		for _, token := range chainResp.Tokens {
+			resp.Tokens = append(resp.Tokens, UserChainToken{chainId, token})
+		}
+	}
+	slices.SortFunc(resp.Tokens, func(a, b UserChainToken) int {
+		return cmp.Or(types.CompareChainIds(a.ChainId, b.ChainId), cmp.Compare(a.Token, b.Token))
+	})
+	return resp
+}
+
+func (v *Views) QueryMultiUserPositions(chainIds []types.ChainId, user types.EthAddress) []UserPosition {
+	results := make([]UserPosition, 0)
+	for _, chainId := range chainIds {
+		results = append(results, v.QueryUserPositions(chainId, user)...)
+	}
+	sort.Sort(byTime(results))
+	return results
+}
+
+func (v *Views) QueryMultiUserLimits(chainIds []types.ChainId, user types.EthAddress) []UserLimitOrder {
+	results := make([]UserLimitOrder, 0)
+	for _, chainId := range chainIds {
+		results = append(results, v.QueryUserLimits(chainId, user)...)
+	}
+	sort.Sort(byTimeLO(results))
+	return results
+}
+
+// Takes the latest n txs from each chain, then the latest n of those across chains
+func (v *Views) QueryMultiUserTxHist(chainIds []types.ChainId, user types.EthAddress,
+	nResults int, afterTime int, beforeTime int) []UserTxHistory {
+	results := make([]UserTxHistory, 0)
+	for _, chainId := range chainIds {
+		results = append(results, v.QueryUserTxHist(chainId, user, nResults, afterTime, beforeTime)...)
+	}
+	slices.SortStableFunc(results, func(a, b UserTxHistory) int {
+		return cmp.Or(cmp.Compare(b.TxTime, a.TxTime), types.CompareChainIds(a.ChainId, b.ChainId),
+			cmp.Compare(b.CallIndex, a.CallIndex))
+	})
+	if len(results) > nResults {
+		results = results[:nResults]
+	}
+	return results
+}
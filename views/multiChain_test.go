@@ -0,0 +1,49 @@
+package views
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestMultiChainMergeOrder(t *testing.T) {
+	c := cache.New()
+	user := types.EthAddress("0xcccc")
+	chains := []types.ChainId{"0x10", "0x2", "0x1"}
+	for i, chainId := range chains {
+		c.AddUserBalance(chainId, user, "0xbbbb")
+		c.AddUserBalance(chainId, user, "0xaaaa")
+		// Every chain has a tx at the same time and a later one
+		for _, txTime := range []int{100, 200 + i} {
+			c.AddPoolEvent(types.PoolTxEvent{
+				EthTxHeader:  types.EthTxHeader{TxTime: txTime, TxHash: "0x01", User: user},
+				PoolLocation: types.PoolLocation{ChainId: chainId, Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420},
+			})
+		}
+	}
+	v := Views{Cache: c}
+
+	tokens := v.QueryMultiUserTokens(chains, user)
+	expectedTokens := []UserChainToken{{"0x1", "0xaaaa"}, {"0x1", "0xbbbb"}, {"0x2", "0xaaaa"}, {"0x2", "0xbbbb"},
+		{"0x10", "0xaaaa"}, {"0x10", "0xbbbb"}}
+	if !slices.Equal(tokens.Tokens, expectedTokens) || len(tokens.Blocks) != len(chains) {
+		t.Fatalf("Expected tokens in chain ID order %v, got %v", expectedTokens, tokens)
+	}
+
+	// Latest first, with ties in chain ID order, then cut to n across the chains
+	type chainTx struct {
+		chainId types.ChainId
+		txTime  int
+	}
+	expectedTxs := []chainTx{{"0x1", 202}, {"0x2", 201}, {"0x10", 200}, {"0x1", 100}, {"0x2", 100}}
+	txs := v.QueryMultiUserTxHist(chains, user, 5, 0, 0)
+	merged := make([]chainTx, 0, len(txs))
+	for _, tx := range txs {
+		merged = append(merged, chainTx{tx.ChainId, tx.TxTime})
+	}
+	if !slices.Equal(merged, expectedTxs) {
+		t.Fatalf("Expected txs %v, got %v", expectedTxs, merged)
+	}
+}
@@ -3,8 +3,10 @@ package views
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"math/big"
 	"sort"
+	"strings"
 
 	"github.com/CrocSwap/graphcache-go/cache"
 	"github.com/CrocSwap/graphcache-go/model"
@@ -16,7 +18,10 @@ type UserPosition struct {
 	types.PositionLocation
 	model.PositionTracker
 	model.APRCalcResult
-	PositionId string `json:"positionId"`
+	PositionId string             `json:"positionId"`
+	PnL        *model.PositionPnL `json:"pnl,omitempty"`
+	// Only set on the APY leaders, which are ranked by it
+	AprSmoothed *float64 `json:"aprSmoothed,omitempty"`
 }
 
 type HistoricUserPosition struct {
@@ -36,9 +41,9 @@ func (v *Views) QueryUserPositions(chainId types.ChainId, user types.EthAddress)
 	positions := v.Cache.RetrieveUserPositions(chainId, user)
 
 	results := make([]UserPosition, 0)
+	prices := make(poolPriceCache)
 	for key, val := range positions {
-		element := UserPosition{key, *val, val.CalcAPR(key), formPositionId(key)}
-		results = append(results, element)
+		results = append(results, v.formUserPosition(key, val, prices))
 	}
 
 	sort.Sort(byTime(results))
@@ -69,6 +74,7 @@ func (v *Views) QueryPoolPositions(chainId types.ChainId,
 		EMPTY_MULT = 50
 	}
 	hasSeen := make(map[[32]byte]struct{}, nResults*EMPTY_MULT*2)
+	prices := make(poolPriceCache)
 	buf := new(bytes.Buffer)
 	buf.Grow(300)
 
@@ -89,9 +95,7 @@ func (v *Views) QueryPoolPositions(chainId types.ChainId,
 				hasSeen[hash] = struct{}{}
 
 				if !omitEmpty || !val.Pos.PositionLiquidity.IsEmpty() {
-					element := UserPosition{PositionLocation: val.Loc, PositionTracker: *val.Pos,
-						APRCalcResult: val.Pos.CalcAPR(val.Loc), PositionId: formPositionId(val.Loc)}
-					results = append(results, element)
+					results = append(results, v.formUserPosition(val.Loc, val.Pos, prices))
 				}
 			}
 			if len(results) >= nResults {
@@ -112,6 +116,54 @@ func (v *Views) QueryPoolPositions(chainId types.ChainId,
 	return results
 }
 
+// Cursor based version of QueryPoolPositions. Positions are ordered by their latest
+// update time then hash. The returned cursor is empty once the pool is exhausted.
+func (v *Views) QueryPoolPositionsPage(chainId types.ChainId,
+	base types.EthAddress, quote types.EthAddress, poolIdx int, nResults int,
+	omitEmpty bool, cursor string) ([]UserPosition, string, error) {
+	pos, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	loc := types.PoolLocation{
+		ChainId: chainId,
+		PoolIdx: poolIdx,
+		Base:    base,
+		Quote:   quote,
+	}
+
+	scanN := nResults
+	if omitEmpty {
+		scanN = nResults * 2
+	}
+
+	results := make([]UserPosition, 0, nResults)
+	prices := make(poolPriceCache)
+	var last cache.ArrayCursor
+	// Same iteration limit as QueryPoolPositions. If hit, the cursor points to the
+	// last scanned position so the client can keep paging.
+	for i := 0; i < 5; i++ {
+		positions, next := v.Cache.RetrievePoolPosBeforeCursor(loc, pos, scanN)
+		for _, val := range positions {
+			if !omitEmpty || !val.Pos.PositionLiquidity.IsEmpty() {
+				// Only points to a next page if there's a result past this one
+				if len(results) == nResults {
+					return results, encodeCursor(&last), nil
+				}
+				results = append(results, v.formUserPosition(val.Loc, val.Pos, prices))
+				last = val.Cursor(nil)
+			}
+		}
+
+		pos = next
+		if next == nil {
+			break
+		}
+	}
+	return results, encodeCursor(pos), nil
+}
+
 func (v *Views) QueryPoolApyLeaders(chainId types.ChainId,
 	base types.EthAddress, quote types.EthAddress, poolIdx int, nResults int,
 	omitEmpty bool) []UserPosition {
@@ -119,6 +171,10 @@ func (v *Views) QueryPoolApyLeaders(chainId types.ChainId,
 	const LAST_N_ELIGIBLE = 2000
 
 	results := v.QueryPoolPositions(chainId, base, quote, poolIdx, LAST_N_ELIGIBLE, true, 0, 0)
+	for i := range results {
+		apr := v.smoothedPositionApr(results[i])
+		results[i].AprSmoothed = &apr
+	}
 
 	sort.Sort(byApr(results))
 
@@ -141,9 +197,9 @@ func (v *Views) QueryUserPoolPositions(chainId types.ChainId, user types.EthAddr
 	positions := v.Cache.RetrieveUserPoolPositions(user, loc)
 
 	results := make([]UserPosition, 0)
+	prices := make(poolPriceCache)
 	for key, val := range positions {
-		element := UserPosition{key, *val, val.CalcAPR(key), formPositionId(key)}
-		results = append(results, element)
+		results = append(results, v.formUserPosition(key, val, prices))
 	}
 
 	sort.Sort(byTime(results))
@@ -227,10 +283,63 @@ func (v *Views) QueryHistoricPositions(chainId types.ChainId, base types.EthAddr
 	return livePositions
 }
 
+// Pool prices looked up while building a response, so each pool is only read once
+type poolPriceCache map[types.PoolLocation]float64
+
+func (v *Views) formUserPosition(loc types.PositionLocation, pos *model.PositionTracker,
+	prices poolPriceCache) UserPosition {
+	poolLoc := loc.PoolLocation
+	price, ok := prices[poolLoc]
+	if !ok {
+		accum, _ := v.Cache.RetrievePoolAccum(poolLoc)
+		price = accum.LastPriceIndic
+		prices[poolLoc] = price
+	}
+
+	return UserPosition{
+		PositionLocation: loc,
+		PositionTracker:  *pos,
+		APRCalcResult:    pos.CalcAPR(loc),
+		PositionId:       formPositionId(loc),
+		PnL:              pos.CalcPnL(loc, price),
+	}
+}
+
 func formPositionId(loc types.PositionLocation) string {
 	return "pos_" + hex.EncodeToString(loc.CachedHash[:])
 }
 
+var ErrInvalidId = errors.New("invalid id")
+
+// Inverse of formPositionId and formLimitId
+func parseEntityId(id string, prefix string) ([32]byte, error) {
+	var hash [32]byte
+	raw, found := strings.CutPrefix(id, prefix)
+	if !found {
+		return hash, ErrInvalidId
+	}
+	decoded, err := hex.DecodeString(raw)
+	if err != nil || len(decoded) != len(hash) {
+		return hash, ErrInvalidId
+	}
+	copy(hash[:], decoded)
+	return hash, nil
+}
+
+// Nil if no position has the ID
+func (v *Views) QueryPositionById(id string) (*UserPosition, error) {
+	hash, err := parseEntityId(id, "pos_")
+	if err != nil {
+		return nil, err
+	}
+	loc, pos, ok := v.Cache.RetrievePositionById(hash)
+	if !ok {
+		return nil, nil
+	}
+	result := v.formUserPosition(loc, pos, make(poolPriceCache))
+	return &result, nil
+}
+
 type byTime []UserPosition
 
 func (a byTime) Len() int      { return len(a) }
@@ -260,8 +369,8 @@ func (a byApr) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
 
 func (a byApr) Less(i, j int) bool {
 	// Break ties by time, the hash
-	if a[i].APRCalcResult.Apr != a[j].APRCalcResult.Apr {
-		return a[i].APRCalcResult.Apr > a[j].APRCalcResult.Apr
+	if *a[i].AprSmoothed != *a[j].AprSmoothed {
+		return *a[i].AprSmoothed > *a[j].AprSmoothed
 	} else if a[i].LatestUpdateTime != a[j].LatestUpdateTime {
 		return a[i].LatestUpdateTime > a[j].LatestUpdateTime
 	} else {
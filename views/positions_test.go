@@ -0,0 +1,54 @@
+package views
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestParseEntityId(t *testing.T) {
+	hash := [32]byte{1, 2, 3, 0xff}
+	loc := types.PositionLocation{CachedHash: hash}
+	if parsed, err := parseEntityId(formPositionId(loc), "pos_"); err != nil || parsed != hash {
+		t.Fatalf("Bad round trip %x %v", parsed, err)
+	}
+
+	valid := strings.TrimPrefix(formPositionId(loc), "pos_")
+	for _, bad := range []string{"", "pos_", "limit_" + valid, valid, "pos_" + valid[2:], "pos_" + valid + "00",
+		"pos_zz" + valid[2:], "POS_" + valid} {
+		if _, err := parseEntityId(bad, "pos_"); err != ErrInvalidId {
+			t.Errorf("Expected invalid id for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestQueryPositionById(t *testing.T) {
+	pool := types.PoolLocation{ChainId: "0x1", Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420}
+	book := types.BookLocation{PoolLocation: pool, LiquidityLocation: types.RangeLiquidityLocation(-100, 100)}
+	loc := book.ToPositionLocation("0xcccc")
+	c := cache.New()
+	c.MaterializePosition(loc).ConcLiq.SetInt64(1000)
+	v := Views{Cache: c}
+
+	id := formPositionId(loc)
+	pos, err := v.QueryPositionById(id)
+	if err != nil || pos == nil || pos.PositionId != id || pos.PositionLocation != loc || pos.ConcLiq.Int64() != 1000 {
+		t.Fatalf("Position not found by its ID %+v %v", pos, err)
+	}
+
+	other := book.ToPositionLocation("0xdddd")
+	if pos, err := v.QueryPositionById(formPositionId(other)); pos != nil || err != nil {
+		t.Fatalf("Expected no position for an unknown ID, got %+v %v", pos, err)
+	}
+	if _, err := v.QueryPositionById("pos_12"); err != ErrInvalidId {
+		t.Fatalf("Expected invalid id, got %v", err)
+	}
+
+	// Positions created by a rolled back change are removed from the index
+	c.RevertPositionUpdate(loc, true)
+	if pos, err := v.QueryPositionById(id); pos != nil || err != nil {
+		t.Fatalf("Expected no position after rollback, got %+v %v", pos, err)
+	}
+}
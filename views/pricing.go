@@ -0,0 +1,263 @@
+package views
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/loader"
+	"github.com/CrocSwap/graphcache-go/model"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+const USD_PRICE_TTL = time.Minute
+
+// Historical price sets kept across all chains, after which the expired ones are dropped
+const MAX_HIST_PRICE_SETS = 20000
+
+// Pools with less liquidity than this aren't used to price tokens
+const MIN_PRICE_LIQ_USD = 1000.0
+
+// Prices tokens in USD from the dex's own pools, starting from each chain's configured
+// stablecoins. Prices are kept per wei, so they can be applied directly to the raw
+// token amounts in the pool stats.
+type UsdPriceOracle struct {
+	cache  *cache.MemoryCache
+	cfg    loader.NetworkConfig
+	tokens *loader.TokenRegistry
+	latest map[types.ChainId]usdPriceSet
+	hist   map[histPriceKey]usdPriceSet
+	lock   sync.Mutex
+}
+
+type usdPriceSet struct {
+	weiPrices map[types.EthAddress]float64
+	calcTime  time.Time
+}
+
+type histPriceKey struct {
+	chainId  types.ChainId
+	histTime int
+}
+
+func NewUsdPriceOracle(cache *cache.MemoryCache, cfg loader.NetworkConfig, tokens *loader.TokenRegistry) *UsdPriceOracle {
+	return &UsdPriceOracle{
+		cache:  cache,
+		cfg:    cfg,
+		tokens: tokens,
+		latest: make(map[types.ChainId]usdPriceSet),
+		hist:   make(map[histPriceKey]usdPriceSet),
+	}
+}
+
+// Current USD value of one wei of each token, recalculated at most once per TTL
+func (o *UsdPriceOracle) WeiPrices(chainId types.ChainId) map[types.EthAddress]float64 {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if set, ok := o.latest[chainId]; ok && time.Since(set.calcTime) < USD_PRICE_TTL {
+		return set.weiPrices
+	}
+	prices := o.routePrices(chainId, o.cache.RetrieveChainAccums(chainId))
+	o.latest[chainId] = usdPriceSet{prices, time.Now()}
+	return prices
+}
+
+// USD value of one wei of each token as of histTime, using the pool stats snapshots
+func (o *UsdPriceOracle) WeiPricesAt(chainId types.ChainId, histTime int) map[types.EthAddress]float64 {
+	return o.WeiPricesSeries(chainId, []int{histTime})[0]
+}
+
+// Same as WeiPricesAt at each of the times, which must be ascending. Like the latest prices,
+// each time's prices are cached for the TTL, and the snapshots are read once for the rest.
+func (o *UsdPriceOracle) WeiPricesSeries(chainId types.ChainId, times []int) []map[types.EthAddress]float64 {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	result := make([]map[types.EthAddress]float64, len(times))
+	missed := make([]int, 0)
+	for i, histTime := range times {
+		if set, ok := o.hist[histPriceKey{chainId, histTime}]; ok && time.Since(set.calcTime) < USD_PRICE_TTL {
+			result[i] = set.weiPrices
+		} else {
+			missed = append(missed, i)
+		}
+	}
+	if len(missed) == 0 {
+		return result
+	}
+
+	missedTimes := make([]int, len(missed))
+	for j, i := range missed {
+		missedTimes[j] = times[i]
+	}
+	o.pruneHistPrices(len(missed))
+	for j, accums := range o.cache.RetrieveChainAccumsSeries(chainId, missedTimes) {
+		prices := o.routePrices(chainId, accums)
+		result[missed[j]] = prices
+		o.hist[histPriceKey{chainId, missedTimes[j]}] = usdPriceSet{prices, time.Now()}
+	}
+	return result
+}
+
+// Makes room for n more price sets. Must be called with the lock held.
+func (o *UsdPriceOracle) pruneHistPrices(n int) {
+	if len(o.hist)+n <= MAX_HIST_PRICE_SETS {
+		return
+	}
+	for key, set := range o.hist {
+		if time.Since(set.calcTime) >= USD_PRICE_TTL {
+			delete(o.hist, key)
+		}
+	}
+	if len(o.hist)+n > MAX_HIST_PRICE_SETS {
+		clear(o.hist)
+	}
+}
+
+// USD price of a whole token, or nil if the token or its decimals aren't known
+func (o *UsdPriceOracle) TokenPrice(chainId types.ChainId, token types.EthAddress,
+	weiPrices map[types.EthAddress]float64) *float64 {
+	weiPrice, ok := weiPrices[token]
+	if !ok || o.tokens == nil {
+		return nil
+	}
+	meta, ok := o.tokens.Lookup(chainId, token)
+	if !ok {
+		return nil
+	}
+	price := weiPrice * math.Pow10(meta.Decimals)
+	return &price
+}
+
+func (o *UsdPriceOracle) routePrices(chainId types.ChainId, accums []cache.AccumTagged) map[types.EthAddress]float64 {
+	chainCfg, ok := o.cfg.ChainConfig(chainId)
+	if !ok || o.tokens == nil {
+		return map[types.EthAddress]float64{}
+	}
+
+	// The wrapped native token is merged into the native token, so that either can be
+	// used to route through pools of the other
+	wrapped := types.EthAddress(strings.ToLower(string(chainCfg.WrappedNative)))
+	mergeNative := func(token types.EthAddress) types.EthAddress {
+		if wrapped != "" && token == wrapped {
+			return loader.NATIVE_TOKEN_ADDR
+		}
+		return token
+	}
+
+	anchors := make(map[types.EthAddress]float64)
+	for _, stable := range chainCfg.UsdStables {
+		stable = types.EthAddress(strings.ToLower(string(stable)))
+		if meta, ok := o.tokens.Lookup(chainId, stable); ok {
+			anchors[mergeNative(stable)] = math.Pow10(-meta.Decimals)
+		}
+	}
+
+	edges := make([]model.PriceEdge, 0, len(accums))
+	for _, accum := range accums {
+		edge := model.PriceEdgeFromAccum(accum.PoolLocation, accum.AccumPoolStats)
+		edge.Base = mergeNative(edge.Base)
+		edge.Quote = mergeNative(edge.Quote)
+		edges = append(edges, edge)
+	}
+
+	prices := model.RouteUsdPrices(anchors, edges, MIN_PRICE_LIQ_USD)
+	if price, ok := prices[loader.NATIVE_TOKEN_ADDR]; ok && wrapped != "" {
+		prices[wrapped] = price
+	}
+	return prices
+}
+
+type PoolUsdStats struct {
+	BaseUsdPrice    *float64 `json:"baseUsdPrice,omitempty"`
+	QuoteUsdPrice   *float64 `json:"quoteUsdPrice,omitempty"`
+	TvlUsd          float64  `json:"tvlUsd"`
+	VolumeUsd       float64  `json:"volumeUsd"`
+	FeesUsd         float64  `json:"feesUsd"`
+	VolumeUsd24hAgo *float64 `json:"volumeUsd24hAgo,omitempty"`
+	FeesUsd24hAgo   *float64 `json:"feesUsd24hAgo,omitempty"`
+}
+
+// Volume is counted on whichever side of the pool has a price, since both sides are
+// the same trades. Returns nil if neither token has a price.
+func (o *UsdPriceOracle) poolUsdStats(loc types.PoolLocation, stats PoolStats,
+	weiPrices map[types.EthAddress]float64) *PoolUsdStats {
+	basePrice, baseOk := weiPrices[loc.Base]
+	quotePrice, quoteOk := weiPrices[loc.Quote]
+	if !baseOk && !quoteOk {
+		return nil
+	}
+
+	usd := &PoolUsdStats{
+		BaseUsdPrice:  o.TokenPrice(loc.ChainId, loc.Base, weiPrices),
+		QuoteUsdPrice: o.TokenPrice(loc.ChainId, loc.Quote, weiPrices),
+		TvlUsd:        stats.BaseTvl*basePrice + stats.QuoteTvl*quotePrice,
+	}
+
+	volumeUsd := func(baseVol float64, quoteVol float64) float64 {
+		if baseOk {
+			return baseVol * basePrice
+		}
+		return quoteVol * quotePrice
+	}
+	usd.VolumeUsd = volumeUsd(stats.BaseVolume, stats.QuoteVolume)
+	usd.FeesUsd = stats.BaseFees*basePrice + stats.QuoteFees*quotePrice
+
+	if stats.AdditionalPoolStatsFields != nil && stats.BaseVolume24hAgo != nil {
+		volume24hAgo := volumeUsd(*stats.BaseVolume24hAgo, *stats.QuoteVolume24hAgo)
+		fees24hAgo := *stats.BaseFees24hAgo*basePrice + *stats.QuoteFees24hAgo*quotePrice
+		usd.VolumeUsd24hAgo = &volume24hAgo
+		usd.FeesUsd24hAgo = &fees24hAgo
+	}
+	return usd
+}
+
+type TokenUsdPrice struct {
+	Token    types.EthAddress `json:"tokenAddr"`
+	UsdPrice float64          `json:"usdPrice"`
+}
+
+func (v *Views) QueryTokenPrices(chainId types.ChainId) []TokenUsdPrice {
+	result := make([]TokenUsdPrice, 0)
+	if v.Prices == nil {
+		return result
+	}
+	weiPrices := v.Prices.WeiPrices(chainId)
+	for token := range weiPrices {
+		if price := v.Prices.TokenPrice(chainId, token, weiPrices); price != nil {
+			result = append(result, TokenUsdPrice{token, *price})
+		}
+	}
+	slices.SortFunc(result, func(a, b TokenUsdPrice) int {
+		return strings.Compare(string(a.Token), string(b.Token))
+	})
+	return result
+}
+
+type UsdPricePoint struct {
+	Time     int      `json:"time"`
+	UsdPrice *float64 `json:"usdPrice"`
+}
+
+// Series of n prices at period second intervals, ending at the most recent period
+func (v *Views) QueryTokenPriceHist(chainId types.ChainId, token types.EthAddress,
+	period int, n int) []UsdPricePoint {
+	result := make([]UsdPricePoint, 0, n)
+	if v.Prices == nil {
+		return result
+	}
+	token = types.EthAddress(strings.ToLower(string(token)))
+
+	endTime := int(time.Now().Unix())
+	endTime = endTime - endTime%period
+	times := make([]int, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		times = append(times, endTime-i*period)
+	}
+	for i, weiPrices := range v.Prices.WeiPricesSeries(chainId, times) {
+		result = append(result, UsdPricePoint{times[i], v.Prices.TokenPrice(chainId, token, weiPrices)})
+	}
+	return result
+}
@@ -0,0 +1,37 @@
+package views
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/loader"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestHistPricesCached(t *testing.T) {
+	o := NewUsdPriceOracle(cache.New(), loader.NetworkConfig{}, nil)
+	cached := usdPriceSet{map[types.EthAddress]float64{"0xaaaa": 2}, time.Now()}
+	o.hist[histPriceKey{"0x1", 100}] = cached
+
+	prices := o.WeiPricesSeries("0x1", []int{100, 200, 300})
+	if prices[0]["0xaaaa"] != 2 || len(prices[1]) != 0 || len(o.hist) != 3 {
+		t.Fatalf("Expected the cached set reused and the rest cached, got %v with %d cached", prices, len(o.hist))
+	}
+
+	// Expired sets are routed again
+	cached.calcTime = time.Now().Add(-USD_PRICE_TTL)
+	o.hist[histPriceKey{"0x1", 100}] = cached
+	if prices := o.WeiPricesSeries("0x1", []int{100}); len(prices[0]) != 0 {
+		t.Fatalf("Expected the expired set recalculated, got %v", prices[0])
+	}
+
+	// Expired sets are dropped once the cache is full
+	for i := len(o.hist); i < MAX_HIST_PRICE_SETS; i++ {
+		o.hist[histPriceKey{"0x2", i}] = cached
+	}
+	o.WeiPricesSeries("0x1", []int{400})
+	if len(o.hist) != 4 {
+		t.Fatalf("Expected the expired sets pruned, got %d cached", len(o.hist))
+	}
+}
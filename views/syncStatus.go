@@ -0,0 +1,77 @@
+package views
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+// Limits past which the service reports itself as not ready. Zero disables a check.
+type ReadinessThresholds struct {
+	MaxLagBlocks int // Synced block behind the data source's head
+	MaxStallSecs int // Time since the data source's head last advanced
+	MaxBacklog   int // Urgent liquidity refreshes waiting
+}
+
+type ChainSyncView struct {
+	cache.ChainSyncStatus
+	LagBlocks   int   `json:"lagBlocks"`
+	HeadAgeSecs int64 `json:"headAgeSecs"`
+}
+
+type SyncStatusResponse struct {
+	Ready    bool                 `json:"ready"`
+	Problems []string             `json:"problems"`
+	Chains   []ChainSyncView      `json:"chains"`
+	Backlog  cache.RefreshBacklog `json:"refreshBacklog"`
+}
+
+func (v *Views) QuerySyncStatus() SyncStatusResponse {
+	now := time.Now().Unix()
+	resp := SyncStatusResponse{
+		Problems: make([]string, 0),
+		Chains:   make([]ChainSyncView, 0),
+		Backlog:  v.Cache.RetrieveRefreshBacklog(),
+	}
+	limits := v.Readiness
+
+	for _, status := range v.Cache.RetrieveSyncStatus() {
+		chain := ChainSyncView{
+			ChainSyncStatus: status,
+			LagBlocks:       max(status.HeadBlock-status.SyncedBlock, 0),
+		}
+		if status.HeadAt > 0 {
+			chain.HeadAgeSecs = now - status.HeadAt
+		}
+		resp.Chains = append(resp.Chains, chain)
+
+		if !status.StartupDone {
+			resp.Problems = append(resp.Problems, fmt.Sprintf("chain %s startup sync in progress", status.ChainId))
+		}
+		if limits.MaxLagBlocks > 0 && chain.LagBlocks > limits.MaxLagBlocks {
+			resp.Problems = append(resp.Problems, fmt.Sprintf("chain %s is %d blocks behind head", status.ChainId, chain.LagBlocks))
+		}
+		if limits.MaxStallSecs > 0 && chain.HeadAgeSecs > int64(limits.MaxStallSecs) {
+			resp.Problems = append(resp.Problems, fmt.Sprintf("chain %s head hasn't advanced in %ds", status.ChainId, chain.HeadAgeSecs))
+		}
+		if status.SyncError != "" {
+			resp.Problems = append(resp.Problems, fmt.Sprintf("chain %s sync failing since %ds ago: %s",
+				status.ChainId, now-status.SyncErrorAt, status.SyncError))
+		}
+	}
+
+	if len(resp.Chains) == 0 {
+		resp.Problems = append(resp.Problems, "no chains synced")
+	}
+	if limits.MaxBacklog > 0 && resp.Backlog.Urgent > limits.MaxBacklog {
+		resp.Problems = append(resp.Problems, fmt.Sprintf("%d urgent liquidity refreshes queued", resp.Backlog.Urgent))
+	}
+	resp.Ready = len(resp.Problems) == 0
+	return resp
+}
+
+func (v *Views) QueryChainSyncing(chainId types.ChainId) bool {
+	return v.Cache.IsChainSyncing(chainId)
+}
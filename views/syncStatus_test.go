@@ -0,0 +1,59 @@
+package views
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestSyncStatusDuringStartup(t *testing.T) {
+	c := cache.New()
+	v := Views{Cache: c}
+	if v.QueryChainSyncing("0x1") {
+		t.Fatal("Unlisted chain reported as syncing")
+	}
+
+	// Chains are listed before the server starts, so the ones waiting on an earlier
+	// chain's sync are reported too
+	c.AddSyncingChain("0x1")
+	c.AddSyncingChain("0x2")
+	c.SetStartupSynced("0x1")
+	if v.QueryChainSyncing("0x1") || !v.QueryChainSyncing("0x2") {
+		t.Fatal("Bad syncing chains")
+	}
+	status := v.QuerySyncStatus()
+	if status.Ready || len(status.Chains) != 2 || len(status.Problems) != 1 {
+		t.Fatalf("Expected not ready on the waiting chain, got %+v", status)
+	}
+
+	c.SetStartupSynced("0x2")
+	if status := v.QuerySyncStatus(); !status.Ready {
+		t.Fatalf("Expected ready, got %+v", status.Problems)
+	}
+
+	// A stalled sync is reported until it recovers
+	c.SetSyncError("0x2", "unable to fetch dex logs")
+	if status := v.QuerySyncStatus(); status.Ready || status.Chains[1].SyncError == "" || status.Chains[1].SyncErrorAt == 0 {
+		t.Fatalf("Expected the failing sync reported, got %+v", status)
+	}
+	c.SetSyncError("0x2", "")
+	if status := v.QuerySyncStatus(); !status.Ready || status.Chains[1].SyncErrorAt != 0 {
+		t.Fatalf("Expected ready after recovering, got %+v", status.Problems)
+	}
+}
+
+func TestSyncStatusChainOrder(t *testing.T) {
+	c := cache.New()
+	for _, chainId := range []types.ChainId{"0x10", "0x2", "0x1"} {
+		c.AddSyncingChain(chainId)
+	}
+	chainIds := make([]types.ChainId, 0)
+	for _, chain := range (&Views{Cache: c}).QuerySyncStatus().Chains {
+		chainIds = append(chainIds, chain.ChainId)
+	}
+	if expected := []types.ChainId{"0x1", "0x2", "0x10"}; !slices.Equal(chainIds, expected) {
+		t.Fatalf("Expected chains in chain ID order %v, got %v", expected, chainIds)
+	}
+}
@@ -0,0 +1,44 @@
+package views
+
+import (
+	"sort"
+
+	"github.com/CrocSwap/graphcache-go/loader"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+type PoolListEntry struct {
+	types.PoolLocation
+	Tokens *types.TokenPairMetadata `json:"tokens,omitempty"`
+}
+
+// Tokens whose metadata is still loading are left out, and show up on later calls
+func (v *Views) QueryTokenList(chainId types.ChainId) []loader.TokenMetadataEntry {
+	if v.Tokens == nil {
+		return []loader.TokenMetadataEntry{}
+	}
+	v.Tokens.RequestPools(v.QueryPoolSet(chainId))
+
+	tokens := v.Tokens.ChainTokens(chainId)
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Token < tokens[j].Token
+	})
+	return tokens
+}
+
+func (v *Views) QueryPoolSetWithTokens(chainId types.ChainId) []PoolListEntry {
+	pools := v.QueryPoolSet(chainId)
+	result := make([]PoolListEntry, len(pools))
+	for i, pool := range pools {
+		result[i] = PoolListEntry{PoolLocation: pool, Tokens: v.QueryPoolTokens(pool)}
+	}
+	return result
+}
+
+// Returns nil until the metadata of both tokens is loaded
+func (v *Views) QueryPoolTokens(pool types.PoolLocation) *types.TokenPairMetadata {
+	if v.Tokens == nil {
+		return nil
+	}
+	return v.Tokens.LookupPair(pool)
+}
@@ -23,6 +23,15 @@ func (v *Views) QueryUserTxHist(chainId types.ChainId, user types.EthAddress, nR
 	return appendTags(results)
 }
 
+func (v *Views) QueryUserTxHistPage(chainId types.ChainId, user types.EthAddress, nResults int, cursor string) ([]UserTxHistory, string, error) {
+	pos, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	results, next := v.Cache.RetrieveUserTxsBeforeCursor(chainId, user, pos, nResults)
+	return appendTags(results), encodeCursor(next), nil
+}
+
 func (v *Views) QueryUserPoolTxHist(chainId types.ChainId, user types.EthAddress, base types.EthAddress, quote types.EthAddress, poolIdx int, nResults int, afterTime int, beforeTime int) []UserTxHistory {
 	results := v.Cache.RetrieveLastNUserTxs(chainId, user, 99999999)
 	var filteredResults []types.PoolTxEvent
@@ -63,6 +72,92 @@ func (v *Views) QueryPoolTxHist(chainId types.ChainId,
 	return appendTags(results)
 }
 
+func (v *Views) QueryPoolTxHistPage(chainId types.ChainId,
+	base types.EthAddress, quote types.EthAddress, poolIdx int, nResults int, cursor string) ([]UserTxHistory, string, error) {
+	pos, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	loc := types.PoolLocation{
+		ChainId: chainId,
+		PoolIdx: poolIdx,
+		Base:    base,
+		Quote:   quote,
+	}
+	results, next := v.Cache.RetrievePoolTxsBeforeCursor(loc, pos, nResults)
+	return appendTags(results), encodeCursor(next), nil
+}
+
+// Every event in a transaction, in call order
+func (v *Views) QueryTx(chainId types.ChainId, txHash types.EthTxHash) []UserTxHistory {
+	return appendTags(v.Cache.RetrieveTxEvents(chainId, txHash))
+}
+
+type TxGroup struct {
+	ChainId  types.ChainId    `json:"chainId"`
+	TxHash   types.EthTxHash  `json:"txHash"`
+	BlockNum int              `json:"blockNum"`
+	TxTime   int              `json:"txTime"`
+	User     types.EthAddress `json:"user"`
+	// "single" for one event or swaps in a single pool, "multihop" for swaps through more
+	// than one pool, or "composite" for any other mix, e.g. a swap followed by a mint
+	Kind   string          `json:"kind"`
+	Events []UserTxHistory `json:"events"`
+}
+
+// Groups a tx history by transaction, keeping the history's order. Each group has every
+// event in its transaction, including ones outside the history, such as the other legs
+// of a multi-hop swap in a pool history.
+func (v *Views) QueryTxGroups(txs []UserTxHistory) []TxGroup {
+	type chainAndTx struct {
+		chainId types.ChainId
+		txHash  types.EthTxHash
+	}
+	groups := make([]TxGroup, 0)
+	// Multi-chain histories can have the same hash on more than one chain
+	seen := make(map[chainAndTx]bool)
+	for _, tx := range txs {
+		key := chainAndTx{tx.ChainId, tx.TxHash}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		events := v.QueryTx(tx.ChainId, tx.TxHash)
+		if len(events) == 0 {
+			events = []UserTxHistory{tx}
+		}
+		groups = append(groups, TxGroup{
+			ChainId:  tx.ChainId,
+			TxHash:   tx.TxHash,
+			BlockNum: tx.BlockNum,
+			TxTime:   tx.TxTime,
+			User:     tx.User,
+			Kind:     txGroupKind(events),
+			Events:   events,
+		})
+	}
+	return groups
+}
+
+func txGroupKind(events []UserTxHistory) string {
+	if len(events) == 1 {
+		return "single"
+	}
+	pools := make(map[types.PoolLocation]bool)
+	for _, event := range events {
+		if event.EntityType != tables.EntityTypeSwap {
+			return "composite"
+		}
+		pools[event.PoolLocation] = true
+	}
+	if len(pools) > 1 {
+		return "multihop"
+	}
+	return "single"
+}
+
 type PlumeTaskStatus struct {
 	Completed *bool  `json:"completed,omitempty"`
 	Error     string `json:"error,omitempty"`
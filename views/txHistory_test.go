@@ -0,0 +1,77 @@
+package views
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/tables"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestQueryTxGroups(t *testing.T) {
+	poolA := types.PoolLocation{ChainId: "0x1", Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420}
+	poolB := types.PoolLocation{ChainId: "0x1", Base: "0xbbbb", Quote: "0xdddd", PoolIdx: 420}
+	event := func(pool types.PoolLocation, txHash types.EthTxHash, txTime int, callIndex int,
+		entityType tables.EntityType) types.PoolTxEvent {
+		return types.PoolTxEvent{
+			EthTxHeader:         types.EthTxHeader{TxTime: txTime, TxHash: txHash, User: "0xcccc", CallIndex: callIndex},
+			PoolLocation:        pool,
+			PoolEventDescriptor: types.PoolEventDescriptor{EntityType: entityType},
+		}
+	}
+	otherChain := poolA
+	otherChain.ChainId = "0x2"
+
+	c := cache.New()
+	for _, tx := range []types.PoolTxEvent{
+		event(poolA, "0x01", 500, 0, tables.EntityTypeSwap),
+		event(poolA, "0x02", 400, 0, tables.EntityTypeSwap),
+		event(poolB, "0x02", 400, 1, tables.EntityTypeSwap),
+		event(poolA, "0x03", 300, 0, tables.EntityTypeSwap),
+		event(poolA, "0x03", 300, 1, tables.EntityTypeSwap),
+		event(poolA, "0x04", 200, 0, tables.EntityTypeSwap),
+		event(poolA, "0x04", 200, 1, tables.EntityTypeLiqChange),
+		// Same hash as the multihop on another chain
+		event(otherChain, "0x02", 100, 0, tables.EntityTypeSwap),
+	} {
+		c.AddPoolEvent(tx)
+	}
+	v := Views{Cache: c}
+
+	// Pool history only has the multihop's leg in the pool
+	history := v.QueryPoolTxHist(poolA.ChainId, poolA.Base, poolA.Quote, poolA.PoolIdx, 100, 0, 0)
+	history = append(history, v.QueryTx("0x2", "0x02")...)
+	groups := v.QueryTxGroups(history)
+
+	expected := []struct {
+		chainId types.ChainId
+		txHash  types.EthTxHash
+		kind    string
+		nEvents int
+	}{
+		{"0x1", "0x01", "single", 1},
+		{"0x1", "0x02", "multihop", 2},
+		{"0x1", "0x03", "single", 2},
+		{"0x1", "0x04", "composite", 2},
+		{"0x2", "0x02", "single", 1},
+	}
+	if len(groups) != len(expected) {
+		t.Fatalf("Expected %d groups, got %+v", len(expected), groups)
+	}
+	for i, exp := range expected {
+		group := groups[i]
+		if group.ChainId != exp.chainId || group.TxHash != exp.txHash || group.Kind != exp.kind ||
+			len(group.Events) != exp.nEvents {
+			t.Errorf("Group %d: expected %+v, got %s %s %s with %d events", i, exp, group.ChainId, group.TxHash,
+				group.Kind, len(group.Events))
+		}
+		callIndices := make([]int, 0)
+		for _, event := range group.Events {
+			callIndices = append(callIndices, event.CallIndex)
+		}
+		if !slices.IsSorted(callIndices) {
+			t.Errorf("Group %d events not in call order %v", i, callIndices)
+		}
+	}
+}
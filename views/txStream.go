@@ -0,0 +1,88 @@
+package views
+
+import (
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+const TX_STREAM_MAX_BACKFILL = 1000
+
+// Point to resume a stream from. Events at exactly (TxTime, CallIndex) are re-sent
+// because other transactions may share the same timestamp and call index, so clients
+// should dedupe on txId.
+type TxStreamResume struct {
+	TxTime    int
+	CallIndex int
+}
+
+type TxStream struct {
+	// Events committed since the resume point when the stream was opened, oldest first
+	Backfill []UserTxHistory
+	// Set if the backfill hit the size limit and the client should re-sync from the
+	// regular tx history endpoints instead.
+	Truncated bool
+	// Closed if the subscriber falls too far behind
+	Events <-chan types.PoolTxEvent
+
+	sub  *cache.TxSubscription
+	seen map[[32]byte]struct{}
+}
+
+func (v *Views) SubscribePoolTxs(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+	poolIdx int, resume *TxStreamResume) *TxStream {
+	loc := types.PoolLocation{
+		ChainId: chainId,
+		PoolIdx: poolIdx,
+		Base:    base,
+		Quote:   quote,
+	}
+
+	// Subscribe before backfilling so nothing committed in between is lost. Overlap
+	// is removed by Tag()
+	sub := v.Cache.SubscribePoolTxs(loc)
+	var backfill []types.PoolTxEvent
+	var truncated bool
+	if resume != nil {
+		backfill, truncated = v.Cache.RetrievePoolTxsFrom(loc, resume.TxTime, resume.CallIndex, TX_STREAM_MAX_BACKFILL)
+	}
+	return newTxStream(sub, backfill, truncated)
+}
+
+func (v *Views) SubscribeUserTxs(chainId types.ChainId, user types.EthAddress, resume *TxStreamResume) *TxStream {
+	sub := v.Cache.SubscribeUserTxs(chainId, user)
+	var backfill []types.PoolTxEvent
+	var truncated bool
+	if resume != nil {
+		backfill, truncated = v.Cache.RetrieveUserTxsFrom(chainId, user, resume.TxTime, resume.CallIndex, TX_STREAM_MAX_BACKFILL)
+	}
+	return newTxStream(sub, backfill, truncated)
+}
+
+func (v *Views) CloseTxStream(stream *TxStream) {
+	v.Cache.Unsubscribe(stream.sub)
+}
+
+func newTxStream(sub *cache.TxSubscription, backfill []types.PoolTxEvent, truncated bool) *TxStream {
+	stream := &TxStream{
+		Backfill:  appendTags(backfill),
+		Truncated: truncated,
+		Events:    sub.Events,
+		sub:       sub,
+		seen:      make(map[[32]byte]struct{}, len(backfill)),
+	}
+	for _, tx := range backfill {
+		stream.seen[tx.Hash(nil)] = struct{}{}
+	}
+	return stream
+}
+
+// Tags a live event with its ID. Returns false if the event was already sent as part
+// of the backfill.
+func (s *TxStream) Tag(tx types.PoolTxEvent) (UserTxHistory, bool) {
+	hash := tx.Hash(nil)
+	if _, ok := s.seen[hash]; ok {
+		delete(s.seen, hash)
+		return UserTxHistory{}, false
+	}
+	return UserTxHistory{tx, formTxId(tx)}, true
+}
@@ -0,0 +1,50 @@
+package views
+
+import (
+	"testing"
+
+	"github.com/CrocSwap/graphcache-go/cache"
+	"github.com/CrocSwap/graphcache-go/types"
+)
+
+func TestTxStreamTruncatedAfterCallIndexFilter(t *testing.T) {
+	pool := types.PoolLocation{ChainId: "0x1", Base: "0xaaaa", Quote: "0xbbbb", PoolIdx: 420}
+	c := cache.New()
+	// More events than the backfill limit, all in the same block
+	for i := 0; i < TX_STREAM_MAX_BACKFILL+10; i++ {
+		c.AddPoolEvent(types.PoolTxEvent{
+			EthTxHeader:  types.EthTxHeader{TxTime: 500, TxHash: "0x01", User: "0xcccc", CallIndex: i},
+			PoolLocation: pool,
+		})
+	}
+	v := Views{Cache: c}
+
+	// Calls before the resume point don't count against the limit
+	stream := v.SubscribePoolTxs(pool.ChainId, pool.Base, pool.Quote, pool.PoolIdx,
+		&TxStreamResume{TxTime: 500, CallIndex: 5})
+	defer v.CloseTxStream(stream)
+	if len(stream.Backfill) != TX_STREAM_MAX_BACKFILL || stream.Backfill[0].CallIndex != 5 || !stream.Truncated {
+		t.Fatalf("Expected truncated backfill, got %d events truncated=%v", len(stream.Backfill), stream.Truncated)
+	}
+
+	// Exactly the limit left isn't truncated
+	stream = v.SubscribePoolTxs(pool.ChainId, pool.Base, pool.Quote, pool.PoolIdx,
+		&TxStreamResume{TxTime: 500, CallIndex: 10})
+	defer v.CloseTxStream(stream)
+	if len(stream.Backfill) != TX_STREAM_MAX_BACKFILL || stream.Truncated {
+		t.Fatalf("Expected full backfill, got %d events truncated=%v", len(stream.Backfill), stream.Truncated)
+	}
+
+	stream = v.SubscribeUserTxs(pool.ChainId, "0xcccc", &TxStreamResume{TxTime: 500, CallIndex: 5})
+	defer v.CloseTxStream(stream)
+	if !stream.Truncated {
+		t.Fatal("Expected truncated user backfill")
+	}
+
+	stream = v.SubscribePoolTxs(pool.ChainId, pool.Base, pool.Quote, pool.PoolIdx,
+		&TxStreamResume{TxTime: 501, CallIndex: 0})
+	defer v.CloseTxStream(stream)
+	if len(stream.Backfill) != 0 || stream.Truncated {
+		t.Fatalf("Expected empty backfill, got %d events truncated=%v", len(stream.Backfill), stream.Truncated)
+	}
+}
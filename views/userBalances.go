@@ -1,6 +1,9 @@
 package views
 
 import (
+	"math/big"
+	"slices"
+
 	"github.com/CrocSwap/graphcache-go/types"
 )
 
@@ -24,3 +27,42 @@ func (v *Views) QueryUserTokens(chainId types.ChainId, user types.EthAddress) Us
 
 	return resp
 }
+
+type UserBalancesResponse struct {
+	ChainId  types.ChainId      `json:"chainId"`
+	User     types.EthAddress   `json:"user"`
+	Block    int64              `json:"block"`
+	Balances []UserTokenBalance `json:"balances"`
+}
+
+type UserTokenBalance struct {
+	Token       types.EthAddress `json:"token"`
+	Balance     *big.Int         `json:"balance"`
+	RefreshTime int64            `json:"refreshTime"`
+}
+
+// Surplus collateral amounts for every token the user may hold surplus in. Tokens that
+// haven't been refreshed yet have a zero balance and refresh time.
+func (v *Views) QueryUserBalances(chainId types.ChainId, user types.EthAddress) UserBalancesResponse {
+	resp := UserBalancesResponse{
+		ChainId:  chainId,
+		User:     user,
+		Block:    v.Cache.LatestBlock(chainId),
+		Balances: make([]UserTokenBalance, 0),
+	}
+
+	seen := make([]types.EthAddress, 0)
+	for _, token := range v.Cache.RetrieveUserBalances(chainId, user) {
+		if slices.Contains(seen, token) {
+			continue
+		}
+		seen = append(seen, token)
+
+		entry := UserTokenBalance{Token: token, Balance: big.NewInt(0)}
+		if surplus, ok := v.Cache.RetrieveUserSurplus(chainId, user, token); ok {
+			entry.Balance, entry.RefreshTime = surplus.Read()
+		}
+		resp.Balances = append(resp.Balances, entry)
+	}
+	return resp
+}
@@ -9,10 +9,13 @@ import (
 
 type IViews interface {
 	QueryUserTokens(chainId types.ChainId, user types.EthAddress) UserTokensResponse
+	QueryUserBalances(chainId types.ChainId, user types.EthAddress) UserBalancesResponse
 
 	QueryUserPositions(chainId types.ChainId, user types.EthAddress) []UserPosition
 	QueryPoolPositions(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
 		poolIdx int, nResults int, omitEmpty bool, afterTime int, beforeTime int) []UserPosition
+	QueryPoolPositionsPage(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+		poolIdx int, nResults int, omitEmpty bool, cursor string) ([]UserPosition, string, error)
 	QueryPoolApyLeaders(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
 		poolIdx int, nResults int, omitEmpty bool) []UserPosition
 	QueryUserPoolPositions(chainId types.ChainId, user types.EthAddress,
@@ -20,6 +23,11 @@ type IViews interface {
 	QuerySinglePosition(chainId types.ChainId, user types.EthAddress,
 		base types.EthAddress, quote types.EthAddress,
 		poolIdx int, bidTick int, askTick int) *UserPosition
+	QueryPositionById(id string) (*UserPosition, error)
+	QueryPositionAprHist(chainId types.ChainId, user types.EthAddress,
+		base types.EthAddress, quote types.EthAddress, poolIdx int, bidTick int, askTick int) []AprPoint
+	QueryPoolAprHist(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+		poolIdx int, period int, n int) []AprPoint
 	QueryHistoricPositions(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
 		poolIdx int, time int, user types.EthAddress, omitEmpty bool) []HistoricUserPosition
 
@@ -34,30 +42,68 @@ type IViews interface {
 	QuerySingleLimit(chainId types.ChainId, user types.EthAddress,
 		base types.EthAddress, quote types.EthAddress,
 		poolIdx int, bidTick int, askTick int, isBid bool, pivotTime int) *UserLimitOrder
+	QueryLimitById(id string) (*UserLimitOrder, error)
 
 	QueryUserTxHist(chainId types.ChainId, user types.EthAddress,
 		nResults int, afterTime int, beforeTime int) []UserTxHistory
 	QueryPoolTxHist(chainId types.ChainId, base types.EthAddress, quote types.EthAddress, poolIdx int,
 		nResults int, afterTime int, beforeTime int) []UserTxHistory
+	QueryUserTxHistPage(chainId types.ChainId, user types.EthAddress,
+		nResults int, cursor string) ([]UserTxHistory, string, error)
+	QueryPoolTxHistPage(chainId types.ChainId, base types.EthAddress, quote types.EthAddress, poolIdx int,
+		nResults int, cursor string) ([]UserTxHistory, string, error)
+	QueryTx(chainId types.ChainId, txHash types.EthTxHash) []UserTxHistory
+	QueryTxGroups(txs []UserTxHistory) []TxGroup
 	QueryPoolLiquidityCurve(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
 		poolIdx int) PoolLiqCurve
+	QueryPoolLiquidityCurveAt(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+		poolIdx int, histTime int, histBlock int) PoolLiqCurve
+	QuerySwapQuote(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+		poolIdx int, isBuy bool, qty float64) model.SwapQuote
+	QueryPoolDepth(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+		poolIdx int, bucketTicks int, nBuckets int) model.CurveDepth
 
 	QueryPoolStats(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
-		poolIdx int, with24hPrices bool) PoolStats
+		poolIdx int, with24hPrices bool, withUsd bool) PoolStats
 	QueryPoolStatsFrom(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
-		poolIdx int, histTime int) PoolStats
-	QueryAllPoolStats(chainId types.ChainId, histTime int, with24hPrices bool) []PoolStats
-	QueryChainStats(chainId types.ChainId, nResults int) []TokenDexAgg
+		poolIdx int, histTime int, withUsd bool) PoolStats
+	QueryAllPoolStats(chainId types.ChainId, histTime int, with24hPrices bool, withUsd bool) []PoolStats
+	QueryChainStats(chainId types.ChainId, nResults int, withUsd bool) []TokenDexAgg
+	QueryTokenPrices(chainId types.ChainId) []TokenUsdPrice
+	QueryTokenPriceHist(chainId types.ChainId, token types.EthAddress, period int, n int) []UsdPricePoint
 
 	QueryPoolCandles(chainId types.ChainId, base types.EthAddress, quote types.EthAddress, poolIdx int,
 		timeRange CandleRangeArgs) []model.Candle
+	QueryPoolFeeHistory(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+		poolIdx int) []model.FeeRateChange
 
 	QueryPoolSet(chainId types.ChainId) []types.PoolLocation
+	QueryPoolSetWithTokens(chainId types.ChainId) []PoolListEntry
+	QueryPoolTokens(pool types.PoolLocation) *types.TokenPairMetadata
+	QueryTokenList(chainId types.ChainId) []loader.TokenMetadataEntry
+
+	QueryChainIds() []types.ChainId
+	QueryMultiUserTokens(chainIds []types.ChainId, user types.EthAddress) MultiUserTokensResponse
+	QueryMultiUserPositions(chainIds []types.ChainId, user types.EthAddress) []UserPosition
+	QueryMultiUserLimits(chainIds []types.ChainId, user types.EthAddress) []UserLimitOrder
+	QueryMultiUserTxHist(chainIds []types.ChainId, user types.EthAddress,
+		nResults int, afterTime int, beforeTime int) []UserTxHistory
+
+	QuerySyncStatus() SyncStatusResponse
+	QueryChainSyncing(chainId types.ChainId) bool
 
 	QueryPlumeUserTask(user types.EthAddress, task string) PlumeTaskStatus
+
+	SubscribePoolTxs(chainId types.ChainId, base types.EthAddress, quote types.EthAddress,
+		poolIdx int, resume *TxStreamResume) *TxStream
+	SubscribeUserTxs(chainId types.ChainId, user types.EthAddress, resume *TxStreamResume) *TxStream
+	CloseTxStream(stream *TxStream)
 }
 
 type Views struct {
-	Cache   *cache.MemoryCache
-	OnChain *loader.OnChainLoader
+	Cache     *cache.MemoryCache
+	OnChain   *loader.OnChainLoader
+	Tokens    *loader.TokenRegistry
+	Prices    *UsdPriceOracle
+	Readiness ReadinessThresholds
 }